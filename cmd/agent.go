@@ -0,0 +1,77 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/qiniu/goc/pkg/cover"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var agentCmd = &cobra.Command{
+	Use:   "agent <agent id>",
+	Short: "Show the details of a registered service instance",
+	Long:  "Show the service name, the address, the revision and all the labels of a registered service instance, the labels are printed in full",
+	Example: `
+# Show the agent 'http://127.0.0.1:53' registered in the default register center http://127.0.0.1:7777.
+goc agent http://127.0.0.1:53
+
+# Show the agent registered in the specified register center.
+goc agent http://127.0.0.1:53 --center=http://192.168.1.1:8080
+`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		agent, err := cover.NewWorker(center).GetAgent(args[0])
+		if errors.Is(err, cover.ErrAgentNotFound) {
+			log.Fatalf("Agent %s is not registered in the center %v, see 'goc list' for all agents", args[0], center)
+		}
+		if err != nil {
+			log.Fatalf("Goc server %v return an error: %v", center, err)
+		}
+		printAgent(os.Stdout, agent)
+	},
+}
+
+// printAgent prints the details of the agent in a human readable form, one label per line
+func printAgent(w io.Writer, agent cover.Agent) {
+	revision := agent.Labels[revisionLabel]
+	if revision == "" {
+		revision = "unknown"
+	}
+	fmt.Fprintf(w, "Name:     %s\n", agent.Name)
+	fmt.Fprintf(w, "Address:  %s\n", agent.Address)
+	fmt.Fprintf(w, "Center:   %s\n", agent.Host)
+	fmt.Fprintf(w, "Revision: %s\n", revision)
+	if len(agent.Labels) == 0 {
+		fmt.Fprintf(w, "Labels:   <none>\n")
+		return
+	}
+	fmt.Fprintf(w, "Labels:\n")
+	for _, label := range cover.FormatLabels(agent.Labels) {
+		fmt.Fprintf(w, "  %s\n", label)
+	}
+}
+
+func init() {
+	addBasicFlags(agentCmd.Flags())
+	rootCmd.AddCommand(agentCmd)
+}
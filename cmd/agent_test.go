@@ -0,0 +1,51 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/goc/pkg/cover"
+)
+
+func TestPrintAgent(t *testing.T) {
+	var buf bytes.Buffer
+	printAgent(&buf, cover.Agent{
+		Name:    "foo",
+		Address: "http://127.0.0.1:53",
+		Host:    "http://127.0.0.1:7777",
+		Labels:  map[string]string{revisionLabel: "abcdef-dirty", "zone": "east", "env": "staging"},
+	})
+	assert.Equal(t, `Name:     foo
+Address:  http://127.0.0.1:53
+Center:   http://127.0.0.1:7777
+Revision: abcdef-dirty
+Labels:
+  env:staging
+  revision:abcdef-dirty
+  zone:east
+`, buf.String())
+
+	// the agents built outside a git repository have no revision
+	buf.Reset()
+	printAgent(&buf, cover.Agent{Name: "foo", Address: "http://127.0.0.1:53", Host: "http://127.0.0.1:7777"})
+	assert.Contains(t, buf.String(), "Revision: unknown\n")
+	assert.Contains(t, buf.String(), "Labels:   <none>\n")
+}
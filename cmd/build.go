@@ -24,6 +24,7 @@ import (
 	"github.com/qiniu/goc/pkg/build"
 	"github.com/qiniu/goc/pkg/cover"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var buildCmd = &cobra.Command{
@@ -42,28 +43,50 @@ goc build --center=http://127.0.0.1:7777
 # Build the current binary with cover variables injected, and redirect output to /to/this/path.
 goc build --output /to/this/path
 
+# Build the current binary with cover variables injected, and name the binary myapp.
+goc build --name myapp
+
 # Build the current binary with cover variables injected, and set necessary build flags: -ldflags "-extldflags -static" -tags="embed kodo".
 goc build --buildflags="-ldflags '-extldflags -static' -tags='embed kodo'"
+
+# Build the current binary with cover variables injected, and inject the version by -ldflags.
+goc build --ldflags="-X main.version=v1.0.0"
+
+# Build the main package in a sub directory, and report the coverage of all the packages in the project.
+cd cmd/server && goc build --instrument-scope=module .
+
+# Build the current binary, and archive the instrumented source into instrumented.tar.gz as well.
+goc build --export-instrumented=instrumented.tar.gz .
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		wd, err := os.Getwd()
 		if err != nil {
 			log.Fatalf("Fail to build: %v", err)
 		}
-		runBuild(args, wd)
+		if err := checkNativeCover(nativeCover, coverPkgs, skipPkgs); err != nil {
+			log.Fatalf("Fail to build: %v", err)
+		}
+		if err := checkVerbosity(quiet, verbose); err != nil {
+			log.Fatalf("Fail to build: %v", err)
+		}
+		runBuild(cmd.Flags(), args, wd)
 	},
 }
 
-var buildOutput string
+var (
+	buildOutput string
+	binaryName  string
+)
 
 func init() {
 	addBuildFlags(buildCmd.Flags())
 	buildCmd.Flags().StringVarP(&buildOutput, "output", "o", "", "it forces build to write the resulting executable to the named output file")
+	buildCmd.Flags().StringVar(&binaryName, "name", "", "the name of the resulting executable, named after the main package by default")
 	rootCmd.AddCommand(buildCmd)
 }
 
-func runBuild(args []string, wd string) {
-	gocBuild, err := build.NewBuild(buildFlags, args, wd, buildOutput)
+func runBuild(flags *pflag.FlagSet, args []string, wd string) {
+	gocBuild, err := build.NewBuildWithOptions(buildOptions(flags, args, wd))
 	if err != nil {
 		log.Fatalf("Fail to build: %v", err)
 	}
@@ -72,26 +95,62 @@ func runBuild(args []string, wd string) {
 	// doCover with original buildFlags, with new GOPATH( tmp:original )
 	// in the tmp directory
 	ci := &cover.CoverInfo{
-		Args:                     buildFlags,
+		Args:                     gocBuild.BuildFlags,
 		GoPath:                   gocBuild.NewGOPATH,
 		Target:                   gocBuild.TmpDir,
-		Mode:                     coverMode.String(),
+		Mode:                     gocBuild.CoverMode,
 		AgentPort:                agentPort.String(),
 		Center:                   center,
+		AgentName:                agentName,
+		RegisterTimeout:          registerTimeout,
+		AgentHost:                agentHost,
+		NoFlushOnExit:            noFlushOnExit,
+		PushInterval:             pushInterval,
+		Revision:                 gocBuild.Revision(),
 		Singleton:                singleton,
 		IsMod:                    gocBuild.IsMod,
 		ModRootPath:              gocBuild.ModRootPath,
 		OneMainPackage:           true, // it is a go build
 		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		IncludeGenerated:         includeGenerated,
+		CoverPkgs:                coverPkgs,
+		SkipPkgs:                 skipPkgs,
+		ReportFile:               instrumentReport,
+		CoverVarPrefix:           coverVarPrefix,
+		InstrumentScope:          instrumentScope,
 	}
-	err = cover.Execute(ci)
+	restrictToChanged(gocBuild, ci)
+	err = gocBuild.Instrument(ci)
 	if err != nil {
 		log.Fatalf("Fail to build: %v", err)
 	}
+	exportInstrumented(gocBuild)
 	// do install in the temporary directory
 	err = gocBuild.Build()
 	if err != nil {
 		log.Fatalf("Fail to build: %v", err)
 	}
+	reportResult(os.Stderr, "build succeeded: %v", gocBuild.Target)
 	return
 }
+
+// restrictToChanged only instruments the packages changed since the git ref if the --changed-since flag is given
+func restrictToChanged(gocBuild *build.Build, ci *cover.CoverInfo) {
+	if changedSince == "" {
+		return
+	}
+	if err := gocBuild.RestrictToChanged(ci, changedSince); err != nil {
+		log.Fatalf("Fail to find the packages changed since %v: %v", changedSince, err)
+	}
+}
+
+// exportInstrumented archives the instrumented source if the --export-instrumented flag is given
+func exportInstrumented(gocBuild *build.Build) {
+	if exportPath == "" {
+		return
+	}
+	if err := gocBuild.ExportInstrumented(exportPath); err != nil {
+		log.Fatalf("Fail to export the instrumented source: %v", err)
+	}
+	log.Infof("The instrumented source is archived into %v", exportPath)
+}
@@ -44,7 +44,7 @@ func TestGeneratedBinary(t *testing.T) {
 
 	buildFlags, buildOutput = "", ""
 	args := []string{"."}
-	runBuild(args, workingDir)
+	runBuild(buildCmd.Flags(), args, workingDir)
 
 	obj := filepath.Join(workingDir, "simple-project")
 	fInfo, err := os.Lstat(obj)
@@ -72,7 +72,7 @@ func TestBuildBinaryName(t *testing.T) {
 
 	buildFlags, buildOutput = "", ""
 	args := []string{"."}
-	runBuild(args, workingDir)
+	runBuild(buildCmd.Flags(), args, workingDir)
 
 	obj := filepath.Join(workingDir, "simple-project")
 	fInfo, err := os.Lstat(obj)
@@ -101,7 +101,7 @@ func TestBuildBinaryForInternalPackage(t *testing.T) {
 
 	buildFlags, buildOutput = "", ""
 	args := []string{"."}
-	runBuild(args, workingDir)
+	runBuild(buildCmd.Flags(), args, workingDir)
 
 	obj := filepath.Join(workingDir, "simple-project")
 	fInfo, err := os.Lstat(obj)
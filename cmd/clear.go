@@ -27,7 +27,7 @@ import (
 )
 
 var clearCmd = &cobra.Command{
-	Use:   "clear",
+	Use:   "clear [agent id...]",
 	Short: "Clear code coverage counters of all the registered services",
 	Long:  `Clear code coverage counters for the services under test at runtime.`,
 	Example: `
@@ -36,11 +36,28 @@ goc clear
 
 # Clear coverage counter from specified register center.
 goc clear --center=http://192.168.1.1:8080
+
+# Clear coverage counter of the services registered with the label env:staging.
+goc clear --label=env:staging
+
+# Clear coverage counter of the agents by their ids, which are the addresses shown by 'goc list'.
+goc clear http://127.0.0.1:53 http://127.0.0.1:54
 `,
 	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 0 {
+			if len(svrList) != 0 || len(addrList) != 0 || len(labelList) != 0 {
+				log.Fatalf("agent ids can not be used with the 'service', 'address' or 'label' flag")
+			}
+			result := cover.NewWorker(center).ClearAgents(args)
+			if !printOpResult(os.Stdout, "cleared", result) {
+				log.Fatalf("failed to clear %d of %d agents", len(result.Failed), len(args))
+			}
+			return
+		}
 		p := cover.ProfileParam{
 			Service: svrList,
 			Address: addrList,
+			Label:   labelList,
 		}
 		res, err := cover.NewWorker(center).Clear(p)
 		if err != nil {
@@ -54,5 +71,6 @@ func init() {
 	addBasicFlags(clearCmd.Flags())
 	clearCmd.Flags().StringSliceVarP(&svrList, "service", "", nil, "service name to clear profile, see 'goc list' for all services.")
 	clearCmd.Flags().StringSliceVarP(&addrList, "address", "", nil, "address to clear profile, see 'goc list' for all addresses.")
+	clearCmd.Flags().StringSliceVar(&labelList, "label", nil, "only select the services having all the labels in the form of key:value, e.g. env:staging")
 	rootCmd.AddCommand(clearCmd)
 }
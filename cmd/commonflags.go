@@ -17,9 +17,13 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"time"
 
+	"github.com/qiniu/goc/pkg/build"
+	"github.com/qiniu/goc/pkg/cover"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
@@ -28,17 +32,40 @@ var (
 	target            string
 	center            string
 	agentPort         AgentPort
+	agentName         string
+	registerTimeout   time.Duration
+	agentHost         string
 	debugGoc          bool
 	debugInCISyncFile string
 	buildFlags        string
+	ldFlags           string
+	gcFlags           string
+	instrumentReport  string
 	singleton         bool
+	includeGenerated  bool
+	coverPkgs         []string
+	skipPkgs          []string
+	coverVarPrefix    string
+	instrumentScope   string
+	verbose           bool
+	quiet             bool
+	buildTimeout      time.Duration
+	exportPath        string
+	static            bool
+	goBinary          string
+	nativeCover       bool
+	changedSince      string
+	parallelism       int
+	copyDepsOnly      bool
+	noFlushOnExit     bool
+	pushInterval      time.Duration
 
 	goRunExecFlag  string
 	goRunArguments string
 )
 
 var coverMode = CoverMode{
-	mode: "count",
+	mode: build.DefaultCoverMode,
 }
 
 // addBasicFlags adds a
@@ -51,19 +78,59 @@ func addBasicFlags(cmdset *pflag.FlagSet) {
 func addCommonFlags(cmdset *pflag.FlagSet) {
 	addBasicFlags(cmdset)
 	cmdset.Var(&coverMode, "mode", "coverage mode: set, count, atomic")
-	cmdset.Var(&agentPort, "agentport", "a fixed port such as :8100 for registered service communicate with goc server. if not provided, using a random one")
+	cmdset.Var(&agentPort, "agentport", "the address such as :8100, 127.0.0.1:8100, or :0 for a port picked by the system, the registered service listens on to communicate with goc server, the actual port is registered. if not provided, using a random one. the GOC_AGENT_LISTEN environment variable of the service takes precedence")
+	cmdset.StringVar(&agentName, "agent-name", "", "name the service registers into goc server with, the binary name if empty, the GOC_AGENT_NAME environment variable of the service takes precedence")
 	cmdset.BoolVar(&singleton, "singleton", false, "singleton mode, not register to goc center")
-	cmdset.StringVar(&buildFlags, "buildflags", "", "specify the build flags")
+	cmdset.DurationVar(&registerTimeout, "register-timeout", 0, "how long the service retries registering into goc server if it is unreachable, e.g. 2m if the service may start before the server, no retry if 0, the GOC_REGISTER_TIMEOUT environment variable of the service takes precedence")
+	cmdset.StringVar(&agentHost, "agent-host", "", "the IP or the network interface such as eth0 whose address the service advertises to goc server, the address goc server sees if empty or goc server is not started with --accept-advertised, the GOC_AGENT_HOST environment variable of the service takes precedence")
+	cmdset.BoolVar(&noFlushOnExit, "no-flush-on-exit", false, "do not push the final coverage of the service to goc server when it is terminated by SIGTERM or SIGINT, the GOC_FLUSH_ON_EXIT environment variable of the service takes precedence")
+	cmdset.DurationVar(&pushInterval, "push-interval", 0, "how often the service pushes its coverage to goc server, e.g. 30s to keep the dashboards fresh without goc server asking every service, no push if 0, the GOC_PUSH_INTERVAL environment variable of the service takes precedence")
+	cmdset.StringVar(&buildFlags, "buildflags", "", "specify the build flags, which take precedence over GOFLAGS in the environment")
+	cmdset.BoolVar(&includeGenerated, "include-generated", false, "also instrument the generated files, i.e. the ones marked by \"// Code generated ... DO NOT EDIT.\", which are skipped by default")
+	cmdset.StringSliceVar(&coverPkgs, "cover-pkg", nil, "only instrument the packages whose import paths match the patterns, e.g. example.com/foo/...")
+	cmdset.StringSliceVar(&skipPkgs, "skip-pkg", nil, "do not instrument the packages whose import paths match the patterns")
+	cmdset.StringVar(&instrumentScope, "instrument-scope", cover.ScopeDeps, "packages to instrument, 'deps' for the packages imported by the main package, 'module' for all the packages of the project even if the main package is in a sub directory")
+	cmdset.StringVar(&coverVarPrefix, "cover-var-prefix", cover.DefaultCoverVarPrefix, "prefix of the injected coverage counter names, change it if the code declares identifiers colliding with the counters")
 	// bind to viper
 	viper.BindPFlags(cmdset)
 }
 
 func addBuildFlags(cmdset *pflag.FlagSet) {
 	addCommonFlags(cmdset)
+	cmdset.StringVar(&ldFlags, "ldflags", "", "specify the -ldflags passed to go, e.g. --ldflags \"-X main.version=v1.0.0\", -ldflags in --buildflags is rejected then")
+	cmdset.StringVar(&gcFlags, "gcflags", "", "specify the -gcflags passed to go, -gcflags in --buildflags is rejected then")
+	cmdset.StringVar(&instrumentReport, "instrument-report", "", "write a JSON report of the instrumented packages and files to the file")
+	cmdset.BoolVarP(&verbose, "verbose", "v", false, "print the commands run by go, i.e. go build -x -v, and the debug logs")
+	cmdset.BoolVarP(&quiet, "quiet", "q", false, "print only the final result without the progress and the status of goc, and log only the warnings and errors with --debug, e.g. in CI")
+	cmdset.DurationVar(&buildTimeout, "timeout", 0, "kill the go command if it does not finish in the duration, e.g. 10m, no limit if 0, goc run only accepts it with --watch, where it limits each rebuild")
+	cmdset.StringVar(&goBinary, "go", "", "path of the go command to build with, e.g. $GOROOT/bin/go to pin a toolchain, the go in PATH if empty")
+	cmdset.BoolVar(&nativeCover, "native-cover", false, "build with go build -cover instead of instrumenting the source if go1.20 or later is used, the coverage is written into GOCOVERDIR when the binary exits, see 'goc merge --coverdir', --cover-pkg and --skip-pkg are not supported with it")
+	cmdset.StringVar(&changedSince, "changed-since", "", "only instrument the packages with go files changed since the git ref, e.g. origin/master, the others are built without counters")
+	cmdset.IntVarP(&parallelism, "parallelism", "p", 0, "number of programs the go command runs in parallel, i.e. go build -p, the default of go if 0")
+	cmdset.BoolVar(&static, "static", false, "build a statically linked binary with cgo disabled, e.g. for scratch containers, it fails if any package needs cgo")
+	cmdset.BoolVar(&copyDepsOnly, "copy-deps-only", false, "copy only the packages the target packages depend on into the temporary directory instead of the whole module, e.g. for a module with huge vendored sources, the others are not instrumented even with --instrument-scope=module")
+	cmdset.StringVar(&exportPath, "export-instrumented", "", "also archive the instrumented source into the .tar.gz file, e.g. to attach it to a bug report")
 	// bind to viper
 	viper.BindPFlags(cmdset)
 }
 
+// checkNativeCover rejects the package filters along with --native-cover, go build -cover decides the
+// packages to cover by itself, and the glob patterns of the filters have no counterpart in -coverpkg
+func checkNativeCover(native bool, coverPkgs, skipPkgs []string) error {
+	if native && (len(coverPkgs) != 0 || len(skipPkgs) != 0) {
+		return errors.New("--cover-pkg and --skip-pkg are not supported with --native-cover, which covers the packages of the main module")
+	}
+	return nil
+}
+
+// checkVerbosity rejects --quiet along with --verbose
+func checkVerbosity(quiet, verbose bool) error {
+	if quiet && verbose {
+		return errors.New("--quiet and --verbose can not be used together")
+	}
+	return nil
+}
+
 func addRunFlags(cmdset *pflag.FlagSet) {
 	addBuildFlags(cmdset)
 	cmdset.StringVar(&goRunExecFlag, "exec", "", "same as -exec flag in 'go run' command")
@@ -81,10 +148,10 @@ func (m *CoverMode) String() string {
 	return m.mode
 }
 
-// Set sets the value to the CoverMode struct, use 'count' as default if v is empty
+// Set sets the value to the CoverMode struct, use 'atomic' as default if v is empty
 func (m *CoverMode) Set(v string) error {
 	if v == "" {
-		m.mode = "count"
+		m.mode = build.DefaultCoverMode
 		return nil
 	}
 	if v != "set" && v != "count" && v != "atomic" {
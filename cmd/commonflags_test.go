@@ -32,7 +32,7 @@ func TestCoverModeFlag(t *testing.T) {
 	}{
 		{
 			value:         "",
-			expectedValue: "count",
+			expectedValue: "atomic",
 			err:           nil,
 		},
 		{
@@ -108,3 +108,17 @@ func TestAgentPortFlag(t *testing.T) {
 		}
 	}
 }
+
+func TestCheckVerbosity(t *testing.T) {
+	assert.NoError(t, checkVerbosity(false, false))
+	assert.NoError(t, checkVerbosity(true, false))
+	assert.NoError(t, checkVerbosity(false, true))
+	assert.Error(t, checkVerbosity(true, true))
+}
+
+func TestCheckNativeCover(t *testing.T) {
+	assert.NoError(t, checkNativeCover(true, nil, nil))
+	assert.NoError(t, checkNativeCover(false, []string{"example.com/foo/..."}, []string{"example.com/foo/bar"}))
+	assert.Error(t, checkNativeCover(true, []string{"example.com/foo/..."}, nil))
+	assert.Error(t, checkNativeCover(true, nil, []string{"example.com/foo/bar"}))
+}
@@ -0,0 +1,63 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"github.com/qiniu/goc/pkg/build"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/pflag"
+)
+
+// buildOptions collects the build options from the command line and the goc config file
+// found from the working directory upward, options on the command line take precedence
+func buildOptions(flags *pflag.FlagSet, args []string, wd string) build.BuildOptions {
+	opts := build.BuildOptions{
+		BuildFlags:   buildFlags,
+		LDFlags:      ldFlags,
+		GCFlags:      gcFlags,
+		Packages:     args,
+		WorkingDir:   wd,
+		OutputDir:    buildOutput,
+		BinaryName:   binaryName,
+		CoverMode:    coverMode.String(),
+		Verbose:      verbose,
+		Timeout:      buildTimeout,
+		Static:       static,
+		GoBinary:     goBinary,
+		NativeCover:  nativeCover,
+		Parallelism:  parallelism,
+		CopyDepsOnly: copyDepsOnly,
+	}
+	opts.Progress = newProgress()
+
+	file := build.FindConfig(wd)
+	if file == "" {
+		return opts
+	}
+	cfg, err := build.LoadConfig(file)
+	if err != nil {
+		log.Fatalf("Fail to load config: %v", err)
+	}
+	log.Infof("Using config file: %v", file)
+	cfg.Apply(&opts, func(name string) bool {
+		if name == "packages" {
+			return len(args) != 0
+		}
+		return flags.Changed(name)
+	})
+	return opts
+}
@@ -45,14 +45,24 @@ goc cover --center=http://127.0.0.1:7777 --target=/path/to/target --mode=atomic
 func runCover(target string) {
 	buildFlags := viper.GetString("buildflags")
 	ci := &cover.CoverInfo{
-		Args:           buildFlags,
-		GoPath:         "",
-		Target:         target,
-		Mode:           coverMode.String(),
-		AgentPort:      agentPort.String(),
-		Center:         center,
-		Singleton:      singleton,
-		OneMainPackage: false,
+		Args:             buildFlags,
+		GoPath:           "",
+		Target:           target,
+		Mode:             coverMode.String(),
+		AgentPort:        agentPort.String(),
+		Center:           center,
+		AgentName:        agentName,
+		RegisterTimeout:  registerTimeout,
+		AgentHost:        agentHost,
+		NoFlushOnExit:    noFlushOnExit,
+		PushInterval:     pushInterval,
+		Singleton:        singleton,
+		OneMainPackage:   false,
+		IncludeGenerated: includeGenerated,
+		CoverPkgs:        coverPkgs,
+		SkipPkgs:         skipPkgs,
+		CoverVarPrefix:   coverVarPrefix,
+		InstrumentScope:  instrumentScope,
 	}
 	_ = cover.Execute(ci)
 }
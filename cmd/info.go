@@ -0,0 +1,73 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/qiniu/goc/pkg/cover"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var infoCmd = &cobra.Command{
+	Use:   "info",
+	Short: "Show the version and the state of the service registry center",
+	Long:  "Show the version, the build commit, the uptime and the number of registered services of the service registry center",
+	Example: `
+# Show the info of the default service registry center http://127.0.0.1:7777.
+goc info
+
+# Show the info of the specified service registry center.
+goc info --center=http://192.168.1.1:8080
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		info, err := cover.NewWorker(center).ServerInfo()
+		if err != nil {
+			log.Fatalf("Goc server %v return an error: %v", center, err)
+		}
+		printServerInfo(os.Stdout, center, info)
+	},
+}
+
+// printServerInfo prints the info of the service center in a human readable form
+func printServerInfo(w io.Writer, center string, info cover.ServerInfo) {
+	version, commit := info.Version, info.Commit
+	if version == "" {
+		version = "unknown"
+	}
+	if commit == "" {
+		commit = "unknown"
+	}
+	fmt.Fprintf(w, "Server:   %s\n", center)
+	fmt.Fprintf(w, "Version:  %s\n", version)
+	fmt.Fprintf(w, "Commit:   %s\n", commit)
+	fmt.Fprintf(w, "Uptime:   %s\n", info.Uptime.Round(time.Second))
+	fmt.Fprintf(w, "Services: %d\n", info.Agents)
+	// the client and the server may not speak the same API
+	if info.Version != "" && info.Version != gocVersion() {
+		fmt.Fprintf(w, "Warning:  the client version %s differs from the server\n", gocVersion())
+	}
+}
+
+func init() {
+	addBasicFlags(infoCmd.Flags())
+	rootCmd.AddCommand(infoCmd)
+}
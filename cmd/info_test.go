@@ -0,0 +1,44 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/goc/pkg/cover"
+)
+
+func TestPrintServerInfo(t *testing.T) {
+	var buf bytes.Buffer
+	printServerInfo(&buf, "http://127.0.0.1:7777", cover.ServerInfo{
+		Version: "v0.0.0-mismatch",
+		Uptime:  90*time.Minute + 1500*time.Millisecond,
+		Agents:  3,
+	})
+
+	out := buf.String()
+	assert.Contains(t, out, "Server:   http://127.0.0.1:7777\n")
+	assert.Contains(t, out, "Version:  v0.0.0-mismatch\n")
+	assert.Contains(t, out, "Commit:   unknown\n")
+	assert.Contains(t, out, "Uptime:   1h30m2s\n")
+	assert.Contains(t, out, "Services: 3\n")
+	assert.Contains(t, out, "Warning:")
+}
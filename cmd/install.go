@@ -23,6 +23,7 @@ import (
 	"github.com/qiniu/goc/pkg/cover"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var installCmd = &cobra.Command{
@@ -46,7 +47,13 @@ goc build --buildflags="-ldflags '-extldflags -static' -tags='embed kodo'"
 		if err != nil {
 			log.Fatalf("Fail to build: %v", err)
 		}
-		runInstall(args, wd)
+		if err := checkNativeCover(nativeCover, coverPkgs, skipPkgs); err != nil {
+			log.Fatalf("Fail to install: %v", err)
+		}
+		if err := checkVerbosity(quiet, verbose); err != nil {
+			log.Fatalf("Fail to install: %v", err)
+		}
+		runInstall(cmd.Flags(), args, wd)
 	},
 }
 
@@ -55,8 +62,8 @@ func init() {
 	rootCmd.AddCommand(installCmd)
 }
 
-func runInstall(args []string, wd string) {
-	gocBuild, err := build.NewInstall(buildFlags, args, wd)
+func runInstall(flags *pflag.FlagSet, args []string, wd string) {
+	gocBuild, err := build.NewInstallWithOptions(buildOptions(flags, args, wd))
 	if err != nil {
 		log.Fatalf("Fail to install: %v", err)
 	}
@@ -65,26 +72,41 @@ func runInstall(args []string, wd string) {
 	// doCover with original buildFlags, with new GOPATH( tmp:original )
 	// in the tmp directory
 	ci := &cover.CoverInfo{
-		Args:                     buildFlags,
+		Args:                     gocBuild.BuildFlags,
 		GoPath:                   gocBuild.NewGOPATH,
 		Target:                   gocBuild.TmpDir,
-		Mode:                     coverMode.String(),
+		Mode:                     gocBuild.CoverMode,
 		AgentPort:                agentPort.String(),
 		Center:                   center,
+		AgentName:                agentName,
+		RegisterTimeout:          registerTimeout,
+		AgentHost:                agentHost,
+		NoFlushOnExit:            noFlushOnExit,
+		PushInterval:             pushInterval,
+		Revision:                 gocBuild.Revision(),
 		Singleton:                singleton,
 		IsMod:                    gocBuild.IsMod,
 		ModRootPath:              gocBuild.ModRootPath,
 		OneMainPackage:           false,
 		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		IncludeGenerated:         includeGenerated,
+		CoverPkgs:                coverPkgs,
+		SkipPkgs:                 skipPkgs,
+		ReportFile:               instrumentReport,
+		CoverVarPrefix:           coverVarPrefix,
+		InstrumentScope:          instrumentScope,
 	}
-	err = cover.Execute(ci)
+	restrictToChanged(gocBuild, ci)
+	err = gocBuild.Instrument(ci)
 	if err != nil {
 		log.Fatalf("Fail to install: %v", err)
 	}
+	exportInstrumented(gocBuild)
 	// do install in the temporary directory
 	err = gocBuild.Install()
 	if err != nil {
 		log.Fatalf("Fail to install: %v", err)
 	}
+	reportResult(os.Stderr, "install succeeded: %v", gocBuild.Packages)
 	return
 }
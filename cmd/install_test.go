@@ -38,7 +38,7 @@ func TestInstalledBinaryForMod(t *testing.T) {
 
 	buildFlags, buildOutput = "", ""
 	args := []string{"."}
-	runInstall(args, workingDir)
+	runInstall(installCmd.Flags(), args, workingDir)
 
 	obj := filepath.Join(gopath, "bin", "simple-project")
 	fInfo, err := os.Lstat(obj)
@@ -66,7 +66,7 @@ func TestInstalledBinaryForLegacy(t *testing.T) {
 
 	buildFlags, buildOutput = "", ""
 	args := []string{"."}
-	runInstall(args, workingDir)
+	runInstall(installCmd.Flags(), args, workingDir)
 
 	obj := filepath.Join(gopath, "bin", "simple_gopath_project")
 	fInfo, err := os.Lstat(obj)
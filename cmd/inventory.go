@@ -0,0 +1,153 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/qiniu/goc/pkg/cover"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "Export the hosts of the registered services as an inventory",
+	Long: `Export the hosts of the registered services as an inventory, e.g. to act on them with ansible or ssh.
+The hosts format prints one entry per line, the ansible format prints an INI inventory with a group for each service.`,
+	Example: `
+# Print the hosts the services run on, one per line.
+goc inventory
+
+# Print the addresses of the services instead.
+goc inventory --field=address
+
+# Run a command on the hosts of the service 'mongo' with ansible.
+goc inventory --format=ansible > hosts.ini
+ansible -i hosts.ini mongo -m shell -a uptime
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := checkInventoryFlags(); err != nil {
+			log.Fatalf("export inventory failed, err: %v", err)
+		}
+		list := cover.NewMultiWorker([]string{center}).ListAgents()
+		if err := list.Failed[center]; err != nil {
+			log.Fatalf("Goc server %v return an error: %v", center, err)
+		}
+		if err := writeInventory(os.Stdout, list.Agents, inventoryFormat, inventoryField); err != nil {
+			log.Fatalf("export inventory failed, err: %v", err)
+		}
+	},
+}
+
+var (
+	inventoryFormat string // --format flag
+	inventoryField  string // --field flag
+)
+
+func init() {
+	inventoryCmd.Flags().StringVar(&inventoryFormat, "format", "hosts", "inventory format: hosts, one entry per line, or ansible, an INI inventory grouped by service")
+	inventoryCmd.Flags().StringVar(&inventoryField, "field", "host", "attribute of the service instances to print: host, the host name or IP of the address, address or name. name only works with the hosts format")
+	addBasicFlags(inventoryCmd.Flags())
+	rootCmd.AddCommand(inventoryCmd)
+}
+
+func checkInventoryFlags() error {
+	if inventoryFormat != "hosts" && inventoryFormat != "ansible" {
+		return fmt.Errorf("unknown inventory format: %s", inventoryFormat)
+	}
+	if inventoryField != "host" && inventoryField != "address" && inventoryField != "name" {
+		return fmt.Errorf("unknown field: %s", inventoryField)
+	}
+	if inventoryFormat == "ansible" && inventoryField == "name" {
+		return fmt.Errorf("the ansible inventory is grouped by name already, use --field=host or --field=address")
+	}
+	return nil
+}
+
+// agentField returns the attribute of the agent selected by the field flag
+func agentField(agent cover.Agent, field string) string {
+	switch field {
+	case "name":
+		return agent.Name
+	case "address":
+		return agent.Address
+	}
+	u, err := url.Parse(agent.Address)
+	if err != nil || u.Hostname() == "" {
+		return agent.Address
+	}
+	return u.Hostname()
+}
+
+// invalidGroupChars are the characters ansible does not take in the group names
+var invalidGroupChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// writeInventory writes the field of the agents as an inventory in the format, the entries are deduplicated
+// and sorted, as the instances of the services may run on the same hosts
+func writeInventory(w io.Writer, agents []cover.Agent, format, field string) error {
+	if format == "hosts" {
+		for _, entry := range uniqueSorted(agents, field) {
+			if _, err := fmt.Fprintln(w, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	groups := map[string][]cover.Agent{}
+	for _, agent := range agents {
+		group := invalidGroupChars.ReplaceAllString(agent.Name, "_")
+		groups[group] = append(groups[group], agent)
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "[%s]\n", name)
+		for _, entry := range uniqueSorted(groups[name], field) {
+			if _, err := fmt.Fprintln(w, entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func uniqueSorted(agents []cover.Agent, field string) []string {
+	seen := map[string]bool{}
+	var entries []string
+	for _, agent := range agents {
+		entry := agentField(agent, field)
+		if !seen[entry] {
+			seen[entry] = true
+			entries = append(entries, entry)
+		}
+	}
+	sort.Strings(entries)
+	return entries
+}
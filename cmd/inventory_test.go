@@ -0,0 +1,80 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/goc/pkg/cover"
+)
+
+func TestWriteInventory(t *testing.T) {
+	agents := []cover.Agent{
+		{Name: "mongo", Address: "http://10.0.0.2:7001", Host: "http://127.0.0.1:7777"},
+		{Name: "mongo", Address: "http://10.0.0.1:7001", Host: "http://127.0.0.1:7777"},
+		{Name: "web-api", Address: "http://10.0.0.1:7002", Host: "http://127.0.0.1:7777"},
+		{Name: "web-api", Address: "http://[fd00::1]:7002", Host: "http://127.0.0.1:7777"},
+	}
+
+	var tcs = []struct {
+		format   string
+		field    string
+		expected string
+	}{
+		{format: "hosts", field: "host", expected: "10.0.0.1\n10.0.0.2\nfd00::1\n"},
+		{format: "hosts", field: "address", expected: "http://10.0.0.1:7001\nhttp://10.0.0.1:7002\nhttp://10.0.0.2:7001\nhttp://[fd00::1]:7002\n"},
+		{format: "hosts", field: "name", expected: "mongo\nweb-api\n"},
+		{format: "ansible", field: "host", expected: "[mongo]\n10.0.0.1\n10.0.0.2\n\n[web_api]\n10.0.0.1\nfd00::1\n"},
+		{format: "ansible", field: "address", expected: "[mongo]\nhttp://10.0.0.1:7001\nhttp://10.0.0.2:7001\n\n[web_api]\nhttp://10.0.0.1:7002\nhttp://[fd00::1]:7002\n"},
+	}
+	for _, tc := range tcs {
+		var buf bytes.Buffer
+		assert.NoError(t, writeInventory(&buf, agents, tc.format, tc.field))
+		assert.Equal(t, tc.expected, buf.String(), tc.format+" "+tc.field)
+	}
+
+	// nothing registered
+	var buf bytes.Buffer
+	assert.NoError(t, writeInventory(&buf, nil, "ansible", "host"))
+	assert.Equal(t, "", buf.String())
+}
+
+func TestCheckInventoryFlags(t *testing.T) {
+	defer func(format, field string) {
+		inventoryFormat, inventoryField = format, field
+	}(inventoryFormat, inventoryField)
+
+	var tcs = []struct {
+		format string
+		field  string
+		err    bool
+	}{
+		{format: "hosts", field: "host"},
+		{format: "hosts", field: "name"},
+		{format: "ansible", field: "address"},
+		{format: "ansible", field: "name", err: true},
+		{format: "yaml", field: "host", err: true},
+		{format: "hosts", field: "port", err: true},
+	}
+	for _, tc := range tcs {
+		inventoryFormat, inventoryField = tc.format, tc.field
+		assert.Equal(t, tc.err, checkInventoryFlags() != nil, tc.format+" "+tc.field)
+	}
+}
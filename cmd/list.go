@@ -17,9 +17,22 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
+	"github.com/olekukonko/tablewriter"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/qiniu/goc/pkg/cover"
@@ -32,18 +45,268 @@ var listCmd = &cobra.Command{
 	Long:  "Lists all the registered services",
 	Example: `
 goc list [flags]
+
+# List at most 100 registered services.
+goc list --limit=100
+
+# List the registered services, collapse the instances registered more than once.
+goc list --unique
+
+# List the registered services as a table, ordered by address in descending order.
+goc list --format=table --sort=address --desc
+
+# Watch the registered services, refresh every 5 seconds.
+goc list --watch --interval=5s
+
+# List the registered services as a table along with the revisions they are built from and their labels.
+goc list --format=table --wide
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		res, err := cover.NewWorker(center).ListServices()
+		if err := checkListFlags(); err != nil {
+			log.Fatalf("list failed, err: %v", err)
+		}
+		worker := cover.NewWorker(center)
+		if listWatch {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			sig := make(chan os.Signal, 1)
+			signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+			go func() {
+				<-sig
+				cancel()
+			}()
+			watchServices(ctx, os.Stdout, worker, listInterval)
+			return
+		}
+
+		services, labels, err := listServices(worker)
 		if err != nil {
 			log.Fatalf("list failed, err: %v", err)
 		}
+		if listFormat == "table" {
+			if !hasServices(services) {
+				// an empty table looks like an error during the early setup
+				fmt.Fprintln(os.Stderr, noServicesMessage)
+				return
+			}
+			renderServices(os.Stdout, services, labels)
+			return
+		}
+		res, _ := json.Marshal(services)
 		log.Infoln(string(res))
 		fmt.Fprint(os.Stdout, string(res))
 	},
 }
 
+var (
+	listLimit    int           // --limit flag
+	listWatch    bool          // --watch flag
+	listInterval time.Duration // --interval flag
+	listUnique   bool          // --unique flag
+	listFormat   string        // --format flag
+	listSortKey  string        // --sort flag
+	listDesc     bool          // --desc flag
+	listWide     bool          // --wide flag
+)
+
 func init() {
+	listCmd.Flags().IntVar(&listLimit, "limit", 0, "list at most the given number of services, 0 means no limit")
+	listCmd.Flags().BoolVarP(&listWatch, "watch", "w", false, "watch the registered services and refresh the table in place")
+	listCmd.Flags().BoolVar(&listUnique, "unique", false, "collapse the service instances registered more than once under the same name")
+	listCmd.Flags().DurationVar(&listInterval, "interval", 2*time.Second, "fixed refresh interval in watch mode, the refreshes do not drift however long the listing takes")
+	listCmd.Flags().StringVar(&listFormat, "format", "json", "output format: json, table. watch mode always renders a table")
+	listCmd.Flags().StringVar(&listSortKey, "sort", "name", "sort the table by the column: name, address")
+	listCmd.Flags().BoolVar(&listDesc, "desc", false, "sort the table in descending order")
+	listCmd.Flags().BoolVar(&listWide, "wide", false, "also show the revisions the services are built from and their other labels in the table")
 	addBasicFlags(listCmd.Flags())
 	rootCmd.AddCommand(listCmd)
 }
+
+// checkListFlags validates the flags of list command
+func checkListFlags() error {
+	if listFormat != "json" && listFormat != "table" {
+		return fmt.Errorf("unknown format: %s", listFormat)
+	}
+	if listSortKey != "name" && listSortKey != "address" {
+		return fmt.Errorf("unknown sort key: %s", listSortKey)
+	}
+	if listWide && listFormat != "table" && !listWatch {
+		return fmt.Errorf("--wide only works with the table format")
+	}
+	if listWatch && listInterval <= 0 {
+		return fmt.Errorf("invalid interval: %v, it should be positive", listInterval)
+	}
+	return nil
+}
+
+// clearScreen moves the cursor to the top left corner and clears the terminal
+const clearScreen = "\033[H\033[2J"
+
+// newWatchTicker returns the ticks of the watch mode and the function to stop them,
+// it is replaced by a fake clock in the tests
+var newWatchTicker = func(interval time.Duration) (<-chan time.Time, func()) {
+	ticker := time.NewTicker(interval)
+	return ticker.C, ticker.Stop
+}
+
+// watchServices re-polls the registered services at the given fixed interval
+// and re-renders the table in place until the context is cancelled,
+// a ticker is used so that the time spent on listing does not delay the next refresh
+func watchServices(ctx context.Context, w io.Writer, worker cover.Action, interval time.Duration) {
+	// re-render immediately when the terminal is resized
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	defer signal.Stop(resize)
+
+	refresh := func() {
+		fmt.Fprint(w, clearScreen)
+		fmt.Fprintf(w, "Every %v: goc list --center=%s\n\n", interval, center)
+		services, labels, err := listServices(worker)
+		if err != nil {
+			fmt.Fprintf(w, "list failed, err: %v\n", err)
+			return
+		}
+		if !hasServices(services) {
+			fmt.Fprintln(w, noServicesMessage)
+			return
+		}
+		renderServices(w, services, labels)
+	}
+
+	ticks, stop := newWatchTicker(interval)
+	defer stop()
+
+	refresh()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-resize:
+			refresh()
+		case <-ticks:
+			refresh()
+		}
+	}
+}
+
+// listServices fetches the registered services according to the list flags,
+// along with the labels of the service instances by address
+func listServices(worker cover.Action) (map[string][]string, map[string]map[string]string, error) {
+	list, err := worker.ListServicesWithLabels(listLimit)
+	if err != nil {
+		return nil, nil, err
+	}
+	services := list.Items
+	if listUnique {
+		services = cover.UniqueServices(services)
+	}
+	// always a valid JSON object even if the server responds null
+	if services == nil {
+		services = map[string][]string{}
+	}
+	return services, list.Labels, nil
+}
+
+// noServicesMessage is shown instead of an empty table
+const noServicesMessage = "no services registered"
+
+// hasServices reports whether any service instance is registered
+func hasServices(services map[string][]string) bool {
+	for _, addrs := range services {
+		if len(addrs) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// serviceRow is a row of the service table
+type serviceRow struct {
+	name    string
+	address string
+}
+
+// revisionLabel is the label the services register the revision they are built from with
+const revisionLabel = "revision"
+
+// renderServices renders the registered services as a table ordered by the sort flags,
+// the revisions and the other labels are shown as well in the wide mode
+func renderServices(w io.Writer, services map[string][]string, labels map[string]map[string]string) {
+	rows := make([]serviceRow, 0)
+	for name, addrs := range services {
+		for _, addr := range addrs {
+			rows = append(rows, serviceRow{name: name, address: addr})
+		}
+	}
+	sortServiceRows(rows, listSortKey, listDesc)
+
+	table := tablewriter.NewWriter(w)
+	if listWide {
+		table.SetHeader([]string{"Service", "Address", "Revision", "Labels"})
+	} else {
+		table.SetHeader([]string{"Service", "Address"})
+	}
+	table.SetAutoFormatHeaders(false)
+	for _, row := range rows {
+		if !listWide {
+			table.Append([]string{row.name, row.address})
+			continue
+		}
+		others := make(map[string]string)
+		for k, v := range labels[row.address] {
+			if k != revisionLabel {
+				others[k] = v
+			}
+		}
+		table.Append([]string{row.name, row.address, labels[row.address][revisionLabel], strings.Join(cover.FormatLabels(others), ",")})
+	}
+	table.Render()
+}
+
+// sortServiceRows sorts the rows by name or address, ties are broken by the other column
+func sortServiceRows(rows []serviceRow, key string, desc bool) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		var c int
+		if key == "address" {
+			c = compareAddress(rows[i].address, rows[j].address)
+			if c == 0 {
+				c = strings.Compare(rows[i].name, rows[j].name)
+			}
+		} else {
+			c = strings.Compare(rows[i].name, rows[j].name)
+			if c == 0 {
+				c = compareAddress(rows[i].address, rows[j].address)
+			}
+		}
+		if desc {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+// compareAddress compares two service addresses, the IP hosts are compared numerically,
+// and then the ports. It falls back to lexical order for the non-IP addresses.
+func compareAddress(a, b string) int {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	ipA, ipB := net.ParseIP(ua.Hostname()), net.ParseIP(ub.Hostname())
+	if ipA == nil || ipB == nil {
+		return strings.Compare(a, b)
+	}
+	if c := bytes.Compare(ipA.To16(), ipB.To16()); c != 0 {
+		return c
+	}
+	portA, _ := strconv.Atoi(ua.Port())
+	portB, _ := strconv.Atoi(ub.Port())
+	switch {
+	case portA < portB:
+		return -1
+	case portA > portB:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,268 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/goc/pkg/cover"
+)
+
+func TestRenderServices(t *testing.T) {
+	var buf bytes.Buffer
+	renderServices(&buf, map[string][]string{
+		"b": {"http://127.0.0.1:2001"},
+		"a": {"http://127.0.0.1:1001", "http://127.0.0.1:1002"},
+	}, nil)
+
+	out := buf.String()
+	assert.Contains(t, out, "Service")
+	assert.True(t, strings.Index(out, "1001") < strings.Index(out, "1002"))
+	assert.True(t, strings.Index(out, "1002") < strings.Index(out, "2001"))
+}
+
+func TestRenderServicesWide(t *testing.T) {
+	defer func() { listWide = false }()
+	listWide = true
+
+	var buf bytes.Buffer
+	renderServices(&buf, map[string][]string{
+		"a": {"http://127.0.0.1:1001", "http://127.0.0.1:1002"},
+	}, map[string]map[string]string{
+		"http://127.0.0.1:1001": {"revision": "abc123", "env": "staging", "team": "db"},
+	})
+
+	out := buf.String()
+	assert.Contains(t, out, "Revision")
+	assert.Contains(t, out, "abc123")
+	assert.Contains(t, out, "env:staging,team:db")
+	assert.NotContains(t, out, "revision:", "the revision should not be repeated in the labels")
+	assert.Contains(t, out, "http://127.0.0.1:1002", "the instances without labels should be listed")
+}
+
+func TestWatchServices(t *testing.T) {
+	server := cover.NewMemoryBasedServer()
+	server.Store.Set(map[string][]string{"a": {"http://127.0.0.1:1001"}})
+	ts := httptest.NewServer(server.Route(ioutil.Discard))
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 250*time.Millisecond)
+	defer cancel()
+
+	var buf bytes.Buffer
+	watchServices(ctx, &buf, cover.NewWorker(ts.URL), 100*time.Millisecond)
+
+	out := buf.String()
+	assert.Contains(t, out, "http://127.0.0.1:1001")
+	assert.True(t, strings.Count(out, clearScreen) >= 2, "the table should be refreshed")
+}
+
+func TestWatchServicesFixedInterval(t *testing.T) {
+	server := cover.NewMemoryBasedServer()
+	server.Store.Set(map[string][]string{"a": {"http://127.0.0.1:1001"}})
+	ts := httptest.NewServer(server.Route(ioutil.Discard))
+	defer ts.Close()
+
+	// a fake clock whose ticks are sent by the test
+	ticks := make(chan time.Time)
+	var interval time.Duration
+	stopped := false
+	defer func(orig func(time.Duration) (<-chan time.Time, func())) { newWatchTicker = orig }(newWatchTicker)
+	newWatchTicker = func(d time.Duration) (<-chan time.Time, func()) {
+		interval = d
+		return ticks, func() { stopped = true }
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		watchServices(ctx, &buf, cover.NewWorker(ts.URL), 2*time.Second)
+		close(done)
+	}()
+
+	start := time.Unix(0, 0)
+	for i := 1; i <= 3; i++ {
+		ticks <- start.Add(time.Duration(i) * 2 * time.Second)
+	}
+	cancel()
+	<-done
+
+	assert.Equal(t, 2*time.Second, interval, "the ticker should fire at the given interval")
+	assert.True(t, stopped, "the ticker should be stopped")
+	assert.Equal(t, 4, strings.Count(buf.String(), clearScreen), "the table should be rendered once and refreshed on every tick")
+}
+
+// the ticks arriving while the center is slow to list are not lost, every tick refreshes once
+func TestWatchServicesSlowCenter(t *testing.T) {
+	server := cover.NewMemoryBasedServer()
+	server.Store.Set(map[string][]string{"a": {"http://127.0.0.1:1001"}})
+	router := server.Route(ioutil.Discard)
+	var (
+		lists   int32
+		entered = make(chan struct{})
+		release = make(chan struct{})
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == cover.CoverServicesListAPI {
+			atomic.AddInt32(&lists, 1)
+			entered <- struct{}{}
+			<-release
+		}
+		router.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	// a fake clock buffering a tick as time.Ticker does
+	ticks := make(chan time.Time, 1)
+	defer func(orig func(time.Duration) (<-chan time.Time, func())) { newWatchTicker = orig }(newWatchTicker)
+	newWatchTicker = func(d time.Duration) (<-chan time.Time, func()) {
+		return ticks, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var buf bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		watchServices(ctx, &buf, cover.NewWorker(ts.URL), 2*time.Second)
+		close(done)
+	}()
+
+	start := time.Unix(0, 0)
+	for i := 1; i <= 3; i++ {
+		// the tick arrives during the refresh
+		<-entered
+		ticks <- start.Add(time.Duration(i) * 2 * time.Second)
+		release <- struct{}{}
+	}
+	<-entered
+	release <- struct{}{}
+	cancel()
+	<-done
+
+	assert.Equal(t, int32(4), atomic.LoadInt32(&lists), "the table should be listed once and on every tick")
+	assert.Equal(t, 4, strings.Count(buf.String(), clearScreen))
+	assert.NotContains(t, buf.String(), "list failed")
+}
+
+func TestListNoServices(t *testing.T) {
+	server := cover.NewMemoryBasedServer()
+	ts := httptest.NewServer(server.Route(ioutil.Discard))
+	defer ts.Close()
+
+	services, _, err := listServices(cover.NewWorker(ts.URL))
+	assert.NoError(t, err)
+	assert.False(t, hasServices(services))
+	res, err := json.Marshal(services)
+	assert.NoError(t, err)
+	assert.Equal(t, "{}", string(res), "the JSON should still be valid")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var buf bytes.Buffer
+	watchServices(ctx, &buf, cover.NewWorker(ts.URL), time.Second)
+	assert.Contains(t, buf.String(), noServicesMessage)
+	assert.NotContains(t, buf.String(), "Service", "the empty table should not be rendered")
+
+	assert.False(t, hasServices(map[string][]string{"a": {}}))
+	assert.True(t, hasServices(map[string][]string{"a": {}, "b": {"http://127.0.0.1:1001"}}))
+}
+
+func TestListServicesWithLimitFromLegacyCenter(t *testing.T) {
+	defer func() { listLimit = 0 }()
+	listLimit = 2
+
+	// the centers before the pagination reply the plain map and ignore the limit
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string][]string{
+			"a": {"http://127.0.0.1:1001"},
+			"b": {"http://127.0.0.1:2001", "http://127.0.0.1:2002"},
+		})
+	}))
+	defer ts.Close()
+
+	services, _, err := listServices(cover.NewWorker(ts.URL))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"a": {"http://127.0.0.1:1001"},
+		"b": {"http://127.0.0.1:2001"},
+	}, services)
+}
+
+func TestSortServiceRows(t *testing.T) {
+	rows := []serviceRow{
+		{name: "b", address: "http://10.0.0.10:80"},
+		{name: "a", address: "http://10.0.0.9:80"},
+		{name: "c", address: "http://9.0.0.1:8080"},
+		{name: "a", address: "http://10.0.0.9:7"},
+	}
+
+	sortServiceRows(rows, "address", false)
+	assert.Equal(t, []serviceRow{
+		{name: "c", address: "http://9.0.0.1:8080"},
+		{name: "a", address: "http://10.0.0.9:7"},
+		{name: "a", address: "http://10.0.0.9:80"},
+		{name: "b", address: "http://10.0.0.10:80"},
+	}, rows)
+
+	sortServiceRows(rows, "name", true)
+	assert.Equal(t, []serviceRow{
+		{name: "c", address: "http://9.0.0.1:8080"},
+		{name: "b", address: "http://10.0.0.10:80"},
+		{name: "a", address: "http://10.0.0.9:80"},
+		{name: "a", address: "http://10.0.0.9:7"},
+	}, rows)
+}
+
+func TestCheckListFlags(t *testing.T) {
+	defer func() { listFormat, listSortKey = "json", "name" }()
+
+	listFormat, listSortKey = "table", "address"
+	assert.NoError(t, checkListFlags())
+
+	listFormat = "yaml"
+	assert.Error(t, checkListFlags())
+
+	listFormat, listSortKey = "json", "pid"
+	assert.Error(t, checkListFlags())
+
+	defer func() { listWatch, listInterval = false, 2*time.Second }()
+	listSortKey, listWatch, listInterval = "name", true, 0
+	assert.Error(t, checkListFlags())
+
+	listInterval = time.Second
+	assert.NoError(t, checkListFlags())
+
+	defer func() { listWide = false }()
+	listWide = true
+	assert.NoError(t, checkListFlags(), "the watch mode always renders a table")
+	listWatch = false
+	assert.Error(t, checkListFlags(), "--wide does not work with the json format")
+	listFormat = "table"
+	assert.NoError(t, checkListFlags())
+}
@@ -17,12 +17,13 @@
 package cmd
 
 import (
+	"io/ioutil"
+	"os"
+
 	log "github.com/sirupsen/logrus"
 
+	"github.com/qiniu/goc/pkg/cover"
 	"github.com/spf13/cobra"
-	"golang.org/x/tools/cover"
-	"k8s.io/test-infra/gopherage/pkg/cov"
-	"k8s.io/test-infra/gopherage/pkg/util"
 )
 
 var mergeCmd = &cobra.Command{
@@ -32,45 +33,64 @@ var mergeCmd = &cobra.Command{
 merge requires that the files are 'coherent', meaning that if they both contain references to the
 same paths, then the contents of those source files were identical for the binary that generated
 each file.
+`,
+	Example: `
+# Merge the coverage files into merged.cov.
+goc merge a.cov b.cov -o merged.cov
+
+# Merge the coverage written into GOCOVERDIR by the binaries built with --native-cover, along with a coverage file.
+goc merge --coverdir=/tmp/covdata a.cov -o merged.cov
+
+# Merge the coverage files of the binaries built from the forks of the same source, with the file paths rewritten to the local checkout.
+goc merge a.cov b.cov --path-map=example.com/app=$HOME/src/app --path-map=github.com/me/app=$HOME/src/app -o merged.cov
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		runMerge(args, outputMergeProfile)
 	},
 }
 
-var outputMergeProfile string
+var (
+	outputMergeProfile string
+	mergeCoverDirs     []string // --coverdir flag
+	mergePathMappings  []string // --path-map flag
+)
 
 func init() {
 	mergeCmd.Flags().StringVarP(&outputMergeProfile, "output", "o", "mergeprofile.cov", "output file")
+	mergeCmd.Flags().StringSliceVar(&mergeCoverDirs, "coverdir", nil, "also merge the coverage in the GOCOVERDIR directories written by the binaries built with --native-cover, needs go1.20 or later")
+	mergeCmd.Flags().StringVar(&goBinary, "go", "", "path of the go command to read the --coverdir directories with, e.g. the one the binaries are built with, the go in PATH if empty")
+
+	mergeCmd.Flags().StringSliceVar(&mergePathMappings, "path-map", nil, "rewrite the file paths of the coverage files starting with a prefix to another before merging, in the form of from=to")
 
 	rootCmd.AddCommand(mergeCmd)
 }
 
 func runMerge(args []string, output string) {
-	if len(args) == 0 {
-		log.Fatalln("Expected at least one coverage file.")
-		return
-	}
-
-	profiles := make([][]*cover.Profile, len(args))
-	for _, path := range args {
-		profile, err := util.LoadProfile(path)
+	if len(mergeCoverDirs) != 0 {
+		f, err := ioutil.TempFile("", "goc-covdata")
 		if err != nil {
-			log.Fatalf("failed to open %s: %v", path, err)
+			log.Fatalf("failed to create temp file, err: %v", err)
+		}
+		f.Close()
+		defer os.Remove(f.Name())
+		if err := cover.ConvertCoverDirs(goBinary, mergeCoverDirs, f.Name()); err != nil {
+			log.Fatalln(err)
 			return
 		}
-		profiles = append(profiles, profile)
+		args = append(args, f.Name())
 	}
-
-	merged, err := cov.MergeMultipleProfiles(profiles)
-	if err != nil {
-		log.Fatalf("failed to merge files: %v", err)
+	if len(args) == 0 {
+		log.Fatalln("Expected at least one coverage file.")
 		return
 	}
 
-	err = util.DumpProfile(output, merged)
+	mappings, err := cover.ParsePathMappings(mergePathMappings)
 	if err != nil {
 		log.Fatalln(err)
 		return
 	}
+	if err := cover.MergeWithPathMappings(args, output, mappings); err != nil {
+		log.Fatalln(err)
+		return
+	}
 }
@@ -154,3 +154,26 @@ func TestMergeEmptyProfile(t *testing.T) {
 	assert.Equal(t, fatal, true)
 	assert.Contains(t, fatalStr, "failed to dump profile")
 }
+
+func TestMergeWithPathMappings(t *testing.T) {
+	profileA := filepath.Join(baseDir, "../tests/samples/merge_profile_samples/a.voc")
+	mergeprofile := filepath.Join(baseDir, "../tests/samples/merge_profile_samples/merge.cov")
+
+	// clear fatal string in setup
+	fatalStr = ""
+	fatal = false
+	defer func() { mergePathMappings = nil }()
+
+	mergePathMappings = []string{"qiniu.com/kodo=/home/me/src/kodo"}
+	runMerge([]string{profileA}, mergeprofile)
+	assert.Equal(t, fatal, false)
+	contents, err := ioutil.ReadFile(mergeprofile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(contents), "/home/me/src/kodo/apiserver/server/main.go:32.49,33.13 1 30")
+	assert.NotContains(t, string(contents), "qiniu.com/kodo/")
+
+	mergePathMappings = []string{"qiniu.com/kodo"}
+	runMerge([]string{profileA}, mergeprofile)
+	assert.Equal(t, fatal, true)
+	assert.Contains(t, fatalStr, "invalid path mapping")
+}
@@ -20,8 +20,10 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
 
 	"github.com/qiniu/goc/pkg/cover"
 	log "github.com/sirupsen/logrus"
@@ -50,63 +52,210 @@ goc profile --coverfile=pattern1,pattern2,pattern3
 
 # Force fetching all available profiles.
 goc profile --force
+
+# Fail if the total coverage is below 80%.
+goc profile --fail-under=80
+
+# Fail if the total coverage is below 80%, generated files and mocks are not counted.
+goc profile --fail-under=80 --exclude="**/*.pb.go,**/mocks"
+
+# Render the coverage as an HTML report, the source files are looked up under the current directory.
+goc profile --html=./coverage.html --source-root=.
+
+# Report the coverage of the lines changed since origin/master, run it in the git repository of the source.
+goc profile --diff-base=origin/master
+
+# Get the coverage counters of the services registered with the label env:staging.
+goc profile --label=env:staging
+
+# Get the coverage counters of an agent, and rewrite the file paths to the local checkout for go tool cover -html.
+goc profile --address=http://10.0.0.1:7778 --path-map=example.com/app=$HOME/src/app -o agent.cov
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		p := cover.ProfileParam{
 			Force:             force,
 			Service:           svrList,
 			Address:           addrList,
+			Label:             labelList,
 			CoverFilePatterns: coverFilePatterns,
 			SkipFilePatterns:  skipFilePatterns,
 		}
+		// the profile is streamed into the output if it is not processed any further, which saves
+		// much memory for the large ones
+		if len(pathMappings) == 0 && failUnder <= 0 && htmlOutput == "" && diffBase == "" {
+			w, closeOutput := openProfileOutput(output)
+			err := cover.NewWorker(center).ProfileTo(p, w)
+			closeOutput(err == nil)
+			if err != nil {
+				log.Fatalf("Goc server %v return an error: %v", center, err)
+			}
+			return
+		}
+
 		res, err := cover.NewWorker(center).Profile(p)
 		if err != nil {
 			log.Fatalf("Goc server %v return an error: %v", center, err)
 		}
+		res = remapProfile(res, pathMappings)
 
-		if output == "" {
-			fmt.Fprint(os.Stdout, string(res))
-		} else {
-			var dir, filename string = path.Split(output)
-			if dir != "" {
-				err = os.MkdirAll(dir, os.ModePerm)
-				if err != nil {
-					log.Fatalf("failed to create directory %s, err:%v", dir, err)
-				}
-			}
-			if filename == "" {
-				output += "coverage.cov"
-			}
+		w, closeOutput := openProfileOutput(output)
+		_, err = io.Copy(w, bytes.NewReader(res))
+		closeOutput(err == nil)
+		if err != nil {
+			log.Fatalf("failed to write file: %v, err: %v", output, err)
+		}
 
-			f, err := os.Create(output)
-			if err != nil {
-				log.Fatalf("failed to create file %s, err:%v", output, err)
-			}
-			defer f.Close()
-			_, err = io.Copy(f, bytes.NewReader(res))
-			if err != nil {
-				log.Fatalf("failed to write file: %v, err: %v", output, err)
-			}
+		if failUnder > 0 {
+			checkCoverage(res, failUnder, excludePatterns)
+		}
+
+		if htmlOutput != "" {
+			renderHTML(res, htmlOutput, sourceRoot)
+		}
+
+		if diffBase != "" {
+			reportDiffCoverage(res, diffBase)
 		}
 	},
 }
 
+// openProfileOutput opens the output file of the profile, the directories are created if needed,
+// and coverage.cov is written into the directory if the output is a directory.
+// The stdout is returned if the output is empty. The profile is written into a temp file next to
+// the output, the returned function closes it, and renames it to the output if the profile is
+// written successfully, or removes it otherwise, so the output is never left half written.
+func openProfileOutput(output string) (io.Writer, func(ok bool)) {
+	if output == "" {
+		return os.Stdout, func(bool) {}
+	}
+	var dir, filename string = path.Split(output)
+	if dir != "" {
+		err := os.MkdirAll(dir, os.ModePerm)
+		if err != nil {
+			log.Fatalf("failed to create directory %s, err:%v", dir, err)
+		}
+	}
+	if filename == "" {
+		output += "coverage.cov"
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(output), "."+filepath.Base(output))
+	if err != nil {
+		log.Fatalf("failed to create file %s, err:%v", output, err)
+	}
+	return f, func(ok bool) {
+		if err := f.Close(); err != nil && ok {
+			log.Errorf("failed to write file: %v, err: %v", output, err)
+			ok = false
+		}
+		if !ok {
+			os.Remove(f.Name())
+			return
+		}
+		// the temp file is only readable by the owner
+		os.Chmod(f.Name(), 0644)
+		if err := os.Rename(f.Name(), output); err != nil {
+			os.Remove(f.Name())
+			log.Fatalf("failed to create file %s, err:%v", output, err)
+		}
+	}
+}
+
+// remapProfile rewrites the file paths of the profile by the path mappings in the form of from=to
+func remapProfile(profile []byte, specs []string) []byte {
+	mappings, err := cover.ParsePathMappings(specs)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	remapped, err := cover.RemapProfile(profile, mappings)
+	if err != nil {
+		log.Fatalf("failed to remap the profile, err: %v", err)
+	}
+	return remapped
+}
+
+// checkCoverage exits with a non-zero code if the total coverage of the profile is below the threshold,
+// files matching the exclude patterns are not counted
+func checkCoverage(profile []byte, threshold float64, excludes []string) {
+	file := writeTempProfile(profile)
+	percentage, err := cover.Percentage(file, excludes...)
+	os.Remove(file)
+	if err != nil {
+		log.Fatalf("failed to calculate the coverage, err: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "total coverage: %.1f%%\n", percentage)
+	if percentage < threshold {
+		log.Fatalf("total coverage %.1f%% is below %.1f%%", percentage, threshold)
+	}
+}
+
+// renderHTML renders the profile to an HTML report, the sources are looked up under srcRoot
+func renderHTML(profile []byte, out, srcRoot string) {
+	file := writeTempProfile(profile)
+	err := cover.HTML(file, out, srcRoot)
+	os.Remove(file)
+	if err != nil {
+		log.Fatalf("failed to render the HTML report, err: %v", err)
+	}
+}
+
+// reportDiffCoverage prints the coverage of the lines changed since the base ref
+func reportDiffCoverage(profile []byte, baseRef string) {
+	file := writeTempProfile(profile)
+	percentage, err := cover.DiffCoverage(file, baseRef)
+	os.Remove(file)
+	if err != nil {
+		log.Fatalf("failed to calculate the diff coverage, err: %v", err)
+	}
+	fmt.Fprintf(os.Stderr, "diff coverage against %s: %.1f%%\n", baseRef, percentage)
+}
+
+// writeTempProfile writes the profile to a temp file and returns its name,
+// the caller should remove the file
+func writeTempProfile(profile []byte) string {
+	f, err := ioutil.TempFile("", "goc-profile")
+	if err != nil {
+		log.Fatalf("failed to create temp file, err: %v", err)
+	}
+	_, err = f.Write(profile)
+	f.Close()
+	if err != nil {
+		os.Remove(f.Name())
+		log.Fatalf("failed to write temp file, err: %v", err)
+	}
+	return f.Name()
+}
+
 var (
 	svrList           []string // --service flag
 	addrList          []string // --address flag
+	labelList         []string // --label flag
 	force             bool     // --force flag
 	output            string   // --output flag
 	coverFilePatterns []string // --coverfile flag
 	skipFilePatterns  []string // --skipfile flag
+	failUnder         float64  // --fail-under flag
+	excludePatterns   []string // --exclude flag
+	htmlOutput        string   // --html flag
+	sourceRoot        string   // --source-root flag
+	diffBase          string   // --diff-base flag
+	pathMappings      []string // --path-map flag
 )
 
 func init() {
 	profileCmd.Flags().StringVarP(&output, "output", "o", "", "download cover profile")
 	profileCmd.Flags().StringSliceVarP(&svrList, "service", "", nil, "service name to fetch profile, see 'goc list' for all services.")
 	profileCmd.Flags().StringSliceVarP(&addrList, "address", "", nil, "address to fetch profile, see 'goc list' for all addresses.")
+	profileCmd.Flags().StringSliceVar(&labelList, "label", nil, "only select the services having all the labels in the form of key:value, e.g. env:staging")
 	profileCmd.Flags().BoolVarP(&force, "force", "f", false, "force fetching all available profiles")
 	profileCmd.Flags().StringSliceVarP(&coverFilePatterns, "coverfile", "", nil, "only output coverage data of the files matching the patterns")
 	profileCmd.Flags().StringSliceVarP(&skipFilePatterns, "skipfile", "", nil, "skip the files matching the patterns when outputing coverage data")
+	profileCmd.Flags().Float64Var(&failUnder, "fail-under", 0, "exit with a non-zero code if the total coverage percentage is below the value")
+	profileCmd.Flags().StringSliceVar(&excludePatterns, "exclude", nil, "glob patterns of the files not counted in the total coverage percentage, e.g. **/*_mock.go")
+	profileCmd.Flags().StringVar(&htmlOutput, "html", "", "render the coverage profile to the HTML file")
+	profileCmd.Flags().StringVar(&sourceRoot, "source-root", ".", "directory to look up the source files for the HTML report")
+	profileCmd.Flags().StringVar(&diffBase, "diff-base", "", "report the coverage of the lines changed since the git ref")
+	profileCmd.Flags().StringSliceVar(&pathMappings, "path-map", nil, "rewrite the file paths of the profile starting with a prefix to another in the form of from=to, e.g. the module path to the local source root")
 	addBasicFlags(profileCmd.Flags())
 	rootCmd.AddCommand(profileCmd)
 }
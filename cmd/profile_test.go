@@ -0,0 +1,59 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenProfileOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-profile-output")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// the output is replaced only if the profile is written successfully
+	output := filepath.Join(dir, "sub", "coverage.out")
+	w, closeOutput := openProfileOutput(output)
+	w.Write([]byte("mode: count\n"))
+	closeOutput(true)
+	content, err := ioutil.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, "mode: count\n", string(content))
+
+	w, closeOutput = openProfileOutput(output)
+	w.Write([]byte("mode: "))
+	closeOutput(false)
+	content, err = ioutil.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, "mode: count\n", string(content), "the output should not be half written")
+	files, err := ioutil.ReadDir(filepath.Join(dir, "sub"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "the temp file should be removed")
+
+	// coverage.cov is written into the directory
+	w, closeOutput = openProfileOutput(dir + "/")
+	w.Write([]byte("mode: set\n"))
+	closeOutput(true)
+	content, err = ioutil.ReadFile(filepath.Join(dir, "coverage.cov"))
+	assert.NoError(t, err)
+	assert.Equal(t, "mode: set\n", string(content))
+}
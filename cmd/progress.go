@@ -0,0 +1,70 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/qiniu/goc/pkg/build"
+)
+
+// newProgress returns a progress reporter printing to stderr,
+// progress is suppressed in the quiet mode or if stderr is not a terminal
+func newProgress() build.ProgressFunc {
+	if quiet || !stderrIsTerminal() {
+		return nil
+	}
+	return progressWriter(os.Stderr)
+}
+
+// reportStatus prints the status of a command besides the logs, e.g. the server goc run starts,
+// which is suppressed in the quiet mode
+func reportStatus(w io.Writer, format string, args ...interface{}) {
+	if !quiet {
+		fmt.Fprintf(w, "[goc] "+format+"\n", args...)
+	}
+}
+
+// reportResult prints the final result of a command, which is kept in the quiet mode,
+// the failures are reported by the fatal logs which are never suppressed
+func reportResult(w io.Writer, format string, args ...interface{}) {
+	fmt.Fprintf(w, "[goc] "+format+"\n", args...)
+}
+
+func progressWriter(w io.Writer) build.ProgressFunc {
+	copying := false
+	return func(stage string, done int) {
+		switch stage {
+		case build.StageCopy:
+			copying = true
+			fmt.Fprintf(w, "\r[goc] copying project: %d files copied", done)
+		case build.StageBuild:
+			if copying {
+				// finish the line of copying progress
+				fmt.Fprintln(w)
+				copying = false
+			}
+			if done == 0 {
+				fmt.Fprintln(w, "[goc] go build started")
+			} else {
+				fmt.Fprintln(w, "[goc] go build finished")
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+// the quiet mode drops the progress and the status printed besides the logs, and keeps the final result
+func TestQuietOutput(t *testing.T) {
+	defer func(q bool, isTerminal func() bool) {
+		quiet, stderrIsTerminal = q, isTerminal
+	}(quiet, stderrIsTerminal)
+	stderrIsTerminal = func() bool { return true }
+
+	var buf bytes.Buffer
+	quiet = false
+	assert.NotNil(t, newProgress())
+	reportStatus(&buf, "goc server started: %v", "http://127.0.0.1:7777")
+	reportResult(&buf, "build succeeded: %v", "/tmp/app")
+	assert.Equal(t, "[goc] goc server started: http://127.0.0.1:7777\n[goc] build succeeded: /tmp/app\n", buf.String())
+
+	buf.Reset()
+	quiet = true
+	assert.Nil(t, newProgress())
+	assert.Nil(t, buildOptions(pflag.NewFlagSet("build", pflag.ContinueOnError), []string{"."}, t.TempDir()).Progress)
+	reportStatus(&buf, "goc server started: %v", "http://127.0.0.1:7777")
+	reportResult(&buf, "build succeeded: %v", "/tmp/app")
+	assert.Equal(t, "[goc] build succeeded: /tmp/app\n", buf.String())
+}
@@ -31,11 +31,19 @@ var registerCmd = &cobra.Command{
 	Long:  "Register a service into service center",
 	Example: `
 goc register [flags] 
+
+# Register a service with labels, which can be selected by the label flag of goc profile and goc clear.
+goc register --name=mongo --address=http://127.0.0.1:53 --label=env:staging --label=team:db
 `,
 	Run: func(cmd *cobra.Command, args []string) {
+		labels, err := cover.ParseLabels(labelList)
+		if err != nil {
+			log.Fatalf("register service failed, err: %v", err)
+		}
 		s := cover.ServiceUnderTest{
 			Name:    name,
 			Address: address,
+			Labels:  labels,
 		}
 		res, err := cover.NewWorker(center).RegisterService(s)
 		if err != nil {
@@ -54,6 +62,7 @@ func init() {
 	registerCmd.Flags().StringVarP(&center, "center", "", "http://127.0.0.1:7777", "cover profile host center")
 	registerCmd.Flags().StringVarP(&name, "name", "n", "", "service name")
 	registerCmd.Flags().StringVarP(&address, "address", "a", "", "service address")
+	registerCmd.Flags().StringSliceVar(&labelList, "label", nil, "labels of the service in the form of key:value, e.g. env:staging")
 	registerCmd.MarkFlagRequired("name")
 	registerCmd.MarkFlagRequired("address")
 	rootCmd.AddCommand(registerCmd)
@@ -18,7 +18,9 @@ package cmd
 
 import (
 	"fmt"
+	"io"
 	"os"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 
@@ -27,7 +29,7 @@ import (
 )
 
 var removeCmd = &cobra.Command{
-	Use:   "remove",
+	Use:   "remove [agent id...]",
 	Short: "Remove the specified service from the register center.",
 	Long:  `Remove the specified service from the register center, after that, goc profile will not collect coverage data from this service anymore`,
 	Example: `
@@ -36,8 +38,28 @@ goc remove --service=mongo
 
 # Remove the service 'http://127.0.0.1:53' from the specified register center.
 goc remove --address="http://127.0.0.1:53" --center=http://192.168.1.1:8080
+
+# Remove the agents by their ids, which are the addresses shown by 'goc list'.
+goc remove http://127.0.0.1:53 http://127.0.0.1:54
+
+# Remove the agents the register center failed to connect to when it got the profiles, e.g. their hosts are down.
+goc remove --unreachable
 `,
 	Run: func(cmd *cobra.Command, args []string) {
+		if removeUnreachable {
+			if len(args) != 0 || len(svrList) != 0 || len(addrList) != 0 {
+				log.Fatalf("'unreachable' flag can not be used with the agent ids or the 'service' or 'address' flag")
+			}
+			pruneUnreachable(cover.NewWorker(center))
+			return
+		}
+		if len(args) != 0 {
+			if len(svrList) != 0 || len(addrList) != 0 {
+				log.Fatalf("agent ids can not be used with the 'service' or 'address' flag")
+			}
+			removeAgents(cover.NewWorker(center), args)
+			return
+		}
 		p := cover.ProfileParam{
 			Service: svrList,
 			Address: addrList,
@@ -50,9 +72,54 @@ goc remove --address="http://127.0.0.1:53" --center=http://192.168.1.1:8080
 	},
 }
 
+var removeUnreachable bool // --unreachable flag
+
 func init() {
 	addBasicFlags(removeCmd.Flags())
+	removeCmd.Flags().BoolVar(&removeUnreachable, "unreachable", false, "remove the services goc server failed to connect to when it got the profiles, see 'goc server --agent-timeout'")
 	removeCmd.Flags().StringSliceVarP(&svrList, "service", "", nil, "service name to clear profile, see 'goc list' for all services.")
 	removeCmd.Flags().StringSliceVarP(&addrList, "address", "", nil, "address to clear profile, see 'goc list' for all addresses.")
 	rootCmd.AddCommand(removeCmd)
 }
+
+func removeAgents(worker cover.Action, ids []string) {
+	result := worker.RemoveAgents(ids)
+	if !printOpResult(os.Stdout, "removed from the center", result) {
+		log.Fatalf("failed to remove %d of %d agents from the center %v", len(result.Failed), len(ids), center)
+	}
+}
+
+// pruneUnreachable removes the agents the center failed to connect to when it got the profiles
+func pruneUnreachable(worker cover.Action) {
+	agents, err := worker.ListUnreachable()
+	if err != nil {
+		log.Fatalf("failed to list the unreachable agents of the center %v, err: %v", center, err)
+	}
+	if len(agents) == 0 {
+		fmt.Fprintln(os.Stdout, "No unreachable agents.")
+		return
+	}
+	ids := make([]string, 0, len(agents))
+	for _, agent := range agents {
+		fmt.Fprintf(os.Stdout, "Agent %s of %s is unreachable since %s, err: %s\n", agent.Address, agent.Name,
+			agent.Since.Format(time.RFC3339), agent.Error)
+		ids = append(ids, agent.Address)
+	}
+	removeAgents(worker, ids)
+}
+
+// printOpResult summarizes the result of an operation on agents,
+// it returns false if the operation failed on any agent
+func printOpResult(w io.Writer, action string, result cover.OpResult) bool {
+	for _, id := range result.Succeeded {
+		fmt.Fprintf(w, "Agent %s %s.\n", id, action)
+	}
+	for _, id := range result.FailedIDs() {
+		fmt.Fprintf(w, "Agent %s failed, err: %v\n", id, result.Failed[id])
+	}
+	if len(result.Failed) != 0 {
+		fmt.Fprintf(w, "%d succeeded, %d failed.\n", len(result.Succeeded), len(result.Failed))
+		return false
+	}
+	return true
+}
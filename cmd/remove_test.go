@@ -0,0 +1,50 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/goc/pkg/cover"
+)
+
+func TestPrintOpResult(t *testing.T) {
+	var buf bytes.Buffer
+	ok := printOpResult(&buf, "removed from the center", cover.OpResult{
+		Succeeded: []string{"http://127.0.0.1:1001"},
+	})
+	assert.True(t, ok)
+	assert.Equal(t, "Agent http://127.0.0.1:1001 removed from the center.\n", buf.String())
+
+	buf.Reset()
+	ok = printOpResult(&buf, "cleared", cover.OpResult{
+		Succeeded: []string{"http://127.0.0.1:1001"},
+		Failed: map[string]error{
+			"http://127.0.0.1:1003": errors.New("timeout"),
+			"http://127.0.0.1:1002": errors.New("not found"),
+		},
+	})
+	assert.False(t, ok)
+	assert.Equal(t, "Agent http://127.0.0.1:1001 cleared.\n"+
+		"Agent http://127.0.0.1:1002 failed, err: not found\n"+
+		"Agent http://127.0.0.1:1003 failed, err: timeout\n"+
+		"1 succeeded, 2 failed.\n", buf.String())
+}
@@ -23,6 +23,7 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/qiniu/goc/pkg/cover"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -37,10 +38,12 @@ Find more information at:
  https://github.com/qiniu/goc
 `,
 	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		cover.UserAgent = "goc/" + gocVersion()
 		log.SetReportCaller(true)
 		log.SetLevel(log.InfoLevel)
 		log.SetFormatter(&log.TextFormatter{
 			FullTimestamp: true,
+			DisableColors: colorDisabled(),
 			CallerPrettyfier: func(f *runtime.Frame) (string, string) {
 				dirname, filename := filepath.Split(f.File)
 				lastelem := filepath.Base(dirname)
@@ -49,16 +52,24 @@ Find more information at:
 				return "", "[" + filename + ":" + line + "]"
 			},
 		})
-		if debugGoc == false {
+		if verbose {
+			// verbose mode surfaces the debug logs besides the commands of go
+			log.SetLevel(log.DebugLevel)
+		} else if debugGoc == false {
 			// we only need log in debug mode
 			log.SetLevel(log.FatalLevel)
 			log.SetFormatter(&log.TextFormatter{
 				DisableTimestamp: true,
+				DisableColors:    colorDisabled(),
 				CallerPrettyfier: func(f *runtime.Frame) (string, string) {
 					return "", ""
 				},
 			})
 		}
+		// quiet mode surfaces the warnings and errors only, it never logs more than the level above
+		if quiet && log.IsLevelEnabled(log.InfoLevel) {
+			log.SetLevel(log.WarnLevel)
+		}
 	},
 	PersistentPostRun: func(cmd *cobra.Command, args []string) {
 		if debugInCISyncFile != "" {
@@ -80,6 +91,21 @@ func init() {
 	viper.BindPFlags(rootCmd.PersistentFlags())
 }
 
+// isTerminal reports whether the file is a terminal
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// stderrIsTerminal reports whether stderr, where the logs go, is a terminal, it is replaced in the tests
+var stderrIsTerminal = func() bool { return isTerminal(os.Stderr) }
+
+// colorDisabled reports whether the logs are printed without colors, i.e. stderr is not a terminal,
+// e.g. the logs are written into a file in CI, or the NO_COLOR environment variable is set, see https://no-color.org
+func colorDisabled() bool {
+	return os.Getenv("NO_COLOR") != "" || !stderrIsTerminal()
+}
+
 // Execute the goc tool
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
@@ -0,0 +1,92 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogColors(t *testing.T) {
+	defer func(terminal func() bool, debug bool, formatter log.Formatter, level log.Level) {
+		stderrIsTerminal, debugGoc = terminal, debug
+		log.SetFormatter(formatter)
+		log.SetLevel(level)
+		log.SetReportCaller(false)
+	}(stderrIsTerminal, debugGoc, log.StandardLogger().Formatter, log.GetLevel())
+	noColor, ok := os.LookupEnv("NO_COLOR")
+	defer func() {
+		if ok {
+			os.Setenv("NO_COLOR", noColor)
+		} else {
+			os.Unsetenv("NO_COLOR")
+		}
+	}()
+
+	var tcs = []struct {
+		terminal bool
+		noColor  string
+		disabled bool
+	}{
+		{terminal: true, noColor: "", disabled: false},
+		{terminal: true, noColor: "1", disabled: true},
+		{terminal: false, noColor: "", disabled: true},
+		{terminal: false, noColor: "1", disabled: true},
+	}
+	for _, tc := range tcs {
+		stderrIsTerminal = func() bool { return tc.terminal }
+		os.Setenv("NO_COLOR", tc.noColor)
+		// both the debug logs and the fatal only logs
+		for _, debug := range []bool{true, false} {
+			debugGoc = debug
+			rootCmd.PersistentPreRun(rootCmd, nil)
+			formatter, ok := log.StandardLogger().Formatter.(*log.TextFormatter)
+			if assert.True(t, ok) {
+				assert.Equal(t, tc.disabled, formatter.DisableColors, "terminal: %v, NO_COLOR: %q, debug: %v", tc.terminal, tc.noColor, debug)
+			}
+		}
+	}
+}
+
+// the quiet mode never logs more than the mode without it
+func TestQuietLogLevel(t *testing.T) {
+	defer func(debug, q bool, formatter log.Formatter, level log.Level) {
+		debugGoc, quiet = debug, q
+		log.SetFormatter(formatter)
+		log.SetLevel(level)
+		log.SetReportCaller(false)
+	}(debugGoc, quiet, log.StandardLogger().Formatter, log.GetLevel())
+
+	var tcs = []struct {
+		debug    bool
+		quiet    bool
+		expected log.Level
+	}{
+		{debug: false, quiet: false, expected: log.FatalLevel},
+		{debug: false, quiet: true, expected: log.FatalLevel},
+		{debug: true, quiet: false, expected: log.InfoLevel},
+		{debug: true, quiet: true, expected: log.WarnLevel},
+	}
+	for _, tc := range tcs {
+		debugGoc, quiet = tc.debug, tc.quiet
+		rootCmd.PersistentPreRun(rootCmd, nil)
+		assert.Equal(t, tc.expected, log.GetLevel(), "debug: %v, quiet: %v", tc.debug, tc.quiet)
+	}
+}
@@ -21,11 +21,15 @@ import (
 	"io/ioutil"
 	"net"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
 
 	"github.com/qiniu/goc/pkg/build"
 	"github.com/qiniu/goc/pkg/cover"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 )
 
@@ -37,20 +41,24 @@ It is exactly behave as 'go run .' in addition of some internal goc features.`,
 	Example: `	
 goc run .
 goc run . [--buildflags] [--exec] [--arguments]
+
+# Rebuild and restart the service whenever the source files change, files matching .gitignore and --watch-exclude are not watched.
+goc run . --watch --watch-exclude="*_mock.go,testdata/"
 `,
 	Run: func(cmd *cobra.Command, args []string) {
+		if buildTimeout > 0 && !watch {
+			log.Fatalf("Fail to run: --timeout is not supported without --watch, it would kill the running service")
+		}
+		if err := checkNativeCover(nativeCover, coverPkgs, skipPkgs); err != nil {
+			log.Fatalf("Fail to run: %v", err)
+		}
+		if err := checkVerbosity(quiet, verbose); err != nil {
+			log.Fatalf("Fail to run: %v", err)
+		}
 		wd, err := os.Getwd()
 		if err != nil {
 			log.Fatalf("Fail to build: %v", err)
 		}
-		gocBuild, err := build.NewBuild(buildFlags, args, wd, buildOutput)
-		if err != nil {
-			log.Fatalf("Fail to run: %v", err)
-		}
-		gocBuild.GoRunExecFlag = goRunExecFlag
-		gocBuild.GoRunArguments = goRunArguments
-		defer gocBuild.Clean()
-
 		server := cover.NewMemoryBasedServer() // only save services in memory
 
 		// start goc server
@@ -62,30 +70,31 @@ goc run . [--buildflags] [--exec] [--arguments]
 			}
 		}()
 		gocServer := fmt.Sprintf("http://%s", l.Addr().String())
-		fmt.Printf("[goc] goc server started: %s \n", gocServer)
+		reportStatus(os.Stdout, "goc server started: %s", gocServer)
 
 		if viper.IsSet("center") {
 			gocServer = center
 		}
 
-		// execute covers for the target source with original buildFlags and new GOPATH( tmp:original )
-		ci := &cover.CoverInfo{
-			Args:                     buildFlags,
-			GoPath:                   gocBuild.NewGOPATH,
-			Target:                   gocBuild.TmpDir,
-			Mode:                     coverMode.String(),
-			Center:                   gocServer,
-			Singleton:                singleton,
-			AgentPort:                "",
-			IsMod:                    gocBuild.IsMod,
-			ModRootPath:              gocBuild.ModRootPath,
-			OneMainPackage:           true, // go run is similar with go build, build only one main package
-			GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		if watch {
+			runWatch(cmd.Flags(), args, wd, gocServer)
+			return
 		}
-		err = cover.Execute(ci)
+
+		gocBuild, err := build.NewBuildWithOptions(buildOptions(cmd.Flags(), args, wd))
+		if err != nil {
+			log.Fatalf("Fail to run: %v", err)
+		}
+		gocBuild.GoRunExecFlag = goRunExecFlag
+		gocBuild.GoRunArguments = goRunArguments
+		defer gocBuild.Clean()
+
+		// execute covers for the target source with original buildFlags and new GOPATH( tmp:original )
+		err = gocBuild.Instrument(runCoverInfo(gocBuild, gocServer))
 		if err != nil {
 			log.Fatalf("Fail to run: %v", err)
 		}
+		exportInstrumented(gocBuild)
 
 		if err := gocBuild.Run(); err != nil {
 			log.Fatalf("Fail to run: %v", err)
@@ -93,8 +102,127 @@ goc run . [--buildflags] [--exec] [--arguments]
 	},
 }
 
+// runCoverInfo returns the CoverInfo to instrument the main package of goc run
+func runCoverInfo(gocBuild *build.Build, gocServer string) *cover.CoverInfo {
+	ci := &cover.CoverInfo{
+		Args:                     gocBuild.BuildFlags,
+		GoPath:                   gocBuild.NewGOPATH,
+		Target:                   gocBuild.TmpDir,
+		Mode:                     gocBuild.CoverMode,
+		Center:                   gocServer,
+		AgentName:                agentName,
+		RegisterTimeout:          registerTimeout,
+		AgentHost:                agentHost,
+		NoFlushOnExit:            noFlushOnExit,
+		PushInterval:             pushInterval,
+		Revision:                 gocBuild.Revision(),
+		Singleton:                singleton,
+		AgentPort:                "",
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		OneMainPackage:           true, // go run is similar with go build, build only one main package
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		IncludeGenerated:         includeGenerated,
+		CoverPkgs:                coverPkgs,
+		SkipPkgs:                 skipPkgs,
+		ReportFile:               instrumentReport,
+		CoverVarPrefix:           coverVarPrefix,
+		InstrumentScope:          instrumentScope,
+	}
+	restrictToChanged(gocBuild, ci)
+	return ci
+}
+
+// runWatch builds and starts the instrumented binary, then restarts it whenever
+// the source files under the working directory change, until goc is interrupted
+func runWatch(flags *pflag.FlagSet, args []string, wd string, gocServer string) {
+	watcher, err := build.NewWatcher(wd, watchExcludes)
+	if err != nil {
+		log.Fatalf("Fail to watch %v: %v", wd, err)
+	}
+	defer watcher.Close()
+
+	// build the binary out of the working directory
+	outputDir, err := ioutil.TempDir("", "goc-run")
+	if err != nil {
+		log.Fatalf("Fail to create output directory: %v", err)
+	}
+	defer os.RemoveAll(outputDir)
+
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupted)
+
+	for {
+		service, err := startInstrumented(flags, args, wd, outputDir, gocServer)
+		if err != nil {
+			log.Errorf("Fail to run: %v", err)
+			reportStatus(os.Stdout, "waiting for changes to rebuild")
+		}
+
+		var exited <-chan struct{}
+		if service != nil {
+			exited = service.Exited()
+		}
+	wait:
+		for {
+			select {
+			case file := <-watcher.Changes():
+				reportStatus(os.Stdout, "%v changed, rebuilding", file)
+				break wait
+			case <-exited:
+				reportStatus(os.Stdout, "service exited, waiting for changes to rebuild")
+				exited = nil
+			case <-interrupted:
+				if service != nil {
+					service.Stop()
+				}
+				return
+			}
+		}
+		if service != nil {
+			if err := service.Stop(); err != nil {
+				log.Errorf("Fail to stop service: %v", err)
+			}
+		}
+	}
+}
+
+// startInstrumented instruments, builds and starts the binary in the background
+func startInstrumented(flags *pflag.FlagSet, args []string, wd string, outputDir string, gocServer string) (*build.RunningService, error) {
+	gocBuild, err := build.NewBuildWithOptions(buildOptions(flags, args, wd))
+	if err != nil {
+		return nil, err
+	}
+	gocBuild.Target = filepath.Join(outputDir, filepath.Base(gocBuild.Target))
+	gocBuild.GoRunArguments = goRunArguments
+
+	if err := gocBuild.Instrument(runCoverInfo(gocBuild, gocServer)); err != nil {
+		gocBuild.Clean()
+		return nil, err
+	}
+	if err := gocBuild.Build(); err != nil {
+		gocBuild.Clean()
+		return nil, err
+	}
+	// the service cleans the temporary directory when stopped
+	service, err := gocBuild.Start()
+	if err != nil {
+		gocBuild.Clean()
+		return nil, err
+	}
+	return service, nil
+}
+
+var (
+	watch         bool     // --watch flag
+	watchExcludes []string // --watch-exclude flag
+)
+
 func init() {
 	addRunFlags(runCmd.Flags())
+	runCmd.Flags().BoolVar(&watch, "watch", false, "rebuild and restart the service when the source files under the current directory change")
+	runCmd.Flags().StringSliceVar(&watchExcludes, "watch-exclude", nil, "gitignore-style patterns of the files not watched, in addition to .gitignore")
 	rootCmd.AddCommand(runCmd)
 }
 
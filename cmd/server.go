@@ -17,9 +17,11 @@
 package cmd
 
 import (
+	"log"
+	"time"
+
 	"github.com/qiniu/goc/pkg/cover"
 	"github.com/spf13/cobra"
-	"log"
 )
 
 var serverCmd = &cobra.Command{
@@ -35,20 +37,41 @@ goc server --port=:8080
 
 # Start a service registry center with localhost:8080.
 goc server --port=localhost:8080
+
+# Start a service registry center keeping the addresses the services built with --agent-host advertise.
+goc server --accept-advertised
+
+# Start a service registry center serving the API over gRPC on port :7778 as well.
+goc server --grpc-port=:7778
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		server, err := cover.NewFileBasedServer(localPersistence)
 		if err != nil {
 			log.Fatalf("New file based server failed, err: %v", err)
 		}
+		server.Version = gocVersion()
+		server.Commit = commit
+		server.ProfileConcurrency = profileConcurrency
+		server.MergeIncrementally = mergeIncrementally
+		server.AgentTimeout = agentTimeout
+		server.GRPCAddress = grpcPort
+		server.AcceptAdvertised = acceptAdvertised
 		server.Run(port)
 	},
 }
 
-var port, localPersistence string
+var port, localPersistence, grpcPort string
+var profileConcurrency int
+var mergeIncrementally, acceptAdvertised bool
+var agentTimeout time.Duration
 
 func init() {
 	serverCmd.Flags().StringVarP(&port, "port", "", ":7777", "listen port to start a coverage host center")
+	serverCmd.Flags().StringVar(&grpcPort, "grpc-port", "", "listen port to serve the API over gRPC as well, e.g. :7778, which the clients connect to with --center=grpc://127.0.0.1:7778")
 	serverCmd.Flags().StringVarP(&localPersistence, "local-persistence", "", "_svrs_address.txt", "the file to save services address information")
+	serverCmd.Flags().IntVar(&profileConcurrency, "profile-concurrency", cover.DefaultProfileConcurrency, "the max number of services to get the profiles from at the same time")
+	serverCmd.Flags().BoolVar(&mergeIncrementally, "merge-incrementally", false, "merge each profile as soon as it is got instead of holding all of them in memory, for the large fleets")
+	serverCmd.Flags().DurationVar(&agentTimeout, "agent-timeout", cover.DefaultAgentTimeout, "how long to wait for a service to respond with its profile, the unreachable services are skipped, see 'goc remove --unreachable'")
+	serverCmd.Flags().BoolVar(&acceptAdvertised, "accept-advertised", false, "keep the addresses the services advertise with --agent-host instead of the addresses the registrations come from, only for the trusted services")
 	rootCmd.AddCommand(serverCmd)
 }
@@ -0,0 +1,95 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/qiniu/goc/pkg/cover"
+	"github.com/spf13/cobra"
+)
+
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Snapshot the coverage profile and report the blocks covered since an earlier snapshot",
+	Long:  `Snapshot the coverage profile of the services under test, and report the blocks newly covered since an earlier snapshot, e.g. to verify a test exercises the new code.`,
+	Example: `
+# Snapshot the coverage profile before running the test.
+goc snapshot -o before.cov
+
+# Report the blocks covered by the test, and snapshot again for the next test.
+goc snapshot --since=before.cov -o after.cov
+
+# Only snapshot the coverage profile of the services registered with the label env:staging.
+goc snapshot --label=env:staging -o before.cov
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if snapshotSince == "" && output == "" {
+			log.Fatalf("either the 'since' or the 'output' flag is required")
+		}
+		p := cover.ProfileParam{
+			Force:   force,
+			Service: svrList,
+			Address: addrList,
+			Label:   labelList,
+		}
+		worker := cover.NewWorker(center)
+		if snapshotSince == "" {
+			if err := cover.Snapshot(worker, p, output); err != nil {
+				log.Fatalf("snapshot failed, err: %v", err)
+			}
+			return
+		}
+
+		blocks, profile, err := cover.CoveredSince(worker, p, snapshotSince)
+		if err != nil {
+			log.Fatalf("snapshot failed, err: %v", err)
+		}
+		printCoveredBlocks(os.Stdout, blocks)
+		if output != "" {
+			if err := ioutil.WriteFile(output, profile, 0644); err != nil {
+				log.Fatalf("failed to write file: %v, err: %v", output, err)
+			}
+		}
+	},
+}
+
+// printCoveredBlocks prints the blocks newly covered one per line and the number of them
+func printCoveredBlocks(w io.Writer, blocks []cover.CoveredBlock) {
+	for _, b := range blocks {
+		fmt.Fprintln(w, b)
+	}
+	fmt.Fprintf(w, "%d blocks newly covered\n", len(blocks))
+}
+
+var snapshotSince string // --since flag
+
+func init() {
+	addBasicFlags(snapshotCmd.Flags())
+	snapshotCmd.Flags().StringVarP(&output, "output", "o", "", "store the snapshot of the coverage profile into the file")
+	snapshotCmd.Flags().StringVar(&snapshotSince, "since", "", "report the blocks covered since the snapshot in the file")
+	snapshotCmd.Flags().StringSliceVarP(&svrList, "service", "", nil, "service name to snapshot profile, see 'goc list' for all services.")
+	snapshotCmd.Flags().StringSliceVarP(&addrList, "address", "", nil, "address to snapshot profile, see 'goc list' for all addresses.")
+	snapshotCmd.Flags().StringSliceVar(&labelList, "label", nil, "only select the services having all the labels in the form of key:value, e.g. env:staging")
+	snapshotCmd.Flags().BoolVarP(&force, "force", "f", false, "force fetching all available profiles")
+	rootCmd.AddCommand(snapshotCmd)
+}
@@ -0,0 +1,40 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/cover"
+
+	goccover "github.com/qiniu/goc/pkg/cover"
+)
+
+func TestPrintCoveredBlocks(t *testing.T) {
+	var buf bytes.Buffer
+	printCoveredBlocks(&buf, []goccover.CoveredBlock{
+		{FileName: "example.com/a/a.go", ProfileBlock: cover.ProfileBlock{StartLine: 3, StartCol: 10, EndLine: 5, EndCol: 2, Count: 1}},
+		{FileName: "example.com/a/b.go", ProfileBlock: cover.ProfileBlock{StartLine: 7, StartCol: 1, EndLine: 9, EndCol: 2, Count: 4}},
+	})
+	assert.Equal(t, "example.com/a/a.go:3.10,5.2\nexample.com/a/b.go:7.1,9.2\n2 blocks newly covered\n", buf.String())
+
+	buf.Reset()
+	printCoveredBlocks(&buf, nil)
+	assert.Equal(t, "0 blocks newly covered\n", buf.String())
+}
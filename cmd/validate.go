@@ -0,0 +1,91 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"os"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/qiniu/goc/pkg/build"
+	"github.com/qiniu/goc/pkg/cover"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the project can be instrumented without building it",
+	Long: `
+Validate command does cover for the target in a temporary directory as goc build does, and checks the instrumented source, e.g. no identifier collides with the coverage counters, but does not run go build.
+It gives fast feedback, e.g. in a pre-commit hook.
+`,
+	Example: `
+# Check the current binary can be instrumented.
+goc validate .
+
+# Check with the same flags the binary is built with.
+goc validate --buildflags="-tags=embed" --cover-var-prefix=GocCounter .
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		wd, err := os.Getwd()
+		if err != nil {
+			log.Fatalf("Fail to validate: %v", err)
+		}
+		if err := runValidate(cmd.Flags(), args, wd); err != nil {
+			log.Fatalf("Fail to validate: %v", err)
+		}
+		reportResult(os.Stderr, "validate succeeded")
+	},
+}
+
+func init() {
+	addCommonFlags(validateCmd.Flags())
+	rootCmd.AddCommand(validateCmd)
+}
+
+func runValidate(flags *pflag.FlagSet, args []string, wd string) error {
+	gocBuild, err := build.NewBuildWithOptions(buildOptions(flags, args, wd))
+	if err != nil {
+		return err
+	}
+	defer gocBuild.Clean()
+	return gocBuild.Validate(&cover.CoverInfo{
+		Args:                     gocBuild.BuildFlags,
+		GoPath:                   gocBuild.NewGOPATH,
+		Target:                   gocBuild.TmpDir,
+		Mode:                     gocBuild.CoverMode,
+		AgentPort:                agentPort.String(),
+		Center:                   center,
+		AgentName:                agentName,
+		RegisterTimeout:          registerTimeout,
+		AgentHost:                agentHost,
+		NoFlushOnExit:            noFlushOnExit,
+		PushInterval:             pushInterval,
+		Revision:                 gocBuild.Revision(),
+		Singleton:                singleton,
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		OneMainPackage:           true,
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		IncludeGenerated:         includeGenerated,
+		CoverPkgs:                coverPkgs,
+		SkipPkgs:                 skipPkgs,
+		CoverVarPrefix:           coverVarPrefix,
+		InstrumentScope:          instrumentScope,
+	})
+}
@@ -0,0 +1,41 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/goc/pkg/cover"
+)
+
+func TestRunValidate(t *testing.T) {
+	os.Setenv("GOPATH", "")
+	os.Setenv("GO111MODULE", "on")
+	buildFlags, buildOutput = "", ""
+
+	workingDir := filepath.Join(baseDir, "../tests/samples/simple_project")
+	assert.NoError(t, runValidate(validateCmd.Flags(), []string{"."}, workingDir))
+
+	workingDir = filepath.Join(baseDir, "../tests/samples/cover_var_collision_project")
+	err := runValidate(validateCmd.Flags(), []string{"."}, workingDir)
+	assert.True(t, errors.Is(err, cover.ErrCoverVarCollision), "%v", err)
+}
@@ -23,8 +23,11 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// the version value will be injected when publishing
-var version = "Unstable"
+// the version and commit values will be injected when publishing
+var (
+	version = "Unstable"
+	commit  = ""
+)
 
 var versionCmd = &cobra.Command{
 	Use:   "version",
@@ -34,18 +37,22 @@ var versionCmd = &cobra.Command{
 goc version
 	`,
 	Run: func(cmd *cobra.Command, args []string) {
-		// if it is "Unstable", means user build local or with go get
-		if version == "Unstable" {
-			if info, ok := debug.ReadBuildInfo(); ok {
-				fmt.Println(info.Main.Version)
-			}
-		} else {
-			// otherwise the value is injected in CI
-			fmt.Println(version)
-		}
+		fmt.Println(gocVersion())
 	},
 }
 
+// gocVersion returns the version of goc
+func gocVersion() string {
+	// if it is "Unstable", means user build local or with go get
+	if version == "Unstable" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			return info.Main.Version
+		}
+	}
+	// otherwise the value is injected in CI
+	return version
+}
+
 func init() {
 	rootCmd.AddCommand(versionCmd)
 }
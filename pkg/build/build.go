@@ -18,10 +18,13 @@ package build
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/qiniu/goc/pkg/cover"
 	log "github.com/sirupsen/logrus"
@@ -49,71 +52,246 @@ type Build struct {
 	// go build [-o output] [-i] [build flags] [packages]
 	// go install [-i] [build flags] [packages]
 	BuildFlags     string // Build flags
+	LDFlags        string // value of the -ldflags flag, appended after BuildFlags
+	GCFlags        string // value of the -gcflags flag, appended after BuildFlags
 	Packages       string // Packages that needs to build
 	GoRunExecFlag  string // for the -exec flags in go run command
 	GoRunArguments string // for the '[arguments]' parameters in go run command
+	CoverMode      string // coverage mode to instrument with: set, count or atomic
+	Verbose        bool   // print the commands run by the go command, i.e. go build -x -v
+	Static         bool   // disable cgo and link statically
+	GoBinary       string // path of the go command, go in PATH if empty
+	NativeCover    bool   // build with go build -cover instead of instrumenting the source
+	Parallelism    int    // value of the -p flag, not passed if zero
+	// Timeout limits how long the go command of Build, Install and the go test ones may take,
+	// the command and the processes it spawns are killed when it expires, zero means no limit.
+	// It is not applied to Run, whose go command keeps running with the service.
+	Timeout time.Duration
 
 	OneMainPackage           bool   // whether this build is a go build or go install? true: build, false: install
 	GlobalCoverVarImportPath string // Importpath for storing cover variables
 	GlobalCoverVarFilePath   string // Importpath for storing cover variables
+
+	// Stats records how long the phases of the last build took
+	Stats BuildStats
+
+	binaryName   string            // the name of the binary, named after the main package if empty
+	copyDepsOnly bool              // copy only the target packages and their dependencies of the module
+	progress     ProgressFunc      // reports the progress of copying and building, nil to disable
+	env          map[string]string // the environment variables of the go commands besides the environment
+	tmpDirLock   *os.File          // advisory lock held on the temporary directory
+	copied       int               // number of files copied into the temporary directory
+	// instrumented is set once the project in the temporary directory is instrumented
+	instrumented bool
+	// copyFilter tells the files and directories not to copy into the temporary directory besides skipCopy, nil to copy all
+	copyFilter func(src string, info os.FileInfo) bool
+}
+
+// BuildOptions describes how to do a goc build/install/run
+type BuildOptions struct {
+	// build flags passed to the go command, GOFLAGS in the environment is passed through
+	// to the go command as well, and the flags here take precedence over it
+	BuildFlags string
+	LDFlags    string        // -ldflags passed to the go command, e.g. "-X main.version=v1.0.0"
+	GCFlags    string        // -gcflags passed to the go command
+	Packages   []string      // packages to build
+	WorkingDir string        // the directory where goc is executed
+	OutputDir  string        // the output of go build, generate binary in the working directory if empty
+	BinaryName string        // the name of the binary, named after the main package if empty
+	CoverMode  string        // coverage mode: set, count or atomic, DefaultCoverMode if empty
+	Verbose    bool          // print the commands run by the go command, i.e. go build -x -v
+	Timeout    time.Duration // how long the go command may take except go run, no limit if zero
+	Static     bool          // build a statically linked binary with cgo disabled, e.g. for scratch containers
+	GoBinary   string        // path of the go command to pin a toolchain, e.g. /usr/local/go1.15/bin/go, go in PATH if empty
+	// Parallelism is the number of programs the go command runs in parallel, i.e. go build -p,
+	// the default of the go command if zero. It does not limit goc itself, which copies the
+	// project sequentially while listing the packages with go list in parallel.
+	Parallelism int
+	// NativeCover builds with go build -cover instead of instrumenting the source if the go command
+	// is go1.20 or later, the profiles are written into GOCOVERDIR and no agent is injected
+	NativeCover bool
+	// BuildFlagsSlice is the build flags given as separate arguments, e.g. []string{"-tags", "a b"},
+	// which saves quoting them for the shell. It takes precedence over BuildFlags if not empty.
+	BuildFlagsSlice []string
+
+	Progress ProgressFunc // reports the progress of copying and building, nil to disable
+	// CopyDepsOnly copies only the target packages and the packages of the module they depend on,
+	// including the vendored ones, into the temporary directory instead of the whole module, which
+	// saves much time and disk for a large module. The packages not copied are not instrumented
+	// even with cover.ScopeModule. The whole module is copied if the packages are patterns.
+	CopyDepsOnly bool
+	// Env is the environment variables of the go commands besides the environment of goc,
+	// e.g. the ones in the config file, which take precedence over the environment
+	Env map[string]string
 }
 
+// DefaultCoverMode is the coverage mode used if not specified,
+// services are inherently concurrent so atomic avoids racy counters
+const DefaultCoverMode = "atomic"
+
 // NewBuild creates a Build struct which can build from goc temporary directory,
 // and generate binary in current working directory
 func NewBuild(buildflags string, args []string, workingDir string, outputDir string) (*Build, error) {
-	if err := checkParameters(args, workingDir); err != nil {
-		return nil, err
-	}
-	// buildflags = buildflags + " -o " + outputDir
-	b := &Build{
+	return NewBuildWithOptions(BuildOptions{
 		BuildFlags: buildflags,
-		Packages:   strings.Join(args, " "),
+		Packages:   args,
 		WorkingDir: workingDir,
+		OutputDir:  outputDir,
+	})
+}
+
+// NewBuildWithOptions creates a Build struct which can build from goc temporary directory
+// according to the given options
+func NewBuildWithOptions(opts BuildOptions) (*Build, error) {
+	b, err := newBuild(opts, func(b *Build) error {
+		if false == b.validatePackageForBuild() {
+			log.Errorln(ErrWrongPackageTypeForBuild)
+			return ErrWrongPackageTypeForBuild
+		}
+		// fail before the long copy and build if the binary can not be written
+		return checkOutputWritable(opts.OutputDir, opts.WorkingDir)
+	})
+	if err != nil {
+		return nil, err
 	}
-	if false == b.validatePackageForBuild() {
-		log.Errorln(ErrWrongPackageTypeForBuild)
-		return nil, ErrWrongPackageTypeForBuild
+	dir, err := b.determineOutputDir(opts.OutputDir)
+	b.Target = dir
+	if err != nil {
+		b.Clean()
+		return nil, err
 	}
-	if err := b.MvProjectsToTmp(); err != nil {
+	return b, nil
+}
+
+// newBuild checks the options shared by build and install, creates the Build of them,
+// and moves the project into the temporary directory once validatePkg accepts the packages
+func newBuild(opts BuildOptions, validatePkg func(b *Build) error) (*Build, error) {
+	if err := checkParameters(opts.Packages, opts.WorkingDir); err != nil {
 		return nil, err
 	}
-	dir, err := b.determineOutputDir(outputDir)
-	b.Target = dir
+	mode, err := checkCoverMode(opts.CoverMode)
 	if err != nil {
 		return nil, err
 	}
+	if err := checkGoBinary(opts.GoBinary); err != nil {
+		return nil, err
+	}
+	if opts.Parallelism < 0 {
+		err := fmt.Errorf("%w: %d", ErrInvalidParallelism, opts.Parallelism)
+		log.Errorln(err)
+		return nil, err
+	}
+	b := &Build{
+		BuildFlags:   opts.buildFlags(),
+		LDFlags:      opts.LDFlags,
+		GCFlags:      opts.GCFlags,
+		Packages:     strings.Join(opts.Packages, " "),
+		WorkingDir:   opts.WorkingDir,
+		CoverMode:    mode,
+		Verbose:      opts.Verbose,
+		Timeout:      opts.Timeout,
+		Static:       opts.Static,
+		GoBinary:     opts.GoBinary,
+		Parallelism:  opts.Parallelism,
+		binaryName:   opts.BinaryName,
+		copyDepsOnly: opts.CopyDepsOnly,
+		progress:     opts.Progress,
+		env:          opts.Env,
+	}
+	b.NativeCover = opts.NativeCover && b.useNativeCover()
+	if err := checkOutputFlag(b.BuildFlags); err != nil {
+		return nil, err
+	}
+	if err := checkToolFlags(b.BuildFlags, b.LDFlags != "" || b.Static, b.GCFlags != ""); err != nil {
+		return nil, err
+	}
+	if err := validatePkg(b); err != nil {
+		return nil, err
+	}
+	if err := b.checkStatic(); err != nil {
+		return nil, err
+	}
+	if err := b.MvProjectsToTmp(); err != nil {
+		return nil, err
+	}
 	return b, nil
 }
 
 // Build calls 'go build' tool to do building
 func (b *Build) Build() error {
 	log.Infoln("Go building in temp...")
-	// new -o will overwrite  previous ones
-	b.BuildFlags = b.BuildFlags + " -o " + b.Target
-	cmd := exec.Command("/bin/bash", "-c", "go build "+b.BuildFlags+" "+b.Packages)
+	// new -o will overwrite  previous ones, the flags are not saved back
+	// so that the Build can be built again and used by Run at the same time
+	buildFlags := b.BuildFlags + " -o " + shellQuote(b.Target)
+	cmd := exec.Command("/bin/bash", "-c", b.goBinary()+" build "+buildFlags+b.coverFlags()+b.toolFlags()+" "+b.Packages)
 	cmd.Dir = b.TmpWorkingDir
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-
-	if b.NewGOPATH != "" {
-		// Change to temp GOPATH for go install command
-		cmd.Env = append(os.Environ(), fmt.Sprintf("GOPATH=%v", b.NewGOPATH))
-	}
+	cmd.Env = b.goEnv()
 
 	log.Printf("go build cmd is: %v", cmd.Args)
-	err := cmd.Start()
+	b.reportProgress(StageBuild, 0)
+	defer b.reportProgress(StageBuild, 1)
+	defer b.recordCompile(time.Now())
+	err := b.startCmd(cmd)
 	if err != nil {
 		return fmt.Errorf("fail to execute: %v, err: %w", cmd.Args, err)
 	}
-	if err = cmd.Wait(); err != nil {
+	if err = b.waitCmd(cmd); err != nil {
 		return fmt.Errorf("fail to execute: %v, err: %w", cmd.Args, err)
 	}
 	log.Infoln("Go build exit successful.")
 	return nil
 }
 
+// OutputPath returns the absolute path of the binary generated by Build,
+// so that the tools embedding goc can run or ship it, ErrNotBuilt is returned before it is built
+func (b *Build) OutputPath() (string, error) {
+	if b.Target == "" {
+		return "", ErrNotBuilt
+	}
+	if _, err := os.Stat(b.Target); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrNotBuilt, err)
+	}
+	return b.Target, nil
+}
+
+// checkOutputWritable checks the directory the binary is written into is writable, which is the output
+// if it is a directory, or the nearest existing directory it is in, or the working directory if no output is given
+func checkOutputWritable(outputDir, workingDir string) error {
+	dir := workingDir
+	if outputDir != "" {
+		abs, err := filepath.Abs(outputDir)
+		if err != nil {
+			return fmt.Errorf("Fail to transform the path: %v to absolute path: %v", outputDir, err)
+		}
+		dir = abs
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			dir = filepath.Dir(dir)
+		}
+		// go build creates the missing directories of the output
+		for {
+			if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+	}
+
+	f, err := ioutil.TempFile(dir, ".goc-write-check")
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrOutputNotWritable, err)
+		log.Errorln(err)
+		return err
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return nil
+}
+
 // determineOutputDir, as we only allow . as package name,
-// the binary name is always same as the directory name of current directory
+// the binary name is always same as the directory name of current directory,
+// unless the BinaryName option is given
 func (b *Build) determineOutputDir(outputDir string) (string, error) {
 	if b.TmpDir == "" {
 		return "", fmt.Errorf("can only be called after Build.MvProjectsToTmp(): %w", ErrEmptyTempWorkingDir)
@@ -126,18 +304,21 @@ func (b *Build) determineOutputDir(outputDir string) (string, error) {
 			return "", fmt.Errorf("Fail to transform the path: %v to absolute path: %v", outputDir, err)
 
 		}
+		// the output is a directory, put the named binary into it
+		if fi, err := os.Stat(abs); err == nil && fi.IsDir() && b.binaryName != "" {
+			return filepath.Join(abs, b.binaryName), nil
+		}
 		return abs, nil
 	}
+	if b.binaryName != "" {
+		return filepath.Join(b.WorkingDir, b.binaryName), nil
+	}
 	// fix #43
-	// use target name from `go list -json ./...` of the main module
+	// name the binary after the main package the same way as go build does
 	targetName := ""
 	for _, pkg := range b.Pkgs {
 		if pkg.Name == "main" {
-			if pkg.Target != "" {
-				targetName = filepath.Base(pkg.Target)
-			} else {
-				targetName = filepath.Base(pkg.Dir)
-			}
+			targetName = defaultExecName(pkg.ImportPath, b.IsMod, b.targetGOOS())
 			break
 		}
 	}
@@ -145,6 +326,36 @@ func (b *Build) determineOutputDir(outputDir string) (string, error) {
 	return filepath.Join(b.WorkingDir, targetName), nil
 }
 
+// defaultExecName returns the default binary name of go build for the main package,
+// which is the last element of the import path with the .exe suffix for windows,
+// see DefaultExecName in cmd/go/internal/load
+func defaultExecName(importPath string, isMod bool, goos string) string {
+	_, elem := path.Split(importPath)
+	if isMod {
+		// example.com/mycmd/v2 is named mycmd rather than v2
+		if elem != importPath && isVersionElement(elem) {
+			_, elem = path.Split(path.Dir(importPath))
+		}
+	}
+	if goos == "windows" {
+		elem += ".exe"
+	}
+	return elem
+}
+
+// isVersionElement reports whether s is a major version suffix like v2
+func isVersionElement(s string) bool {
+	if len(s) < 2 || s[0] != 'v' || s[1] == '0' || s[1] == '1' && len(s) == 2 {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		if s[i] < '0' || '9' < s[i] {
+			return false
+		}
+	}
+	return true
+}
+
 // validatePackageForBuild only allow . as package name
 func (b *Build) validatePackageForBuild() bool {
 	if b.Packages == "." || b.Packages == "" {
@@ -153,6 +364,31 @@ func (b *Build) validatePackageForBuild() bool {
 	return false
 }
 
+// checkCoverMode validates the coverage mode, DefaultCoverMode is returned if mode is empty
+func checkCoverMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return DefaultCoverMode, nil
+	case "set", "count", "atomic":
+		return mode, nil
+	}
+	log.Errorf("%v: %v", ErrInvalidCoverMode, mode)
+	return "", fmt.Errorf("%w: %v", ErrInvalidCoverMode, mode)
+}
+
+// checkGoBinary checks the go command given to pin a toolchain is an executable
+func checkGoBinary(goBinary string) error {
+	if goBinary == "" {
+		return nil
+	}
+	if _, err := exec.LookPath(goBinary); err != nil {
+		err = fmt.Errorf("%w: %v", ErrInvalidGoBinary, err)
+		log.Errorln(err)
+		return err
+	}
+	return nil
+}
+
 func checkParameters(args []string, workingDir string) error {
 	if len(args) > 1 {
 		log.Errorln(ErrTooManyArgs)
@@ -19,20 +19,29 @@ package build
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/qiniu/goc/pkg/cover"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestInvalidPackage(t *testing.T) {
-
 	workingDir := filepath.Join(baseDir, "../../tests/samples/simple_project")
-	gopath := ""
-
-	os.Setenv("GOPATH", gopath)
-	os.Setenv("GO111MODULE", "on")
+	defer setModuleEnv()()
 
 	_, err := NewBuild("", []string{"example.com/simple-project"}, workingDir, "")
 	if !assert.Equal(t, err, ErrWrongPackageTypeForBuild) {
@@ -42,16 +51,15 @@ func TestInvalidPackage(t *testing.T) {
 
 func TestBasicBuildForModProject(t *testing.T) {
 	workingDir := filepath.Join(baseDir, "../../tests/samples/simple_project")
-	gopath := ""
+	defer setModuleEnv()()
 
-	os.Setenv("GOPATH", gopath)
-	os.Setenv("GO111MODULE", "on")
 	fmt.Println(workingDir)
 	buildFlags, args, buildOutput := "", []string{"."}, ""
 	gocBuild, err := NewBuild(buildFlags, args, workingDir, buildOutput)
 	if !assert.Equal(t, err, nil) {
 		assert.FailNow(t, "should create temporary directory successfully")
 	}
+	defer gocBuild.Clean()
 
 	err = gocBuild.Build()
 	if !assert.Equal(t, err, nil) {
@@ -59,6 +67,80 @@ func TestBasicBuildForModProject(t *testing.T) {
 	}
 }
 
+func TestBuildForVendoredModProject(t *testing.T) {
+	workingDir := filepath.Join(baseDir, "../../tests/samples/gomod_vendor_project")
+	defer setEnv(map[string]string{"GOFLAGS": ""})()
+
+	outputDir, err := ioutil.TempDir("", "goc-vendor")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	buildOutput := filepath.Join(outputDir, "gomod-vendor-project")
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir, OutputDir: buildOutput})
+	assert.Contains(t, gocBuild.BuildFlags, "-mod=vendor")
+	_, err = os.Stat(filepath.Join(gocBuild.TmpDir, "vendor", "qiniu.com", "foo", "bar.go"))
+	assert.NoError(t, err, "vendor directory should be copied")
+
+	err = gocBuild.Build()
+	assert.NoError(t, err, "vendored project should build successfully")
+	cleanup()
+
+	// explicit -mod flag should be respected, in either form
+	assert.Equal(t, "-mod=mod", addVendorFlag("-mod=mod", workingDir, nil))
+	assert.Equal(t, "-mod mod -trimpath", addVendorFlag("-mod mod -trimpath", workingDir, nil))
+	assert.Equal(t, "-tags=mod -mod=vendor", addVendorFlag("-tags=mod", workingDir, nil))
+	assert.Equal(t, "", addVendorFlag("", workingDir, []string{"GOFLAGS=-mod=mod"}))
+	// the environment of the go command is looked up, e.g. the env of the config file, the last one wins
+	assert.Equal(t, "-mod=vendor", addVendorFlag("", workingDir, []string{"GOFLAGS=-mod=mod", "GOFLAGS=-trimpath"}))
+	assert.Equal(t, "", addVendorFlag("", workingDir, []string{"GO111MODULE=off"}))
+
+	// GOFLAGS of the config file reaches the check
+	gocBuild, cleanup = newTestBuild(t, BuildOptions{WorkingDir: workingDir, OutputDir: buildOutput, Env: map[string]string{"GOFLAGS": "-mod=vendor"}})
+	defer cleanup()
+	assert.NotContains(t, gocBuild.BuildFlags, "-mod=vendor", "-mod is given by GOFLAGS already")
+}
+
+// GOFLAGS in the environment should be passed through to the go command
+func TestBuildWithGOFLAGS(t *testing.T) {
+	workingDir := filepath.Join(baseDir, "../../tests/samples/ldflags_project")
+	defer setEnv(map[string]string{"GOFLAGS": "-mod=mod -ldflags=-X=main.version=goflags"})()
+
+	outputDir, err := ioutil.TempDir("", "goc-goflags")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	buildOutput := filepath.Join(outputDir, "ldflags-project")
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir, OutputDir: buildOutput})
+	defer cleanup()
+
+	assert.NoError(t, gocBuild.Build())
+	out, err := exec.Command(buildOutput).Output()
+	assert.NoError(t, err)
+	assert.Equal(t, "version: goflags\n", string(out))
+}
+
+// the version injected by -ldflags -X should survive the instrumentation
+func TestBuildWithLDFlags(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "goc-ldflags")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	buildOutput := filepath.Join(outputDir, "ldflags-project")
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{
+		BuildFlags: "-trimpath",
+		LDFlags:    `-X "main.version=v1.0.0 (it's quoted)"`,
+		WorkingDir: filepath.Join(baseDir, "../../tests/samples/ldflags_project"),
+		OutputDir:  buildOutput,
+	})
+	defer cleanup()
+
+	err = gocBuild.Build()
+	if !assert.NoError(t, err) {
+		assert.FailNow(t, "temporary directory should build successfully")
+	}
+
+	out, err := exec.Command(buildOutput).Output()
+	assert.NoError(t, err)
+	assert.Equal(t, "version: v1.0.0 (it's quoted)\n", string(out))
+}
+
 func TestCheckParameters(t *testing.T) {
 	err := checkParameters([]string{"aa", "bb"}, "aa")
 	assert.Equal(t, err, ErrTooManyArgs, "too many arguments should failed")
@@ -75,14 +157,103 @@ func TestDetermineOutputDir(t *testing.T) {
 	b.TmpDir = "fake"
 	_, err = b.determineOutputDir("xx")
 	assert.Equal(t, err, nil, "should return a directory")
+
+	// explicit binary name takes precedence over the directory name
+	b.WorkingDir = "/path/to/simple_project"
+	b.binaryName = "myapp"
+	dir, err := b.determineOutputDir("")
+	assert.NoError(t, err)
+	assert.Equal(t, "/path/to/simple_project/myapp", dir)
+
+	// and respects the output directory
+	outputDir, err := ioutil.TempDir("", "goc-output")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	dir, err = b.determineOutputDir(outputDir)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "myapp"), dir)
+
+	// output file is used as is
+	dir, err = b.determineOutputDir(filepath.Join(outputDir, "other"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "other"), dir)
+
+	// the binary named after the main package has the .exe suffix when built for windows
+	b.binaryName = ""
+	b.IsMod = true
+	b.Pkgs = map[string]*cover.Package{"example.com/my_app": {Name: "main", ImportPath: "example.com/my_app"}}
+	defer setEnv(map[string]string{"GOOS": ""})()
+	b.env = map[string]string{"GOOS": "windows"}
+	dir, err = b.determineOutputDir("")
+	assert.NoError(t, err)
+	assert.Equal(t, "/path/to/simple_project/my_app.exe", dir)
+
+	b.env = nil
+	defer setEnv(map[string]string{"GOOS": "windows"})()
+	dir, err = b.determineOutputDir("")
+	assert.NoError(t, err)
+	assert.Equal(t, "/path/to/simple_project/my_app.exe", dir)
+}
+
+// GOOS given by the Env option only, e.g. in the config file, names the binary for the target too
+func TestTargetGOOSFromEnvOption(t *testing.T) {
+	workingDir := filepath.Join(baseDir, "../../tests/samples/simple_project")
+	defer setModuleEnv()()
+	defer setEnv(map[string]string{"GOOS": ""})()
+
+	b, err := NewBuildWithOptions(BuildOptions{Packages: []string{"."}, WorkingDir: workingDir, Env: map[string]string{"GOOS": "windows"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer b.Clean()
+	assert.Equal(t, "windows", b.targetGOOS())
+	assert.Equal(t, filepath.Join(workingDir, "simple-project.exe"), b.Target)
+}
+
+// the default binary name should be the same as the one go build generates
+func TestDefaultExecName(t *testing.T) {
+	var tcs = []struct {
+		importPath string
+		isMod      bool
+		goos       string
+		expected   string
+	}{
+		{importPath: "example.com/my_app", isMod: true, expected: "my_app"},
+		{importPath: "example.com/my_app/v2", isMod: true, goos: "windows", expected: "my_app.exe"},
+		{importPath: "example.com/my_app/cmd/my_server", isMod: true, expected: "my_server"},
+		{importPath: "example.com/my_app/v2", isMod: true, expected: "my_app"},
+		{importPath: "example.com/my_app/v1", isMod: true, expected: "v1"},
+		{importPath: "my_app", isMod: true, expected: "my_app"},
+		{importPath: "qiniu.com/my_app/v2", isMod: false, expected: "v2"},
+		{importPath: "_/path/to/my_app", isMod: false, expected: "my_app"},
+	}
+
+	for _, tc := range tcs {
+		assert.Equal(t, tc.expected, defaultExecName(tc.importPath, tc.isMod, tc.goos), tc.importPath)
+	}
+
+	// check the parity with go build for module paths containing underscores
+	for _, modPath := range []string{"example.com/my_app", "example.com/my_app/v2"} {
+		dir, err := ioutil.TempDir("", "goc-exec-name")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+		ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module "+modPath+"\n"), 0644)
+		ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644)
+
+		cmd := exec.Command("go", "build", ".")
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GO111MODULE=on")
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+		_, err = os.Stat(filepath.Join(dir, defaultExecName(modPath, true, runtime.GOOS)))
+		assert.NoError(t, err, "go build should generate the binary with the same name for %v", modPath)
+	}
 }
 
 func TestInvalidPackageNameForBuild(t *testing.T) {
 	workingDir := filepath.Join(baseDir, "../../tests/samples/simple_project")
 	gopath := filepath.Join(baseDir, "../../tests/samples/simple_project", "testhome")
-
-	os.Setenv("GOPATH", gopath)
-	os.Setenv("GO111MODULE", "on")
+	defer setEnv(map[string]string{"GOPATH": gopath, "GO111MODULE": "on"})()
 
 	buildFlags, packages := "", []string{"main.go"}
 	_, err := NewBuild(buildFlags, packages, workingDir, "")
@@ -99,3 +270,907 @@ func TestNewBuildWithWrongParameters(t *testing.T) {
 	_, err = NewBuild("", []string{"a.go"}, "", "cur")
 	assert.Equal(t, err, ErrInvalidWorkingDir)
 }
+
+func TestBuildWithCoverMode(t *testing.T) {
+	workingDir := filepath.Join(baseDir, "../../tests/samples/simple_project")
+	defer setModuleEnv()()
+
+	_, err := NewBuildWithOptions(BuildOptions{Packages: []string{"."}, WorkingDir: workingDir, CoverMode: "xxx"})
+	assert.True(t, errors.Is(err, ErrInvalidCoverMode), "mode should be validated")
+
+	outputDir, err := ioutil.TempDir("", "goc-mode")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	var tcs = []struct {
+		mode     string
+		expected string
+		counter  string // the counter statement in the instrumented main.go
+	}{
+		{mode: "", expected: DefaultCoverMode, counter: "_cover_atomic_.AddUint32(&"},
+		{mode: "set", expected: "set", counter: ".Count[0] = 1"},
+		{mode: "count", expected: "count", counter: ".Count[0]++"},
+		{mode: "atomic", expected: "atomic", counter: "_cover_atomic_.AddUint32(&"},
+	}
+	for _, tc := range tcs {
+		gocBuild, cleanup := newTestBuild(t, BuildOptions{
+			OutputDir: filepath.Join(outputDir, "simple-project"),
+			CoverMode: tc.mode,
+		})
+		assert.Equal(t, tc.expected, gocBuild.CoverMode)
+
+		err = cover.Execute(&cover.CoverInfo{
+			Target:                   gocBuild.TmpDir,
+			GoPath:                   gocBuild.NewGOPATH,
+			IsMod:                    gocBuild.IsMod,
+			ModRootPath:              gocBuild.ModRootPath,
+			GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+			Mode:                     gocBuild.CoverMode,
+			Center:                   "http://127.0.0.1:7777",
+			OneMainPackage:           true,
+		})
+		assert.NoError(t, err, "mode %s", tc.mode)
+
+		src, err := ioutil.ReadFile(filepath.Join(gocBuild.TmpWorkingDir, "main.go"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(src), tc.counter, "mode %s", tc.mode)
+		assert.NoError(t, gocBuild.Build(), "the counters of mode %s should compile", tc.mode)
+		cleanup()
+	}
+}
+
+func TestToolFlags(t *testing.T) {
+	var tcs = []struct {
+		build    Build
+		expected string
+	}{
+		{build: Build{}, expected: ""},
+		{build: Build{Verbose: true}, expected: " -x -v"},
+		{build: Build{LDFlags: "-X 'main.version=v1'", Verbose: true}, expected: ` -x -v -ldflags='-X '\''main.version=v1'\'''`},
+		{build: Build{GCFlags: "all=-N -l"}, expected: " -gcflags='all=-N -l'"},
+		{build: Build{Parallelism: 2, Verbose: true}, expected: " -x -v -p 2"},
+	}
+	for _, tc := range tcs {
+		assert.Equal(t, tc.expected, tc.build.toolFlags())
+	}
+}
+
+func TestJoinArgs(t *testing.T) {
+	assert.Equal(t, "", joinArgs(nil))
+	assert.Equal(t, "-trimpath -mod=vendor -tags=a,b", joinArgs([]string{"-trimpath", "-mod=vendor", "-tags=a,b"}))
+	assert.Equal(t, `-tags 'a b' '-ldflags=-X '\''main.v=1'\''' ''`, joinArgs([]string{"-tags", "a b", "-ldflags=-X 'main.v=1'", ""}))
+	assert.Equal(t, "'$(rm -rf /)'", joinArgs([]string{"$(rm -rf /)"}))
+}
+
+// files importing "C" are left uninstrumented, while the other files still get counters
+func TestBuildCgoProject(t *testing.T) {
+	if _, err := exec.LookPath("gcc"); err != nil {
+		t.Skip("gcc is not installed")
+	}
+	defer setEnv(map[string]string{"CGO_ENABLED": "1"})()
+
+	outputDir, err := ioutil.TempDir("", "goc-cgo")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	buildOutput := filepath.Join(outputDir, "cgo-project")
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: filepath.Join(baseDir, "../../tests/samples/cgo_project"), OutputDir: buildOutput})
+	defer cleanup()
+
+	err = cover.Execute(&cover.CoverInfo{
+		Target:                   gocBuild.TmpDir,
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		Mode:                     gocBuild.CoverMode,
+		Center:                   "http://127.0.0.1:7777",
+		OneMainPackage:           true,
+	})
+	assert.NoError(t, err)
+
+	apis, err := ioutil.ReadFile(filepath.Join(gocBuild.TmpWorkingDir, "http_cover_apis_auto_generated.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(apis), "example.com/cgo-project/calc/double.go")
+	assert.NotContains(t, string(apis), "example.com/cgo-project/calc/add.go")
+
+	assert.NoError(t, gocBuild.Build(), "cgo project should build successfully")
+	out, err := exec.Command(buildOutput).Output()
+	assert.NoError(t, err)
+	assert.Equal(t, "3 6\n", string(out))
+}
+
+// a hung go command should be killed with its children when the timeout expires
+func TestBuildTimeout(t *testing.T) {
+	if _, err := os.Stat("/proc/self"); err != nil {
+		t.Skip("the killed process is checked through procfs")
+	}
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{Timeout: time.Second})
+	defer cleanup()
+
+	// a fake go hangs with a child process
+	pidFile := filepath.Join(os.TempDir(), fmt.Sprintf("goc-timeout-%d.pid", os.Getpid()))
+	defer os.Remove(pidFile)
+	goBinary, removeGo := fakeGo(t, fmt.Sprintf("sleep 60 &\necho $! > %s\nwait\n", pidFile))
+	defer removeGo()
+	defer setEnv(map[string]string{"PATH": filepath.Dir(goBinary) + string(os.PathListSeparator) + os.Getenv("PATH")})()
+
+	start := time.Now()
+	err := gocBuild.Build()
+	assert.True(t, errors.Is(err, ErrTimeout), "should time out, got %v", err)
+	assert.True(t, time.Since(start) < 30*time.Second, "should not wait for the hung command")
+
+	pid, err := ioutil.ReadFile(pidFile)
+	assert.NoError(t, err)
+	// the killed child is gone, or a zombie not reaped yet, the signal is delivered asynchronously
+	statFile := filepath.Join("/proc", strings.TrimSpace(string(pid)), "stat")
+	state := ""
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		stat, err := ioutil.ReadFile(statFile)
+		if err != nil {
+			return
+		}
+		if state = strings.Fields(string(stat))[2]; state == "Z" {
+			return
+		}
+	}
+	assert.Fail(t, "the child of the go command should be killed", "state: %s", state)
+}
+
+// building from a sub directory instruments the whole module with the module scope
+func TestBuildFromSubDirWithModuleScope(t *testing.T) {
+	workingDir := filepath.Join(baseDir, "../../tests/samples/nested_main_project/cmd/server")
+
+	outputDir, err := ioutil.TempDir("", "goc-scope")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	for _, scope := range []string{cover.ScopeDeps, cover.ScopeModule} {
+		buildOutput := filepath.Join(outputDir, "server")
+		gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir, OutputDir: buildOutput})
+
+		err = cover.Execute(&cover.CoverInfo{
+			Target:                   gocBuild.TmpDir,
+			IsMod:                    gocBuild.IsMod,
+			ModRootPath:              gocBuild.ModRootPath,
+			GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+			Mode:                     gocBuild.CoverMode,
+			Center:                   "http://127.0.0.1:7777",
+			OneMainPackage:           true,
+			InstrumentScope:          scope,
+		})
+		assert.NoError(t, err)
+
+		apis, err := ioutil.ReadFile(filepath.Join(gocBuild.TmpWorkingDir, "http_cover_apis_auto_generated.go"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(apis), "example.com/nested-main-project/pkg/used/used.go")
+		assert.Equal(t, scope == cover.ScopeModule, strings.Contains(string(apis), "example.com/nested-main-project/pkg/unused/unused.go"),
+			"packages not imported should only be instrumented in the module scope")
+
+		assert.NoError(t, gocBuild.Build(), "the main package in the sub directory should build successfully")
+		out, err := exec.Command(buildOutput).Output()
+		assert.NoError(t, err)
+		assert.Equal(t, "hello\n", string(out))
+		cleanup()
+	}
+}
+
+func TestBuildStats(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "goc-stats")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{OutputDir: filepath.Join(outputDir, "simple-project")})
+	defer cleanup()
+	assert.True(t, gocBuild.Stats.Copy > 0, "the copy phase should be measured")
+	assert.Zero(t, gocBuild.Stats.Instrument)
+	assert.Zero(t, gocBuild.Stats.Compile)
+
+	err = gocBuild.Instrument(&cover.CoverInfo{
+		Target:                   gocBuild.TmpDir,
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		Mode:                     gocBuild.CoverMode,
+		Center:                   "http://127.0.0.1:7777",
+		OneMainPackage:           true,
+	})
+	assert.NoError(t, err)
+	assert.True(t, gocBuild.Stats.Instrument > 0, "the instrument phase should be measured")
+
+	assert.NoError(t, gocBuild.Build())
+	assert.True(t, gocBuild.Stats.Compile > 0, "the compile phase should be measured")
+	assert.Equal(t, gocBuild.Stats.Copy+gocBuild.Stats.Instrument+gocBuild.Stats.Compile, gocBuild.Stats.Total())
+}
+
+func TestBuildStatsString(t *testing.T) {
+	stats := BuildStats{Copy: 1500 * time.Millisecond, Instrument: 200 * time.Millisecond, Compile: 3*time.Second + 100*time.Microsecond}
+	assert.Equal(t, "copy: 1.5s, instrument: 200ms, compile: 3s, total: 4.7s", stats.String())
+}
+
+// the code injected into the main package does not clash with the names the service declares
+func TestInjectedNamesInMainPackage(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "goc-names-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "go.mod"), []byte("module example.com/names\n\ngo 1.13\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "main.go"),
+		[]byte("package main\n\nfunc main() { println(contains([]string{\"a\"}, \"a\")) }\n"), 0644))
+	// the names are common enough to be declared by the service itself
+	var names strings.Builder
+	names.WriteString("package main\n\n")
+	names.WriteString("func contains(arr []string, str string) bool { return len(arr) > 0 && arr[0] == str }\n\n")
+	for _, name := range []string{"pushTimeout", "dumpProfile", "pushLoop", "sendProfile", "advertise", "advertisedIP",
+		"listenAddress", "boundHost", "pushInterval", "flushOnExit", "flushSelf", "registerTimeout", "registerWithRetry",
+		"registerStatusError"} {
+		fmt.Fprintf(&names, "var %s = %q\n", name, name)
+	}
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "names.go"), []byte(names.String()), 0644))
+	outputDir, err := ioutil.TempDir("", "goc-names")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	binary := filepath.Join(outputDir, "names")
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir, OutputDir: binary})
+	defer cleanup()
+	assert.NoError(t, gocBuild.Instrument(&cover.CoverInfo{
+		Target:                   gocBuild.TmpDir,
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		Mode:                     gocBuild.CoverMode,
+		Center:                   "http://127.0.0.1:7777",
+		OneMainPackage:           true,
+	}))
+	assert.NoError(t, gocBuild.Build(), "the service should build along with the injected code")
+	assert.FileExists(t, binary)
+}
+
+// the center and the agent name are compiled into the service, and can be replaced by -ldflags -X
+func TestRegisterCenterBakedIn(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "goc-center-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "go.mod"), []byte("module example.com/center\n\ngo 1.13\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "main.go"),
+		[]byte("package main\n\nimport \"time\"\n\nfunc main() { time.Sleep(time.Minute) }\n"), 0644))
+	outputDir, err := ioutil.TempDir("", "goc-center")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	// fake centers record the registered services
+	newCenter := func() (*httptest.Server, chan string) {
+		registered := make(chan string, 10)
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			registered <- r.URL.Path + "?name=" + r.URL.Query().Get("name")
+			w.Write([]byte(`{"result":"success"}`))
+		})), registered
+	}
+	baked, bakedRegistered := newCenter()
+	defer baked.Close()
+	linked, linkedRegistered := newCenter()
+	defer linked.Close()
+
+	var tcs = []struct {
+		ldflags    string
+		agentName  string
+		env        string
+		registered chan string
+		expected   string
+	}{
+		{registered: bakedRegistered, expected: "center"},
+		{ldflags: "-X main.gocRegisterCenter=" + linked.URL, registered: linkedRegistered, expected: "center"},
+		{agentName: "payment canary-1", registered: bakedRegistered, expected: "payment canary-1"},
+		{agentName: "payment canary-1", env: "GOC_AGENT_NAME=payment canary-2", registered: bakedRegistered, expected: "payment canary-2"},
+	}
+	for _, tc := range tcs {
+		binary := filepath.Join(outputDir, "center")
+		gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir, OutputDir: binary, LDFlags: tc.ldflags})
+		ci := &cover.CoverInfo{
+			Target:                   gocBuild.TmpDir,
+			IsMod:                    gocBuild.IsMod,
+			ModRootPath:              gocBuild.ModRootPath,
+			GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+			Mode:                     gocBuild.CoverMode,
+			Center:                   "ftp://127.0.0.1:7777",
+			AgentName:                tc.agentName,
+			OneMainPackage:           true,
+		}
+		err := gocBuild.Instrument(ci)
+		assert.Error(t, err, "the center should be validated at build time")
+		assert.Contains(t, err.Error(), "invalid center")
+
+		ci.Center = baked.URL + "/"
+		assert.NoError(t, gocBuild.Instrument(ci))
+		assert.NoError(t, gocBuild.Build())
+		cleanup()
+
+		cmd := exec.Command(binary)
+		if tc.env != "" {
+			cmd.Env = append(os.Environ(), tc.env)
+		}
+		assert.NoError(t, cmd.Start())
+		select {
+		case r := <-tc.registered:
+			assert.Equal(t, "/v1/cover/register?name="+tc.expected, r, "the service should register into the center %q", tc.ldflags)
+		case <-time.After(30 * time.Second):
+			assert.Fail(t, "the service does not register into the center", tc.ldflags)
+		}
+		cmd.Process.Kill()
+		cmd.Wait()
+	}
+	assert.Empty(t, bakedRegistered, "the center replaced at link time should be used")
+	assert.Empty(t, linkedRegistered)
+}
+
+func TestOutputPath(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "goc-output")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{OutputDir: filepath.Join(outputDir, "hello")})
+	defer cleanup()
+
+	_, err = gocBuild.OutputPath()
+	assert.True(t, errors.Is(err, ErrNotBuilt), "should not return the path before built")
+
+	assert.NoError(t, gocBuild.Build())
+	path, err := gocBuild.OutputPath()
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "hello"), path)
+	fi, err := os.Stat(path)
+	if assert.NoError(t, err) {
+		assert.NotZero(t, fi.Mode()&0111, "the binary should be executable")
+	}
+	out, err := exec.Command(path).Output()
+	assert.NoError(t, err)
+	assert.Equal(t, "hello, world.\n", string(out))
+}
+
+func TestOutputNotWritable(t *testing.T) {
+	workingDir := filepath.Join(baseDir, "../../tests/samples/simple_project")
+	defer setModuleEnv()()
+
+	dir, err := ioutil.TempDir("", "goc-readonly")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "file")
+	assert.NoError(t, ioutil.WriteFile(file, nil, 0644))
+
+	outputs := []string{filepath.Join(file, "bin")}
+	if os.Geteuid() != 0 {
+		readonly := filepath.Join(dir, "readonly")
+		assert.NoError(t, os.Mkdir(readonly, 0555))
+		outputs = append(outputs, readonly, filepath.Join(readonly, "sub", "bin"))
+	}
+	for _, output := range outputs {
+		_, err := NewBuildWithOptions(BuildOptions{Packages: []string{"."}, WorkingDir: workingDir, OutputDir: output})
+		assert.True(t, errors.Is(err, ErrOutputNotWritable), "%v: %v", output, err)
+	}
+
+	// the missing directories are created by go build
+	assert.NoError(t, checkOutputWritable(filepath.Join(dir, "a", "b", "bin"), workingDir))
+	assert.NoError(t, checkOutputWritable("", workingDir))
+	files, err := filepath.Glob(filepath.Join(dir, ".goc-write-check*"))
+	assert.NoError(t, err)
+	assert.Empty(t, files, "the files to check should be removed")
+}
+
+func TestBuildParallelism(t *testing.T) {
+	workingDir := filepath.Join(baseDir, "../../tests/samples/simple_project")
+	restore := setModuleEnv()
+	_, err := NewBuildWithOptions(BuildOptions{Packages: []string{"."}, WorkingDir: workingDir, Parallelism: -1})
+	assert.True(t, errors.Is(err, ErrInvalidParallelism), "%v", err)
+	_, err = NewInstallWithOptions(BuildOptions{Packages: []string{"."}, WorkingDir: workingDir, Parallelism: -1})
+	assert.True(t, errors.Is(err, ErrInvalidParallelism), "%v", err)
+	restore()
+
+	// a fake go records its arguments
+	fakeDir, err := ioutil.TempDir("", "goc-fake-go")
+	assert.NoError(t, err)
+	defer os.RemoveAll(fakeDir)
+	argsFile := filepath.Join(fakeDir, "args")
+	goBinary := filepath.Join(fakeDir, "go")
+	assert.NoError(t, ioutil.WriteFile(goBinary, []byte(fmt.Sprintf("#!/bin/sh\necho \"$@\" > '%s'\n", argsFile)), 0755))
+
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{GoBinary: goBinary, Parallelism: 2})
+	defer cleanup()
+	assert.NoError(t, gocBuild.Build())
+	args, err := ioutil.ReadFile(argsFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(args), " -p 2 ")
+}
+
+// the build flags given as a slice make the same go command as the string ones quoted by hand
+func TestBuildFlagsSlice(t *testing.T) {
+	// a fake go records its arguments one per line
+	fakeDir, err := ioutil.TempDir("", "goc-fake-go")
+	assert.NoError(t, err)
+	defer os.RemoveAll(fakeDir)
+	argsFile := filepath.Join(fakeDir, "args")
+	goBinary := filepath.Join(fakeDir, "go")
+	assert.NoError(t, ioutil.WriteFile(goBinary, []byte(fmt.Sprintf("#!/bin/sh\nprintf '%%s\\n' \"$@\" > '%s'\n", argsFile)), 0755))
+
+	buildArgs := func(opts BuildOptions) string {
+		opts.GoBinary = goBinary
+		gocBuild, cleanup := newTestBuild(t, opts)
+		defer cleanup()
+		assert.NoError(t, gocBuild.Build())
+		args, err := ioutil.ReadFile(argsFile)
+		assert.NoError(t, err)
+		return string(args)
+	}
+
+	fromString := buildArgs(BuildOptions{BuildFlags: "-gcflags='all=-N -l' -trimpath"})
+	fromSlice := buildArgs(BuildOptions{BuildFlagsSlice: []string{"-gcflags=all=-N -l", "-trimpath"}})
+	assert.Equal(t, fromString, fromSlice)
+	assert.Contains(t, fromSlice, "\n-gcflags=all=-N -l\n-trimpath\n")
+
+	// the slice takes precedence over the string
+	both := buildArgs(BuildOptions{BuildFlags: "-a", BuildFlagsSlice: []string{"-gcflags=all=-N -l", "-trimpath"}})
+	assert.Equal(t, fromSlice, both)
+}
+
+func TestSplitWords(t *testing.T) {
+	var tcs = []struct {
+		line     string
+		expected []string
+	}{
+		{line: "", expected: nil},
+		{line: "  -trimpath \t -mod=vendor\n", expected: []string{"-trimpath", "-mod=vendor"}},
+		{line: `-ldflags '-X main.v=1' -tags="a b"`, expected: []string{"-ldflags", "-X main.v=1", "-tags=a b"}},
+		{line: `-gcflags=all=-N\ -l ''`, expected: []string{"-gcflags=all=-N -l", ""}},
+		{line: `"it's" 'say "hi"' "a\"b"`, expected: []string{"it's", `say "hi"`, `a"b`}},
+	}
+	for _, tc := range tcs {
+		assert.Equal(t, tc.expected, splitWords(tc.line), tc.line)
+	}
+}
+
+// the binary is written into the output goc manages, -o in the build flags is rejected
+func TestOutputInBuildFlags(t *testing.T) {
+	for _, flags := range []string{"-o app", "-trimpath -o=app", "--o ./bin/app", "-a --o=app"} {
+		assert.True(t, errors.Is(checkOutputFlag(flags), ErrOutputInBuildFlags), flags)
+	}
+	for _, flags := range []string{"", "-ldflags '-o app'", "-overlay=overlay.json", "-mod=mod -tags=o"} {
+		assert.NoError(t, checkOutputFlag(flags), flags)
+	}
+
+	workingDir := filepath.Join(baseDir, "../../tests/samples/simple_project")
+	defer setModuleEnv()()
+	_, err := NewBuildWithOptions(BuildOptions{BuildFlags: "-trimpath -o ./bin/app", Packages: []string{"."}, WorkingDir: workingDir})
+	assert.True(t, errors.Is(err, ErrOutputInBuildFlags), "%v", err)
+	_, err = NewBuildWithOptions(BuildOptions{BuildFlagsSlice: []string{"-o", "./bin/app"}, Packages: []string{"."}, WorkingDir: workingDir})
+	assert.True(t, errors.Is(err, ErrOutputInBuildFlags), "%v", err)
+}
+
+// -ldflags and -gcflags in the build flags are rejected if the options give them too,
+// otherwise the ones of the options would override them silently
+func TestToolFlagsInBuildFlags(t *testing.T) {
+	assert.True(t, errors.Is(checkToolFlags("-ldflags '-s'", true, false), ErrToolFlagsInBuildFlags))
+	assert.True(t, errors.Is(checkToolFlags("-a --gcflags=all=-N", false, true), ErrToolFlagsInBuildFlags))
+	assert.NoError(t, checkToolFlags("-ldflags '-s'", false, true))
+	assert.NoError(t, checkToolFlags("-gcflags=all=-N -tags=ldflags", true, false))
+
+	workingDir := filepath.Join(baseDir, "../../tests/samples/simple_project")
+	defer setModuleEnv()()
+	_, err := NewBuildWithOptions(BuildOptions{BuildFlags: "-ldflags '-s'", LDFlags: "-X main.version=v1", Packages: []string{"."}, WorkingDir: workingDir})
+	assert.True(t, errors.Is(err, ErrToolFlagsInBuildFlags), "%v", err)
+	// the -ldflags of a static build are given by goc
+	_, err = NewBuildWithOptions(BuildOptions{BuildFlagsSlice: []string{"-ldflags", "-s"}, Static: true, Packages: []string{"."}, WorkingDir: workingDir})
+	assert.True(t, errors.Is(err, ErrToolFlagsInBuildFlags), "%v", err)
+}
+
+// the service started before the center retries registering until the center is up
+func TestRegisterRetry(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "goc-retry-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "go.mod"), []byte("module example.com/retry\n\ngo 1.13\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "main.go"),
+		[]byte("package main\n\nimport \"time\"\n\nfunc main() { time.Sleep(time.Minute) }\n"), 0644))
+	outputDir, err := ioutil.TempDir("", "goc-retry")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	// reserve a port for the center, which is not up yet
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+	ln.Close()
+
+	binary := filepath.Join(outputDir, "retry")
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir, OutputDir: binary})
+	ci := &cover.CoverInfo{
+		Target:                   gocBuild.TmpDir,
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		Mode:                     gocBuild.CoverMode,
+		Center:                   "http://" + addr,
+		OneMainPackage:           true,
+		RegisterTimeout:          -time.Second,
+	}
+	assert.Error(t, gocBuild.Instrument(ci), "the negative timeout should be rejected")
+	ci.RegisterTimeout = 30 * time.Second
+	assert.NoError(t, gocBuild.Instrument(ci))
+	assert.NoError(t, gocBuild.Build())
+	cleanup()
+
+	// no retry if the timeout is overridden by zero, the service exits as the center is down
+	cmd := exec.Command(binary)
+	cmd.Env = append(os.Environ(), "GOC_REGISTER_TIMEOUT=0s")
+	assert.Error(t, cmd.Run())
+
+	cmd = exec.Command(binary)
+	assert.NoError(t, cmd.Start())
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	time.Sleep(time.Second)
+
+	// the center is up late, and unavailable at first
+	var requests int32
+	registered := make(chan struct{})
+	center := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"result":"success"}`))
+		close(registered)
+	}))
+	center.Listener, err = net.Listen("tcp", addr)
+	if !assert.NoError(t, err) {
+		return
+	}
+	center.Start()
+	defer center.Close()
+
+	select {
+	case <-registered:
+		assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	case <-time.After(30 * time.Second):
+		assert.Fail(t, "the service does not register into the center")
+	}
+}
+
+func TestAgentHost(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "goc-host-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "go.mod"), []byte("module example.com/host\n\ngo 1.13\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "main.go"),
+		[]byte("package main\n\nimport \"time\"\n\nfunc main() { time.Sleep(time.Minute) }\n"), 0644))
+	outputDir, err := ioutil.TempDir("", "goc-host")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	addresses := make(chan string, 1)
+	center := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/cover/register" {
+			assert.Equal(t, "true", r.URL.Query().Get("advertised"))
+			addresses <- r.URL.Query().Get("address")
+		}
+		w.Write([]byte(`{"result":"success"}`))
+	}))
+	defer center.Close()
+
+	binary := filepath.Join(outputDir, "host")
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir, OutputDir: binary})
+	ci := &cover.CoverInfo{
+		Target:                   gocBuild.TmpDir,
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		Mode:                     gocBuild.CoverMode,
+		Center:                   center.URL,
+		OneMainPackage:           true,
+		AgentHost:                "203.0.113.7",
+	}
+	assert.NoError(t, gocBuild.Instrument(ci))
+	assert.NoError(t, gocBuild.Build())
+	cleanup()
+
+	run := func(env []string, prefix string) {
+		cmd := exec.Command(binary)
+		cmd.Env = append(os.Environ(), env...)
+		assert.NoError(t, cmd.Start())
+		defer func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}()
+		select {
+		case address := <-addresses:
+			assert.True(t, strings.HasPrefix(address, prefix), "unexpected address %s", address)
+		case <-time.After(30 * time.Second):
+			assert.Fail(t, "the service does not register into the center")
+		}
+	}
+
+	// the IP given at build time is advertised
+	run(nil, "http://203.0.113.7:")
+	// the network interface given by the environment variable takes precedence
+	run([]string{"GOC_AGENT_HOST=lo"}, "http://127.0.0.1:")
+}
+
+func TestAgentListen(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "goc-listen-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "go.mod"), []byte("module example.com/listen\n\ngo 1.13\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "main.go"),
+		[]byte("package main\n\nimport \"time\"\n\nfunc main() { time.Sleep(time.Minute) }\n"), 0644))
+	outputDir, err := ioutil.TempDir("", "goc-listen")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	addresses := make(chan string, 10)
+	center := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/cover/register" {
+			addresses <- r.URL.Query().Get("address")
+		}
+		w.Write([]byte(`{"result":"success"}`))
+	}))
+	defer center.Close()
+
+	binary := filepath.Join(outputDir, "listen")
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir, OutputDir: binary})
+	ci := &cover.CoverInfo{
+		Target:                   gocBuild.TmpDir,
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		Mode:                     gocBuild.CoverMode,
+		Center:                   center.URL,
+		OneMainPackage:           true,
+		AgentPort:                "127.0.0.1:0",
+	}
+	assert.NoError(t, gocBuild.Instrument(ci))
+	assert.NoError(t, gocBuild.Build())
+	cleanup()
+
+	// start returns the address the service registers with, the services are killed at the end of the test
+	var services []*exec.Cmd
+	defer func() {
+		for _, cmd := range services {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}
+	}()
+	start := func(env ...string) string {
+		cmd := exec.Command(binary)
+		cmd.Env = append(os.Environ(), env...)
+		assert.NoError(t, cmd.Start())
+		services = append(services, cmd)
+		select {
+		case address := <-addresses:
+			return address
+		case <-time.After(30 * time.Second):
+			assert.Fail(t, "the service does not register into the center")
+			return ""
+		}
+	}
+	// port returns the registered port, which the service serves the coverage on
+	port := func(address string) string {
+		u, err := url.Parse(address)
+		assert.NoError(t, err)
+		resp, err := http.Get(address + "/v1/cover/profile")
+		if assert.NoError(t, err, "the registered address should be the bound one") {
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+		}
+		return u.Port()
+	}
+
+	// the services built with :0 on the same host get their own ports
+	first, second := start(), start()
+	assert.True(t, strings.HasPrefix(first, "http://127.0.0.1:"), "unexpected address %s", first)
+	assert.True(t, strings.HasPrefix(second, "http://127.0.0.1:"), "unexpected address %s", second)
+	assert.NotEqual(t, "0", port(first))
+	assert.NotEqual(t, port(first), port(second))
+
+	// the address given by the environment variable takes precedence
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	assert.NoError(t, err)
+	free := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+	ln.Close()
+	assert.Equal(t, "http://127.0.0.1:"+free, start("GOC_AGENT_LISTEN=127.0.0.1:"+free))
+}
+
+func TestFlushOnExit(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "goc-flush-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "go.mod"), []byte("module example.com/flush\n\ngo 1.13\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "main.go"),
+		[]byte("package main\n\nimport \"time\"\n\nfunc main() { time.Sleep(time.Minute) }\n"), 0644))
+	outputDir, err := ioutil.TempDir("", "goc-flush")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	paths := make(chan string, 10)
+	profiles := make(chan string, 10)
+	center := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths <- r.URL.Path
+		if r.URL.Path == "/v1/cover/flush" {
+			body, _ := ioutil.ReadAll(r.Body)
+			profiles <- string(body)
+		}
+		w.Write([]byte(`{"result":"success"}`))
+	}))
+	defer center.Close()
+
+	build := func(noFlush bool) string {
+		binary := filepath.Join(outputDir, fmt.Sprintf("flush-%v", noFlush))
+		gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir, OutputDir: binary})
+		ci := &cover.CoverInfo{
+			Target:                   gocBuild.TmpDir,
+			IsMod:                    gocBuild.IsMod,
+			ModRootPath:              gocBuild.ModRootPath,
+			GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+			Mode:                     gocBuild.CoverMode,
+			Center:                   center.URL,
+			OneMainPackage:           true,
+			NoFlushOnExit:            noFlush,
+		}
+		assert.NoError(t, gocBuild.Instrument(ci))
+		assert.NoError(t, gocBuild.Build())
+		cleanup()
+		return binary
+	}
+	// terminate returns the paths the service requests from the registration to the exit
+	terminate := func(binary string, env ...string) []string {
+		cmd := exec.Command(binary)
+		cmd.Env = append(os.Environ(), env...)
+		assert.NoError(t, cmd.Start())
+		defer func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}()
+		select {
+		case path := <-paths:
+			assert.Equal(t, "/v1/cover/register", path)
+		case <-time.After(30 * time.Second):
+			assert.Fail(t, "the service does not register into the center")
+			return nil
+		}
+		// the signals are watched right after the registration
+		time.Sleep(time.Second)
+		assert.NoError(t, cmd.Process.Signal(syscall.SIGTERM))
+		assert.NoError(t, cmd.Wait())
+		close(paths)
+		var requested []string
+		for path := range paths {
+			requested = append(requested, path)
+		}
+		paths = make(chan string, 10)
+		return requested
+	}
+
+	// the final coverage is pushed before deregistering
+	binary := build(false)
+	assert.Equal(t, []string{"/v1/cover/flush", "/v1/cover/remove"}, terminate(binary))
+	select {
+	case profile := <-profiles:
+		assert.Contains(t, profile, "mode: "+DefaultCoverMode+"\nexample.com/flush/main.go:")
+	default:
+		assert.Fail(t, "the final coverage is not pushed")
+	}
+	// opted out by the environment variable
+	assert.Equal(t, []string{"/v1/cover/remove"}, terminate(binary, "GOC_FLUSH_ON_EXIT=false"))
+	// opted out at build time
+	assert.Equal(t, []string{"/v1/cover/remove"}, terminate(build(true)))
+}
+
+func TestPushInterval(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "goc-push-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "go.mod"), []byte("module example.com/push\n\ngo 1.13\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "main.go"),
+		[]byte("package main\n\nimport \"time\"\n\nfunc main() { time.Sleep(time.Minute) }\n"), 0644))
+	outputDir, err := ioutil.TempDir("", "goc-push")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	pushes := make(chan time.Time, 100)
+	registered := make(chan struct{}, 10)
+	center := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/cover/register":
+			registered <- struct{}{}
+		case "/v1/cover/push":
+			body, _ := ioutil.ReadAll(r.Body)
+			assert.Contains(t, string(body), "example.com/push/main.go:")
+			pushes <- time.Now()
+		}
+		w.Write([]byte(`{"result":"success"}`))
+	}))
+	defer center.Close()
+
+	binary := filepath.Join(outputDir, "push")
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir, OutputDir: binary})
+	ci := &cover.CoverInfo{
+		Target:                   gocBuild.TmpDir,
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		Mode:                     gocBuild.CoverMode,
+		Center:                   center.URL,
+		OneMainPackage:           true,
+		PushInterval:             -time.Second,
+	}
+	assert.Error(t, gocBuild.Instrument(ci), "the negative interval should be rejected")
+	ci.PushInterval = 300 * time.Millisecond
+	assert.NoError(t, gocBuild.Instrument(ci))
+	assert.NoError(t, gocBuild.Build())
+	cleanup()
+
+	// run returns the times the service pushes its coverage in the duration since it registers
+	run := func(d time.Duration, env ...string) []time.Time {
+		cmd := exec.Command(binary)
+		cmd.Env = append(os.Environ(), env...)
+		assert.NoError(t, cmd.Start())
+		defer func() {
+			cmd.Process.Kill()
+			cmd.Wait()
+		}()
+		select {
+		case <-registered:
+		case <-time.After(30 * time.Second):
+			assert.Fail(t, "the service does not register into the center")
+			return nil
+		}
+		var times []time.Time
+		timeout := time.After(d)
+		for {
+			select {
+			case pushed := <-pushes:
+				times = append(times, pushed)
+			case <-timeout:
+				return times
+			}
+		}
+	}
+
+	// pushed every interval baked in
+	times := run(1600 * time.Millisecond)
+	assert.True(t, len(times) >= 3 && len(times) <= 6, "expected about 5 pushes, got %d", len(times))
+	for i := 1; i < len(times); i++ {
+		assert.True(t, times[i].Sub(times[i-1]) >= 150*time.Millisecond, "pushed too often: %v", times[i].Sub(times[i-1]))
+	}
+	// the environment variable takes precedence
+	assert.Empty(t, run(time.Second, "GOC_PUSH_INTERVAL=0s"))
+	times = run(1600*time.Millisecond, "GOC_PUSH_INTERVAL=1s")
+	assert.True(t, len(times) >= 1 && len(times) <= 2, "expected 1 push, got %d", len(times))
+}
+
+// a broken package not imported by the main package does not fail the build
+func TestBuildWithBrokenPackage(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "goc-broken-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(workingDir, "broken"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "go.mod"), []byte("module example.com/broken\n\ngo 1.13\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "broken", "broken.go"), []byte("packag broken\n"), 0644))
+	outputDir, err := ioutil.TempDir("", "goc-broken")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir, OutputDir: filepath.Join(outputDir, "app")})
+	defer cleanup()
+	ci := &cover.CoverInfo{
+		Target:                   gocBuild.TmpDir,
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		Mode:                     gocBuild.CoverMode,
+		OneMainPackage:           true,
+		Singleton:                true,
+	}
+	assert.NoError(t, gocBuild.Instrument(ci))
+	assert.NoError(t, gocBuild.Build())
+	_, err = os.Stat(filepath.Join(outputDir, "app"))
+	assert.NoError(t, err)
+}
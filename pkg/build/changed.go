@@ -0,0 +1,115 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/qiniu/goc/pkg/cover"
+)
+
+// ChangedPackages returns the import paths of the packages of the project whose go files, except the tests,
+// are added, modified or removed since the git ref, including the changes not committed yet
+func (b *Build) ChangedPackages(ref string) ([]string, error) {
+	top, err := git(b.WorkingDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	out, err := git(b.WorkingDir, "diff", "--name-only", "--no-renames", ref, "--", "*.go")
+	if err != nil {
+		return nil, err
+	}
+
+	changedDirs := make(map[string]bool)
+	for _, file := range strings.Split(out, "\n") {
+		if file == "" || strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		changedDirs[realPath(filepath.Dir(filepath.Join(top, filepath.FromSlash(file))))] = true
+	}
+
+	var changed []string
+	for _, pkg := range b.filterPackages(func(pkg *cover.Package) bool { return changedDirs[realPath(pkg.Dir)] }) {
+		changed = append(changed, pkg.ImportPath)
+	}
+	return changed, nil
+}
+
+// RestrictToChanged restricts the instrumentation of ci to the packages changed since the git ref,
+// which are intersected with the CoverPkgs given already, the other packages are built without counters
+func (b *Build) RestrictToChanged(ci *cover.CoverInfo, ref string) error {
+	changed, err := b.ChangedPackages(ref)
+	if err != nil {
+		return err
+	}
+	var include []string
+	for _, importPath := range changed {
+		if len(ci.CoverPkgs) == 0 || matchAny(ci.CoverPkgs, importPath) {
+			include = append(include, importPath)
+		}
+	}
+	log.Infof("Only instrument the packages changed since %v: %v", ref, include)
+	if len(include) != 0 {
+		ci.CoverPkgs = include
+		return nil
+	}
+	// no counters at all, the agent is still injected into the main packages
+	skip := append([]string{}, ci.SkipPkgs...)
+	for importPath := range b.Pkgs {
+		skip = append(skip, importPath)
+	}
+	sort.Strings(skip)
+	ci.SkipPkgs = skip
+	return nil
+}
+
+func matchAny(patterns []string, importPath string) bool {
+	for _, pattern := range patterns {
+		if cover.MatchPackage(pattern, importPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// git runs the git command in dir and returns the output
+func git(dir string, args ...string) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("fail to execute: git %v, err: %v, stderr: %s", strings.Join(args, " "), err, stderr.String())
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// realPath resolves the symbolic links in the path, the path is returned as it is if it can not be resolved
+func realPath(path string) string {
+	if p, err := filepath.EvalSymlinks(path); err == nil {
+		return p
+	}
+	return filepath.Clean(path)
+}
@@ -0,0 +1,95 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/goc/pkg/cover"
+)
+
+func TestRestrictToChanged(t *testing.T) {
+	repo, err := ioutil.TempDir("", "goc-changed")
+	assert.NoError(t, err)
+	defer os.RemoveAll(repo)
+	write := func(name, content string) {
+		file := filepath.Join(repo, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	}
+	gitRun := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=goc", "-c", "user.email=goc@example.com"}, args...)...)
+		cmd.Dir = repo
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+	write("go.mod", "module example.com/changed\n\ngo 1.13\n")
+	write("main.go", "package main\n\nimport (\n\t\"example.com/changed/a\"\n\t\"example.com/changed/b\"\n)\n\nfunc main() { a.A(); b.B() }\n")
+	write("a/a.go", "package a\n\nfunc A() int { return 1 }\n")
+	write("b/b.go", "package b\n\nfunc B() int { return 2 }\n")
+	write("b/b_test.go", "package b\n")
+	gitRun("init", "-q")
+	gitRun("add", "-A")
+	gitRun("commit", "-q", "-m", "init")
+	gitRun("tag", "base")
+
+	// a is changed after the ref, b only has its test changed
+	write("a/a.go", "package a\n\nfunc A() int { return 10 }\n")
+	gitRun("commit", "-q", "-am", "change a")
+	write("b/b_test.go", "package b\n\n// test\n")
+
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: repo})
+	defer cleanup()
+
+	changed, err := gocBuild.ChangedPackages("base")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"example.com/changed/a"}, changed)
+	_, err = gocBuild.ChangedPackages("nonexistent-ref")
+	assert.Error(t, err)
+
+	// the changed packages are intersected with the ones to cover
+	ci := &cover.CoverInfo{CoverPkgs: []string{"example.com/changed/b"}, SkipPkgs: []string{"example.com/changed/x"}}
+	assert.NoError(t, gocBuild.RestrictToChanged(ci, "base"))
+	assert.Equal(t, []string{"example.com/changed/b"}, ci.CoverPkgs)
+	assert.Equal(t, []string{"example.com/changed", "example.com/changed/a", "example.com/changed/b", "example.com/changed/x"}, ci.SkipPkgs)
+
+	ci = &cover.CoverInfo{
+		Target:                   gocBuild.TmpDir,
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		Mode:                     gocBuild.CoverMode,
+		Center:                   "http://127.0.0.1:7777",
+		OneMainPackage:           true,
+	}
+	assert.NoError(t, gocBuild.RestrictToChanged(ci, "base"))
+	assert.Equal(t, []string{"example.com/changed/a"}, ci.CoverPkgs)
+	assert.NoError(t, gocBuild.Instrument(ci))
+	for file, instrumented := range map[string]bool{"a/a.go": true, "b/b.go": false, "main.go": false} {
+		content, err := ioutil.ReadFile(filepath.Join(gocBuild.TmpWorkingDir, file))
+		assert.NoError(t, err)
+		assert.Equal(t, instrumented, strings.Contains(string(content), cover.DefaultCoverVarPrefix), file)
+	}
+	assert.NoError(t, gocBuild.Build())
+}
@@ -0,0 +1,126 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// depsClosure returns the directories of the target packages and the packages in the module they
+// import directly or indirectly, including the vendored ones, ok is false if any target is a pattern
+// or file list which can not be resolved into a listed package
+func (b *Build) depsClosure() (dirs map[string]bool, ok bool) {
+	targets := strings.Fields(b.Packages)
+	if len(targets) == 0 {
+		targets = []string{"."}
+	}
+
+	byDir := make(map[string]string, len(b.Pkgs))
+	for importPath, pkg := range b.Pkgs {
+		byDir[pkg.Dir] = importPath
+	}
+	dirs = make(map[string]bool)
+	for _, target := range targets {
+		importPath := target
+		if _, listed := b.Pkgs[target]; !listed {
+			if strings.Contains(target, "...") || strings.HasSuffix(target, ".go") {
+				return nil, false
+			}
+			if importPath, ok = byDir[filepath.Join(b.WorkingDir, target)]; !ok {
+				return nil, false
+			}
+		}
+		pkg := b.Pkgs[importPath]
+		dirs[pkg.Dir] = true
+		for _, dep := range pkg.Deps {
+			// only the packages under the working directory are listed, so the directory
+			// is derived from the import path
+			if dep == b.ModRootPath || strings.HasPrefix(dep, b.ModRootPath+"/") {
+				dirs[filepath.Join(b.ModRoot, filepath.FromSlash(strings.TrimPrefix(dep, b.ModRootPath)))] = true
+			} else if dir := filepath.Join(b.ModRoot, "vendor", filepath.FromSlash(dep)); isDir(dir) {
+				// the standard packages and the packages of the other modules are not in the module,
+				// except the vendored ones
+				dirs[dir] = true
+			}
+		}
+	}
+	return dirs, true
+}
+
+// closureSkip returns the function telling whether a file or directory of the module is out of
+// the closure and should not be copied: the go files of the packages not in the closure, and the
+// directories of the packages not in the closure unless they contain any package in the closure.
+// The other files and directories, e.g. go.mod and the assets, are copied, so are the paths
+// outside the module.
+func (b *Build) closureSkip(dirs map[string]bool) func(src string, info os.FileInfo) bool {
+	// the directories containing any package in the closure
+	ancestors := make(map[string]bool)
+	for dir := range dirs {
+		for d := filepath.Dir(dir); d != b.ModRoot && strings.HasPrefix(d, b.ModRoot); d = filepath.Dir(d) {
+			ancestors[d] = true
+		}
+	}
+
+	return func(src string, info os.FileInfo) bool {
+		if src == b.ModRoot || !strings.HasPrefix(src, b.ModRoot+string(filepath.Separator)) {
+			return false
+		}
+		if !info.IsDir() {
+			return filepath.Ext(src) == ".go" && !dirs[filepath.Dir(src)]
+		}
+		if dirs[src] || ancestors[src] {
+			return false
+		}
+		return hasGoFiles(src)
+	}
+}
+
+// restrictCopyToClosure makes the copy of the module skip the packages not needed by the target packages
+func (b *Build) restrictCopyToClosure() {
+	dirs, ok := b.depsClosure()
+	if !ok {
+		log.Infof("The packages %q can not be resolved, copy the whole module", b.Packages)
+		return
+	}
+	log.Infof("Copy only the %d packages of the module the target packages depend on", len(dirs))
+	b.copyFilter = b.closureSkip(dirs)
+}
+
+// hasGoFiles reports whether the directory contains any go file directly
+func hasGoFiles(dir string) bool {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, f := range files {
+		if !f.IsDir() && filepath.Ext(f.Name()) == ".go" {
+			return true
+		}
+	}
+	return false
+}
+
+// isDir reports whether the path is an existing directory
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
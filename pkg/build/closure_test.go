@@ -0,0 +1,102 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/qiniu/goc/pkg/cover"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCopyDepsOnly(t *testing.T) {
+	// build with the vendor directory
+	defer setEnv(map[string]string{"GOFLAGS": ""})()
+
+	workingDir, err := ioutil.TempDir("", "goc-closure-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	files := map[string]string{
+		"go.mod":                                  "module example.com/closure\n\ngo 1.13\n\nrequire example.com/dep v1.0.0\n",
+		"cmd/app/main.go":                         "package main\n\nimport \"example.com/closure/used\"\n\nfunc main() { used.Hello() }\n",
+		"cmd/app/config.yaml":                     "asset: true\n",
+		"cmd/other/main.go":                       "package main\n\nfunc main() {}\n",
+		"used/used.go":                            "package used\n\nimport \"example.com/dep\"\n\nfunc Hello() { dep.Hello() }\n",
+		"used/unused/unused.go":                   "package unused\n",
+		"unused/unused.go":                        "package unused\n",
+		"unused/testdata/data.txt":                "data\n",
+		"vendor/modules.txt":                      "# example.com/dep v1.0.0\n## explicit\nexample.com/dep\nexample.com/dep/unused\n",
+		"vendor/example.com/dep/dep.go":           "package dep\n\nfunc Hello() {}\n",
+		"vendor/example.com/dep/unused/unused.go": "package unused\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(workingDir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+	outputDir, err := ioutil.TempDir("", "goc-closure")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{
+		WorkingDir:   filepath.Join(workingDir, "cmd/app"),
+		OutputDir:    filepath.Join(outputDir, "app"),
+		CopyDepsOnly: true,
+	})
+	defer cleanup()
+
+	copied := func(name string) bool {
+		_, err := os.Stat(filepath.Join(gocBuild.TmpDir, name))
+		return err == nil
+	}
+	for _, name := range []string{"go.mod", "cmd/app/main.go", "cmd/app/config.yaml", "used/used.go",
+		"vendor/modules.txt", "vendor/example.com/dep/dep.go"} {
+		assert.True(t, copied(name), "%v should be copied", name)
+	}
+	for _, name := range []string{"cmd/other", "used/unused", "unused", "vendor/example.com/dep/unused"} {
+		assert.False(t, copied(name), "%v should not be copied", name)
+	}
+
+	ci := &cover.CoverInfo{
+		Target:                   gocBuild.TmpDir,
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		Mode:                     gocBuild.CoverMode,
+		Args:                     gocBuild.BuildFlags,
+		OneMainPackage:           true,
+		Singleton:                true,
+		InstrumentScope:          cover.ScopeModule,
+	}
+	assert.NoError(t, gocBuild.Instrument(ci))
+	assert.NoError(t, gocBuild.Build())
+	_, err = os.Stat(filepath.Join(outputDir, "app"))
+	assert.NoError(t, err)
+}
+
+func TestCopyDepsOnlyWithPatterns(t *testing.T) {
+	b := &Build{Packages: "./...", WorkingDir: "/project"}
+	_, ok := b.depsClosure()
+	assert.False(t, ok, "the patterns can not be resolved")
+
+	b.Packages = "main.go"
+	_, ok = b.depsClosure()
+	assert.False(t, ok, "the files can not be resolved")
+}
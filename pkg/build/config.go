@@ -0,0 +1,145 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigFileName is the name of the goc config file
+const ConfigFileName = ".goc.yaml"
+
+// Config is the content of the goc config file, e.g.
+//
+//	packages: ["."]
+//	buildflags: -v
+//	tags: [embed, kodo]
+//	ldflags: -X main.version=v1.0.0
+//	mode: count
+//	env:
+//	  CGO_ENABLED: "0"
+//	output: bin/myapp
+type Config struct {
+	Packages   []string          `yaml:"packages"`
+	BuildFlags string            `yaml:"buildflags"`
+	Tags       []string          `yaml:"tags"`
+	LDFlags    string            `yaml:"ldflags"`
+	GCFlags    string            `yaml:"gcflags"`
+	Mode       string            `yaml:"mode"` // coverage mode: set, count or atomic
+	Env        map[string]string `yaml:"env"`
+	Output     string            `yaml:"output"` // relative to the directory of the config file
+	BinaryName string            `yaml:"name"`
+	Static     bool              `yaml:"static"` // build a statically linked binary with cgo disabled
+
+	dir string // directory of the config file
+}
+
+// FindConfig looks for the config file from dir upward like go.mod,
+// it returns an empty string if no config file found
+func FindConfig(dir string) string {
+	dir = filepath.Clean(dir)
+	for {
+		file := filepath.Join(dir, ConfigFileName)
+		if fi, err := os.Stat(file); err == nil && !fi.IsDir() {
+			return file
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig reads the config file
+func LoadConfig(file string) (*Config, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("fail to read config file %v: %v", file, err)
+	}
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("fail to parse config file %v: %v", file, err)
+	}
+	abs, err := filepath.Abs(filepath.Dir(file))
+	if err != nil {
+		return nil, err
+	}
+	cfg.dir = abs
+	return cfg, nil
+}
+
+// Apply fills the options with the values in the config file, the environment variables in the
+// config file are passed to the go command by the options instead of changing the environment,
+// set reports whether an option is given on the command line by its flag name,
+// which takes precedence over the config file
+func (c *Config) Apply(opts *BuildOptions, set func(name string) bool) {
+	if !set("packages") && len(c.Packages) != 0 {
+		opts.Packages = c.Packages
+	}
+	if !set("buildflags") && c.BuildFlags != "" {
+		opts.BuildFlags = c.BuildFlags
+	}
+	if len(c.Tags) != 0 && !strings.Contains(opts.buildFlags(), "-tags") {
+		if len(opts.BuildFlagsSlice) != 0 {
+			opts.BuildFlagsSlice = append(opts.BuildFlagsSlice, "-tags="+strings.Join(c.Tags, ","))
+		} else {
+			opts.BuildFlags = strings.TrimSpace(opts.BuildFlags + " -tags=" + strings.Join(c.Tags, ","))
+		}
+	}
+	if !set("ldflags") && c.LDFlags != "" {
+		opts.LDFlags = c.LDFlags
+	}
+	if !set("gcflags") && c.GCFlags != "" {
+		opts.GCFlags = c.GCFlags
+	}
+	if !set("mode") && c.Mode != "" {
+		opts.CoverMode = c.Mode
+	}
+	if !set("output") && c.Output != "" {
+		if filepath.IsAbs(c.Output) {
+			opts.OutputDir = c.Output
+		} else {
+			opts.OutputDir = filepath.Join(c.dir, c.Output)
+		}
+	}
+	if !set("name") && c.BinaryName != "" {
+		opts.BinaryName = c.BinaryName
+	}
+	if !set("static") && c.Static {
+		opts.Static = true
+	}
+	// the variables already in the environment or the options take precedence
+	for k, v := range c.Env {
+		if _, ok := os.LookupEnv(k); ok {
+			continue
+		}
+		if _, ok := opts.Env[k]; ok {
+			continue
+		}
+		if opts.Env == nil {
+			opts.Env = make(map[string]string)
+		}
+		opts.Env[k] = v
+	}
+}
@@ -0,0 +1,129 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testConfig = []byte(`packages: ["."]
+buildflags: -v
+tags: [embed, kodo]
+ldflags: -X main.version=v1.0.0
+mode: count
+env:
+  GOC_TEST_CONFIG_ENV: from-config
+  GOC_TEST_CONFIG_SET: from-config
+output: bin/myapp
+static: true
+`)
+
+func TestFindAndLoadConfig(t *testing.T) {
+	root, err := ioutil.TempDir("", "goc-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	subDir := filepath.Join(root, "cmd", "myapp")
+	assert.NoError(t, os.MkdirAll(subDir, os.ModePerm))
+	assert.Equal(t, "", FindConfig(subDir))
+
+	file := filepath.Join(root, ConfigFileName)
+	assert.NoError(t, ioutil.WriteFile(file, testConfig, 0644))
+	assert.Equal(t, file, FindConfig(subDir), "config file should be found upward")
+
+	cfg, err := LoadConfig(file)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"."}, cfg.Packages)
+	assert.Equal(t, []string{"embed", "kodo"}, cfg.Tags)
+	assert.Equal(t, "from-config", cfg.Env["GOC_TEST_CONFIG_ENV"])
+
+	// unknown fields are reported
+	assert.NoError(t, ioutil.WriteFile(file, []byte("buildflag: -v\n"), 0644))
+	_, err = LoadConfig(file)
+	assert.Error(t, err)
+}
+
+// options given on the command line take precedence over the config file
+func TestApplyConfig(t *testing.T) {
+	root, err := ioutil.TempDir("", "goc-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	file := filepath.Join(root, ConfigFileName)
+	assert.NoError(t, ioutil.WriteFile(file, testConfig, 0644))
+	cfg, err := LoadConfig(file)
+	assert.NoError(t, err)
+
+	// nothing on the command line
+	opts := BuildOptions{WorkingDir: root}
+	cfg.Apply(&opts, func(string) bool { return false })
+	assert.Equal(t, []string{"."}, opts.Packages)
+	assert.Equal(t, "-v -tags=embed,kodo", opts.BuildFlags)
+	assert.Equal(t, "-X main.version=v1.0.0", opts.LDFlags)
+	assert.Equal(t, "count", opts.CoverMode)
+	assert.Equal(t, filepath.Join(root, "bin", "myapp"), opts.OutputDir)
+	assert.True(t, opts.Static)
+
+	// command line wins
+	opts = BuildOptions{
+		BuildFlags: "-race -tags=dev",
+		LDFlags:    "-s",
+		OutputDir:  "out",
+		Packages:   []string{"./cmd"},
+		CoverMode:  "set",
+	}
+	set := map[string]bool{"buildflags": true, "ldflags": true, "output": true, "packages": true, "mode": true}
+	cfg.Apply(&opts, func(name string) bool { return set[name] })
+	assert.Equal(t, []string{"./cmd"}, opts.Packages)
+	assert.Equal(t, "-race -tags=dev", opts.BuildFlags, "tags in the build flags should not be overridden")
+	assert.Equal(t, "-s", opts.LDFlags)
+	assert.Equal(t, "out", opts.OutputDir)
+	assert.Equal(t, "set", opts.CoverMode)
+
+	assert.Equal(t, map[string]string{"GOC_TEST_CONFIG_ENV": "from-config", "GOC_TEST_CONFIG_SET": "from-config"}, opts.Env)
+
+	// environment wins, and it is left untouched
+	defer setEnv(map[string]string{"GOC_TEST_CONFIG_SET": "from-env", "GOC_TEST_CONFIG_ENV": ""})()
+	os.Unsetenv("GOC_TEST_CONFIG_ENV")
+	opts = BuildOptions{Env: map[string]string{"GOC_TEST_CONFIG_OPTS": "from-opts"}}
+	cfg.Apply(&opts, func(string) bool { return false })
+	assert.Equal(t, map[string]string{"GOC_TEST_CONFIG_ENV": "from-config", "GOC_TEST_CONFIG_OPTS": "from-opts"}, opts.Env)
+	_, ok := os.LookupEnv("GOC_TEST_CONFIG_ENV")
+	assert.False(t, ok, "the config file should not change the environment")
+}
+
+// the packages listed in the config file are checked like the ones given on the command line
+func TestBuildConfigWithPackages(t *testing.T) {
+	root, err := ioutil.TempDir("", "goc-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+	file := filepath.Join(root, ConfigFileName)
+	assert.NoError(t, ioutil.WriteFile(file, []byte("packages: [./cmd/main1, ./cmd/main2]\noutput: bin\n"), 0644))
+	cfg, err := LoadConfig(file)
+	assert.NoError(t, err)
+
+	opts := BuildOptions{WorkingDir: filepath.Join(baseDir, "../../tests/samples/multi_mains_project_with_internal")}
+	cfg.Apply(&opts, func(string) bool { return false })
+	assert.Equal(t, []string{"./cmd/main1", "./cmd/main2"}, opts.Packages)
+	defer setModuleEnv()()
+	_, err = NewBuildWithOptions(opts)
+	assert.Equal(t, ErrTooManyArgs, err)
+}
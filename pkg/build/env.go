@@ -0,0 +1,100 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// goEnv returns the environment of the go command of build, install and run.
+// The environment of goc is passed through as it is, so GOFLAGS, GOEXPERIMENT, GODEBUG, CGO_ENABLED
+// and the others reach the go command, only GOPATH is replaced when the project is copied into
+// a temporary GOPATH, CGO_ENABLED is turned off for a static build, the variables of the Env option
+// are set, and the overrides, in the form of key=value, replace the ones of the same key.
+// In particular the variables to download the private modules, i.e. GOPROXY, GOPRIVATE, GONOPROXY,
+// GOSUMDB, GONOSUMDB, GONOSUMCHECK, GOINSECURE and GOFLAGS (e.g. -insecure of the old go versions),
+// are never touched, the same as for go list run by goc.
+func (b *Build) goEnv(overrides ...string) []string {
+	if b.NewGOPATH != "" {
+		overrides = append(overrides, fmt.Sprintf("GOPATH=%v", b.NewGOPATH))
+	}
+	if b.Static {
+		overrides = append(overrides, "CGO_ENABLED=0")
+	}
+	keys := make([]string, 0, len(b.env))
+	for k := range b.env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if !overridden(k, overrides) {
+			overrides = append(overrides, k+"="+b.env[k])
+		}
+	}
+
+	env := make([]string, 0, len(os.Environ())+len(overrides))
+	for _, kv := range os.Environ() {
+		if !overridden(kv, overrides) {
+			env = append(env, kv)
+		}
+	}
+	return append(env, overrides...)
+}
+
+// goBinary returns the go command quoted for bash, the one in PATH is used if GoBinary is not given
+func (b *Build) goBinary() string {
+	if b.GoBinary == "" {
+		return "go"
+	}
+	return shellQuote(b.GoBinary)
+}
+
+// targetGOOS returns the operating system the go command builds for, which is GOOS
+// in the environment of the go command, i.e. the Env option or the environment of goc,
+// or the one goc runs on if it is not set
+func (b *Build) targetGOOS() string {
+	if goos := lookupEnv(b.goEnv(), "GOOS"); goos != "" {
+		return goos
+	}
+	return runtime.GOOS
+}
+
+// lookupEnv returns the value of the key in the environment in the form of key=value,
+// the last one wins like the go command does, empty if the key is not set
+func lookupEnv(env []string, key string) string {
+	value := ""
+	for _, kv := range env {
+		if strings.HasPrefix(kv, key+"=") {
+			value = strings.TrimPrefix(kv, key+"=")
+		}
+	}
+	return value
+}
+
+func overridden(kv string, overrides []string) bool {
+	key := strings.SplitN(kv, "=", 2)[0]
+	for _, o := range overrides {
+		if strings.SplitN(o, "=", 2)[0] == key {
+			return true
+		}
+	}
+	return false
+}
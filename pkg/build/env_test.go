@@ -0,0 +1,157 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoEnv(t *testing.T) {
+	defer setEnv(map[string]string{"GOBIN": "/original/bin"})()
+
+	b := &Build{}
+	env := b.goEnv("GOBIN=/tmp/bin")
+	assert.Contains(t, env, "GOBIN=/tmp/bin")
+	assert.NotContains(t, env, "GOBIN=/original/bin", "the override should replace the one in the environment")
+	assert.Len(t, env, len(os.Environ()))
+
+	b.NewGOPATH = "/tmp/gopath:/original/gopath"
+	env = b.goEnv()
+	assert.Contains(t, env, "GOPATH=/tmp/gopath:/original/gopath")
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "GOPATH=") {
+			assert.Equal(t, "GOPATH=/tmp/gopath:/original/gopath", kv, "there should be only one GOPATH")
+		}
+	}
+
+	// the variables of the options replace the environment but not the overrides
+	b = &Build{env: map[string]string{"GOBIN": "/env/bin", "GOC_TEST_ENV": "from-options"}}
+	env = b.goEnv()
+	assert.Contains(t, env, "GOBIN=/env/bin")
+	assert.Contains(t, env, "GOC_TEST_ENV=from-options")
+	assert.NotContains(t, env, "GOBIN=/original/bin")
+	env = b.goEnv("GOBIN=/tmp/bin")
+	assert.Contains(t, env, "GOBIN=/tmp/bin")
+	assert.NotContains(t, env, "GOBIN=/env/bin")
+}
+
+// the environment of goc, e.g. GOEXPERIMENT and GODEBUG, reaches the go command
+func TestBuildPassesThroughEnv(t *testing.T) {
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{})
+	defer cleanup()
+
+	// a fake go records its environment
+	goBinary, removeGo := fakeGo(t, "env > \"$(dirname \"$0\")/env\"\n")
+	defer removeGo()
+	envFile := filepath.Join(filepath.Dir(goBinary), "env")
+	defer setEnv(map[string]string{
+		"PATH":         filepath.Dir(goBinary) + string(os.PathListSeparator) + os.Getenv("PATH"),
+		"GOEXPERIMENT": "fieldtrack",
+		"GODEBUG":      "gctrace=1",
+	})()
+	// the variables to download the private modules
+	moduleEnv := map[string]string{
+		"GOPROXY":      "https://proxy.example.com,direct",
+		"GOPRIVATE":    "git.example.com/*",
+		"GONOPROXY":    "git.example.com/*",
+		"GOSUMDB":      "sum.example.com",
+		"GONOSUMDB":    "git.example.com/*",
+		"GONOSUMCHECK": "1",
+		"GOINSECURE":   "git.example.com/*",
+		"GOFLAGS":      "-insecure",
+	}
+	defer setEnv(moduleEnv)()
+
+	for name, run := range map[string]func() error{"build": gocBuild.Build, "run": gocBuild.Run} {
+		os.Remove(envFile)
+		assert.NoError(t, run(), name)
+		env, err := ioutil.ReadFile(envFile)
+		assert.NoError(t, err, name)
+		assert.Contains(t, string(env), "GOEXPERIMENT=fieldtrack\n", name)
+		assert.Contains(t, string(env), "GODEBUG=gctrace=1\n", name)
+		for key, value := range moduleEnv {
+			assert.Contains(t, string(env), key+"="+value+"\n", name)
+		}
+	}
+}
+
+func TestBuildWithGoBinary(t *testing.T) {
+	workingDir := filepath.Join(baseDir, "../../tests/samples/simple_project")
+	restore := setModuleEnv()
+	_, err := NewBuildWithOptions(BuildOptions{Packages: []string{"."}, WorkingDir: workingDir, GoBinary: "/nonexistent/bin/go"})
+	assert.True(t, errors.Is(err, ErrInvalidGoBinary), "%v", err)
+	restore()
+
+	// a fake go out of PATH records its arguments
+	fakeDir, err := ioutil.TempDir("", "goc fake toolchain")
+	assert.NoError(t, err)
+	defer os.RemoveAll(fakeDir)
+	argsFile := filepath.Join(fakeDir, "args")
+	goBinary := filepath.Join(fakeDir, "go")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" > '%s'\n", argsFile)
+	assert.NoError(t, ioutil.WriteFile(goBinary, []byte(script), 0755))
+
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{GoBinary: goBinary})
+	defer cleanup()
+
+	for name, run := range map[string]func() error{"build": gocBuild.Build, "run": gocBuild.Run} {
+		os.Remove(argsFile)
+		assert.NoError(t, run(), name)
+		args, err := ioutil.ReadFile(argsFile)
+		assert.NoError(t, err, name)
+		assert.True(t, strings.HasPrefix(string(args), name+" "), "the fake go should be called by %s: %s", name, args)
+	}
+}
+
+// the build flags are not changed by Build, so that the Build can be built again
+func TestBuildTwice(t *testing.T) {
+	fakeDir, err := ioutil.TempDir("", "goc-fake-go")
+	assert.NoError(t, err)
+	defer os.RemoveAll(fakeDir)
+	argsFile := filepath.Join(fakeDir, "args")
+	goBinary := filepath.Join(fakeDir, "go")
+	script := fmt.Sprintf("#!/bin/sh\necho \"$@\" >> '%s'\n", argsFile)
+	assert.NoError(t, ioutil.WriteFile(goBinary, []byte(script), 0755))
+
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{BuildFlags: "-trimpath", GoBinary: goBinary})
+	defer cleanup()
+	// only the calls of the builds are counted
+	os.Remove(argsFile)
+
+	assert.NoError(t, gocBuild.Build())
+	assert.NoError(t, gocBuild.Build())
+	assert.NoError(t, gocBuild.Run())
+	assert.Equal(t, "-trimpath", gocBuild.BuildFlags)
+
+	out, err := ioutil.ReadFile(argsFile)
+	assert.NoError(t, err)
+	calls := strings.Split(strings.TrimSpace(string(out)), "\n")
+	if assert.Len(t, calls, 3) {
+		expected := "build -trimpath -o " + gocBuild.Target + " ."
+		assert.Equal(t, expected, calls[0])
+		assert.Equal(t, expected, calls[1], "-o should not be duplicated")
+		assert.NotContains(t, calls[2], "-o", "run should not get the output of build")
+	}
+}
@@ -21,4 +21,32 @@ var (
 	ErrEmptyTempWorkingDir = errors.New("temporary working directory is empty")
 	// ErrNoPlaceToInstall represents the err that no place to install the generated binary
 	ErrNoPlaceToInstall = errors.New("don't know where to install")
+	// ErrTmpDirLocked represents the temporary directory is being used by another goc process
+	ErrTmpDirLocked = errors.New("temporary directory is locked")
+	// ErrNotBuilt represents the binary is not built yet
+	ErrNotBuilt = errors.New("binary is not built yet")
+	// ErrInvalidCoverMode represents the coverage mode is not one of set, count and atomic
+	ErrInvalidCoverMode = errors.New("invalid coverage mode, should be set, count or atomic")
+	// ErrNoGoMod represents go works in module mode but the project has no go.mod
+	ErrNoGoMod = errors.New("go.mod not found")
+	// ErrTimeout represents the go command does not finish in time
+	ErrTimeout = errors.New("go command timed out")
+	// ErrTestInstrumented represents go test is run on the instrumented project
+	ErrTestInstrumented = errors.New("can not run go test on the instrumented project, run it before instrumenting")
+	// ErrStaticCgo represents a static binary is asked for but some packages to build need cgo
+	ErrStaticCgo = errors.New("can not build a static binary, the packages need cgo")
+	// ErrInvalidGoBinary represents the go command given is not an executable
+	ErrInvalidGoBinary = errors.New("invalid go binary")
+	// ErrOutputNotWritable represents the binary can not be written into the output directory
+	ErrOutputNotWritable = errors.New("output directory is not writable")
+	// ErrInvalidParallelism represents the parallelism of the go command is negative
+	ErrInvalidParallelism = errors.New("invalid parallelism, should be positive")
+	// ErrInvalidInstrumented represents the instrumented source is not valid Go
+	ErrInvalidInstrumented = errors.New("instrumented source is invalid")
+	// ErrOutputInBuildFlags represents the build flags have -o, which conflicts with the output goc manages
+	ErrOutputInBuildFlags = errors.New("-o is not allowed in the build flags, use the output option instead")
+	// ErrToolFlagsInBuildFlags represents the build flags have -ldflags or -gcflags given by the options as well
+	ErrToolFlagsInBuildFlags = errors.New("-ldflags and -gcflags are not allowed in the build flags when given by the options")
+	// ErrUnknownPackage represents the package given is not a package of the project
+	ErrUnknownPackage = errors.New("unknown package of the project")
 )
@@ -0,0 +1,145 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/qiniu/goc/pkg/cover"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportInstrumented(t *testing.T) {
+	assert.True(t, errors.Is((&Build{}).ExportInstrumented("x.tar.gz"), ErrEmptyTempWorkingDir))
+
+	// a fresh project, as the samples may have the build leftovers
+	workingDir, err := ioutil.TempDir("", "goc-export-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "go.mod"), []byte("module example.com/export\n\ngo 1.13\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir})
+	defer cleanup()
+	err = gocBuild.Instrument(&cover.CoverInfo{
+		Target:                   gocBuild.TmpDir,
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		Mode:                     gocBuild.CoverMode,
+		Center:                   "http://127.0.0.1:7777",
+		OneMainPackage:           true,
+	})
+	assert.NoError(t, err)
+	// an executable file keeps its mode
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(gocBuild.TmpDir, "run.sh"), []byte("#!/bin/sh\n"), 0755))
+	assert.NoError(t, os.Chmod(filepath.Join(gocBuild.TmpDir, "run.sh"), 0755))
+
+	outputDir, err := ioutil.TempDir("", "goc-export")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	archive := filepath.Join(outputDir, "instrumented.tar.gz")
+	assert.NoError(t, gocBuild.ExportInstrumented(archive))
+
+	// extract the archive and diff it with the temporary directory
+	extracted := filepath.Join(outputDir, "extracted")
+	assert.NoError(t, extract(archive, extracted))
+	files := 0
+	err = filepath.Walk(gocBuild.TmpDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(gocBuild.TmpDir, path)
+		if rel == "." {
+			return nil
+		}
+		got, err := os.Lstat(filepath.Join(extracted, rel))
+		if !assert.NoError(t, err, rel) {
+			return nil
+		}
+		assert.Equal(t, info.Mode(), got.Mode(), rel)
+		if info.Mode().IsRegular() {
+			files++
+			want, _ := ioutil.ReadFile(path)
+			content, _ := ioutil.ReadFile(filepath.Join(extracted, rel))
+			assert.Equal(t, string(want), string(content), rel)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.True(t, files > 3, "the source, the instrumented apis and the cover variables should be archived")
+	main, err := ioutil.ReadFile(filepath.Join(extracted, "main.go"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(main), gocBuild.GlobalCoverVarImportPath, "the archived source should be instrumented")
+}
+
+func extract(archive, dir string) error {
+	f, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gr)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(dir, hdr.Name)
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, os.FileMode(hdr.Mode)); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, path); err != nil {
+				return err
+			}
+		default:
+			content, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			if err := ioutil.WriteFile(path, content, os.FileMode(hdr.Mode)); err != nil {
+				return err
+			}
+		}
+		// the mode is masked by the umask on creation
+		if hdr.Typeflag != tar.TypeSymlink {
+			if err := os.Chmod(path, os.FileMode(hdr.Mode)); err != nil {
+				return err
+			}
+		}
+	}
+}
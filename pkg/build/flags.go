@@ -0,0 +1,178 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// toolFlags returns the -ldflags and -gcflags arguments quoted for the shell,
+// -x -v in verbose mode, and -p if the parallelism is given,
+// they are appended after the build flags so the values given here take effect
+func (b *Build) toolFlags() string {
+	flags := ""
+	if b.Verbose {
+		flags += " -x -v"
+	}
+	if b.Parallelism > 0 {
+		flags += fmt.Sprintf(" -p %d", b.Parallelism)
+	}
+	if ldflags := b.ldflags(); ldflags != "" {
+		flags += " -ldflags=" + shellQuote(ldflags)
+	}
+	if b.GCFlags != "" {
+		flags += " -gcflags=" + shellQuote(b.GCFlags)
+	}
+	return flags
+}
+
+// ldflags returns the -ldflags of the go command, the external linker is asked to link statically
+// for a static build in case the external linking is forced, unless the -extldflags is given already
+func (b *Build) ldflags() string {
+	if b.Static && !strings.Contains(b.LDFlags, "-extldflags") {
+		return strings.TrimSpace(b.LDFlags + " -extldflags=-static")
+	}
+	return b.LDFlags
+}
+
+// shellQuote quotes s as a single word for bash
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// plainWord matches the words which mean the same to bash whether quoted or not
+var plainWord = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// joinArgs joins the arguments into a command line for bash, each of them stays a single word,
+// the ones with spaces, quotes or other characters special to the shell are quoted
+func joinArgs(args []string) string {
+	words := make([]string, 0, len(args))
+	for _, arg := range args {
+		if plainWord.MatchString(arg) {
+			words = append(words, arg)
+			continue
+		}
+		words = append(words, shellQuote(arg))
+	}
+	return strings.Join(words, " ")
+}
+
+// buildFlags returns the build flags of the go command, BuildFlagsSlice takes precedence over BuildFlags
+func (opts BuildOptions) buildFlags() string {
+	if len(opts.BuildFlagsSlice) != 0 {
+		return joinArgs(opts.BuildFlagsSlice)
+	}
+	return opts.BuildFlags
+}
+
+// splitWords splits the command line into words like bash, the quotes and the backslashes are
+// removed, the other expansions of bash are not done
+func splitWords(s string) []string {
+	var (
+		words  []string
+		word   strings.Builder
+		inWord bool
+		quote  rune
+		escape bool
+	)
+	for _, r := range s {
+		switch {
+		case escape:
+			word.WriteRune(r)
+			escape = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' {
+				escape = true
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\':
+			escape = true
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words
+}
+
+// checkOutputFlag rejects the -o flag in the build flags, as goc builds in the temporary directory
+// and writes the binary into the output it manages, another -o would conflict with it
+func checkOutputFlag(buildFlags string) error {
+	for _, word := range splitWords(buildFlags) {
+		if isFlag(word, "o") {
+			err := fmt.Errorf("%w: %v", ErrOutputInBuildFlags, buildFlags)
+			log.Errorln(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// checkToolFlags rejects the -ldflags and -gcflags in the build flags when they are given by the options
+// as well, the ones of the options appended after the build flags would drop the others silently.
+// The -ldflags of a static build is given by the options too.
+func checkToolFlags(buildFlags string, hasLDFlags, hasGCFlags bool) error {
+	for _, word := range splitWords(buildFlags) {
+		if hasLDFlags && isFlag(word, "ldflags") || hasGCFlags && isFlag(word, "gcflags") {
+			err := fmt.Errorf("%w: %v", ErrToolFlagsInBuildFlags, buildFlags)
+			log.Errorln(err)
+			return err
+		}
+	}
+	return nil
+}
+
+// hasFlag reports whether the command line has the flag of the name, e.g. -mod vendor or --mod=vendor
+func hasFlag(flags, name string) bool {
+	for _, word := range splitWords(flags) {
+		if isFlag(word, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// isFlag reports whether the word of the command line is the flag of the name, e.g. -o, --o or -o=app
+func isFlag(word, name string) bool {
+	return word == "-"+name || word == "--"+name || strings.HasPrefix(word, "-"+name+"=") || strings.HasPrefix(word, "--"+name+"=")
+}
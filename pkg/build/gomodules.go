@@ -17,8 +17,12 @@
 package build
 
 import (
+	"fmt"
 	"io/ioutil"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/tongjingran/copy"
@@ -31,7 +35,7 @@ func (b *Build) cpGoModulesProject() {
 			dst := b.TmpDir
 			src := v.Module.Dir
 
-			if err := copy.Copy(src, dst, copy.Options{Skip: skipCopy}); err != nil {
+			if err := copy.Copy(src, dst, b.copyOptions()); err != nil {
 				log.Errorf("Failed to Copy the folder from %v to %v, the error is: %v ", src, dst, err)
 			}
 			break
@@ -41,13 +45,89 @@ func (b *Build) cpGoModulesProject() {
 	}
 }
 
+// findModRoot walks up from dir to find the directory containing go.mod,
+// an empty string is returned if no go.mod is found
+func findModRoot(dir string) string {
+	dir = filepath.Clean(dir)
+	for {
+		if fi, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil && !fi.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// checkGoMod fails fast if go works in module mode but there is no go.mod
+// in the working directory or any parent directory, where go list fails confusingly.
+// The error tells whether the working directory is under GOPATH to suggest the fix.
+func (b *Build) checkGoMod() error {
+	workingDir := b.WorkingDir
+	cmd := exec.Command("/bin/bash", "-c", b.goBinary()+" env GOMOD GOPATH")
+	cmd.Dir = workingDir
+	cmd.Env = b.goEnv()
+	out, err := cmd.Output()
+	if err != nil {
+		// leave it to go list to report
+		log.Warnf("fail to execute: %v, err: %v", cmd.Args, err)
+		return nil
+	}
+	env := strings.Split(strings.TrimSpace(string(out)), "\n")
+	// GOMOD is os.DevNull in module mode without go.mod, and empty in GOPATH mode
+	if len(env) != 2 || strings.TrimSpace(env[0]) != os.DevNull {
+		return nil
+	}
+
+	gopath := strings.TrimSpace(env[1])
+	for _, p := range filepath.SplitList(gopath) {
+		src := filepath.Join(p, "src")
+		if workingDir == src || strings.HasPrefix(workingDir, src+string(filepath.Separator)) {
+			return fmt.Errorf("%w: no go.mod in %v or any parent directory, and it is under GOPATH %v while the module mode is on, set GO111MODULE=off to build in GOPATH mode or run 'go mod init' in the project root",
+				ErrNoGoMod, workingDir, p)
+		}
+	}
+	return fmt.Errorf("%w: no go.mod in %v or any parent directory, and it is not under GOPATH %v, run 'go mod init' in the project root",
+		ErrNoGoMod, workingDir, gopath)
+}
+
+// addVendorFlag appends -mod=vendor to the build flags if the module of the working directory
+// is vendored, so that the vendor directory copied along with the module is used in temporary
+// directory no matter which go version the go.mod declares.
+// The flags are untouched if -mod is specified explicitly in the build flags or GOFLAGS,
+// or the module mode is off, GO111MODULE and GOFLAGS are looked up in env of the go command.
+func addVendorFlag(buildFlags, workingDir string, env []string) string {
+	if lookupEnv(env, "GO111MODULE") == "off" || hasFlag(buildFlags, "mod") || hasFlag(lookupEnv(env, "GOFLAGS"), "mod") {
+		return buildFlags
+	}
+	modRoot := findModRoot(workingDir)
+	if modRoot == "" {
+		return buildFlags
+	}
+	if _, err := os.Stat(filepath.Join(modRoot, "vendor", "modules.txt")); err != nil {
+		return buildFlags
+	}
+
+	log.Infof("Vendor directory found in %v, build with -mod=vendor", modRoot)
+	return strings.TrimSpace(buildFlags + " -mod=vendor")
+}
+
+// replaceDir is the directory in the temporary directory holding the copies of
+// the local replacement targets, go tools ignore directories beginning with '_'
+const replaceDir = "_goc_replace"
+
 // updateGoModFile rewrites the go.mod file in the temporary directory,
-// if it has a 'replace' directive, and the directive has a relative local path
-// it will be rewritten with a absolute path.
+// if it has a 'replace' directive, and the directive points to a local path
+// outside the module, the target is copied into the temporary directory
+// and the directive will be rewritten with the absolute path of the copy.
 // ex.
 // suppose original project is located at /path/to/aa/bb/cc, go.mod contains a directive:
 // 'replace github.com/qiniu/bar => ../home/foo/bar'
-// after the project is copied to temporary directory, it should be rewritten as
+// after the project is copied to temporary directory /tmp/goc-build-xx, it should be rewritten as
+// 'replace github.com/qiniu/bar => /tmp/goc-build-xx/_goc_replace/0-bar'
+// if the target can not be found, the directive is rewritten with its original absolute path
 // 'replace github.com/qiniu/bar => /path/to/aa/bb/home/foo/bar'
 func (b *Build) updateGoModFile() (updateFlag bool, newModFile []byte, err error) {
 	tempModfile := filepath.Join(b.TmpDir, "go.mod")
@@ -68,17 +148,36 @@ func (b *Build) updateGoModFile() (updateFlag bool, newModFile []byte, err error
 		newPath := replace.New.Path
 		newVersion := replace.New.Version
 		// replace to a local filesystem does not have a version
-		// absolute path no need to rewrite
-		if newVersion == "" && !filepath.IsAbs(newPath) {
-			var absPath string
-			fullPath := filepath.Join(b.ModRoot, newPath)
-			absPath, _ = filepath.Abs(fullPath)
-			// DropReplace & AddReplace will not return error
-			// so no need to check the error
-			_ = oriGoModFile.DropReplace(oldPath, oldVersion)
-			_ = oriGoModFile.AddReplace(oldPath, oldVersion, absPath, newVersion)
-			updateFlag = true
+		if newVersion != "" {
+			continue
 		}
+		absPath := newPath
+		if !filepath.IsAbs(newPath) {
+			absPath, _ = filepath.Abs(filepath.Join(b.ModRoot, newPath))
+			// the target inside the module has been copied along with the module
+			if rel, err := filepath.Rel(b.ModRoot, absPath); err == nil && !strings.HasPrefix(rel, "..") {
+				continue
+			}
+		}
+
+		if _, statErr := os.Stat(absPath); statErr == nil {
+			dst := filepath.Join(b.TmpDir, replaceDir, fmt.Sprintf("%d-%s", index, filepath.Base(absPath)))
+			if err = copy.Copy(absPath, dst, b.copyOptions()); err != nil {
+				err = fmt.Errorf("fail to copy the replacement target %v: %w", absPath, err)
+				return
+			}
+			log.Infof("Copy the replacement target of %v from %v to %v", oldPath, absPath, dst)
+			absPath = dst
+		} else if filepath.IsAbs(newPath) {
+			// absolute path no need to rewrite
+			continue
+		}
+
+		// DropReplace & AddReplace will not return error
+		// so no need to check the error
+		_ = oriGoModFile.DropReplace(oldPath, oldVersion)
+		_ = oriGoModFile.AddReplace(oldPath, oldVersion, absPath, newVersion)
+		updateFlag = true
 	}
 	oriGoModFile.Cleanup()
 	// Format will not return error, so ignore the returned error
@@ -19,6 +19,7 @@ package build
 import (
 	"bytes"
 	"errors"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -27,6 +28,7 @@ import (
 	"github.com/qiniu/goc/pkg/cover"
 	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/tongjingran/copy"
 )
 
 func captureOutput(f func()) string {
@@ -77,6 +79,28 @@ func TestUpdateModFileIfContainsReplace(t *testing.T) {
 	assert.Contains(t, string(newmod), "github.com/qiniu/bar2 => github.com/baniu/bar3 v1.2.3")
 }
 
+// test the local replacement target outside the module is copied into temporary directory
+func TestUpdateModFileCopyReplaceTarget(t *testing.T) {
+	modRoot := filepath.Join(baseDir, "../../tests/samples/gomod_replace_project")
+	tmpDir, err := ioutil.TempDir("", "goc-replace")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tmpDir)
+	assert.NoError(t, copy.Copy(modRoot, tmpDir))
+
+	b := &Build{
+		TmpDir:  tmpDir,
+		ModRoot: modRoot,
+	}
+	updated, newmod, err := b.updateGoModFile()
+	assert.NoError(t, err)
+	assert.Equal(t, updated, true)
+
+	target := filepath.Join(tmpDir, replaceDir, "0-gomod_replace_library")
+	assert.Contains(t, string(newmod), "replace qiniu.com/foo => "+target)
+	_, err = os.Stat(filepath.Join(target, "bar.go"))
+	assert.NoError(t, err, "the replacement target should be copied")
+}
+
 // test wrong go mod file
 func TestWithWrongGoModFile(t *testing.T) {
 	// go.mod not exist
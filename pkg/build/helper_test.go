@@ -0,0 +1,89 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setModuleEnv unsets GOPATH and turns on the module mode,
+// the returned function restores the environment
+func setModuleEnv() func() {
+	return setEnv(map[string]string{"GOPATH": "", "GO111MODULE": "on"})
+}
+
+// setEnv sets the environment variables, the returned function restores them
+func setEnv(env map[string]string) func() {
+	type saved struct {
+		value string
+		ok    bool
+	}
+	orig := make(map[string]saved, len(env))
+	for key, value := range env {
+		v, ok := os.LookupEnv(key)
+		orig[key] = saved{value: v, ok: ok}
+		os.Setenv(key, value)
+	}
+	return func() {
+		for key, s := range orig {
+			if s.ok {
+				os.Setenv(key, s.value)
+			} else {
+				os.Unsetenv(key)
+			}
+		}
+	}
+}
+
+// newTestBuild creates the Build of the options in the module mode, the packages default to "."
+// and the working directory to the simple_project sample. The returned function cleans the
+// temporary directory and restores the environment.
+func newTestBuild(t *testing.T, opts BuildOptions) (*Build, func()) {
+	restore := setModuleEnv()
+	if opts.Packages == nil {
+		opts.Packages = []string{"."}
+	}
+	if opts.WorkingDir == "" {
+		opts.WorkingDir = filepath.Join(baseDir, "../../tests/samples/simple_project")
+	}
+	gocBuild, err := NewBuildWithOptions(opts)
+	if !assert.NoError(t, err) {
+		restore()
+		assert.FailNow(t, "should create temporary directory successfully")
+	}
+	return gocBuild, func() {
+		gocBuild.Clean()
+		restore()
+	}
+}
+
+// fakeGo writes a fake go command running the shell script into a temporary directory,
+// the returned function removes the directory
+func fakeGo(t *testing.T, script string) (string, func()) {
+	dir, err := ioutil.TempDir("", "goc-fake-go")
+	if !assert.NoError(t, err) {
+		assert.FailNow(t, "should create the fake go")
+	}
+	goBinary := filepath.Join(dir, "go")
+	assert.NoError(t, ioutil.WriteFile(goBinary, []byte("#!/bin/sh\n"+script), 0755))
+	return goBinary, func() { os.RemoveAll(dir) }
+}
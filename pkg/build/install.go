@@ -20,35 +20,36 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
 // NewInstall creates a Build struct which can install from goc temporary directory
 func NewInstall(buildflags string, args []string, workingDir string) (*Build, error) {
-	if err := checkParameters(args, workingDir); err != nil {
-		return nil, err
-	}
-	b := &Build{
+	return NewInstallWithOptions(BuildOptions{
 		BuildFlags: buildflags,
-		Packages:   strings.Join(args, " "),
+		Packages:   args,
 		WorkingDir: workingDir,
-	}
-	if false == b.validatePackageForInstall() {
-		log.Errorln(ErrWrongPackageTypeForInstall)
-		return nil, ErrWrongPackageTypeForInstall
-	}
-	if err := b.MvProjectsToTmp(); err != nil {
-		return nil, err
-	}
-	return b, nil
+	})
+}
+
+// NewInstallWithOptions creates a Build struct which can install from goc temporary directory
+// according to the given options, the OutputDir option is ignored
+func NewInstallWithOptions(opts BuildOptions) (*Build, error) {
+	return newBuild(opts, func(b *Build) error {
+		if false == b.validatePackageForInstall() {
+			log.Errorln(ErrWrongPackageTypeForInstall)
+			return ErrWrongPackageTypeForInstall
+		}
+		return nil
+	})
 }
 
 // Install use the 'go install' tool to install packages
 func (b *Build) Install() error {
 	log.Println("Go building in temp...")
-	cmd := exec.Command("/bin/bash", "-c", "go install "+b.BuildFlags+" "+b.Packages)
+	cmd := exec.Command("/bin/bash", "-c", b.goBinary()+" install "+b.BuildFlags+b.coverFlags()+b.toolFlags()+" "+b.Packages)
 	cmd.Dir = b.TmpWorkingDir
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -59,19 +60,18 @@ func (b *Build) Install() error {
 		log.Errorf("No place to install: %v", err)
 	}
 	// Change the temp GOBIN, to force binary install to original place
-	cmd.Env = append(os.Environ(), fmt.Sprintf("GOBIN=%v", whereToInstall))
-	if b.NewGOPATH != "" {
-		// Change to temp GOPATH for go install command
-		cmd.Env = append(cmd.Env, fmt.Sprintf("GOPATH=%v", b.NewGOPATH))
-	}
+	cmd.Env = b.goEnv(fmt.Sprintf("GOBIN=%v", whereToInstall))
 
 	log.Infof("go install cmd is: %v", cmd.Args)
-	err = cmd.Start()
+	b.reportProgress(StageBuild, 0)
+	defer b.reportProgress(StageBuild, 1)
+	defer b.recordCompile(time.Now())
+	err = b.startCmd(cmd)
 	if err != nil {
 		log.Errorf("Fail to execute: %v. The error is: %v", cmd.Args, err)
 		return err
 	}
-	if err = cmd.Wait(); err != nil {
+	if err = b.waitCmd(cmd); err != nil {
 		log.Errorf("go install failed. The error is: %v", err)
 		return err
 	}
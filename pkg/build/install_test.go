@@ -1,7 +1,7 @@
 package build
 
 import (
-	"os"
+	"errors"
 	"path/filepath"
 	"testing"
 
@@ -12,14 +12,14 @@ func TestBasicInstallForModProject(t *testing.T) {
 	workingDir := filepath.Join(baseDir, "../../tests/samples/simple_project")
 	gopath := filepath.Join(baseDir, "../../tests/samples/simple_project", "testhome")
 
-	os.Setenv("GOPATH", gopath)
-	os.Setenv("GO111MODULE", "on")
+	defer setEnv(map[string]string{"GOPATH": gopath, "GO111MODULE": "on"})()
 
 	buildFlags, packages := "", []string{"."}
 	gocBuild, err := NewInstall(buildFlags, packages, workingDir)
 	if !assert.Equal(t, err, nil) {
 		assert.FailNow(t, "should create temporary directory successfully")
 	}
+	defer gocBuild.Clean()
 
 	err = gocBuild.Install()
 	if !assert.Equal(t, err, nil) {
@@ -31,8 +31,7 @@ func TestInvalidPackageNameForInstall(t *testing.T) {
 	workingDir := filepath.Join(baseDir, "../../tests/samples/simple_project")
 	gopath := filepath.Join(baseDir, "../../tests/samples/simple_project", "testhome")
 
-	os.Setenv("GOPATH", gopath)
-	os.Setenv("GO111MODULE", "on")
+	defer setEnv(map[string]string{"GOPATH": gopath, "GO111MODULE": "on"})()
 
 	buildFlags, packages := "", []string{"main.go"}
 	_, err := NewInstall(buildFlags, packages, workingDir)
@@ -40,3 +39,16 @@ func TestInvalidPackageNameForInstall(t *testing.T) {
 		assert.FailNow(t, "should not success with non . or ./... package")
 	}
 }
+
+// the flags of the build options are checked against the build flags by install too
+func TestFlagsInBuildFlagsForInstall(t *testing.T) {
+	workingDir := filepath.Join(baseDir, "../../tests/samples/simple_project")
+	defer setModuleEnv()()
+
+	_, err := NewInstallWithOptions(BuildOptions{BuildFlags: "-ldflags '-w'", LDFlags: "-X main.version=v1", Packages: []string{"."}, WorkingDir: workingDir})
+	assert.True(t, errors.Is(err, ErrToolFlagsInBuildFlags), "%v", err)
+	_, err = NewInstallWithOptions(BuildOptions{BuildFlagsSlice: []string{"-gcflags", "all=-N"}, GCFlags: "-l", Packages: []string{"."}, WorkingDir: workingDir})
+	assert.True(t, errors.Is(err, ErrToolFlagsInBuildFlags), "%v", err)
+	_, err = NewInstallWithOptions(BuildOptions{BuildFlags: "-o ./bin/app", Packages: []string{"."}, WorkingDir: workingDir})
+	assert.True(t, errors.Is(err, ErrOutputInBuildFlags), "%v", err)
+}
@@ -38,7 +38,7 @@ func (b *Build) cpLegacyProject() {
 			continue
 		}
 
-		if err := copy.Copy(src, dst, copy.Options{Skip: skipCopy}); err != nil {
+		if err := copy.Copy(src, dst, b.copyOptions()); err != nil {
 			log.Errorf("Failed to Copy the folder from %v to %v, the error is: %v ", src, dst, err)
 		}
 
@@ -67,7 +67,7 @@ func (b *Build) cpDepPackages(pkg *cover.Package, visited map[string]bool) {
 
 		dst := filepath.Join(b.TmpDir, "src", dep)
 
-		if err := copy.Copy(src, dst, copy.Options{Skip: skipCopy}); err != nil {
+		if err := copy.Copy(src, dst, b.copyOptions()); err != nil {
 			log.Errorf("Failed to Copy the folder from %v to %v, the error is: %v ", src, dst, err)
 		}
 
@@ -81,7 +81,7 @@ func (b *Build) cpNonStandardLegacy() {
 			dst := b.TmpDir
 			src := v.Dir
 
-			if err := copy.Copy(src, dst, copy.Options{Skip: skipCopy}); err != nil {
+			if err := copy.Copy(src, dst, b.copyOptions()); err != nil {
 				log.Printf("Failed to Copy the folder from %v to %v, the error is: %v ", src, dst, err)
 			}
 			break
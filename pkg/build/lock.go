@@ -0,0 +1,53 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"os"
+)
+
+// lockTmpDir takes an advisory lock on the temporary directory of the project,
+// it fails fast if another goc process is using the same temporary directory
+func (b *Build) lockTmpDir() error {
+	lockFile := b.TmpDir + ".lock"
+	f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return fmt.Errorf("fail to open the lock file %v: %v", lockFile, err)
+	}
+
+	if held, err := tryLockFile(f); err != nil || held {
+		f.Close()
+		if held {
+			return fmt.Errorf("%w: %v is held by another goc process", ErrTmpDirLocked, lockFile)
+		}
+		return fmt.Errorf("fail to lock %v: %v", lockFile, err)
+	}
+	b.tmpDirLock = f
+	return nil
+}
+
+// unlockTmpDir releases the lock taken by lockTmpDir, the lock file itself is kept
+// as removing it would race with the other goc processes waiting on it
+func (b *Build) unlockTmpDir() {
+	if b.tmpDirLock == nil {
+		return
+	}
+	unlockFile(b.tmpDirLock)
+	b.tmpDirLock.Close()
+	b.tmpDirLock = nil
+}
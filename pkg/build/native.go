@@ -0,0 +1,77 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// NativeCoverMinVersion is the minor version of the first Go release which builds
+// the whole program with coverage by go build -cover, and writes the profiles into GOCOVERDIR
+const NativeCoverMinVersion = 20
+
+var goVersionRe = regexp.MustCompile(`go1\.(\d+)`)
+
+// parseGoMinorVersion returns the minor version of the Go release, e.g. 20 of go1.20.3 or devel go1.21-abcdef
+func parseGoMinorVersion(version string) (int, error) {
+	m := goVersionRe.FindStringSubmatch(version)
+	if m == nil {
+		return 0, fmt.Errorf("unknown go version %q", version)
+	}
+	return strconv.Atoi(m[1])
+}
+
+// goMinorVersion returns the minor version of the go command of the Build
+func (b *Build) goMinorVersion() (int, error) {
+	cmd := exec.Command("/bin/bash", "-c", b.goBinary()+" version")
+	cmd.Env = b.goEnv()
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the go version, err: %v", err)
+	}
+	return parseGoMinorVersion(strings.TrimSpace(string(out)))
+}
+
+// useNativeCover tells whether the go command is able to build with coverage natively,
+// goc falls back to rewriting the source with a warning if it is not
+func (b *Build) useNativeCover() bool {
+	minor, err := b.goMinorVersion()
+	if err != nil {
+		log.Warnf("Native coverage is not available, instrument the source instead: %v", err)
+		return false
+	}
+	if minor < NativeCoverMinVersion {
+		log.Warnf("Native coverage needs go1.%d or later but go1.%d is used, instrument the source instead", NativeCoverMinVersion, minor)
+		return false
+	}
+	return true
+}
+
+// coverFlags returns the flags of the go command to build with coverage natively,
+// the coverage of the packages of the main module is written into GOCOVERDIR when the program exits
+func (b *Build) coverFlags() string {
+	if !b.NativeCover {
+		return ""
+	}
+	return " -cover -covermode=" + b.CoverMode
+}
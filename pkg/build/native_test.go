@@ -0,0 +1,99 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/goc/pkg/cover"
+)
+
+func TestParseGoMinorVersion(t *testing.T) {
+	for version, expected := range map[string]int{
+		"go version go1.13.8 linux/amd64":          13,
+		"go version go1.20 darwin/arm64":           20,
+		"go version devel go1.22-abcdef Thu +0000": 22,
+	} {
+		minor, err := parseGoMinorVersion(version)
+		assert.NoError(t, err, version)
+		assert.Equal(t, expected, minor, version)
+	}
+	_, err := parseGoMinorVersion("go version unknown")
+	assert.Error(t, err)
+}
+
+func TestNativeCover(t *testing.T) {
+	b := &Build{}
+	if minor, err := b.goMinorVersion(); err != nil || minor < NativeCoverMinVersion {
+		t.Skip("native coverage needs go1.20 or later")
+	}
+	workingDir, err := ioutil.TempDir("", "goc-native-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	main := "package main\n\nfunc covered() int { return 1 }\n\nfunc main() { covered() }\n"
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "go.mod"), []byte("module example.com/native\n\ngo 1.13\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "main.go"), []byte(main), 0644))
+	outputDir, err := ioutil.TempDir("", "goc-native")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	binary := filepath.Join(outputDir, "native")
+
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir, OutputDir: binary, NativeCover: true})
+	defer cleanup()
+	assert.True(t, gocBuild.NativeCover)
+
+	// the source is not rewritten
+	assert.NoError(t, gocBuild.Instrument(&cover.CoverInfo{Target: gocBuild.TmpDir}))
+	content, err := ioutil.ReadFile(filepath.Join(gocBuild.TmpWorkingDir, "main.go"))
+	assert.NoError(t, err)
+	assert.Equal(t, main, string(content))
+	assert.NoError(t, gocBuild.Build())
+
+	// the binary writes the coverage into GOCOVERDIR on exit
+	coverDir := filepath.Join(outputDir, "covdata")
+	assert.NoError(t, os.Mkdir(coverDir, 0755))
+	cmd := exec.Command(binary)
+	cmd.Env = append(os.Environ(), "GOCOVERDIR="+coverDir)
+	assert.NoError(t, cmd.Run())
+
+	profile := filepath.Join(outputDir, "native.cov")
+	assert.NoError(t, cover.ConvertCoverDirs("", []string{coverDir}, profile))
+	content, err = ioutil.ReadFile(profile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "mode: atomic")
+	assert.Regexp(t, `example.com/native/main.go:3\.\d+,3\.\d+ 1 1`, string(content))
+}
+
+// goc falls back to instrumenting the source if the go command is older than go1.20
+func TestNativeCoverFallback(t *testing.T) {
+	fakeDir, err := ioutil.TempDir("", "goc-fake-go")
+	assert.NoError(t, err)
+	defer os.RemoveAll(fakeDir)
+	goBinary := filepath.Join(fakeDir, "go")
+	assert.NoError(t, ioutil.WriteFile(goBinary, []byte("#!/bin/sh\necho go version go1.19.5 linux/amd64\n"), 0755))
+
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{GoBinary: goBinary, NativeCover: true})
+	defer cleanup()
+	assert.False(t, gocBuild.NativeCover)
+	assert.Equal(t, "", gocBuild.coverFlags())
+}
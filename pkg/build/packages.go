@@ -0,0 +1,53 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"sort"
+
+	"github.com/qiniu/goc/pkg/cover"
+)
+
+// MainPackages returns the main packages of the project sorted by the import paths,
+// it is empty before the project is moved to the temporary directory
+func (b *Build) MainPackages() []*cover.Package {
+	return b.filterPackages(func(pkg *cover.Package) bool {
+		return pkg.Name == "main"
+	})
+}
+
+// PackagesMatching returns the packages of the project whose import paths match the pattern sorted by
+// the import paths, the pattern is either a glob pattern as path.Match, e.g. example.com/*/api,
+// or an import path ending with "/..." which matches the path and all its sub packages
+func (b *Build) PackagesMatching(pattern string) []*cover.Package {
+	return b.filterPackages(func(pkg *cover.Package) bool {
+		return cover.MatchPackage(pattern, pkg.ImportPath)
+	})
+}
+
+func (b *Build) filterPackages(match func(pkg *cover.Package) bool) []*cover.Package {
+	var pkgs []*cover.Package
+	for _, pkg := range b.Pkgs {
+		if match(pkg) {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].ImportPath < pkgs[j].ImportPath
+	})
+	return pkgs
+}
@@ -0,0 +1,78 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/qiniu/goc/pkg/cover"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackageAccessors(t *testing.T) {
+	b := &Build{Pkgs: map[string]*cover.Package{}}
+	assert.Empty(t, b.MainPackages())
+
+	for _, pkg := range []*cover.Package{
+		{Name: "main", ImportPath: "example.com/app/cmd/server"},
+		{Name: "main", ImportPath: "example.com/app"},
+		{Name: "api", ImportPath: "example.com/app/pkg/api"},
+		{Name: "v1", ImportPath: "example.com/app/pkg/api/v1"},
+		{Name: "store", ImportPath: "example.com/app/pkg/store"},
+	} {
+		b.Pkgs[pkg.ImportPath] = pkg
+	}
+	importPaths := func(pkgs []*cover.Package) []string {
+		var paths []string
+		for _, pkg := range pkgs {
+			paths = append(paths, pkg.ImportPath)
+		}
+		return paths
+	}
+
+	assert.Equal(t, []string{"example.com/app", "example.com/app/cmd/server"}, importPaths(b.MainPackages()))
+
+	var tcs = []struct {
+		pattern  string
+		expected []string
+	}{
+		{pattern: "example.com/app/pkg/*", expected: []string{"example.com/app/pkg/api", "example.com/app/pkg/store"}},
+		{pattern: "example.com/app/pkg/api/...", expected: []string{"example.com/app/pkg/api", "example.com/app/pkg/api/v1"}},
+		{pattern: "example.com/app/cmd/server", expected: []string{"example.com/app/cmd/server"}},
+		{pattern: "example.com/other/...", expected: nil},
+		{pattern: "example.com/app/[", expected: nil},
+	}
+	for _, tc := range tcs {
+		assert.Equal(t, tc.expected, importPaths(b.PackagesMatching(tc.pattern)), tc.pattern)
+	}
+}
+
+func TestMainPackagesOfProject(t *testing.T) {
+	defer setModuleEnv()()
+	gocBuild, err := NewInstall("", []string{"./..."}, filepath.Join(baseDir, "../../tests/samples/nested_main_project"))
+	if !assert.NoError(t, err) {
+		assert.FailNow(t, "should create temporary directory successfully")
+	}
+	defer gocBuild.Clean()
+
+	mains := gocBuild.MainPackages()
+	if assert.Len(t, mains, 1) {
+		assert.Equal(t, "example.com/nested-main-project/cmd/server", mains[0].ImportPath)
+	}
+	assert.Len(t, gocBuild.PackagesMatching("example.com/nested-main-project/pkg/..."), 2)
+}
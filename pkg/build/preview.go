@@ -0,0 +1,39 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"github.com/qiniu/goc/pkg/cover"
+)
+
+// PreviewInstrumentation returns the coverage blocks goc would inject into the go files of the packages
+// under the working directory, keyed by the file names in the profiles, i.e. import path/file, without
+// instrumenting anything. The files getting no counters, e.g. excluded by the build constraints or
+// generated, are present with no blocks, which tells why their coverage is missing.
+func (b *Build) PreviewInstrumentation() (map[string][]cover.BlockInfo, error) {
+	res := make(map[string][]cover.BlockInfo)
+	for _, pkg := range b.Pkgs {
+		blocks, err := cover.PreviewPackage(pkg)
+		if err != nil {
+			return nil, err
+		}
+		for file, fileBlocks := range blocks {
+			res[file] = fileBlocks
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,51 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/qiniu/goc/pkg/cover"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviewInstrumentation(t *testing.T) {
+	workingDir := filepath.Join(baseDir, "../../tests/samples/preview_project")
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir})
+	defer cleanup()
+
+	blocks, err := gocBuild.PreviewInstrumentation()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]cover.BlockInfo{
+		"example.com/preview-project/main.go": {
+			{StartLine: 8, StartCol: 13, EndLine: 9, EndCol: 22, NumStmt: 1},
+			{StartLine: 9, StartCol: 22, EndLine: 11, EndCol: 3, NumStmt: 1},
+			{StartLine: 12, StartCol: 2, EndLine: 12, EndCol: 21, NumStmt: 1},
+		},
+		// excluded by the build constraints
+		"example.com/preview-project/tagged.go": nil,
+		// generated files are not instrumented
+		"example.com/preview-project/generated.go": nil,
+	}, blocks)
+
+	// nothing is instrumented
+	content, err := ioutil.ReadFile(filepath.Join(gocBuild.TmpWorkingDir, "main.go"))
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "GoCover")
+}
@@ -0,0 +1,59 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"os"
+
+	"github.com/tongjingran/copy"
+)
+
+const (
+	// StageCopy is reported while copying the project into the temporary directory,
+	// done is the number of files copied so far
+	StageCopy = "copy"
+	// StageBuild is reported when the go command starts (done is 0) and exits (done is 1),
+	// only the start is reported by Run as the go command exits along with the service
+	StageBuild = "build"
+)
+
+// ProgressFunc is called to report the progress of a goc build
+type ProgressFunc func(stage string, done int)
+
+func (b *Build) reportProgress(stage string, done int) {
+	if b.progress != nil {
+		b.progress(stage, done)
+	}
+}
+
+// copyOptions returns the options used to copy the project into the temporary directory,
+// every copied file is reported as progress
+func (b *Build) copyOptions() copy.Options {
+	return copy.Options{
+		Skip: func(src string, info os.FileInfo) (bool, error) {
+			skip, err := skipCopy(src, info)
+			if err == nil && !skip && b.copyFilter != nil {
+				skip = b.copyFilter(src, info)
+			}
+			if err == nil && !skip && !info.IsDir() {
+				b.copied++
+				b.reportProgress(StageCopy, b.copied)
+			}
+			return skip, err
+		},
+	}
+}
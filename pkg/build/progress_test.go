@@ -0,0 +1,53 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// check the progress of copying and building is reported
+func TestBuildReportProgress(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "goc-progress")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	copied := 0
+	var builds []int
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{
+		OutputDir: outputDir,
+		Progress: func(stage string, done int) {
+			switch stage {
+			case StageCopy:
+				copied = done
+			case StageBuild:
+				builds = append(builds, done)
+			}
+		},
+	})
+	defer cleanup()
+
+	assert.True(t, copied > 0, "copied files should be reported")
+
+	err = gocBuild.Build()
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1}, builds)
+}
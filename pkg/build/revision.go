@@ -0,0 +1,35 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+// Revision returns the git commit the project is built from, with the suffix -dirty if there are
+// changes not committed yet, it is empty if the project is not in a git repository
+func (b *Build) Revision() string {
+	revision, err := git(b.WorkingDir, "rev-parse", "HEAD")
+	if err != nil {
+		log.Debugf("No revision of the project: %v", err)
+		return ""
+	}
+	if status, err := git(b.WorkingDir, "status", "--porcelain", "--untracked-files=no"); err == nil && status != "" {
+		revision += "-dirty"
+	}
+	return revision
+}
@@ -0,0 +1,117 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/qiniu/goc/pkg/cover"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-revision")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	b := &Build{WorkingDir: dir}
+	assert.Equal(t, "", b.Revision(), "no revision out of a git repository")
+
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.email", "goc@example.com"},
+		{"config", "user.name", "goc"},
+	} {
+		_, err := git(dir, args...)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644))
+	_, err = git(dir, "add", "main.go")
+	assert.NoError(t, err)
+	_, err = git(dir, "commit", "-q", "-m", "init")
+	assert.NoError(t, err)
+	head, err := git(dir, "rev-parse", "HEAD")
+	assert.NoError(t, err)
+
+	assert.Equal(t, head, b.Revision())
+	// the untracked files do not count
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "untracked.txt"), []byte("data\n"), 0644))
+	assert.Equal(t, head, b.Revision())
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	assert.Equal(t, head+"-dirty", b.Revision())
+}
+
+// the service registers the revision it is built from as a label
+func TestRevisionLabel(t *testing.T) {
+	workingDir, err := ioutil.TempDir("", "goc-revision-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "go.mod"), []byte("module example.com/revision\n\ngo 1.13\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "main.go"),
+		[]byte("package main\n\nimport \"time\"\n\nfunc main() { time.Sleep(time.Minute) }\n"), 0644))
+	outputDir, err := ioutil.TempDir("", "goc-revision")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	labels := make(chan []string, 1)
+	center := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/cover/register" {
+			labels <- r.URL.Query()["label"]
+		}
+		w.Write([]byte(`{"result":"success"}`))
+	}))
+	defer center.Close()
+
+	binary := filepath.Join(outputDir, "revision")
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir, OutputDir: binary})
+	ci := &cover.CoverInfo{
+		Target:                   gocBuild.TmpDir,
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		Mode:                     gocBuild.CoverMode,
+		Center:                   center.URL,
+		OneMainPackage:           true,
+		Revision:                 "abc 123",
+	}
+	assert.Error(t, gocBuild.Instrument(ci), "the revision should be a valid label value")
+	ci.Revision = "abc123-dirty"
+	assert.NoError(t, gocBuild.Instrument(ci))
+	assert.NoError(t, gocBuild.Build())
+	cleanup()
+
+	cmd := exec.Command(binary)
+	cmd.Env = append(os.Environ(), "GOC_AGENT_LABELS=env:staging")
+	assert.NoError(t, cmd.Start())
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	select {
+	case l := <-labels:
+		assert.Equal(t, []string{"revision:abc123-dirty", "env:staging"}, l)
+	case <-time.After(30 * time.Second):
+		assert.Fail(t, "the service does not register into the center")
+	}
+}
@@ -20,23 +20,24 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
 
-// Run excutes the main package in addition with the internal goc features
+// Run excutes the main package in addition with the internal goc features,
+// Build.Timeout is not applied as the go command keeps running with the service
 func (b *Build) Run() error {
-	cmd := exec.Command("/bin/bash", "-c", "go run "+b.BuildFlags+" "+b.GoRunExecFlag+" "+b.Packages+" "+b.GoRunArguments)
+	cmd := exec.Command("/bin/bash", "-c", b.goBinary()+" run "+b.BuildFlags+b.coverFlags()+b.toolFlags()+" "+b.GoRunExecFlag+" "+b.Packages+" "+b.GoRunArguments)
 	cmd.Dir = b.TmpWorkingDir
-
-	if b.NewGOPATH != "" {
-		// Change to temp GOPATH for go install command
-		cmd.Env = append(os.Environ(), fmt.Sprintf("GOPATH=%v", b.NewGOPATH))
-	}
+	cmd.Env = b.goEnv()
 
 	log.Infof("go build cmd is: %v", cmd.Args)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
+	// the completion is not reported since the go command keeps running the service until it exits
+	b.reportProgress(StageBuild, 0)
+	defer b.recordCompile(time.Now())
 	err := cmd.Start()
 	if err != nil {
 		return fmt.Errorf("fail to execute: %v, err: %w", cmd.Args, err)
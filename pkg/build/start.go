@@ -0,0 +1,107 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// stopTimeout is how long Stop waits for the service to exit before killing it
+var stopTimeout = 10 * time.Second
+
+// RunningService is an instrumented binary running in the background
+type RunningService struct {
+	Pid  int    // process id of the service
+	Name string // name of the binary, which is the service name registered to the goc server
+
+	cmd   *exec.Cmd
+	build *Build
+	done  chan struct{}
+}
+
+// Start launches the binary generated by Build in the background,
+// GoRunArguments are passed to the binary as its arguments.
+// The temporary directory is cleaned when the service is stopped.
+func (b *Build) Start() (*RunningService, error) {
+	target, err := b.OutputPath()
+	if err != nil {
+		return nil, err
+	}
+
+	// exec makes the binary itself the process we get the pid of
+	cmd := exec.Command("/bin/bash", "-c", "exec "+shellQuote(target)+" "+b.GoRunArguments)
+	cmd.Dir = b.WorkingDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	log.Infof("start cmd is: %v", cmd.Args)
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("fail to execute: %v, err: %w", cmd.Args, err)
+	}
+
+	s := &RunningService{
+		Pid:   cmd.Process.Pid,
+		Name:  filepath.Base(target),
+		cmd:   cmd,
+		build: b,
+		done:  make(chan struct{}),
+	}
+	go func() {
+		cmd.Wait()
+		close(s.done)
+	}()
+	return s, nil
+}
+
+// Stop terminates the service and cleans the temporary directory,
+// the service is killed if it does not exit in time
+func (s *RunningService) Stop() error {
+	defer s.build.Clean()
+
+	select {
+	case <-s.done:
+		// already exited
+		return nil
+	default:
+	}
+
+	// SIGTERM gives the agent a chance to deregister itself
+	if err := s.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		log.Warnf("fail to terminate service %v (pid %d): %v", s.Name, s.Pid, err)
+	}
+	select {
+	case <-s.done:
+	case <-time.After(stopTimeout):
+		log.Warnf("service %v (pid %d) does not exit in %v, kill it", s.Name, s.Pid, stopTimeout)
+		if err := s.cmd.Process.Kill(); err != nil {
+			return fmt.Errorf("fail to kill service %v: %w", s.Name, err)
+		}
+		<-s.done
+	}
+	return nil
+}
+
+// Exited returns a channel which is closed when the service exits
+func (s *RunningService) Exited() <-chan struct{} {
+	return s.done
+}
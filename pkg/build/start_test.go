@@ -0,0 +1,56 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartAndStop(t *testing.T) {
+	outputDir, err := ioutil.TempDir("", "goc-start")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{
+		WorkingDir: filepath.Join(baseDir, "../../tests/samples/run_for_several_seconds"),
+		OutputDir:  filepath.Join(outputDir, "service"),
+	})
+	defer cleanup()
+
+	_, err = gocBuild.Start()
+	assert.True(t, errors.Is(err, ErrNotBuilt), "should not start before built")
+
+	assert.NoError(t, gocBuild.Build())
+	service, err := gocBuild.Start()
+	if !assert.NoError(t, err) {
+		assert.FailNow(t, "should start the service")
+	}
+	assert.Equal(t, "service", service.Name)
+	assert.NoError(t, service.cmd.Process.Signal(syscall.Signal(0)), "service should be running")
+
+	assert.NoError(t, service.Stop())
+	<-service.Exited()
+	_, err = os.Stat(gocBuild.TmpDir)
+	assert.True(t, os.IsNotExist(err), "temporary directory should be cleaned")
+}
@@ -0,0 +1,58 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/qiniu/goc/pkg/cover"
+	log "github.com/sirupsen/logrus"
+)
+
+// checkStatic reports the packages to build and their dependencies which need cgo for a static build,
+// the standard packages like net and os/user are not reported as they fall back to pure Go without cgo
+func (b *Build) checkStatic() error {
+	if !b.Static {
+		return nil
+	}
+	listArgs := []string{"-json", "-deps"}
+	if len(b.BuildFlags) != 0 {
+		listArgs = append(listArgs, b.BuildFlags)
+	}
+	listArgs = append(listArgs, b.Packages)
+	pkgs, err := cover.ListPackages(b.WorkingDir, strings.Join(listArgs, " "), "")
+	if err != nil {
+		log.Errorln(err)
+		return err
+	}
+
+	var cgoPkgs []string
+	for _, pkg := range pkgs {
+		if !pkg.Standard && len(pkg.CgoFiles) != 0 {
+			cgoPkgs = append(cgoPkgs, pkg.ImportPath)
+		}
+	}
+	if len(cgoPkgs) != 0 {
+		sort.Strings(cgoPkgs)
+		err := fmt.Errorf("%w: %s", ErrStaticCgo, strings.Join(cgoPkgs, ", "))
+		log.Errorln(err)
+		return err
+	}
+	return nil
+}
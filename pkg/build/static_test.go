@@ -0,0 +1,117 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"debug/elf"
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/goc/pkg/cover"
+)
+
+// newStaticProject creates a module project whose main package imports net,
+// which is linked dynamically with cgo enabled, and the extra files
+func newStaticProject(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "goc-static-project")
+	assert.NoError(t, err)
+	files["go.mod"] = "module example.com/static\n\ngo 1.13\n"
+	if _, ok := files["main.go"]; !ok {
+		files["main.go"] = "package main\n\nimport \"net\"\n\nfunc main() { net.LookupHost(\"localhost\") }\n"
+	}
+	for name, content := range files {
+		file := filepath.Join(dir, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	}
+	return dir
+}
+
+func TestBuildStatic(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the binary is checked as ELF")
+	}
+	workingDir := newStaticProject(t, map[string]string{})
+	defer os.RemoveAll(workingDir)
+	outputDir, err := ioutil.TempDir("", "goc-static")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	binary := filepath.Join(outputDir, "static")
+
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir, OutputDir: binary, Static: true})
+	defer cleanup()
+	assert.Contains(t, gocBuild.goEnv(), "CGO_ENABLED=0")
+	assert.Contains(t, gocBuild.toolFlags(), "-extldflags=-static")
+
+	ci := &cover.CoverInfo{
+		Target:                   gocBuild.TmpDir,
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		Mode:                     gocBuild.CoverMode,
+		Center:                   "http://127.0.0.1:7777",
+		OneMainPackage:           true,
+	}
+	assert.NoError(t, gocBuild.Instrument(ci))
+	assert.NoError(t, gocBuild.Build())
+
+	// a statically linked binary has neither an interpreter nor shared libraries
+	f, err := elf.Open(binary)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+	for _, prog := range f.Progs {
+		assert.NotEqual(t, elf.PT_INTERP, prog.Type, "the binary should not have a dynamic linker")
+	}
+	libs, err := f.ImportedLibraries()
+	assert.NoError(t, err)
+	assert.Empty(t, libs)
+}
+
+func TestBuildStaticWithCgo(t *testing.T) {
+	if out, err := exec.Command("go", "env", "CGO_ENABLED").Output(); err != nil || strings.TrimSpace(string(out)) != "1" {
+		t.Skip("the files importing C are ignored without cgo")
+	}
+	defer setModuleEnv()()
+	workingDir := newStaticProject(t, map[string]string{
+		"main.go":   "package main\n\nimport \"example.com/static/clib\"\n\nfunc main() { clib.Hello() }\n",
+		"clib/c.go": "package clib\n\n// int answer() { return 42; }\nimport \"C\"\n\nfunc Hello() int { return int(C.answer()) }\n",
+	})
+	defer os.RemoveAll(workingDir)
+
+	_, err := NewBuildWithOptions(BuildOptions{Packages: []string{"."}, WorkingDir: workingDir, Static: true})
+	assert.True(t, errors.Is(err, ErrStaticCgo), "%v", err)
+	assert.Contains(t, err.Error(), "example.com/static/clib")
+
+	_, err = NewInstallWithOptions(BuildOptions{Packages: []string{"./..."}, WorkingDir: workingDir, Static: true})
+	assert.True(t, errors.Is(err, ErrStaticCgo), "%v", err)
+
+	// the ldflags given by the user are kept
+	b := &Build{Static: true, LDFlags: "-linkmode=external -extldflags=-static-pie"}
+	assert.Equal(t, "-linkmode=external -extldflags=-static-pie", b.ldflags())
+	b = &Build{LDFlags: "-s"}
+	assert.Equal(t, "-s", b.ldflags())
+}
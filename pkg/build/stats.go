@@ -0,0 +1,63 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/qiniu/goc/pkg/cover"
+)
+
+// BuildStats records how long the phases of a goc build took
+type BuildStats struct {
+	Copy       time.Duration // listing the packages and copying the project into the temporary directory
+	Instrument time.Duration // injecting the cover variables and the agent
+	Compile    time.Duration // the go command, for Run it includes the run of the program as well
+}
+
+// Total returns the time of all the phases
+func (s BuildStats) Total() time.Duration {
+	return s.Copy + s.Instrument + s.Compile
+}
+
+func (s BuildStats) String() string {
+	return fmt.Sprintf("copy: %v, instrument: %v, compile: %v, total: %v",
+		s.Copy.Round(time.Millisecond), s.Instrument.Round(time.Millisecond),
+		s.Compile.Round(time.Millisecond), s.Total().Round(time.Millisecond))
+}
+
+// Instrument does cover for the project in the temporary directory, and records how long it took,
+// nothing is done for the native coverage, which is built by the go command
+func (b *Build) Instrument(ci *cover.CoverInfo) error {
+	if b.NativeCover {
+		log.Infoln("Native coverage is used, skip instrumenting the source")
+		return nil
+	}
+	start := time.Now()
+	defer func() { b.Stats.Instrument = time.Since(start) }()
+	b.instrumented = true
+	return cover.Execute(ci)
+}
+
+// recordCompile records the time of the go command started at start, and logs the stats of the build
+func (b *Build) recordCompile(start time.Time) {
+	b.Stats.Compile = time.Since(start)
+	log.Infof("goc build stats, %v", b.Stats)
+}
@@ -0,0 +1,125 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/qiniu/goc/pkg/cover"
+)
+
+// Test runs 'go test' with coverage for all the packages in the temporary directory,
+// and returns the path of the coverage profile, which can be merged with the profiles
+// of the instrumented binaries by cover.Merge to get the unified coverage.
+// The flags are passed to 'go test', e.g. "-run TestFoo -count=1".
+// It must be called before the project is instrumented, the caller should remove the profile.
+func (b *Build) Test(flags string) (profilePath string, err error) {
+	if b.TmpWorkingDir == "" {
+		return "", fmt.Errorf("can only be called after Build.MvProjectsToTmp(): %w", ErrEmptyTempWorkingDir)
+	}
+	if b.instrumented {
+		return "", ErrTestInstrumented
+	}
+
+	f, err := ioutil.TempFile("", "goc-test-*.cov")
+	if err != nil {
+		return "", fmt.Errorf("fail to create the coverage profile, err: %v", err)
+	}
+	f.Close()
+	defer func() {
+		if err != nil {
+			os.Remove(f.Name())
+		}
+	}()
+
+	cmd := exec.Command("/bin/bash", "-c", b.goBinary()+" test -covermode="+b.CoverMode+" -coverprofile="+shellQuote(f.Name())+
+		" "+b.BuildFlags+b.toolFlags()+" "+flags+" ./...")
+	cmd.Dir = b.TmpWorkingDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = b.goEnv()
+
+	log.Infof("go test cmd is: %v", cmd.Args)
+	start := time.Now()
+	if err := b.startCmd(cmd); err != nil {
+		return "", fmt.Errorf("fail to execute: %v, err: %w", cmd.Args, err)
+	}
+	if err := b.waitCmd(cmd); err != nil {
+		return "", fmt.Errorf("fail to execute: %v, err: %w", cmd.Args, err)
+	}
+	log.Infof("Go test finished in %v, coverage profile: %v", time.Since(start).Round(time.Millisecond), f.Name())
+	return f.Name(), nil
+}
+
+// BuildTest compiles the test binary of the package with 'go test -c' from the temporary directory,
+// and returns its absolute path, e.g. to ship it into a container or onto a device and run the tests there.
+// The package is either an import path or a directory relative to the working directory, e.g. "./cmd/server".
+// The binary is named <package>.test as 'go test -c' does and written into the output directory of Build.
+// It is called after the project is instrumented, the test binary of a main package hosts the agent
+// and registers into the center like the service, so that its coverage is collected the same way.
+func (b *Build) BuildTest(pkg string) (string, error) {
+	if b.TmpWorkingDir == "" {
+		return "", fmt.Errorf("can only be called after Build.MvProjectsToTmp(): %w", ErrEmptyTempWorkingDir)
+	}
+	p := b.lookupPackage(pkg)
+	if p == nil {
+		return "", fmt.Errorf("%w: %v", ErrUnknownPackage, pkg)
+	}
+	dir := b.Target
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	output := filepath.Join(dir, path.Base(p.ImportPath)+".test")
+
+	cmd := exec.Command("/bin/bash", "-c", b.goBinary()+" test -c -o "+shellQuote(output)+" "+b.BuildFlags+
+		b.coverFlags()+b.toolFlags()+" "+shellQuote(p.ImportPath))
+	cmd.Dir = b.TmpWorkingDir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = b.goEnv()
+
+	log.Infof("go test -c cmd is: %v", cmd.Args)
+	defer b.recordCompile(time.Now())
+	if err := b.startCmd(cmd); err != nil {
+		return "", fmt.Errorf("fail to execute: %v, err: %w", cmd.Args, err)
+	}
+	if err := b.waitCmd(cmd); err != nil {
+		return "", fmt.Errorf("fail to execute: %v, err: %w", cmd.Args, err)
+	}
+	log.Infof("Go test binary is built: %v", output)
+	return output, nil
+}
+
+// lookupPackage returns the package of the project by the import path, or the directory relative
+// to the working directory, nil if it is not a package of the project
+func (b *Build) lookupPackage(pkg string) *cover.Package {
+	dir := filepath.Join(b.WorkingDir, pkg)
+	for _, p := range b.Pkgs {
+		if p.ImportPath == pkg || p.Dir == dir {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/qiniu/goc/pkg/cover"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildTest(t *testing.T) {
+	assert.True(t, errors.Is(func() error { _, err := (&Build{}).Test(""); return err }(), ErrEmptyTempWorkingDir))
+
+	// a trivial project with a tested package
+	workingDir, err := ioutil.TempDir("", "goc-test-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	files := map[string]string{
+		"go.mod":            "module example.com/tested\n\ngo 1.13\n",
+		"main.go":           "package main\n\nimport \"example.com/tested/calc\"\n\nfunc main() { println(calc.Abs(-1)) }\n",
+		"calc/calc.go":      "package calc\n\nfunc Abs(x int) int {\n\tif x < 0 {\n\t\treturn -x\n\t}\n\treturn x\n}\n",
+		"calc/calc_test.go": "package calc\n\nimport \"testing\"\n\nfunc TestAbs(t *testing.T) {\n\tif Abs(1) != 1 {\n\t\tt.Fail()\n\t}\n}\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(workingDir, name)), 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, name), []byte(content), 0644))
+	}
+
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir})
+	defer cleanup()
+
+	profilePath, err := gocBuild.Test("-count=1")
+	assert.NoError(t, err)
+	defer os.Remove(profilePath)
+	profile, err := ioutil.ReadFile(profilePath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(profile), "mode: "+gocBuild.CoverMode+"\n", "the mode should be the one of the build to merge the profiles")
+	// the block positions vary with the go versions
+	assert.Regexp(t, `example.com/tested/calc/calc.go:[0-9.,]+ 1 1\n`, string(profile), "the tested block should be covered")
+	assert.Regexp(t, `example.com/tested/calc/calc.go:[0-9.,]+ 1 0\n`, string(profile), "the untested block should not be covered")
+
+	// the profile merges with the ones of the instrumented binary
+	merged := filepath.Join(filepath.Dir(profilePath), "goc-test-merged.cov")
+	defer os.Remove(merged)
+	assert.NoError(t, cover.Merge([]string{profilePath, profilePath}, merged))
+
+	err = gocBuild.Instrument(&cover.CoverInfo{
+		Target:                   gocBuild.TmpDir,
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		Mode:                     gocBuild.CoverMode,
+		Center:                   "http://127.0.0.1:7777",
+		OneMainPackage:           true,
+	})
+	assert.NoError(t, err)
+	_, err = gocBuild.Test("")
+	assert.True(t, errors.Is(err, ErrTestInstrumented))
+}
+
+func TestBuildTestBinary(t *testing.T) {
+	assert.True(t, errors.Is(func() error { _, err := (&Build{}).BuildTest("."); return err }(), ErrEmptyTempWorkingDir))
+
+	workingDir, err := ioutil.TempDir("", "goc-test-binary-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	outputDir, err := ioutil.TempDir("", "goc-test-binary")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+	files := map[string]string{
+		"go.mod":  "module example.com/shipped\n\ngo 1.13\n",
+		"main.go": "package main\n\nfunc add(a, b int) int { return a + b }\n\nfunc main() { println(add(1, 2)) }\n",
+		// stay alive until the agent registers into the center
+		"main_test.go": "package main\n\nimport (\n\t\"testing\"\n\t\"time\"\n)\n\nfunc TestAdd(t *testing.T) {\n\tif add(1, 2) != 3 {\n\t\tt.Fail()\n\t}\n\ttime.Sleep(time.Second)\n}\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, name), []byte(content), 0644))
+	}
+
+	registered := make(chan string, 10)
+	center := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		registered <- r.URL.Path
+		w.Write([]byte(`{"result":"success"}`))
+	}))
+	defer center.Close()
+
+	gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir, OutputDir: outputDir})
+	defer cleanup()
+	_, err = gocBuild.BuildTest("./notexist")
+	assert.True(t, errors.Is(err, ErrUnknownPackage))
+
+	err = gocBuild.Instrument(&cover.CoverInfo{
+		Target:                   gocBuild.TmpDir,
+		IsMod:                    gocBuild.IsMod,
+		ModRootPath:              gocBuild.ModRootPath,
+		GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		Mode:                     gocBuild.CoverMode,
+		Center:                   center.URL,
+		OneMainPackage:           true,
+	})
+	assert.NoError(t, err)
+	binary, err := gocBuild.BuildTest(".")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(outputDir, "shipped.test"), binary)
+
+	// the test binary runs the tests and hosts the agent like the service
+	out, err := exec.Command(binary, "-test.v").CombinedOutput()
+	assert.NoError(t, err, string(out))
+	assert.Contains(t, string(out), "--- PASS: TestAdd")
+	select {
+	case path := <-registered:
+		assert.Equal(t, "/v1/cover/register", path)
+	default:
+		assert.Fail(t, "the test binary should register into the center")
+	}
+}
@@ -0,0 +1,60 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"os/exec"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// startCmd starts the go command, which is put into its own process group
+// if there is a timeout, so that the processes it spawns can be killed together
+func (b *Build) startCmd(cmd *exec.Cmd) error {
+	if b.Timeout > 0 {
+		setProcessGroup(cmd)
+	}
+	return cmd.Start()
+}
+
+// waitCmd waits for the started go command, the process group of the command
+// is killed if it does not exit in Build.Timeout
+func (b *Build) waitCmd(cmd *exec.Cmd) error {
+	if b.Timeout <= 0 {
+		return cmd.Wait()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	timer := time.NewTimer(b.Timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		log.Warnf("%v does not finish in %v, kill it", cmd.Args, b.Timeout)
+		if err := killProcessGroup(cmd); err != nil {
+			log.Warnf("fail to kill the process group %d: %v", cmd.Process.Pid, err)
+		}
+		<-done
+		return fmt.Errorf("%w: %v", ErrTimeout, b.Timeout)
+	}
+}
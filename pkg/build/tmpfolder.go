@@ -24,28 +24,59 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/qiniu/goc/pkg/cover"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
 
-// MvProjectsToTmp moves the projects into a temporary directory
+// MvProjectsToTmp moves the projects into a temporary directory.
+// The import paths are kept in the temporary directory, i.e. the module path of a module project,
+// or the path under GOPATH/src of a legacy project, so the internal packages remain importable.
 func (b *Build) MvProjectsToTmp() error {
+	start := time.Now()
+	defer func() { b.Stats.Copy = time.Since(start) }()
+	if err := b.checkGoMod(); err != nil {
+		log.Errorln(err)
+		return err
+	}
+	b.BuildFlags = addVendorFlag(b.BuildFlags, b.WorkingDir, b.goEnv())
 	listArgs := []string{"-json"}
 	if len(b.BuildFlags) != 0 {
 		listArgs = append(listArgs, b.BuildFlags)
 	}
 	listArgs = append(listArgs, "./...")
-	var err error
-	b.Pkgs, err = cover.ListPackages(b.WorkingDir, strings.Join(listArgs, " "), "")
-	if err != nil {
-		log.Errorln(err)
-		return err
+
+	// go list is slow on large projects, run it while preparing the temporary directory
+	type listResult struct {
+		pkgs map[string]*cover.Package
+		err  error
+	}
+	listed := make(chan listResult, 1)
+	go func() {
+		pkgs, err := cover.ListPackagesWithEnv(b.WorkingDir, strings.Join(listArgs, " "), b.goEnv())
+		listed <- listResult{pkgs: pkgs, err: err}
+	}()
+	prepareErr := b.prepareTmpDir()
+	result := <-listed
+	if result.err != nil {
+		if prepareErr == nil {
+			os.RemoveAll(b.TmpDir)
+			b.unlockTmpDir()
+		}
+		log.Errorln(result.err)
+		return result.err
 	}
+	if prepareErr != nil {
+		log.Errorf("Fail to move the project to temporary directory")
+		return prepareErr
+	}
+	b.Pkgs = result.pkgs
 
-	err = b.mvProjectsToTmp()
+	err := b.mvProjectsToTmp()
 	if err != nil {
+		b.unlockTmpDir()
 		log.Errorf("Fail to move the project to temporary directory")
 		return err
 	}
@@ -68,8 +99,12 @@ func (b *Build) MvProjectsToTmp() error {
 	return nil
 }
 
-func (b *Build) mvProjectsToTmp() error {
+// prepareTmpDir locks and creates an empty temporary directory for the project
+func (b *Build) prepareTmpDir() error {
 	b.TmpDir = filepath.Join(os.TempDir(), tmpFolderName(b.WorkingDir))
+	if err := b.lockTmpDir(); err != nil {
+		return err
+	}
 
 	// Delete previous tmp folder and its content
 	os.RemoveAll(b.TmpDir)
@@ -77,10 +112,31 @@ func (b *Build) mvProjectsToTmp() error {
 	b.GlobalCoverVarImportPath = filepath.Join("src", tmpPackageName(b.WorkingDir))
 	err := os.MkdirAll(filepath.Join(b.TmpDir, b.GlobalCoverVarImportPath), os.ModePerm)
 	if err != nil {
+		b.unlockTmpDir()
 		return fmt.Errorf("Fail to create the temporary build directory. The err is: %v", err)
 	}
 	log.Infof("Tmp project generated in: %v", b.TmpDir)
+	warnCrossFilesystem(b.TmpDir, b.WorkingDir)
+	return nil
+}
+
+// warnCrossFilesystem warns that copying the project into the temporary directory is slow
+// if they are on different filesystems, which is often the case with a tmpfs /tmp
+func warnCrossFilesystem(tmpDir, projectDir string) {
+	same, err := sameFilesystem(tmpDir, projectDir)
+	if err != nil {
+		log.Debugf("fail to tell the filesystems of %v and %v: %v", tmpDir, projectDir, err)
+		return
+	}
+	if !same {
+		log.Warnf("The temporary directory %v is on a different filesystem from the project %v, copying the project may be slow, "+
+			"set TMPDIR to a directory on the same filesystem to speed it up", tmpDir, projectDir)
+	}
+}
 
+// mvProjectsToTmp copies the listed packages into the prepared temporary directory
+func (b *Build) mvProjectsToTmp() error {
+	var err error
 	// traverse pkg list to get project meta info
 	b.IsMod, b.Root, err = b.traversePkgsList()
 	log.Infof("mod project? %v", b.IsMod)
@@ -99,6 +155,9 @@ func (b *Build) mvProjectsToTmp() error {
 	if b.IsMod == false && b.Root != "" {
 		b.cpLegacyProject()
 	} else if b.IsMod == true { // go 1.11, 1.12 has no Build.Root
+		if b.copyDepsOnly {
+			b.restrictCopyToClosure()
+		}
 		b.cpGoModulesProject()
 		updated, newGoModContent, err := b.updateGoModFile()
 		if err != nil {
@@ -117,7 +176,7 @@ func (b *Build) mvProjectsToTmp() error {
 		b.cpNonStandardLegacy()
 	}
 
-	log.Infof("New workingdir in tmp directory in: %v", b.TmpWorkingDir)
+	log.Infof("New workingdir in tmp directory in: %v", b.InstrumentedWorkingDir())
 	return nil
 }
 
@@ -203,8 +262,16 @@ func (b *Build) findWhereToInstall() (string, error) {
 	return filepath.Join(os.Getenv("HOME"), "go", "bin"), nil
 }
 
+// InstrumentedWorkingDir returns the working directory in the temporary directory,
+// where the instrumented source of the current directory lives.
+// It is empty before the project is moved to the temporary directory.
+func (b *Build) InstrumentedWorkingDir() string {
+	return b.TmpWorkingDir
+}
+
 // Clean clears up the temporary workspace
 func (b *Build) Clean() error {
+	defer b.unlockTmpDir()
 	if !viper.GetBool("debug") {
 		return os.RemoveAll(b.TmpDir)
 	}
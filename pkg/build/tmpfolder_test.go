@@ -17,12 +17,16 @@
 package build
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/qiniu/goc/pkg/cover"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -36,8 +40,7 @@ func TestNewDirParseInLegacyProject(t *testing.T) {
 	workingDir := filepath.Join(baseDir, "../../tests/samples/simple_gopath_project/src/qiniu.com/simple_gopath_project")
 	gopath := filepath.Join(baseDir, "../../tests/samples/simple_gopath_project")
 
-	os.Setenv("GOPATH", gopath)
-	os.Setenv("GO111MODULE", "off")
+	defer setEnv(map[string]string{"GOPATH": gopath, "GO111MODULE": "off"})()
 
 	b, _ := NewInstall("", []string{"."}, workingDir)
 	if -1 == strings.Index(b.TmpWorkingDir, b.TmpDir) {
@@ -48,7 +51,9 @@ func TestNewDirParseInLegacyProject(t *testing.T) {
 		t.Fatalf("The New GOPATH is wrong. newgopath: %v, tmpdir: %v", b.NewGOPATH, b.TmpDir)
 	}
 
+	b.Clean()
 	b, _ = NewBuild("", []string{"."}, workingDir, "")
+	defer b.Clean()
 	if -1 == strings.Index(b.TmpWorkingDir, b.TmpDir) {
 		t.Fatalf("Directory parse error. newwd: %v, tmpdir: %v", b.TmpWorkingDir, b.TmpDir)
 	}
@@ -63,8 +68,7 @@ func TestNewDirParseInModProject(t *testing.T) {
 	gopath := ""
 
 	fmt.Println(gopath)
-	os.Setenv("GOPATH", gopath)
-	os.Setenv("GO111MODULE", "on")
+	defer setEnv(map[string]string{"GOPATH": gopath, "GO111MODULE": "on"})()
 
 	b, _ := NewInstall("", []string{"."}, workingDir)
 	if -1 == strings.Index(b.TmpWorkingDir, b.TmpDir) {
@@ -75,11 +79,17 @@ func TestNewDirParseInModProject(t *testing.T) {
 		t.Fatalf("The New GOPATH is wrong. newgopath: %v, tmpdir: %v", b.NewGOPATH, b.TmpDir)
 	}
 
+	b.Clean()
 	b, _ = NewBuild("", []string{"."}, workingDir, "")
+	defer b.Clean()
 	if -1 == strings.Index(b.TmpWorkingDir, b.TmpDir) {
 		t.Fatalf("Directory parse error. newwd: %v, tmpdir: %v", b.TmpWorkingDir, b.TmpDir)
 	}
 
+	if b.InstrumentedWorkingDir() != b.TmpWorkingDir {
+		t.Fatalf("The instrumented working directory is wrong. got: %v, want: %v", b.InstrumentedWorkingDir(), b.TmpWorkingDir)
+	}
+
 	if b.NewGOPATH != "" {
 		t.Fatalf("The New GOPATH is wrong. newgopath: %v, tmpdir: %v", b.NewGOPATH, b.TmpDir)
 	}
@@ -91,10 +101,10 @@ func TestLegacyProjectNotInGoPATH(t *testing.T) {
 	gopath := ""
 
 	fmt.Println(gopath)
-	os.Setenv("GOPATH", gopath)
-	os.Setenv("GO111MODULE", "off")
+	defer setEnv(map[string]string{"GOPATH": gopath, "GO111MODULE": "off"})()
 
 	b, _ := NewBuild("", []string{"."}, workingDir, "")
+	defer b.Clean()
 	if b.OriGOPATH != b.NewGOPATH {
 		t.Fatalf("New GOPATH should be same with old GOPATH, for this kind of project. New: %v, old: %v", b.NewGOPATH, b.OriGOPATH)
 	}
@@ -105,6 +115,24 @@ func TestLegacyProjectNotInGoPATH(t *testing.T) {
 	}
 }
 
+// test the temporary directory is locked during the build
+func TestTmpDirLocked(t *testing.T) {
+	workingDir := filepath.Join(baseDir, "../../tests/samples/simple_project")
+	defer setModuleEnv()()
+
+	// simulate another goc process holding the lock
+	held := &Build{TmpDir: filepath.Join(os.TempDir(), tmpFolderName(workingDir))}
+	assert.NoError(t, held.lockTmpDir())
+
+	_, err := NewBuild("", []string{"."}, workingDir, "")
+	assert.True(t, errors.Is(err, ErrTmpDirLocked))
+
+	held.unlockTmpDir()
+	b, err := NewBuild("", []string{"."}, workingDir, "")
+	assert.NoError(t, err)
+	b.Clean()
+}
+
 // test traversePkgsList error case
 func TestTraversePkgsList(t *testing.T) {
 	b := &Build{
@@ -148,3 +176,130 @@ func TestFindWhereToInstall(t *testing.T) {
 	expectedPlace := filepath.Join(os.Getenv("HOME"), "go", "bin")
 	assert.Equal(t, placeToInstall, expectedPlace)
 }
+
+// in module mode, a project without go.mod should fail with a descriptive error
+func TestProjectWithoutGoMod(t *testing.T) {
+	root, err := ioutil.TempDir("", "goc-nogomod")
+	assert.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	gopath := filepath.Join(root, "gopath")
+	inGopath := filepath.Join(gopath, "src", "example.com", "foo")
+	outOfGopath := filepath.Join(root, "project")
+	for _, dir := range []string{inGopath, outOfGopath} {
+		assert.NoError(t, os.MkdirAll(dir, 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	}
+	defer setEnv(map[string]string{"GOPATH": gopath, "GO111MODULE": "on"})()
+
+	_, err = NewBuild("", []string{"."}, outOfGopath, "")
+	assert.True(t, errors.Is(err, ErrNoGoMod), "should fail with ErrNoGoMod, got %v", err)
+	assert.Contains(t, err.Error(), "no go.mod in "+outOfGopath)
+	assert.Contains(t, err.Error(), "not under GOPATH "+gopath)
+
+	_, err = NewBuild("", []string{"."}, inGopath, "")
+	assert.True(t, errors.Is(err, ErrNoGoMod), "should fail with ErrNoGoMod, got %v", err)
+	assert.Contains(t, err.Error(), "under GOPATH "+gopath)
+	assert.Contains(t, err.Error(), "GO111MODULE=off")
+
+	// the module mode is probed with the go command of the build
+	goBinary, removeGo := fakeGo(t, fmt.Sprintf("echo %s\necho '%s'\n", os.DevNull, gopath))
+	defer removeGo()
+	_, err = NewBuildWithOptions(BuildOptions{Packages: []string{"."}, WorkingDir: filepath.Join(baseDir, "../../tests/samples/simple_project"),
+		GoBinary: goBinary})
+	assert.True(t, errors.Is(err, ErrNoGoMod), "should fail with ErrNoGoMod of the given go, got %v", err)
+}
+
+// the main package importing the internal packages builds in the temporary directory
+func TestMvProjectWithInternalPackages(t *testing.T) {
+	// GOPATH and GO111MODULE are set per case
+	defer setEnv(map[string]string{"GOPATH": "", "GO111MODULE": "", "GOFLAGS": ""})()
+
+	// a legacy project under GOPATH
+	gopath, err := ioutil.TempDir("", "goc-internal-gopath")
+	assert.NoError(t, err)
+	defer os.RemoveAll(gopath)
+	legacyDir := filepath.Join(gopath, "src/example.com/legacy")
+	assert.NoError(t, os.MkdirAll(filepath.Join(legacyDir, "internal/greet"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(legacyDir, "main.go"),
+		[]byte("package main\n\nimport \"example.com/legacy/internal/greet\"\n\nfunc main() { greet.Hello() }\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(legacyDir, "internal/greet/greet.go"),
+		[]byte("package greet\n\nimport \"fmt\"\n\nfunc Hello() { fmt.Println(\"hello\") }\n"), 0644))
+
+	outputDir, err := ioutil.TempDir("", "goc-internal")
+	assert.NoError(t, err)
+	defer os.RemoveAll(outputDir)
+
+	var tcs = []struct {
+		workingDir string
+		gopath     string
+		module     string
+		importPath string // the import path of the internal package
+	}{
+		{
+			workingDir: filepath.Join(baseDir, "../../tests/samples/simple_project_with_internal"),
+			module:     "example.com/simple-project",
+			importPath: "example.com/simple-project/internal",
+		},
+		{
+			workingDir: legacyDir,
+			gopath:     gopath,
+			importPath: "example.com/legacy/internal/greet",
+		},
+	}
+	for _, tc := range tcs {
+		os.Setenv("GOPATH", tc.gopath)
+		if tc.module != "" {
+			os.Setenv("GO111MODULE", "on")
+		} else {
+			os.Setenv("GO111MODULE", "off")
+		}
+
+		binary := filepath.Join(outputDir, filepath.Base(tc.workingDir))
+		gocBuild, err := NewBuild("", []string{"."}, tc.workingDir, binary)
+		if !assert.NoError(t, err, tc.workingDir) {
+			continue
+		}
+		assert.Equal(t, tc.module, gocBuild.ModRootPath, "the module path should be kept")
+		if tc.module != "" {
+			goMod, err := ioutil.ReadFile(filepath.Join(gocBuild.TmpDir, "go.mod"))
+			assert.NoError(t, err)
+			assert.Contains(t, string(goMod), "module "+tc.module+"\n")
+		}
+
+		err = gocBuild.Instrument(&cover.CoverInfo{
+			Target:                   gocBuild.TmpDir,
+			GoPath:                   gocBuild.NewGOPATH,
+			IsMod:                    gocBuild.IsMod,
+			ModRootPath:              gocBuild.ModRootPath,
+			GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+			Mode:                     gocBuild.CoverMode,
+			Center:                   "http://127.0.0.1:7777",
+			OneMainPackage:           true,
+		})
+		assert.NoError(t, err, tc.workingDir)
+		apis, err := ioutil.ReadFile(filepath.Join(gocBuild.TmpWorkingDir, "http_cover_apis_auto_generated.go"))
+		assert.NoError(t, err)
+		assert.Contains(t, string(apis), tc.importPath, "the internal package should be instrumented")
+
+		assert.NoError(t, gocBuild.Build(), "the internal packages should be importable in %s", tc.workingDir)
+		assert.NoError(t, exec.Command(binary).Run())
+		gocBuild.Clean()
+	}
+}
+
+func TestSameFilesystem(t *testing.T) {
+	same, err := sameFilesystem(baseDir, filepath.Join(baseDir, "../.."))
+	assert.NoError(t, err)
+	assert.True(t, same)
+
+	// procfs is always a filesystem of its own
+	if _, err := os.Stat("/proc/self"); err == nil {
+		same, err = sameFilesystem("/proc/self", baseDir)
+		assert.NoError(t, err)
+		assert.False(t, same)
+	}
+
+	_, err = sameFilesystem(filepath.Join(baseDir, "nonexistent"), baseDir)
+	assert.Error(t, err)
+}
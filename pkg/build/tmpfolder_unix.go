@@ -0,0 +1,47 @@
+//go:build !windows
+// +build !windows
+
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"os"
+	"syscall"
+)
+
+// sameFilesystem reports whether the two paths are on the same device,
+// they are regarded as the same if the device numbers are not available
+func sameFilesystem(a, b string) (bool, error) {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	fb, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	sa, ok := fa.Sys().(*syscall.Stat_t)
+	if !ok {
+		return true, nil
+	}
+	sb, ok := fb.Sys().(*syscall.Stat_t)
+	if !ok {
+		return true, nil
+	}
+	return sa.Dev == sb.Dev, nil
+}
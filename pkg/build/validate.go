@@ -0,0 +1,82 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/qiniu/goc/pkg/cover"
+)
+
+// maxReportedSyntaxErrors bounds the number of the invalid instrumented files reported by Validate
+const maxReportedSyntaxErrors = 10
+
+// Validate instruments the project in the temporary directory and checks the instrumented source
+// still parses, without running the go command, e.g. as a fast check in a pre-commit hook.
+// The errors of instrumenting, e.g. a declared identifier colliding with the coverage counters,
+// are returned as they are, and the invalid instrumented files wrapped in ErrInvalidInstrumented.
+func (b *Build) Validate(ci *cover.CoverInfo) error {
+	if b.NativeCover {
+		log.Warnln("Native coverage is used, nothing to validate as the source is not instrumented")
+		return nil
+	}
+	if err := b.Instrument(ci); err != nil {
+		return err
+	}
+	return checkSyntax(b.TmpDir)
+}
+
+// checkSyntax parses the go files under dir, the vendored and the testdata ones are skipped
+func checkSyntax(dir string) error {
+	var invalid []string
+	fset := token.NewFileSet()
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && (info.Name() == "vendor" || info.Name() == "testdata" || strings.HasPrefix(info.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		if _, err := parser.ParseFile(fset, path, nil, parser.AllErrors); err != nil {
+			invalid = append(invalid, err.Error())
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("fail to walk the instrumented source in %v: %v", dir, err)
+	}
+	if len(invalid) == 0 {
+		return nil
+	}
+	if len(invalid) > maxReportedSyntaxErrors {
+		invalid = append(invalid[:maxReportedSyntaxErrors], fmt.Sprintf("and %d more", len(invalid)-maxReportedSyntaxErrors))
+	}
+	return fmt.Errorf("%w:\n%s", ErrInvalidInstrumented, strings.Join(invalid, "\n"))
+}
@@ -0,0 +1,94 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/qiniu/goc/pkg/cover"
+)
+
+func TestValidate(t *testing.T) {
+	// a fake go tells whether it is run
+	fakeDir, err := ioutil.TempDir("", "goc-fake-go")
+	assert.NoError(t, err)
+	defer os.RemoveAll(fakeDir)
+	ranFile := filepath.Join(fakeDir, "ran")
+	goBinary := filepath.Join(fakeDir, "go")
+	assert.NoError(t, ioutil.WriteFile(goBinary, []byte(fmt.Sprintf("#!/bin/sh\ntouch '%s'\n", ranFile)), 0755))
+
+	var tcs = []struct {
+		project string
+		err     error
+	}{
+		{project: "simple_project"},
+		{project: "cover_var_collision_project", err: cover.ErrCoverVarCollision},
+	}
+	for _, tc := range tcs {
+		workingDir := filepath.Join(baseDir, "../../tests/samples", tc.project)
+		gocBuild, cleanup := newTestBuild(t, BuildOptions{WorkingDir: workingDir, GoBinary: goBinary})
+		// only the go command probing the module is run before Validate
+		os.Remove(ranFile)
+		err := gocBuild.Validate(&cover.CoverInfo{
+			Target:                   gocBuild.TmpDir,
+			Mode:                     gocBuild.CoverMode,
+			Center:                   "http://127.0.0.1:7777",
+			IsMod:                    gocBuild.IsMod,
+			ModRootPath:              gocBuild.ModRootPath,
+			OneMainPackage:           true,
+			GlobalCoverVarImportPath: gocBuild.GlobalCoverVarImportPath,
+		})
+		if tc.err != nil {
+			assert.True(t, errors.Is(err, tc.err), "%s: %v", tc.project, err)
+		} else {
+			assert.NoError(t, err, tc.project)
+		}
+		// the go command is not run by Validate
+		_, err = os.Stat(ranFile)
+		assert.True(t, os.IsNotExist(err), tc.project)
+		cleanup()
+	}
+}
+
+func TestCheckSyntax(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-check-syntax")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"main.go":             "package main\n\nfunc main() {}\n",
+		"vendor/foo/foo.go":   "package foo\n\nfunc {\n",
+		"testdata/bad/bad.go": "not go at all",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755))
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	assert.NoError(t, checkSyntax(dir))
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "broken.go"), []byte("package main\n\nvar x = \n"), 0644))
+	err = checkSyntax(dir)
+	assert.True(t, errors.Is(err, ErrInvalidInstrumented), "%v", err)
+	assert.Contains(t, err.Error(), "broken.go:")
+}
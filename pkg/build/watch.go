@@ -0,0 +1,234 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	log "github.com/sirupsen/logrus"
+)
+
+// watchDebounce is how long the Watcher waits for the file system to be quiet before reporting a change
+var watchDebounce = 500 * time.Millisecond
+
+// Watcher watches the Go source files under a directory recursively
+type Watcher struct {
+	dir     string
+	ignores []ignorePattern
+	watcher *fsnotify.Watcher
+	changes chan string
+	done    chan struct{}
+}
+
+// NewWatcher watches the Go source files, go.mod and go.sum under dir.
+// The files matching the .gitignore of dir or the excludes are not watched,
+// the patterns are in the gitignore style except that negation and "**" are not supported.
+func NewWatcher(dir string, excludes []string) (*Watcher, error) {
+	ignores, err := loadIgnoreFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return nil, err
+	}
+	for _, exclude := range append([]string{".git/"}, excludes...) {
+		if p, ok := parseIgnorePattern(exclude); ok {
+			ignores = append(ignores, p)
+		}
+	}
+
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("fail to create file watcher: %v", err)
+	}
+	w := &Watcher{
+		dir:     dir,
+		ignores: ignores,
+		watcher: fw,
+		changes: make(chan string, 1),
+		done:    make(chan struct{}),
+	}
+	if err := w.addDir(dir); err != nil {
+		fw.Close()
+		return nil, err
+	}
+	go w.loop()
+	return w, nil
+}
+
+// Changes returns a channel which receives the last changed file
+// once the changes settle down
+func (w *Watcher) Changes() <-chan string {
+	return w.changes
+}
+
+// Close stops watching
+func (w *Watcher) Close() error {
+	close(w.done)
+	return w.watcher.Close()
+}
+
+func (w *Watcher) loop() {
+	var (
+		timer <-chan time.Time
+		last  string
+	)
+	for {
+		select {
+		case ev, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if ev.Op == fsnotify.Chmod {
+				continue
+			}
+			if ev.Op&fsnotify.Create != 0 {
+				if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+					if err := w.addDir(ev.Name); err != nil {
+						log.Warnf("fail to watch %v: %v", ev.Name, err)
+					}
+					continue
+				}
+			}
+			if !w.isSource(ev.Name) {
+				continue
+			}
+			last = ev.Name
+			timer = time.After(watchDebounce)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Warnf("file watcher error: %v", err)
+		case <-timer:
+			timer = nil
+			select {
+			case w.changes <- last:
+			default:
+				// a change is pending already
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// addDir watches dir and its sub directories which are not ignored
+func (w *Watcher) addDir(dir string) error {
+	return filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if p != w.dir && w.ignored(p, true) {
+			return filepath.SkipDir
+		}
+		if err := w.watcher.Add(p); err != nil {
+			return fmt.Errorf("fail to watch %v: %v", p, err)
+		}
+		return nil
+	})
+}
+
+// isSource reports whether the file affects the build
+func (w *Watcher) isSource(file string) bool {
+	base := filepath.Base(file)
+	if filepath.Ext(base) != ".go" && base != "go.mod" && base != "go.sum" {
+		return false
+	}
+	return !w.ignored(file, false)
+}
+
+func (w *Watcher) ignored(file string, isDir bool) bool {
+	rel, err := filepath.Rel(w.dir, file)
+	if err != nil {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	for _, p := range w.ignores {
+		if p.match(rel, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignorePattern is a simplified pattern of .gitignore
+type ignorePattern struct {
+	pattern  string
+	dirOnly  bool // pattern ends with "/", only matches directories
+	anchored bool // pattern contains "/", matches the path relative to the root
+}
+
+func parseIgnorePattern(line string) (ignorePattern, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") {
+		return ignorePattern{}, false
+	}
+	var p ignorePattern
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if strings.Contains(line, "/") {
+		p.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	p.pattern = line
+	return p, true
+}
+
+func (p ignorePattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	name := rel
+	if !p.anchored {
+		name = path.Base(rel)
+	}
+	ok, _ := path.Match(p.pattern, name)
+	return ok
+}
+
+func loadIgnoreFile(file string) ([]ignorePattern, error) {
+	f, err := os.Open(file)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("fail to open %v: %v", file, err)
+	}
+	defer f.Close()
+
+	var ignores []ignorePattern
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if p, ok := parseIgnorePattern(s.Text()); ok {
+			ignores = append(ignores, p)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("fail to read %v: %v", file, err)
+	}
+	return ignores, nil
+}
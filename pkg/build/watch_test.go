@@ -0,0 +1,111 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package build
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIgnorePattern(t *testing.T) {
+	var tcs = []struct {
+		pattern string
+		file    string
+		isDir   bool
+		ignored bool
+	}{
+		{pattern: "vendor/", file: "vendor", isDir: true, ignored: true},
+		{pattern: "vendor/", file: "a/vendor", isDir: true, ignored: true},
+		{pattern: "vendor/", file: "vendor", isDir: false, ignored: false},
+		{pattern: "*.pb.go", file: "api/foo.pb.go", ignored: true},
+		{pattern: "*.pb.go", file: "api/foo.go", ignored: false},
+		{pattern: "/gen", file: "gen", isDir: true, ignored: true},
+		{pattern: "/gen", file: "a/gen", isDir: true, ignored: false},
+		{pattern: "a/*.go", file: "a/b.go", ignored: true},
+	}
+	for _, tc := range tcs {
+		p, ok := parseIgnorePattern(tc.pattern)
+		assert.True(t, ok)
+		assert.Equal(t, tc.ignored, p.match(tc.file, tc.isDir), "pattern %s, file %s", tc.pattern, tc.file)
+	}
+
+	for _, line := range []string{"", "  ", "# comment", "!keep.go"} {
+		_, ok := parseIgnorePattern(line)
+		assert.False(t, ok, line)
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	debounce := watchDebounce
+	watchDebounce = 50 * time.Millisecond
+	defer func() { watchDebounce = debounce }()
+
+	dir, err := ioutil.TempDir("", "goc-watch")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "vendor", "foo"), 0755))
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "pkg"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, ".gitignore"), []byte("vendor/\n"), 0644))
+
+	w, err := NewWatcher(dir, []string{"*_mock.go"})
+	if !assert.NoError(t, err) {
+		assert.FailNow(t, "should create the watcher")
+	}
+	defer w.Close()
+
+	expectNoChange := func() {
+		select {
+		case file := <-w.Changes():
+			assert.Fail(t, "unexpected change", file)
+		case <-time.After(4 * watchDebounce):
+		}
+	}
+	expectChange := func(expected string) {
+		select {
+		case file := <-w.Changes():
+			assert.Equal(t, expected, file)
+		case <-time.After(5 * time.Second):
+			assert.Fail(t, "change is not reported", expected)
+		}
+	}
+
+	// changes of ignored or non source files
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "vendor", "foo", "foo.go"), []byte("package foo\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "pkg", "foo_mock.go"), []byte("package pkg\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("readme\n"), 0644))
+	expectNoChange()
+
+	// several changes are reported once
+	file := filepath.Join(dir, "pkg", "pkg.go")
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, ioutil.WriteFile(file, []byte("package pkg\n"), 0644))
+	}
+	expectChange(file)
+	expectNoChange()
+
+	// files in the new directories are watched
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "cmd"), 0755))
+	time.Sleep(2 * watchDebounce)
+	file = filepath.Join(dir, "cmd", "main.go")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("package main\n"), 0644))
+	expectChange(file)
+}
@@ -0,0 +1,140 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"golang.org/x/tools/cover"
+	"k8s.io/test-infra/gopherage/pkg/cov"
+)
+
+// ProfileAccumulator merges the profiles into the counters of the blocks one profile at a time, so that
+// merging many profiles only holds the merged profile and the one being added in memory, instead of
+// all of them like MergeProfiles. The result is the same as MergeProfiles of the profiles in the order
+// they are added. It is safe to add the profiles concurrently.
+type ProfileAccumulator struct {
+	mu    sync.Mutex
+	mode  string
+	files map[string]*cover.Profile
+}
+
+// NewProfileAccumulator creates an empty accumulator
+func NewProfileAccumulator() *ProfileAccumulator {
+	return &ProfileAccumulator{files: map[string]*cover.Profile{}}
+}
+
+// Add parses the profile read from r and merges it into the counters
+func (a *ProfileAccumulator) Add(r io.Reader) error {
+	profile, err := parseProfile(r)
+	if err != nil {
+		return err
+	}
+	return a.AddProfiles(profile)
+}
+
+// AddProfiles merges the parsed profile into the counters, nothing is merged if any file of it mismatches
+// the blocks merged before, or it is in a mode incompatible with them, see MergeProfiles for the modes
+func (a *ProfileAccumulator) AddProfiles(profile []*cover.Profile) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	mode := a.mode
+	for _, p := range profile {
+		if mode == "" {
+			mode = p.Mode
+			continue
+		}
+		if p.Mode != mode && (p.Mode == "set" || mode == "set") {
+			return fmt.Errorf("%w: mode for %s mismatches, %s vs %s", ErrIncompatibleMode, p.FileName, p.Mode, mode)
+		}
+	}
+	for _, p := range profile {
+		if dest, ok := a.files[p.FileName]; ok {
+			if err := ensureBlocksMatch(dest, p); err != nil {
+				return fmt.Errorf("error merging %s: %v", p.FileName, err)
+			}
+		}
+	}
+
+	a.mode = mode
+	for _, p := range profile {
+		dest, ok := a.files[p.FileName]
+		if !ok {
+			blocks := make([]cover.ProfileBlock, len(p.Blocks))
+			copy(blocks, p.Blocks)
+			a.files[p.FileName] = &cover.Profile{FileName: p.FileName, Mode: mode, Blocks: blocks}
+			continue
+		}
+		for i, block := range p.Blocks {
+			dest.Blocks[i].Count += block.Count
+		}
+	}
+	return nil
+}
+
+// Len returns the number of the files merged
+func (a *ProfileAccumulator) Len() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.files)
+}
+
+// Profiles returns a copy of the merged profile sorted by the file names
+func (a *ProfileAccumulator) Profiles() []*cover.Profile {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	merged := make([]*cover.Profile, 0, len(a.files))
+	for _, p := range a.files {
+		blocks := make([]cover.ProfileBlock, len(p.Blocks))
+		copy(blocks, p.Blocks)
+		if a.mode == "set" {
+			for i := range blocks {
+				if blocks[i].Count > 1 {
+					blocks[i].Count = 1
+				}
+			}
+		}
+		merged = append(merged, &cover.Profile{FileName: p.FileName, Mode: p.Mode, Blocks: blocks})
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].FileName < merged[j].FileName })
+	return merged
+}
+
+// Dump writes the merged profile into w
+func (a *ProfileAccumulator) Dump(w io.Writer) error {
+	return cov.DumpProfile(a.Profiles(), w)
+}
+
+// ensureBlocksMatch checks the blocks of the profiles of the same file refer to the same code
+func ensureBlocksMatch(a, b *cover.Profile) error {
+	if len(a.Blocks) != len(b.Blocks) {
+		return fmt.Errorf("file block count for %s mismatches (%d vs %d)", a.FileName, len(a.Blocks), len(b.Blocks))
+	}
+	for i, ba := range a.Blocks {
+		bb := b.Blocks[i]
+		if ba.StartLine != bb.StartLine || ba.StartCol != bb.StartCol ||
+			ba.EndLine != bb.EndLine || ba.EndCol != bb.EndCol || ba.NumStmt != bb.NumStmt {
+			return fmt.Errorf("coverage block mismatch: block #%d for %s (%+v mismatches %+v)", i, a.FileName, ba, bb)
+		}
+	}
+	return nil
+}
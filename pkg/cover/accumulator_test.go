@@ -0,0 +1,100 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/cover"
+	"k8s.io/test-infra/gopherage/pkg/cov"
+)
+
+// randomProfile generates the profile of a binary built from the files, some of the files are left out
+// like the binaries built from part of the packages
+func randomProfile(r *rand.Rand, mode string, files []string) string {
+	var buf strings.Builder
+	buf.WriteString("mode: " + mode + "\n")
+	for i, file := range files {
+		if i > 0 && r.Intn(3) == 0 {
+			continue
+		}
+		for line := 1; line < 40; line += 4 {
+			count := r.Intn(5)
+			if mode == "set" && count > 1 {
+				count = 1
+			}
+			fmt.Fprintf(&buf, "%s:%d.2,%d.10 %d %d\n", file, line, line+2, line%3+1, count)
+		}
+	}
+	return buf.String()
+}
+
+func TestProfileAccumulatorMatchesBatchMerge(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	files := []string{"example.com/foo/main.go", "example.com/foo/a/a.go", "example.com/foo/b/b.go", "example.com/foo/c/c.go"}
+	for _, modes := range [][]string{{"count"}, {"atomic", "count"}, {"set"}} {
+		t.Run(strings.Join(modes, "+"), func(t *testing.T) {
+			var raws []string
+			for i := 0; i < 20; i++ {
+				raws = append(raws, randomProfile(r, modes[i%len(modes)], files))
+			}
+
+			var profiles [][]*cover.Profile
+			acc := NewProfileAccumulator()
+			for _, raw := range raws {
+				profile, err := convertProfile([]byte(raw))
+				assert.NoError(t, err)
+				profiles = append(profiles, profile)
+				assert.NoError(t, acc.Add(strings.NewReader(raw)))
+			}
+
+			merged, err := MergeProfiles(profiles)
+			assert.NoError(t, err)
+			var batch, streamed bytes.Buffer
+			assert.NoError(t, cov.DumpProfile(merged, &batch))
+			assert.NoError(t, acc.Dump(&streamed))
+			assert.Equal(t, batch.String(), streamed.String())
+			assert.Equal(t, len(files), acc.Len())
+		})
+	}
+}
+
+func TestProfileAccumulatorRejects(t *testing.T) {
+	acc := NewProfileAccumulator()
+	assert.NoError(t, acc.Add(strings.NewReader("mode: count\nexample.com/foo/main.go:3.13,5.2 1 2\nexample.com/foo/main.go:7.13,9.2 1 0\n")))
+
+	// incompatible mode
+	err := acc.Add(strings.NewReader("mode: set\nexample.com/foo/main.go:3.13,5.2 1 1\nexample.com/foo/main.go:7.13,9.2 1 1\n"))
+	assert.True(t, errors.Is(err, ErrIncompatibleMode))
+
+	// built from a different source, the other file of it is not merged either
+	err = acc.Add(strings.NewReader("mode: count\nexample.com/foo/a.go:1.1,2.2 1 1\nexample.com/foo/main.go:3.13,6.2 2 1\n"))
+	assert.Error(t, err)
+
+	// not a profile
+	assert.Error(t, acc.Add(strings.NewReader("not a profile")))
+
+	var buf bytes.Buffer
+	assert.NoError(t, acc.Dump(&buf))
+	assert.Equal(t, "mode: count\nexample.com/foo/main.go:3.13,5.2 1 2\nexample.com/foo/main.go:7.13,9.2 1 0\n", buf.String())
+}
@@ -18,14 +18,20 @@ package cover
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
 	"net/url"
+	"runtime/debug"
+	"sort"
 	"strings"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -33,11 +39,24 @@ import (
 // Action provides methods to contact with the covered service under test
 type Action interface {
 	Profile(param ProfileParam) ([]byte, error)
+	ProfileTo(param ProfileParam, w io.Writer) error
 	Clear(param ProfileParam) ([]byte, error)
 	Remove(param ProfileParam) ([]byte, error)
 	InitSystem() ([]byte, error)
 	ListServices() ([]byte, error)
+	ListServicesWithLimit(limit int) ([]byte, error)
+	ListServicesWithLabels(limit int) (ServicesList, error)
 	RegisterService(svr ServiceUnderTest) ([]byte, error)
+	GetAgent(id string) (Agent, error)
+	ListUnreachable() ([]UnreachableAgent, error)
+	RemoveAgent(id string) error
+	RemoveAgents(ids []string) OpResult
+	ClearAgents(ids []string) OpResult
+	Ping() error
+	ServerInfo() (ServerInfo, error)
+	WatchEvents(ctx context.Context) (<-chan AgentEvent, error)
+	// Do sends a raw request to the service center, it is UNSTABLE, see client.Do
+	Do(method, path string, body io.Reader) ([]byte, int, error)
 }
 
 const (
@@ -47,31 +66,282 @@ const (
 	CoverProfileAPI = "/v1/cover/profile"
 	//CoverProfileClearAPI is provided by the covered service to clear profiles
 	CoverProfileClearAPI = "/v1/cover/clear"
+	//CoverFlushAPI receives the final profile an agent pushes when it is terminated
+	CoverFlushAPI = "/v1/cover/flush"
+	//CoverPushAPI receives the profile an agent pushes periodically
+	CoverPushAPI = "/v1/cover/push"
 	//CoverServicesListAPI list all the registered services
 	CoverServicesListAPI = "/v1/cover/list"
 	//CoverRegisterServiceAPI register a service into service center
 	CoverRegisterServiceAPI = "/v1/cover/register"
 	//CoverServicesRemoveAPI remove one services from the service center
 	CoverServicesRemoveAPI = "/v1/cover/remove"
+	//CoverAgentAPI shows or deletes a registered agent by its id, which is the address of the agent
+	CoverAgentAPI = "/v1/cover/agent"
+	//CoverUnreachableAPI lists the registered agents the service center failed to connect to for the profiles
+	CoverUnreachableAPI = "/v1/cover/unreachable"
+	//CoverPingAPI checks whether the service center is up
+	CoverPingAPI = "/v1/cover/ping"
+	//CoverServerInfoAPI shows the version and the state of the service center
+	CoverServerInfoAPI = "/v1/cover/info"
+	//CoverEventsAPI streams the join and leave events of the agents as server-sent events
+	CoverEventsAPI = "/v1/cover/events"
 )
 
+// pingTimeout bounds the time spent on a readiness probe
+const pingTimeout = 5 * time.Second
+
+// listPageSize is the number of service instances fetched by one list request
+var listPageSize = 500
+
+// ErrCenterUnreachable represents the service center can not be connected
+var ErrCenterUnreachable = errors.New("service center unreachable")
+
+// ErrAgentNotFound represents the agent is not registered in the service center
+var ErrAgentNotFound = errors.New("agent not found")
+
+// gocModule is the path of the goc module
+const gocModule = "github.com/qiniu/goc"
+
+// UserAgent is sent in the User-Agent header of every request of the clients, so that the service center
+// can tell the versions of goc the requests come from. It is goc/<version> with the version of the goc
+// module in the build info by default, goc sets it to its own version.
+var UserAgent = "goc/" + moduleVersion()
+
+// moduleVersion returns the version of the goc module the binary is built with, either as the main module
+// or a dependency, "(devel)" if it is unknown
+func moduleVersion() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if info.Main.Path == gocModule && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == gocModule {
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}
+
+const (
+	// DefaultMaxIdleConns is the default max number of idle connections kept for all hosts
+	DefaultMaxIdleConns = 512
+	// DefaultMaxIdleConnsPerHost is the default max number of idle connections kept for one host,
+	// it is far bigger than the one of http.DefaultTransport so that the connections
+	// to the service center are reused instead of exhausting the local ports
+	DefaultMaxIdleConnsPerHost = 64
+	// DefaultIdleConnTimeout is the default time an idle connection is kept
+	DefaultIdleConnTimeout = 90 * time.Second
+	// DefaultStatusRetries is the default max number of retries of a request responded with a retry status code
+	DefaultStatusRetries = 2
+	// DefaultRetryBackoff is the default wait before the first retry, it doubles for each of the next ones
+	DefaultRetryBackoff = 200 * time.Millisecond
+)
+
+// DefaultRetryStatusCodes are the status codes worth retrying by default,
+// the service center responds them when it is overloaded or being rolled out
+var DefaultRetryStatusCodes = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// WorkerOptions tunes the connection pool and the retry policy of the worker
+type WorkerOptions struct {
+	// MaxIdleConns is the max number of idle connections kept for all hosts, 0 means DefaultMaxIdleConns
+	MaxIdleConns int
+	// MaxIdleConnsPerHost is the max number of idle connections kept for one host, 0 means DefaultMaxIdleConnsPerHost
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is the time an idle connection is kept, 0 means DefaultIdleConnTimeout
+	IdleConnTimeout time.Duration
+	// Proxy is the HTTP proxy to reach the hosts through, nil means the proxy from the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables, which bypasses localhost
+	Proxy *url.URL
+
+	// RetryStatusCodes are the status codes to retry the idempotent requests on, nil means DefaultRetryStatusCodes
+	RetryStatusCodes []int
+	// StatusRetries is the max number of retries on the retry status codes, a retry is sent only if the
+	// service center answers the Ping after the wait, or the retry is used up by the probe.
+	// 0 means DefaultStatusRetries and a negative one disables the retries
+	StatusRetries int
+	// RetryBackoff is the wait before the first retry, it doubles for each of the next ones,
+	// 0 means DefaultRetryBackoff
+	RetryBackoff time.Duration
+	// NoNetworkRetry disables the one-shot retry of the requests failed on the network errors,
+	// e.g. when each request is bounded by a timeout the retry should not double
+	NoNetworkRetry bool
+}
+
+// retryPolicy decides whether and when a request responded with an error status code is retried,
+// and whether the one-shot retry on the network errors is done
+type retryPolicy struct {
+	statusCodes map[int]bool
+	retries     int
+	backoff     time.Duration
+	noNetwork   bool
+}
+
+func newRetryPolicy(opts WorkerOptions) retryPolicy {
+	p := retryPolicy{
+		statusCodes: map[int]bool{},
+		retries:     opts.StatusRetries,
+		backoff:     opts.RetryBackoff,
+		noNetwork:   opts.NoNetworkRetry,
+	}
+	codes := opts.RetryStatusCodes
+	if codes == nil {
+		codes = DefaultRetryStatusCodes
+	}
+	for _, code := range codes {
+		p.statusCodes[code] = true
+	}
+	if p.retries == 0 {
+		p.retries = DefaultStatusRetries
+	}
+	if p.backoff <= 0 {
+		p.backoff = DefaultRetryBackoff
+	}
+	return p
+}
+
+// shouldRetry reports whether the request of the method is retried after the attempt-th retry,
+// the non-idempotent methods, e.g. POST, are never retried as the server may have handled them
+func (p retryPolicy) shouldRetry(method string, attempt int, statusCode int) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+	default:
+		return false
+	}
+	return attempt < p.retries && p.statusCodes[statusCode]
+}
+
+// retryNetwork reports whether the request failed with err is sent once more, i.e. err is a network error
+// and the retry on the network errors is not disabled
+func (p retryPolicy) retryNetwork(err error) bool {
+	return err != nil && !p.noNetwork && isNetworkError(err)
+}
+
+// wait returns the wait before the attempt-th retry, which starts from 0
+func (p retryPolicy) wait(attempt int) time.Duration {
+	return p.backoff << uint(attempt)
+}
+
+// defaultClient is shared by the workers created by NewWorker,
+// so that the workers for the same host reuse the connections
+var defaultClient = &http.Client{Transport: newTransport(WorkerOptions{})}
+
+// OpResult is the result of an operation on a group of agents,
+// partial failure is expected when operating on a large fleet
+type OpResult struct {
+	// Succeeded is the ids of the agents the operation succeeded on
+	Succeeded []string
+	// Failed maps the ids of the agents the operation failed on to the errors
+	Failed map[string]error
+}
+
+func newOpResult() OpResult {
+	return OpResult{Failed: map[string]error{}}
+}
+
+// FailedIDs returns the sorted ids of the failed agents, e.g. to retry them
+func (r OpResult) FailedIDs() []string {
+	ids := make([]string, 0, len(r.Failed))
+	for id := range r.Failed {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
 type client struct {
 	Host   string
 	client *http.Client
+	retry  retryPolicy
 }
 
-// NewWorker creates a worker to contact with service
+// NewWorker creates a worker to contact with service,
+// the host defaults to http if given without a scheme, e.g. localhost:7777,
+// the center serving the API over gRPC is given with the grpc scheme, e.g. grpc://localhost:7778
 func NewWorker(host string) Action {
-	_, err := url.ParseRequestURI(host)
+	return newWorker(host, defaultClient, WorkerOptions{})
+}
+
+// NewWorkerWithOptions creates a worker with its own connection pool and the retry policy tuned by opts
+func NewWorkerWithOptions(host string, opts WorkerOptions) Action {
+	return newWorker(host, &http.Client{Transport: newTransport(opts)}, opts)
+}
+
+func newWorker(host string, httpClient *http.Client, opts WorkerOptions) Action {
+	normalized, err := normalizeHost(host)
 	if err != nil {
 		log.Fatalf("Parse url %s failed, err: %v", host, err)
 	}
+	// the center serving the API over gRPC is requested through the same client
+	if strings.HasPrefix(normalized, GRPCScheme+"://") {
+		httpClient = &http.Client{
+			Transport: &grpcTransport{target: strings.TrimPrefix(normalized, GRPCScheme+"://")},
+			Timeout:   httpClient.Timeout,
+		}
+	}
 	return &client{
-		Host:   host,
-		client: http.DefaultClient,
+		Host:   normalized,
+		client: httpClient,
+		retry:  newRetryPolicy(opts),
 	}
 }
 
+// newTransport creates a transport like http.DefaultTransport with the pool and proxy settings of opts
+func newTransport(opts WorkerOptions) *http.Transport {
+	if opts.MaxIdleConns <= 0 {
+		opts.MaxIdleConns = DefaultMaxIdleConns
+	}
+	if opts.MaxIdleConnsPerHost <= 0 {
+		opts.MaxIdleConnsPerHost = DefaultMaxIdleConnsPerHost
+	}
+	if opts.IdleConnTimeout <= 0 {
+		opts.IdleConnTimeout = DefaultIdleConnTimeout
+	}
+	proxy := http.ProxyFromEnvironment
+	if opts.Proxy != nil {
+		proxy = http.ProxyURL(opts.Proxy)
+	}
+	return &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          opts.MaxIdleConns,
+		MaxIdleConnsPerHost:   opts.MaxIdleConnsPerHost,
+		IdleConnTimeout:       opts.IdleConnTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// normalizeHost adds the http scheme to a bare host:port and trims the trailing slashes,
+// hosts which are not a http or https URL are rejected
+func normalizeHost(host string) (string, error) {
+	host = strings.TrimSpace(host)
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	u, err := url.Parse(host)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" && u.Scheme != GRPCScheme {
+		return "", fmt.Errorf("unsupported scheme %q, the host should be like http://127.0.0.1:7777 or grpc://127.0.0.1:7778", u.Scheme)
+	}
+	if u.Host == "" || u.Hostname() == "" {
+		return "", fmt.Errorf("no host name, the host should be like http://127.0.0.1:7777")
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("query and fragment are not allowed, the host should be like http://127.0.0.1:7777")
+	}
+	return strings.TrimRight(u.String(), "/"), nil
+}
+
 func (c *client) RegisterService(srv ServiceUnderTest) ([]byte, error) {
 	if _, err := url.ParseRequestURI(srv.Address); err != nil {
 		return nil, err
@@ -79,23 +349,150 @@ func (c *client) RegisterService(srv ServiceUnderTest) ([]byte, error) {
 	if strings.TrimSpace(srv.Name) == "" {
 		return nil, fmt.Errorf("invalid service name")
 	}
-	u := fmt.Sprintf("%s%s?name=%s&address=%s", c.Host, CoverRegisterServiceAPI, srv.Name, srv.Address)
+	u := fmt.Sprintf("%s?name=%s&address=%s", joinURL(c.Host, CoverRegisterServiceAPI), srv.Name, srv.Address)
+	for _, label := range FormatLabels(srv.Labels) {
+		u += "&label=" + url.QueryEscape(label)
+	}
 	_, res, err := c.do("POST", u, "", nil)
 	return res, err
 }
 
 func (c *client) ListServices() ([]byte, error) {
-	u := fmt.Sprintf("%s%s", c.Host, CoverServicesListAPI)
-	_, services, err := c.do("GET", u, "", nil)
-	if err != nil && isNetworkError(err) {
-		_, services, err = c.do("GET", u, "", nil)
+	return c.ListServicesWithLimit(0)
+}
+
+// ListServicesWithLimit pages through the registered services of the center,
+// at most limit service instances are returned if limit is positive
+func (c *client) ListServicesWithLimit(limit int) ([]byte, error) {
+	list, err := c.ListServicesWithLabels(limit)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(list.Items)
+}
+
+// ListServicesWithLabels pages through the registered services of the center along with their labels,
+// at most limit service instances are returned if limit is positive
+func (c *client) ListServicesWithLabels(limit int) (ServicesList, error) {
+	var (
+		services = make(map[string][]string)
+		labels   = make(map[string]map[string]string)
+		count    int
+		total    int
+		offset   int
+	)
+	for {
+		size := listPageSize
+		if limit > 0 && limit-count < size {
+			size = limit - count
+		}
+		u := fmt.Sprintf("%s?offset=%d&limit=%d", joinURL(c.Host, CoverServicesListAPI), offset, size)
+		res, body, err := c.do("GET", u, "", nil)
+		if c.retry.retryNetwork(err) {
+			res, body, err = c.do("GET", u, "", nil)
+		}
+		if err != nil {
+			return ServicesList{}, err
+		}
+		if res.StatusCode != http.StatusOK {
+			return ServicesList{}, errors.New(string(body))
+		}
+
+		page, err := decodeServicesPage(body)
+		if err != nil {
+			return ServicesList{}, fmt.Errorf("failed to decode the service list, err: %v", err)
+		}
+		for name, addrs := range page.Items {
+			services[name] = append(services[name], addrs...)
+			count += len(addrs)
+		}
+		for addr, l := range page.Labels {
+			labels[addr] = l
+		}
+		total = page.Total
+
+		if page.Next == 0 || (limit > 0 && count >= limit) {
+			break
+		}
+		if page.Next <= offset {
+			return ServicesList{}, fmt.Errorf("the next offset %d of the service list does not advance from %d", page.Next, offset)
+		}
+		offset = page.Next
+	}
+	// the centers before the pagination ignore the limit and reply all the services at once
+	if limit > 0 && count > limit {
+		services = paginateServices(services, 0, limit).Items
+	}
+
+	return ServicesList{Items: services, Total: total, Labels: labels}, nil
+}
+
+// decodeServicesPage decodes a page of the service list. The centers before the pagination
+// reply the plain map of the service names to the addresses, which is taken as the only page.
+func decodeServicesPage(body []byte) (ServicesList, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return ServicesList{}, err
+	}
+	// the addresses of a service named items are an array in the plain map
+	if items, ok := fields["items"]; ok && !bytes.HasPrefix(bytes.TrimSpace(items), []byte("[")) {
+		var page ServicesList
+		err := json.Unmarshal(body, &page)
+		return page, err
 	}
 
-	return services, err
+	var services map[string][]string
+	if err := json.Unmarshal(body, &services); err != nil {
+		return ServicesList{}, err
+	}
+	page := ServicesList{Items: services}
+	for _, addrs := range services {
+		page.Total += len(addrs)
+	}
+	return page, nil
+}
+
+// UniqueServices collapses the service instances of the same name sharing the same host and port,
+// which happens when an instance registers itself again after reconnecting with
+// a differently spelled address, the later registered address wins.
+// The instances of different names are kept even if they share the host and port.
+func UniqueServices(services map[string][]string) map[string][]string {
+	res := make(map[string][]string)
+	for name, addrs := range services {
+		seen := make(map[string]int)
+		var kept []string
+		for _, addr := range addrs {
+			key := instanceKey(addr)
+			if idx, ok := seen[key]; ok {
+				kept[idx] = addr
+				continue
+			}
+			seen[key] = len(kept)
+			kept = append(kept, addr)
+		}
+		res[name] = kept
+	}
+	return res
+}
+
+// instanceKey returns the normalized host:port of the service address
+func instanceKey(addr string) string {
+	u, err := url.Parse(strings.TrimSpace(addr))
+	if err != nil || u.Host == "" {
+		return addr
+	}
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(strings.ToLower(host), port)
 }
 
 func (c *client) Profile(param ProfileParam) ([]byte, error) {
-	u := fmt.Sprintf("%s%s", c.Host, CoverProfileAPI)
+	u := joinURL(c.Host, CoverProfileAPI)
 	if len(param.Service) != 0 && len(param.Address) != 0 {
 		return nil, fmt.Errorf("use 'service' flag and 'address' flag at the same time may cause ambiguity, please use them separately")
 	}
@@ -105,7 +502,7 @@ func (c *client) Profile(param ProfileParam) ([]byte, error) {
 	body, _ := json.Marshal(param)
 
 	res, profile, err := c.do("POST", u, "application/json", bytes.NewReader(body))
-	if err != nil && isNetworkError(err) {
+	if c.retry.retryNetwork(err) {
 		res, profile, err = c.do("POST", u, "application/json", bytes.NewReader(body))
 	}
 
@@ -115,8 +512,20 @@ func (c *client) Profile(param ProfileParam) ([]byte, error) {
 	return profile, err
 }
 
+// ProfileTo gets the profile like Profile, but writes it into w while it is being downloaded instead of
+// buffering it in memory, e.g. into the output file, which saves much memory for the large profiles
+func (c *client) ProfileTo(param ProfileParam, w io.Writer) error {
+	u := joinURL(c.Host, CoverProfileAPI)
+	if len(param.Service) != 0 && len(param.Address) != 0 {
+		return fmt.Errorf("use 'service' flag and 'address' flag at the same time may cause ambiguity, please use them separately")
+	}
+
+	body, _ := json.Marshal(param)
+	return c.doStream("POST", u, "application/json", body, w)
+}
+
 func (c *client) Clear(param ProfileParam) ([]byte, error) {
-	u := fmt.Sprintf("%s%s", c.Host, CoverProfileClearAPI)
+	u := joinURL(c.Host, CoverProfileClearAPI)
 	if len(param.Service) != 0 && len(param.Address) != 0 {
 		return nil, fmt.Errorf("use 'service' flag and 'address' flag at the same time may cause ambiguity, please use them separately")
 	}
@@ -125,14 +534,14 @@ func (c *client) Clear(param ProfileParam) ([]byte, error) {
 	// so no need to check here
 	body, _ := json.Marshal(param)
 	_, resp, err := c.do("POST", u, "application/json", bytes.NewReader(body))
-	if err != nil && isNetworkError(err) {
+	if c.retry.retryNetwork(err) {
 		_, resp, err = c.do("POST", u, "application/json", bytes.NewReader(body))
 	}
 	return resp, err
 }
 
 func (c *client) Remove(param ProfileParam) ([]byte, error) {
-	u := fmt.Sprintf("%s%s", c.Host, CoverServicesRemoveAPI)
+	u := joinURL(c.Host, CoverServicesRemoveAPI)
 	if len(param.Service) != 0 && len(param.Address) != 0 {
 		return nil, fmt.Errorf("use 'service' flag and 'address' flag at the same time may cause ambiguity, please use them separately")
 	}
@@ -144,19 +553,295 @@ func (c *client) Remove(param ProfileParam) ([]byte, error) {
 		return nil, err
 	}
 	_, resp, err := c.do("POST", u, "application/json", bytes.NewReader(body))
-	if err != nil && isNetworkError(err) {
+	if c.retry.retryNetwork(err) {
 		_, resp, err = c.do("POST", u, "application/json", bytes.NewReader(body))
 	}
 	return resp, err
 }
 
+// GetAgent gets the details of the agent registered in the service center, the id is the address of the agent,
+// an error wrapping ErrAgentNotFound is returned if the agent is not registered
+func (c *client) GetAgent(id string) (Agent, error) {
+	agent := Agent{Host: c.Host}
+	u := fmt.Sprintf("%s?id=%s", joinURL(c.Host, CoverAgentAPI), url.QueryEscape(id))
+	res, body, err := c.do("GET", u, "", nil)
+	if c.retry.retryNetwork(err) {
+		res, body, err = c.do("GET", u, "", nil)
+	}
+	if err != nil {
+		return agent, err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return agent, fmt.Errorf("%w: %s", ErrAgentNotFound, id)
+	default:
+		return agent, fmt.Errorf("fail to get agent %s, response code: %d, body: %s", id, res.StatusCode, string(body))
+	}
+	var svc ServiceUnderTest
+	if err := json.Unmarshal(body, &svc); err != nil {
+		return agent, fmt.Errorf("failed to decode the agent, err: %v", err)
+	}
+	agent.Name, agent.Address, agent.Labels = svc.Name, svc.Address, svc.Labels
+	return agent, nil
+}
+
+// ListUnreachable lists the registered agents the service center failed to connect to when it got the profiles
+// last time, e.g. their hosts are down, which can be removed by RemoveAgents with their addresses
+func (c *client) ListUnreachable() ([]UnreachableAgent, error) {
+	u := joinURL(c.Host, CoverUnreachableAPI)
+	res, body, err := c.do("GET", u, "", nil)
+	if c.retry.retryNetwork(err) {
+		res, body, err = c.do("GET", u, "", nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fail to list the unreachable agents, response code: %d, body: %s", res.StatusCode, string(body))
+	}
+	var agents []UnreachableAgent
+	if err := json.Unmarshal(body, &agents); err != nil {
+		return nil, fmt.Errorf("failed to decode the unreachable agents, err: %v", err)
+	}
+	return agents, nil
+}
+
+// RemoveAgent unregisters the agent from the service center, the id is the address of the agent
+func (c *client) RemoveAgent(id string) error {
+	u := fmt.Sprintf("%s?id=%s", joinURL(c.Host, CoverAgentAPI), url.QueryEscape(id))
+	res, body, err := c.do("DELETE", u, "", nil)
+	if c.retry.retryNetwork(err) {
+		res, body, err = c.do("DELETE", u, "", nil)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return fmt.Errorf("%w: %s", ErrAgentNotFound, id)
+	default:
+		return fmt.Errorf("fail to remove agent %s, response code: %d, body: %s", id, res.StatusCode, string(body))
+	}
+}
+
+// RemoveAgents unregisters the agents one by one, the failure of one agent does not stop the others
+func (c *client) RemoveAgents(ids []string) OpResult {
+	result := newOpResult()
+	for _, id := range ids {
+		if err := c.RemoveAgent(id); err != nil {
+			result.Failed[id] = err
+			continue
+		}
+		result.Succeeded = append(result.Succeeded, id)
+	}
+	return result
+}
+
+// ClearAgents clears the coverage counters of the agents one by one,
+// the failure of one agent does not stop the others
+func (c *client) ClearAgents(ids []string) OpResult {
+	result := newOpResult()
+	for _, id := range ids {
+		if err := c.clearAgent(id); err != nil {
+			result.Failed[id] = err
+			continue
+		}
+		result.Succeeded = append(result.Succeeded, id)
+	}
+	return result
+}
+
+func (c *client) clearAgent(id string) error {
+	u := joinURL(c.Host, CoverProfileClearAPI)
+	body, _ := json.Marshal(ProfileParam{Address: []string{id}})
+	res, resp, err := c.do("POST", u, "application/json", bytes.NewReader(body))
+	if c.retry.retryNetwork(err) {
+		res, resp, err = c.do("POST", u, "application/json", bytes.NewReader(body))
+	}
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("fail to clear agent %s, response code: %d, body: %s", id, res.StatusCode, string(resp))
+	}
+	// the center skips the unknown addresses silently, and reports nothing cleared
+	if len(resp) == 0 {
+		return fmt.Errorf("%w: %s", ErrAgentNotFound, id)
+	}
+	return nil
+}
+
 func (c *client) InitSystem() ([]byte, error) {
-	u := fmt.Sprintf("%s%s", c.Host, CoverInitSystemAPI)
+	u := joinURL(c.Host, CoverInitSystemAPI)
 	_, body, err := c.do("POST", u, "", nil)
 	return body, err
 }
 
+// Ping checks whether the service center is up and ready to serve,
+// an error wrapping ErrCenterUnreachable is returned if the center can not be connected
+func (c *client) Ping() error {
+	u := joinURL(c.Host, CoverPingAPI)
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %s, err: %v", ErrCenterUnreachable, c.Host, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("service center %s is not ready, response code: %d, body: %s", c.Host, res.StatusCode, string(body))
+	}
+	return nil
+}
+
+// ServerInfo gets the version and the state of the service center
+func (c *client) ServerInfo() (ServerInfo, error) {
+	var info ServerInfo
+	u := joinURL(c.Host, CoverServerInfoAPI)
+	res, body, err := c.do("GET", u, "", nil)
+	if c.retry.retryNetwork(err) {
+		res, body, err = c.do("GET", u, "", nil)
+	}
+	if err != nil {
+		return info, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return info, fmt.Errorf("fail to get the info of service center %s, response code: %d, body: %s", c.Host, res.StatusCode, string(body))
+	}
+	if err := json.Unmarshal(body, &info); err != nil {
+		return info, fmt.Errorf("failed to decode the server info, err: %v", err)
+	}
+	return info, nil
+}
+
+// Do sends a raw request to the path of the service center, and returns the response body and status code,
+// e.g. Do("GET", "/v1/cover/list?limit=10", nil). It is meant for debugging and the endpoints the typed
+// methods do not cover yet, it is UNSTABLE and may change in any release without notice.
+// The body, if any, is sent as JSON.
+func (c *client) Do(method, path string, body io.Reader) ([]byte, int, error) {
+	contentType := ""
+	if body != nil {
+		contentType = "application/json"
+	}
+	res, resp, err := c.do(method, joinURL(c.Host, path), contentType, body)
+	if err != nil {
+		return resp, 0, err
+	}
+	return resp, res.StatusCode, nil
+}
+
+// joinURL joins the host and the API path with exactly one slash between them,
+// no matter whether the host ends with slashes
+func joinURL(host, api string) string {
+	return strings.TrimRight(host, "/") + "/" + strings.TrimLeft(api, "/")
+}
+
+// do sends the request, and retries it on the retry status codes of the retry policy
 func (c *client) do(method, url, contentType string, body io.Reader) (*http.Response, []byte, error) {
+	// keep the body to send it again
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = ioutil.ReadAll(body); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for attempt := 0; ; {
+		if payload != nil {
+			body = bytes.NewReader(payload)
+		}
+		res, resp, err := c.doOnce(method, url, contentType, body)
+		if err != nil {
+			return res, resp, err
+		}
+		var ready bool
+		if attempt, ready = c.waitReady(method, url, attempt, res.StatusCode); !ready {
+			return res, resp, err
+		}
+	}
+}
+
+// waitReady waits before the retry of the request responded with the status code, and probes the service
+// center with Ping after every wait, so that the request is sent again only once the center is ready.
+// Every probe takes up a retry, it returns the attempt the request is sent again with, or false if the
+// request should not be retried or the retries run out before the center is ready.
+func (c *client) waitReady(method, url string, attempt, statusCode int) (int, bool) {
+	for ; c.retry.shouldRetry(method, attempt, statusCode); attempt++ {
+		wait := c.retry.wait(attempt)
+		log.Debugf("%s %s responded %d, retry in %v", method, url, statusCode, wait)
+		time.Sleep(wait)
+		err := c.Ping()
+		if err == nil {
+			return attempt + 1, true
+		}
+		log.Debugf("skip the retry of %s %s, err: %v", method, url, err)
+	}
+	return attempt, false
+}
+
+// doStream sends the request like do, and copies the response body into w if it is 200 OK instead of
+// buffering it, the body of the other status codes is returned as the error. The request is sent again
+// on the network errors and the retry status codes only before anything is written into w, the retry
+// on the network errors is not counted against the retries on the status codes.
+func (c *client) doStream(method, url, contentType string, payload []byte, w io.Writer) error {
+	networkRetried := false
+	for attempt := 0; ; {
+		res, reader, err := c.open(method, url, contentType, bytes.NewReader(payload))
+		if err != nil {
+			if !networkRetried && c.retry.retryNetwork(err) {
+				networkRetried = true
+				continue
+			}
+			return err
+		}
+		if res.StatusCode == http.StatusOK {
+			_, err = io.Copy(w, reader)
+			reader.Close()
+			return err
+		}
+		resp, err := ioutil.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return err
+		}
+		var ready bool
+		if attempt, ready = c.waitReady(method, url, attempt, res.StatusCode); !ready {
+			return errors.New(string(resp))
+		}
+	}
+}
+
+func (c *client) doOnce(method, url, contentType string, body io.Reader) (*http.Response, []byte, error) {
+	res, reader, err := c.open(method, url, contentType, body)
+	if err != nil {
+		return res, nil, err
+	}
+	defer reader.Close()
+
+	responseBody, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return res, nil, err
+	}
+	return res, responseBody, nil
+}
+
+// open sends the request and returns the response along with the reader of the decoded body,
+// the caller should close the reader
+func (c *client) open(method, url, contentType string, body io.Reader) (*http.Response, io.ReadCloser, error) {
 	req, err := http.NewRequest(method, url, body)
 	if err != nil {
 		return nil, nil, err
@@ -165,18 +850,42 @@ func (c *client) do(method, url, contentType string, body io.Reader) (*http.Resp
 	if contentType != "" {
 		req.Header.Set("Content-Type", contentType)
 	}
+	// profiles are large, ask for the compressed ones
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("User-Agent", UserAgent)
 
 	res, err := c.client.Do(req)
 	if err != nil {
 		return nil, nil, err
 	}
-	defer res.Body.Close()
+	// the forced profile is merged without the agents failed to respond
+	if failed := res.Header.Get(FailedAgentsHeader); failed != "" {
+		log.Warnf("the profiles of the agents %s are missing as they failed to respond", failed)
+	}
+	if unreachable := res.Header.Get(UnreachableAgentsHeader); unreachable != "" {
+		log.Warnf("the profiles of the agents %s are missing as they are unreachable", unreachable)
+	}
 
-	responseBody, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return res, nil, err
+	if res.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(res.Body)
+		if err != nil {
+			res.Body.Close()
+			return res, nil, err
+		}
+		return res, gzipBody{Reader: gr, body: res.Body}, nil
 	}
-	return res, responseBody, nil
+	return res, res.Body, nil
+}
+
+// gzipBody is the decoded body of a gzip encoded response, closing it closes the response body as well
+type gzipBody struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+func (g gzipBody) Close() error {
+	g.Reader.Close()
+	return g.body.Close()
 }
 
 func isNetworkError(err error) bool {
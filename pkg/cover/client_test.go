@@ -17,10 +17,20 @@
 package cover
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"net/http"
 
@@ -255,3 +265,641 @@ func TestClientRemove(t *testing.T) {
 	_, err = c.Remove(p)
 	assert.Error(t, err)
 }
+
+func TestClientRemoveAgent(t *testing.T) {
+	server := NewMemoryBasedServer()
+	server.Store.Add(ServiceUnderTest{Name: "foo", Address: "http://127.0.0.1:1001"})
+	server.Store.Add(ServiceUnderTest{Name: "foo", Address: "http://127.0.0.1:1002"})
+	ts := httptest.NewServer(server.Route(os.Stdout))
+	defer ts.Close()
+	c := NewWorker(ts.URL)
+
+	assert.NoError(t, c.RemoveAgent("http://127.0.0.1:1001"))
+	assert.Equal(t, map[string][]string{"foo": {"http://127.0.0.1:1002"}}, server.Store.GetAll())
+
+	// remove a non-exist agent
+	err := c.RemoveAgent("http://127.0.0.1:1001")
+	assert.True(t, errors.Is(err, ErrAgentNotFound))
+
+	// remove from a invalid center
+	err = NewWorker("http://127.0.0.1:11111").RemoveAgent("http://127.0.0.1:1002")
+	assert.Error(t, err)
+}
+
+func TestClientGetAgent(t *testing.T) {
+	server := NewMemoryBasedServer()
+	server.Store.Add(ServiceUnderTest{Name: "foo", Address: "http://127.0.0.1:1001"})
+	server.Store.SetLabels("http://127.0.0.1:1001", map[string]string{"revision": "abcdef", "zone": "east"})
+	ts := httptest.NewServer(server.Route(os.Stdout))
+	defer ts.Close()
+	c := NewWorker(ts.URL)
+
+	agent, err := c.GetAgent("http://127.0.0.1:1001")
+	assert.NoError(t, err)
+	assert.Equal(t, Agent{
+		Name:    "foo",
+		Address: "http://127.0.0.1:1001",
+		Host:    ts.URL,
+		Labels:  map[string]string{"revision": "abcdef", "zone": "east"},
+	}, agent)
+
+	// get a non-exist agent
+	_, err = c.GetAgent("http://127.0.0.1:1002")
+	assert.True(t, errors.Is(err, ErrAgentNotFound))
+
+	// get from a invalid center
+	_, err = NewWorker("http://127.0.0.1:11111").GetAgent("http://127.0.0.1:1001")
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrAgentNotFound))
+}
+
+func TestClientRemoveAgents(t *testing.T) {
+	server := NewMemoryBasedServer()
+	server.Store.Add(ServiceUnderTest{Name: "foo", Address: "http://127.0.0.1:1001"})
+	server.Store.Add(ServiceUnderTest{Name: "foo", Address: "http://127.0.0.1:1002"})
+	ts := httptest.NewServer(server.Route(os.Stdout))
+	defer ts.Close()
+
+	result := NewWorker(ts.URL).RemoveAgents([]string{"http://127.0.0.1:1001", "http://127.0.0.1:1003", "http://127.0.0.1:1002"})
+	assert.Equal(t, []string{"http://127.0.0.1:1001", "http://127.0.0.1:1002"}, result.Succeeded)
+	assert.Equal(t, []string{"http://127.0.0.1:1003"}, result.FailedIDs())
+	assert.True(t, errors.Is(result.Failed["http://127.0.0.1:1003"], ErrAgentNotFound))
+	assert.Equal(t, map[string][]string{}, server.Store.GetAll())
+}
+
+func TestClientClearAgents(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("clear call successfully"))
+	}))
+	defer agent.Close()
+
+	server := NewMemoryBasedServer()
+	server.Store.Add(ServiceUnderTest{Name: "foo", Address: agent.URL})
+	server.Store.Add(ServiceUnderTest{Name: "foo", Address: "http://127.0.0.1:11111"})
+	ts := httptest.NewServer(server.Route(os.Stdout))
+	defer ts.Close()
+
+	// the second agent is registered but unreachable, the third one is not registered
+	result := NewWorker(ts.URL).ClearAgents([]string{agent.URL, "http://127.0.0.1:11111", "http://127.0.0.1:11112"})
+	assert.Equal(t, []string{agent.URL}, result.Succeeded)
+	assert.Equal(t, []string{"http://127.0.0.1:11111", "http://127.0.0.1:11112"}, result.FailedIDs())
+	assert.True(t, errors.Is(result.Failed["http://127.0.0.1:11112"], ErrAgentNotFound))
+
+	// clear from a invalid center
+	result = NewWorker("http://127.0.0.1:11111").ClearAgents([]string{agent.URL})
+	assert.Empty(t, result.Succeeded)
+	assert.Equal(t, []string{agent.URL}, result.FailedIDs())
+}
+
+func TestClientPing(t *testing.T) {
+	// ping a healthy center without any registered service
+	server := NewMemoryBasedServer()
+	ts := httptest.NewServer(server.Route(os.Stdout))
+	defer ts.Close()
+	assert.NoError(t, NewWorker(ts.URL).Ping())
+
+	// ping a center which is up but not ready
+	notReady := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer notReady.Close()
+	err := NewWorker(notReady.URL).Ping()
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, ErrCenterUnreachable))
+
+	// ping a center which can not be connected
+	c := &client{
+		Host:   "http://127.0.0.1:64445", // a invalid host
+		client: http.DefaultClient,
+	}
+	err = c.Ping()
+	assert.True(t, errors.Is(err, ErrCenterUnreachable))
+}
+
+func TestClientProfileWithGzip(t *testing.T) {
+	profile := []byte("mode: count\nmockService/main.go:30.13,48.33 13 1\n")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Write(profile)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		gw.Write(profile)
+		gw.Close()
+	}))
+	defer ts.Close()
+
+	res, err := NewWorker(ts.URL).Profile(ProfileParam{})
+	assert.NoError(t, err)
+	assert.Equal(t, profile, res, "gzip encoded profile should be decoded")
+}
+
+func TestClientProfileTo(t *testing.T) {
+	// a large profile of about 32MB
+	var sb strings.Builder
+	sb.WriteString("mode: count\n")
+	for i := 0; sb.Len() < 32<<20; i++ {
+		fmt.Fprintf(&sb, "example.com/large/file%d.go:30.13,48.33 13 %d\n", i, i)
+	}
+	profile := sb.String()
+
+	for _, gzipped := range []bool{false, true} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !gzipped {
+				w.Write([]byte(profile))
+				return
+			}
+			w.Header().Set("Content-Encoding", "gzip")
+			gw := gzip.NewWriter(w)
+			gw.Write([]byte(profile))
+			gw.Close()
+		}))
+
+		f, err := ioutil.TempFile("", "goc-profile")
+		assert.NoError(t, err)
+		assert.NoError(t, NewWorker(ts.URL).ProfileTo(ProfileParam{}, f), "gzipped: %v", gzipped)
+		f.Close()
+		res, err := ioutil.ReadFile(f.Name())
+		assert.NoError(t, err)
+		assert.True(t, profile == string(res), "the profile should be written as it is, gzipped: %v", gzipped)
+		os.Remove(f.Name())
+		ts.Close()
+	}
+
+	// the error response is not written
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusExpectationFailed)
+		w.Write([]byte("no profiles"))
+	}))
+	defer ts.Close()
+	var buf strings.Builder
+	err := NewWorker(ts.URL).ProfileTo(ProfileParam{}, &buf)
+	assert.EqualError(t, err, "no profiles")
+	assert.Equal(t, "", buf.String())
+
+	err = NewWorker(ts.URL).ProfileTo(ProfileParam{Service: []string{"a"}, Address: []string{"http://127.0.0.1:1001"}}, &buf)
+	assert.Error(t, err, "the service and address can not be used at the same time")
+}
+
+func TestClientUserAgent(t *testing.T) {
+	assert.True(t, strings.HasPrefix(UserAgent, "goc/"), UserAgent)
+	defer func(ua string) { UserAgent = ua }(UserAgent)
+	UserAgent = "goc/v1.2.3"
+
+	var agents []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		agents = append(agents, r.URL.Path+" "+r.Header.Get("User-Agent"))
+		w.Write([]byte(`{}`))
+	}))
+	defer ts.Close()
+
+	client := NewWorker(ts.URL)
+	assert.NoError(t, client.Ping())
+	_, err := client.Profile(ProfileParam{})
+	assert.NoError(t, err)
+	assert.NoError(t, client.ProfileTo(ProfileParam{}, ioutil.Discard))
+	_, err = client.InitSystem()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		CoverPingAPI + " goc/v1.2.3",
+		CoverProfileAPI + " goc/v1.2.3",
+		CoverProfileAPI + " goc/v1.2.3",
+		CoverInitSystemAPI + " goc/v1.2.3",
+	}, agents)
+}
+
+func TestClientListServicesWithLimit(t *testing.T) {
+	server := NewMemoryBasedServer()
+	server.Store.Set(map[string][]string{
+		"a": {"http://127.0.0.1:1001", "http://127.0.0.1:1002"},
+		"b": {"http://127.0.0.1:2001"},
+		"c": {"http://127.0.0.1:3001", "http://127.0.0.1:3002"},
+	})
+	ts := httptest.NewServer(server.Route(os.Stdout))
+	defer ts.Close()
+
+	// force several pages to be fetched
+	pageSize := listPageSize
+	listPageSize = 2
+	defer func() { listPageSize = pageSize }()
+
+	client := NewWorker(ts.URL)
+	res, err := client.ListServices()
+	assert.NoError(t, err)
+	var services map[string][]string
+	assert.NoError(t, json.Unmarshal(res, &services))
+	assert.Equal(t, server.Store.GetAll(), services)
+
+	res, err = client.ListServicesWithLimit(3)
+	assert.NoError(t, err)
+	services = nil
+	assert.NoError(t, json.Unmarshal(res, &services))
+	assert.Equal(t, map[string][]string{
+		"a": {"http://127.0.0.1:1001", "http://127.0.0.1:1002"},
+		"b": {"http://127.0.0.1:2001"},
+	}, services)
+}
+
+func TestClientListServicesFromUnpaginatedCenter(t *testing.T) {
+	services := map[string][]string{
+		"a":     {"http://127.0.0.1:1001", "http://127.0.0.1:1002"},
+		"items": {"http://127.0.0.1:2001"},
+	}
+	// the centers before the pagination reply the plain map and ignore the paging parameters
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(services)
+	}))
+	defer ts.Close()
+
+	list, err := NewWorker(ts.URL).ListServicesWithLabels(0)
+	assert.NoError(t, err)
+	assert.Equal(t, services, list.Items)
+	assert.Equal(t, 3, list.Total)
+	assert.Empty(t, list.Labels)
+
+	res, err := NewWorker(ts.URL).ListServices()
+	assert.NoError(t, err)
+	var got map[string][]string
+	assert.NoError(t, json.Unmarshal(res, &got))
+	assert.Equal(t, services, got)
+
+	// the limit is applied by the client, in the order of the service names
+	list, err = NewWorker(ts.URL).ListServicesWithLabels(2)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"a": {"http://127.0.0.1:1001", "http://127.0.0.1:1002"}}, list.Items)
+	assert.Equal(t, 3, list.Total)
+}
+
+func TestClientListServicesRetryOnNetworkError(t *testing.T) {
+	var calls int32
+	// the connection of the first request is closed without a response
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		json.NewEncoder(w).Encode(ServicesList{Items: map[string][]string{"a": {"http://127.0.0.1:1001"}}, Total: 1})
+	}))
+	defer ts.Close()
+
+	// the transports are not shared, which replay the idempotent requests failed on the reused connections
+	c := newWorker(ts.URL, &http.Client{Transport: &http.Transport{}}, WorkerOptions{})
+	list, err := c.ListServicesWithLabels(0)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"a": {"http://127.0.0.1:1001"}}, list.Items)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestClientListServicesWithBadPages(t *testing.T) {
+	// a center replying a next offset not advancing would be listed forever
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ServicesList{Items: map[string][]string{"a": {"http://127.0.0.1:1001"}}, Total: 2, Next: 1})
+	}))
+	defer ts.Close()
+	_, err := NewWorker(ts.URL).ListServicesWithLabels(0)
+	assert.Error(t, err)
+
+	// the body of the error is not taken as a format
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "100% broken", http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+	_, err = NewWorker(ts.URL).ListServicesWithLabels(0)
+	assert.EqualError(t, err, "100% broken\n")
+}
+
+func TestClientListServicesWithLabels(t *testing.T) {
+	server := NewMemoryBasedServer()
+	server.Store.Add(ServiceUnderTest{Name: "a", Address: "http://127.0.0.1:1001", Labels: map[string]string{"revision": "abc123", "env": "staging"}})
+	server.Store.Add(ServiceUnderTest{Name: "a", Address: "http://127.0.0.1:1002"})
+	server.Store.Add(ServiceUnderTest{Name: "b", Address: "http://127.0.0.1:2001", Labels: map[string]string{"revision": "def456"}})
+	ts := httptest.NewServer(server.Route(os.Stdout))
+	defer ts.Close()
+
+	pageSize := listPageSize
+	listPageSize = 2
+	defer func() { listPageSize = pageSize }()
+
+	list, err := NewWorker(ts.URL).ListServicesWithLabels(0)
+	assert.NoError(t, err)
+	assert.Equal(t, server.Store.GetAll(), list.Items)
+	assert.Equal(t, 3, list.Total)
+	assert.Equal(t, map[string]map[string]string{
+		"http://127.0.0.1:1001": {"revision": "abc123", "env": "staging"},
+		"http://127.0.0.1:2001": {"revision": "def456"},
+	}, list.Labels, "the instances without labels should be omitted")
+}
+
+func TestUniqueServices(t *testing.T) {
+	services := map[string][]string{
+		"a": {"http://127.0.0.1:1001", "http://127.0.0.1:1001/", "http://127.0.0.1:1002"},
+		"b": {"http://127.0.0.1:1002", "http://127.0.0.1:2001"},
+		"c": {"http://localhost", "http://LOCALHOST:80"},
+	}
+
+	assert.Equal(t, map[string][]string{
+		"a": {"http://127.0.0.1:1001/", "http://127.0.0.1:1002"},
+		// the instance sharing the host and port with the one of another name is kept
+		"b": {"http://127.0.0.1:1002", "http://127.0.0.1:2001"},
+		"c": {"http://LOCALHOST:80"},
+	}, UniqueServices(services))
+
+	// the raw listing is untouched
+	assert.Len(t, services["a"], 3)
+}
+
+func TestClientServerInfo(t *testing.T) {
+	// mocked response of the service center
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, CoverServerInfoAPI, r.URL.Path)
+		fmt.Fprint(w, `{"version":"v1.4.0","commit":"abcdef","uptime":3600000000000,"agents":2}`)
+	}))
+	defer ts.Close()
+
+	info, err := NewWorker(ts.URL).ServerInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, ServerInfo{Version: "v1.4.0", Commit: "abcdef", Uptime: time.Hour, Agents: 2}, info)
+
+	// the center is too old to have the info API
+	old := httptest.NewServer(http.NotFoundHandler())
+	defer old.Close()
+	_, err = NewWorker(old.URL).ServerInfo()
+	assert.Error(t, err)
+
+	// the real service center
+	server := NewMemoryBasedServer()
+	server.Version = "v1.4.0"
+	server.Store.Add(ServiceUnderTest{Name: "foo", Address: "http://127.0.0.1:1001"})
+	server.Store.Add(ServiceUnderTest{Name: "bar", Address: "http://127.0.0.1:1002"})
+	center := httptest.NewServer(server.Route(os.Stdout))
+	defer center.Close()
+	info, err = NewWorker(center.URL).ServerInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, "v1.4.0", info.Version)
+	assert.Equal(t, 2, info.Agents)
+	assert.True(t, info.Uptime > 0)
+}
+
+func TestNormalizeHost(t *testing.T) {
+	var tcs = []struct {
+		host     string
+		expected string
+		err      bool
+	}{
+		{host: "localhost:7777", expected: "http://localhost:7777"},
+		{host: " 127.0.0.1:7777 ", expected: "http://127.0.0.1:7777"},
+		{host: "http://127.0.0.1:7777/", expected: "http://127.0.0.1:7777"},
+		{host: "http://127.0.0.1:7777//", expected: "http://127.0.0.1:7777"},
+		{host: "https://goc.example.com", expected: "https://goc.example.com"},
+		{host: "https://goc.example.com/prefix/", expected: "https://goc.example.com/prefix"},
+		{host: "ftp://127.0.0.1:7777", err: true},
+		{host: "http://", err: true},
+		{host: "http://:7777", err: true},
+		{host: "", err: true},
+		{host: "http://127.0.0.1:7777?a=b", err: true},
+		{host: "http://127.0.0.1:port", err: true},
+	}
+	for _, tc := range tcs {
+		host, err := normalizeHost(tc.host)
+		if tc.err {
+			assert.Error(t, err, tc.host)
+			continue
+		}
+		assert.NoError(t, err, tc.host)
+		assert.Equal(t, tc.expected, host, tc.host)
+	}
+}
+
+func TestClientWithTrailingSlashHost(t *testing.T) {
+	assert.Equal(t, "http://127.0.0.1:7777/v1/cover/list", joinURL("http://127.0.0.1:7777/", CoverServicesListAPI))
+	assert.Equal(t, "http://127.0.0.1:7777/v1/cover/list", joinURL("http://127.0.0.1:7777", CoverServicesListAPI))
+	assert.Equal(t, "http://127.0.0.1:7777/prefix/v1/cover/list", joinURL("http://127.0.0.1:7777/prefix//", CoverServicesListAPI))
+
+	server := NewMemoryBasedServer()
+	server.Store.Add(ServiceUnderTest{Name: "foo", Address: "http://127.0.0.1:1001"})
+	ts := httptest.NewServer(server.Route(os.Stdout))
+	defer ts.Close()
+
+	// the client is not created by NewWorker, so the host is not normalized
+	c := &client{
+		Host:   ts.URL + "/",
+		client: http.DefaultClient,
+	}
+	res, err := c.ListServices()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"foo":["http://127.0.0.1:1001"]}`, string(res))
+	assert.NoError(t, c.Ping())
+}
+
+func TestNewTransport(t *testing.T) {
+	tr := newTransport(WorkerOptions{})
+	assert.Equal(t, DefaultMaxIdleConns, tr.MaxIdleConns)
+	assert.Equal(t, DefaultMaxIdleConnsPerHost, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, DefaultIdleConnTimeout, tr.IdleConnTimeout)
+
+	tr = newTransport(WorkerOptions{MaxIdleConns: 10, MaxIdleConnsPerHost: 2, IdleConnTimeout: time.Second})
+	assert.Equal(t, 10, tr.MaxIdleConns)
+	assert.Equal(t, 2, tr.MaxIdleConnsPerHost)
+	assert.Equal(t, time.Second, tr.IdleConnTimeout)
+
+	w := NewWorkerWithOptions("127.0.0.1:7777", WorkerOptions{MaxIdleConnsPerHost: 2})
+	assert.Equal(t, 2, w.(*client).client.Transport.(*http.Transport).MaxIdleConnsPerHost)
+	// the workers created by NewWorker share the connection pool
+	assert.Equal(t, NewWorker("127.0.0.1:7777").(*client).client, NewWorker("127.0.0.1:8888").(*client).client)
+}
+
+func TestWorkerThroughProxy(t *testing.T) {
+	// a stub proxy answers for the host only reachable through it
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = append(proxied, r.Method+" "+r.URL.Scheme+"://"+r.URL.Host+r.URL.Path)
+		w.Write([]byte("pong"))
+	}))
+	defer proxy.Close()
+	proxyURL, err := url.Parse(proxy.URL)
+	assert.NoError(t, err)
+
+	w := NewWorkerWithOptions("goc-center.internal:7777", WorkerOptions{Proxy: proxyURL})
+	assert.NoError(t, w.Ping())
+	assert.Equal(t, []string{"GET http://goc-center.internal:7777" + CoverPingAPI}, proxied)
+
+	// the proxy from the environment is used by default
+	assert.NotNil(t, newTransport(WorkerOptions{}).Proxy)
+}
+
+func BenchmarkWorkerPing(b *testing.B) {
+	server := NewMemoryBasedServer()
+	ts := httptest.NewServer(server.Route(ioutil.Discard))
+	defer ts.Close()
+
+	w := NewWorker(ts.URL)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := w.Ping(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestClientRawDo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusTeapot)
+		fmt.Fprintf(w, "%s %s?%s %s %s", r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get("Content-Type"), body)
+	}))
+	defer ts.Close()
+
+	c := NewWorker(ts.URL)
+	res, code, err := c.Do("POST", "/v1/cover/not-yet-typed?x=1", strings.NewReader(`{"a":1}`))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusTeapot, code)
+	assert.Equal(t, `POST /v1/cover/not-yet-typed?x=1 application/json {"a":1}`, string(res))
+
+	// a known endpoint of the service center
+	server := NewMemoryBasedServer()
+	center := httptest.NewServer(server.Route(os.Stdout))
+	defer center.Close()
+	res, code, err = NewWorker(center.URL).Do("GET", CoverPingAPI, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"result":"pong"}`, string(res))
+
+	_, _, err = NewWorker("http://127.0.0.1:11111").Do("GET", CoverPingAPI, nil)
+	assert.Error(t, err)
+}
+
+func TestClientRetryOnStatus(t *testing.T) {
+	var calls int
+	var bodies []string
+	// the server is overloaded for the first two requests
+	var pings int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == CoverPingAPI {
+			pings++
+			return
+		}
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if calls <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer ts.Close()
+	opts := WorkerOptions{RetryBackoff: time.Millisecond}
+
+	// the idempotent request is retried with the body
+	res, code, err := NewWorkerWithOptions(ts.URL, opts).Do("PUT", "/v1/any", strings.NewReader("payload"))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", string(res))
+	assert.Equal(t, 3, calls)
+	assert.Equal(t, []string{"payload", "payload", "payload"}, bodies)
+	// the center is probed before each retry
+	assert.Equal(t, 2, pings)
+
+	// the non-idempotent request is never retried
+	calls = 0
+	_, code, err = NewWorkerWithOptions(ts.URL, opts).Do("POST", "/v1/any", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, 1, calls)
+
+	// give up after the max retries
+	calls = 0
+	_, code, err = NewWorkerWithOptions(ts.URL, WorkerOptions{StatusRetries: 1, RetryBackoff: time.Millisecond}).Do("GET", "/v1/any", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, 2, calls)
+
+	// the retries are disabled
+	calls = 0
+	_, code, err = NewWorkerWithOptions(ts.URL, WorkerOptions{StatusRetries: -1}).Do("GET", "/v1/any", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, 1, calls)
+
+	// the status codes not configured are not retried
+	calls = 0
+	_, code, err = NewWorkerWithOptions(ts.URL, WorkerOptions{RetryStatusCodes: []int{http.StatusBadGateway}}).Do("GET", "/v1/any", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	p := newRetryPolicy(WorkerOptions{})
+	assert.Equal(t, DefaultStatusRetries, p.retries)
+	for _, code := range DefaultRetryStatusCodes {
+		assert.True(t, p.shouldRetry("GET", 0, code))
+	}
+	assert.False(t, p.shouldRetry("GET", 0, http.StatusInternalServerError))
+	assert.False(t, p.shouldRetry("GET", DefaultStatusRetries, http.StatusServiceUnavailable))
+	assert.False(t, p.shouldRetry("POST", 0, http.StatusServiceUnavailable))
+	assert.True(t, p.shouldRetry("DELETE", 0, http.StatusServiceUnavailable))
+	assert.Equal(t, []time.Duration{DefaultRetryBackoff, 2 * DefaultRetryBackoff, 4 * DefaultRetryBackoff},
+		[]time.Duration{p.wait(0), p.wait(1), p.wait(2)})
+
+	assert.True(t, p.retryNetwork(io.EOF))
+	assert.False(t, p.retryNetwork(nil))
+	assert.False(t, p.retryNetwork(errors.New("not a network error")))
+	assert.False(t, newRetryPolicy(WorkerOptions{NoNetworkRetry: true}).retryNetwork(io.EOF))
+}
+
+// the request is not sent again while the service center does not answer the ping
+func TestClientRetryWaitsForReady(t *testing.T) {
+	var calls, pings int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == CoverPingAPI {
+			pings++
+		} else {
+			calls++
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	_, code, err := NewWorkerWithOptions(ts.URL, WorkerOptions{RetryBackoff: time.Millisecond}).Do("GET", "/v1/any", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, DefaultStatusRetries, pings)
+}
+
+// the retry on the network error is not counted against the retries on the status codes
+func TestDoStreamRetries(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == CoverPingAPI {
+			return
+		}
+		switch atomic.AddInt32(&calls, 1) {
+		case 1:
+			// the connection is closed without a response
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+		case 2:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	// the transports are not shared, which replay the idempotent requests failed on the reused connections
+	c := newWorker(ts.URL, &http.Client{Transport: &http.Transport{}}, WorkerOptions{StatusRetries: 1, RetryBackoff: time.Millisecond}).(*client)
+	assert.NoError(t, c.doStream("GET", ts.URL+"/v1/any", "", nil, &buf))
+	assert.Equal(t, "ok", buf.String())
+	assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+
+	// the network error is returned at once if the retry is disabled
+	atomic.StoreInt32(&calls, 0)
+	c = newWorker(ts.URL, &http.Client{Transport: &http.Transport{}}, WorkerOptions{NoNetworkRetry: true}).(*client)
+	assert.Error(t, c.doStream("POST", ts.URL+"/v1/any", "", nil, &buf))
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,44 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// ConvertCoverDirs converts the coverage data written into GOCOVERDIR by the programs built with
+// go build -cover into a text profile, which can be merged with the profiles of goc, it needs go1.20 or later.
+// The conversion is run by the given go command, e.g. the one the programs are built with, the go in PATH if empty.
+func ConvertCoverDirs(goBinary string, dirs []string, out string) error {
+	if len(dirs) == 0 {
+		return errors.New("expected at least one coverage directory")
+	}
+	if goBinary == "" {
+		goBinary = "go"
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(goBinary, "tool", "covdata", "textfmt", "-i="+strings.Join(dirs, ","), "-o="+out)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to convert the coverage directories %v, err: %v, stderr: %s", dirs, err, stderr.String())
+	}
+	return nil
+}
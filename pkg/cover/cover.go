@@ -23,12 +23,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
@@ -45,13 +49,32 @@ var (
 	ErrCoverPkgFailed = errors.New("fail to inject code to project")
 	// ErrCoverListFailed represents the error that fails to list package dependencies
 	ErrCoverListFailed = errors.New("fail to list package dependencies")
+	// ErrCoverVarCollision represents the error that the code declares an identifier named as a coverage counter
+	ErrCoverVarCollision = errors.New("identifier collides with the coverage counter")
 )
 
+const (
+	// ScopeDeps instruments the main packages and the packages of the project they import
+	ScopeDeps = "deps"
+	// ScopeModule instruments all the packages of the project, the ones not imported by
+	// a main package are reported by its agent as well, e.g. uncovered at all
+	ScopeModule = "module"
+)
+
+// DefaultCoverVarPrefix is the default prefix of the names of the injected coverage counters
+const DefaultCoverVarPrefix = "GoCover"
+
 // TestCover is a collection of all counters
 type TestCover struct {
 	Mode                     string
 	AgentPort                string
 	Center                   string // cover profile host center
+	AgentName                string // name the service registers with, the binary name if empty
+	AgentHost                string // IP or network interface the service advertises, an IP of the host if empty
+	RegisterTimeout          time.Duration
+	Revision                 string        // VCS revision the service is built from, reported as the revision label
+	NoFlushOnExit            bool          // not to push the final coverage to the center when terminated
+	PushInterval             time.Duration // how often the service pushes its coverage, no push if zero
 	Singleton                bool
 	MainPkgCover             *PackageCover
 	DepsCover                []*PackageCover
@@ -59,6 +82,20 @@ type TestCover struct {
 	GlobalCoverVarImportPath string
 }
 
+// HasCounters reports whether any package is instrumented,
+// the packages may all be filtered out and leave no counters to report
+func (tc TestCover) HasCounters() bool {
+	if tc.MainPkgCover != nil && len(tc.MainPkgCover.Vars) != 0 {
+		return true
+	}
+	for _, pkgCover := range tc.DepsCover {
+		if len(pkgCover.Vars) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
 // PackageCover holds all the generate coverage variables of a package
 type PackageCover struct {
 	Package *Package
@@ -67,8 +104,9 @@ type PackageCover struct {
 
 // FileVar holds the name of the generated coverage variables targeting the named file.
 type FileVar struct {
-	File string
-	Var  string
+	File   string
+	Var    string
+	Blocks int // number of the coverage blocks in the file
 }
 
 // Package map a package output by go list
@@ -88,6 +126,8 @@ type Package struct {
 	// Source files
 	GoFiles  []string `json:"GoFiles,omitempty"`  // .go source files (excluding CgoFiles, TestGoFiles, XTestGoFiles)
 	CgoFiles []string `json:"CgoFiles,omitempty"` // .go source files that import "C"
+	// IgnoredGoFiles are the .go source files ignored due to build constraints
+	IgnoredGoFiles []string `json:"IgnoredGoFiles,omitempty"`
 
 	// Dependency information
 	Deps      []string          `json:"Deps,omitempty"` // all (recursively) imported dependencies
@@ -98,6 +138,9 @@ type Package struct {
 	Incomplete bool            `json:"Incomplete,omitempty"` // this package or a dependency has an error
 	Error      *PackageError   `json:"Error,omitempty"`      // error loading package
 	DepsErrors []*PackageError `json:"DepsErrors,omitempty"` // errors loading dependencies
+
+	skipFiles      map[string]bool // source files which should not be instrumented
+	coverVarPrefix string          // prefix of the coverage counter names, DefaultCoverVarPrefix if empty
 }
 
 // ModulePublic represents the package info of a module
@@ -140,7 +183,30 @@ type CoverInfo struct {
 	Mode                     string
 	AgentPort                string
 	Center                   string
+	AgentName                string // name the service registers with, the binary name if empty
 	Singleton                bool
+	IncludeGenerated         bool     // instrument generated files too
+	CoverPkgs                []string // patterns of import paths to instrument, all packages if empty
+	SkipPkgs                 []string // patterns of import paths not to instrument
+	ReportFile               string   // write a JSON report of the instrumented files to this file if not empty
+	CoverVarPrefix           string   // prefix of the names of the coverage counters, DefaultCoverVarPrefix if empty
+	InstrumentScope          string   // ScopeDeps or ScopeModule, ScopeDeps if empty
+
+	// AgentHost is the IP, or the network interface whose IP, the service advertises to the center
+	// to be reached at, e.g. on a host with multiple networks, an IP of the host is picked if empty
+	AgentHost string
+	// RegisterTimeout is how long the service retries registering into the center with backoff
+	// if the center is unreachable, e.g. started after the service, no retry if zero
+	RegisterTimeout time.Duration
+	// Revision is the VCS revision the service is built from, e.g. the git commit, which the service
+	// registers with as the label revision:<Revision>, not registered if empty
+	Revision string
+	// NoFlushOnExit stops the service from pushing its final coverage to the center when it is
+	// terminated by SIGTERM or SIGINT, which it does before deregistering by default
+	NoFlushOnExit bool
+	// PushInterval is how often the service pushes its coverage to the center, which reports the
+	// pushed coverage instead of asking the service for it, no push if zero
+	PushInterval time.Duration
 }
 
 //Execute inject cover variables for all the .go files in the target folder
@@ -176,20 +242,93 @@ func Execute(coverInfo *CoverInfo) error {
 		return err
 	}
 
+	filter, err := newPackageFilter(coverInfo.CoverPkgs, coverInfo.SkipPkgs)
+	if err != nil {
+		log.Errorf("Invalid package pattern, the error: %v", err)
+		return err
+	}
+	if prefix := coverInfo.CoverVarPrefix; prefix != "" && !(token.IsIdentifier(prefix) && token.IsExported(prefix)) {
+		err := fmt.Errorf("invalid cover variable prefix %q, it should be an exported Go identifier", prefix)
+		log.Error(err)
+		return err
+	}
+	switch coverInfo.InstrumentScope {
+	case "", ScopeDeps, ScopeModule:
+	default:
+		err := fmt.Errorf("invalid instrument scope %q, it should be %s or %s", coverInfo.InstrumentScope, ScopeDeps, ScopeModule)
+		log.Error(err)
+		return err
+	}
+	// the center is baked into the service to register into, validate it at build time
+	if !singleton {
+		normalized, err := normalizeHost(center)
+		if err != nil {
+			err = fmt.Errorf("invalid center %q: %v", center, err)
+			log.Error(err)
+			return err
+		}
+		// the agent registers and pushes over HTTP only, grpc:// is for the clients of the center
+		if strings.HasPrefix(normalized, GRPCScheme+"://") {
+			err = fmt.Errorf("invalid center %q: the service registers over HTTP, the center should be like http://127.0.0.1:7777", center)
+			log.Error(err)
+			return err
+		}
+		center = normalized
+	}
+	if coverInfo.Revision != "" && !labelValueRe.MatchString(coverInfo.Revision) {
+		err := fmt.Errorf("%w: invalid revision %q", ErrInvalidLabel, coverInfo.Revision)
+		log.Error(err)
+		return err
+	}
+	if coverInfo.RegisterTimeout < 0 {
+		err := fmt.Errorf("invalid register timeout %v, it should not be negative", coverInfo.RegisterTimeout)
+		log.Error(err)
+		return err
+	}
+	if coverInfo.PushInterval < 0 {
+		err := fmt.Errorf("invalid push interval %v, it should not be negative", coverInfo.PushInterval)
+		log.Error(err)
+		return err
+	}
+	if coverInfo.AgentName != "" {
+		if err := CheckAgentName(coverInfo.AgentName); err != nil {
+			log.Error(err)
+			return err
+		}
+	}
+	for _, pkg := range pkgs {
+		markSkipFiles(pkg, coverInfo.IncludeGenerated)
+		pkg.coverVarPrefix = coverInfo.CoverVarPrefix
+	}
+
+	report := newInstrumentReport(target)
+	var instrumented []*PackageCover
 	var seen = make(map[string]*PackageCover)
 	// var seenCache = make(map[string]*PackageCover)
 	allDecl := ""
 	for _, pkg := range pkgs {
 		if pkg.Name == "main" {
 			log.Printf("handle package: %v", pkg.ImportPath)
-			// inject the main package
-			mainCover, mainDecl := AddCounters(pkg, mode, globalCoverVarImportPath)
-			allDecl += mainDecl
+			// inject the main package, the agent is injected even if the package is filtered out
+			mainCover := &PackageCover{Package: pkg}
+			if filter.match(pkg.ImportPath) {
+				var mainDecl string
+				mainCover, mainDecl = AddCounters(pkg, mode, globalCoverVarImportPath)
+				allDecl += mainDecl
+				report.add(mainCover)
+				instrumented = append(instrumented, mainCover)
+			}
 			// new a testcover for this service
 			tc := TestCover{
 				Mode:                     mode,
 				AgentPort:                agentPort,
 				Center:                   center,
+				AgentName:                coverInfo.AgentName,
+				AgentHost:                coverInfo.AgentHost,
+				RegisterTimeout:          coverInfo.RegisterTimeout,
+				Revision:                 coverInfo.Revision,
+				NoFlushOnExit:            coverInfo.NoFlushOnExit,
+				PushInterval:             coverInfo.PushInterval,
 				Singleton:                singleton,
 				MainPkgCover:             mainCover,
 				GlobalCoverVarImportPath: globalCoverVarImportPath,
@@ -198,18 +337,24 @@ func Execute(coverInfo *CoverInfo) error {
 			// handle its dependency
 			// var internalPkgCache = make(map[string][]*PackageCover)
 			tc.CacheCover = make(map[string]*PackageCover)
-			for _, dep := range pkg.Deps {
+			deps := pkg.Deps
+			if coverInfo.InstrumentScope == ScopeModule {
+				deps = append(append([]string{}, pkg.Deps...), otherPackages(pkgs, pkg.Deps)...)
+			}
+			for _, dep := range deps {
 				if packageCover, ok := seen[dep]; ok {
 					tc.DepsCover = append(tc.DepsCover, packageCover)
 					continue
 				}
 
 				//only focus package neither standard Go library nor dependency library
-				if depPkg, ok := pkgs[dep]; ok {
+				if depPkg, ok := pkgs[dep]; ok && filter.match(dep) {
 					packageCover, depDecl := AddCounters(depPkg, mode, globalCoverVarImportPath)
 					allDecl += depDecl
 					tc.DepsCover = append(tc.DepsCover, packageCover)
 					seen[dep] = packageCover
+					report.add(packageCover)
+					instrumented = append(instrumented, packageCover)
 				}
 			}
 
@@ -222,28 +367,89 @@ func Execute(coverInfo *CoverInfo) error {
 		}
 	}
 
+	if err := checkCoverVarCollisions(instrumented); err != nil {
+		log.Errorf("%v, use another prefix of the cover variables", err)
+		return err
+	}
+
+	if coverInfo.ReportFile != "" {
+		if err := report.write(coverInfo.ReportFile); err != nil {
+			log.Errorf("Fail to write the instrument report, the error: %v", err)
+			return err
+		}
+	}
+
 	return injectGlobalCoverVarFile(coverInfo, allDecl)
 }
 
+// otherPackages returns the sorted import paths of the packages which are neither main packages nor in deps
+func otherPackages(pkgs map[string]*Package, deps []string) []string {
+	imported := make(map[string]bool, len(deps))
+	for _, dep := range deps {
+		imported[dep] = true
+	}
+	var others []string
+	for importPath, pkg := range pkgs {
+		if pkg.Name != "main" && !imported[importPath] {
+			others = append(others, importPath)
+		}
+	}
+	sort.Strings(others)
+	return others
+}
+
 // ListPackages list all packages under specific via go list command
 // The argument newgopath is if you need to go list in a different GOPATH
+// The packages failing to load, e.g. with a broken package clause, are skipped with a warning
+// instead of failing the whole listing, the go command reports them if they are really built.
 func ListPackages(dir string, args string, newgopath string) (map[string]*Package, error) {
-	cmd := exec.Command("/bin/bash", "-c", "go list "+args)
-	log.Printf("go list cmd is: %v", cmd.Args)
-	cmd.Dir = dir
+	var env []string
 	if newgopath != "" {
-		cmd.Env = append(os.Environ(), fmt.Sprintf("GOPATH=%v", newgopath))
+		env = append(os.Environ(), fmt.Sprintf("GOPATH=%v", newgopath))
 	}
+	return ListPackagesWithEnv(dir, args, env)
+}
+
+// ListPackagesWithEnv lists the packages like ListPackages with go list run in the given environment,
+// e.g. the one of the go command building the packages, the environment of goc is used if it is nil
+func ListPackagesWithEnv(dir string, args string, env []string) (map[string]*Package, error) {
+	cmd := exec.Command("/bin/bash", "-c", "go list -e "+args)
+	log.Printf("go list cmd is: %v", cmd.Args)
+	cmd.Dir = dir
+	cmd.Env = env
 	var errbuf bytes.Buffer
 	cmd.Stderr = &errbuf
-	out, err := cmd.Output()
+	// go list emits a stream of JSON objects, decode them while the command is running
+	// instead of buffering the whole output, which is huge for large projects
+	out, err := cmd.StdoutPipe()
 	if err != nil {
-		log.Errorf("excute `go list -json ./...` command failed, err: %v, stdout: %v, stderr: %v", err, string(out), errbuf.String())
+		log.Errorf("excute `go list -json ./...` command failed, err: %v", err)
+		return nil, ErrCoverListFailed
+	}
+	if err := cmd.Start(); err != nil {
+		log.Errorf("excute `go list -json ./...` command failed, err: %v, stderr: %v", err, errbuf.String())
 		return nil, ErrCoverListFailed
 	}
+	pkgs, decodeErr := decodePackages(out)
+	// drain the rest of the output, so go list can exit normally
+	io.Copy(ioutil.Discard, out)
+	if err := cmd.Wait(); err != nil {
+		log.Errorf("excute `go list -json ./...` command failed, err: %v, stderr: %v", err, errbuf.String())
+		return nil, ErrCoverListFailed
+	}
+	if decodeErr != nil {
+		return nil, decodeErr
+	}
 	log.Infof("\n%v", errbuf.String())
-	dec := json.NewDecoder(bytes.NewReader(out))
+	return pkgs, nil
+}
+
+// decodePackages decodes the packages from the output stream of go list -e -json,
+// the packages with errors are skipped, ErrCoverPkgFailed is returned if all of them are broken
+func decodePackages(r io.Reader) (map[string]*Package, error) {
+	dec := json.NewDecoder(r)
 	pkgs := make(map[string]*Package, 0)
+	var broken []string
 	for {
 		var pkg Package
 		if err := dec.Decode(&pkg); err != nil {
@@ -254,8 +460,9 @@ func ListPackages(dir string, args string, newgopath string) (map[string]*Packag
 			return nil, ErrCoverListFailed
 		}
 		if pkg.Error != nil {
-			log.Errorf("list package %s failed with output: %v", pkg.ImportPath, pkg.Error)
-			return nil, ErrCoverPkgFailed
+			log.Warnf("list package %s failed with output: %v, skip it", pkg.ImportPath, pkg.Error)
+			broken = append(broken, pkg.ImportPath)
+			continue
 		}
 
 		// for _, err := range pkg.DepsErrors {
@@ -264,6 +471,13 @@ func ListPackages(dir string, args string, newgopath string) (map[string]*Packag
 
 		pkgs[pkg.ImportPath] = &pkg
 	}
+	if len(broken) != 0 {
+		if len(pkgs) == 0 {
+			log.Errorf("all the listed packages failed: %v", broken)
+			return nil, ErrCoverPkgFailed
+		}
+		log.Warnf("%d packages failed to list and are skipped: %v", len(broken), broken)
+	}
 	return pkgs, nil
 }
 
@@ -276,7 +490,9 @@ func AddCounters(pkg *Package, mode string, globalCoverVarImportPath string) (*P
 
 	decl := ""
 	for file, coverVar := range coverVarMap {
-		decl += "\n" + tool.Annotate(path.Join(pkg.Dir, file), mode, coverVar.Var, globalCoverVarImportPath) + "\n"
+		fileDecl, blocks := tool.Annotate(path.Join(pkg.Dir, file), mode, coverVar.Var, globalCoverVarImportPath)
+		decl += "\n" + fileDecl + "\n"
+		coverVar.Blocks = blocks
 	}
 
 	return &PackageCover{
@@ -354,22 +570,32 @@ func declareCoverVars(p *Package) map[string]*FileVar {
 	// break things.
 	sum := sha256.Sum256([]byte(p.ImportPath))
 	h := fmt.Sprintf("%x", sum[:6])
+	prefix := p.coverVarPrefix
+	if prefix == "" {
+		prefix = DefaultCoverVarPrefix
+	}
 	for _, file := range p.GoFiles {
+		if p.skipFiles[file] {
+			continue
+		}
 		// These names appear in the cmd/cover HTML interface.
 		var longFile = path.Join(p.ImportPath, file)
 		coverVars[file] = &FileVar{
 			File: longFile,
-			Var:  fmt.Sprintf("GoCover_%d_%x", coverIndex, h),
+			Var:  fmt.Sprintf("%s_%d_%x", prefix, coverIndex, h),
 		}
 		coverIndex++
 	}
 
 	for _, file := range p.CgoFiles {
+		if p.skipFiles[file] {
+			continue
+		}
 		// These names appear in the cmd/cover HTML interface.
 		var longFile = path.Join(p.ImportPath, file)
 		coverVars[file] = &FileVar{
 			File: longFile,
-			Var:  fmt.Sprintf("GoCover_%d_%x", coverIndex, h),
+			Var:  fmt.Sprintf("%s_%d_%x", prefix, coverIndex, h),
 		}
 		coverIndex++
 	}
@@ -377,6 +603,154 @@ func declareCoverVars(p *Package) map[string]*FileVar {
 	return coverVars
 }
 
+// checkCoverVarCollisions checks whether the instrumented packages declare any identifier named as a coverage counter,
+// the counters are dot imported into the instrumented files, so such identifiers fail the compiling
+func checkCoverVarCollisions(pkgCovers []*PackageCover) error {
+	vars := make(map[string]bool)
+	for _, pkgCover := range pkgCovers {
+		for _, v := range pkgCover.Vars {
+			vars[v.Var] = true
+		}
+	}
+
+	fset := token.NewFileSet()
+	for _, pkgCover := range pkgCovers {
+		if len(pkgCover.Vars) == 0 {
+			continue
+		}
+		pkg := pkgCover.Package
+		for _, files := range [][]string{pkg.GoFiles, pkg.CgoFiles} {
+			for _, file := range files {
+				f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, file), nil, 0)
+				if err != nil {
+					return fmt.Errorf("fail to parse %s: %v", filepath.Join(pkg.Dir, file), err)
+				}
+				for _, name := range topLevelNames(f) {
+					if vars[name.Name] {
+						return fmt.Errorf("%w: %s declared at %s", ErrCoverVarCollision, name.Name, fset.Position(name.Pos()))
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// topLevelNames returns the identifiers declared in the package block by the file
+func topLevelNames(f *ast.File) []*ast.Ident {
+	var names []*ast.Ident
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				names = append(names, d.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch s := spec.(type) {
+				case *ast.ValueSpec:
+					names = append(names, s.Names...)
+				case *ast.TypeSpec:
+					names = append(names, s.Name)
+				}
+			}
+		}
+	}
+	return names
+}
+
+// packageFilter decides which packages should be instrumented by their import paths
+type packageFilter struct {
+	include []string
+	exclude []string
+}
+
+// newPackageFilter creates a packageFilter, a pattern is either a glob pattern
+// as path.Match, or an import path ending with "/..." which matches the path and all its sub packages
+func newPackageFilter(include, exclude []string) (*packageFilter, error) {
+	for _, pattern := range append(append([]string{}, include...), exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("bad package pattern %q: %w", pattern, err)
+		}
+	}
+	return &packageFilter{include: include, exclude: exclude}, nil
+}
+
+// match reports whether the package should be instrumented
+func (f *packageFilter) match(importPath string) bool {
+	if len(f.include) != 0 && !matchAnyPattern(f.include, importPath) {
+		return false
+	}
+	return !matchAnyPattern(f.exclude, importPath)
+}
+
+func matchAnyPattern(patterns []string, importPath string) bool {
+	for _, pattern := range patterns {
+		if MatchPackage(pattern, importPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchPackage reports whether the import path matches the pattern, which is either a glob pattern
+// as path.Match, or an import path ending with "/..." which matches the path and all its sub packages.
+// A malformed pattern matches nothing.
+func MatchPackage(pattern, importPath string) bool {
+	if strings.HasSuffix(pattern, "/...") {
+		prefix := strings.TrimSuffix(pattern, "/...")
+		return importPath == prefix || strings.HasPrefix(importPath, prefix+"/")
+	}
+	ok, _ := path.Match(pattern, importPath)
+	return ok
+}
+
+// generatedCodeRe matches the comment which marks a file as generated,
+// see https://golang.org/s/generatedcode
+var generatedCodeRe = regexp.MustCompile(`^// Code generated .* DO NOT EDIT\.$`)
+
+// markSkipFiles marks generated files of the package as not to be instrumented,
+// as counters in them distort the coverage, they are not marked if includeGenerated is true.
+// Test files are never listed in GoFiles, so they need no marking.
+// Files importing "C" are always marked, the counters interfere with the cgo preprocessing.
+func markSkipFiles(p *Package, includeGenerated bool) {
+	p.skipFiles = make(map[string]bool)
+	for _, file := range p.CgoFiles {
+		log.Infof("skip instrumenting cgo file: %v", filepath.Join(p.Dir, file))
+		p.skipFiles[file] = true
+	}
+	if includeGenerated {
+		return
+	}
+	for _, file := range p.GoFiles {
+		if isGeneratedFile(filepath.Join(p.Dir, file)) {
+			log.Infof("skip instrumenting file: %v", filepath.Join(p.Dir, file))
+			p.skipFiles[file] = true
+		}
+	}
+}
+
+// isGeneratedFile checks whether the file has a generated code comment before the package clause
+func isGeneratedFile(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if generatedCodeRe.MatchString(line) {
+			return true
+		}
+		if strings.HasPrefix(line, "package ") {
+			break
+		}
+	}
+	return false
+}
+
 func declareCacheVars(in *PackageCover) map[string]*FileVar {
 	sum := sha256.Sum256([]byte(in.Package.ImportPath))
 	h := fmt.Sprintf("%x", sum[:5])
@@ -17,7 +17,9 @@
 package cover
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -234,6 +236,38 @@ func TestDeclareCoverVars(t *testing.T) {
 
 }
 
+// generated files should not be instrumented by default
+func TestMarkSkipFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-skip-files")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"foo.go":     "package foo\n\nfunc Foo() {}\n",
+		"foo_gen.go": "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage foo\n",
+		"bar.go":     "package foo\n\n// Code generated by hand. DO NOT EDIT.\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	pkg := &Package{
+		Dir:        dir,
+		GoFiles:    []string{"bar.go", "foo.go", "foo_gen.go"},
+		CgoFiles:   []string{"foo_cgo.go"},
+		ImportPath: "example/foo",
+	}
+	markSkipFiles(pkg, false)
+	coverVars := declareCoverVars(pkg)
+	assert.Equal(t, 2, len(coverVars))
+	assert.NotNil(t, coverVars["foo.go"])
+	assert.NotNil(t, coverVars["bar.go"], "comment after the package clause does not mark a generated file")
+
+	pkg.skipFiles = nil
+	markSkipFiles(pkg, true)
+	assert.Equal(t, 3, len(declareCoverVars(pkg)), "cgo files should never be instrumented")
+}
+
 func TestGetInternalParent(t *testing.T) {
 	var tcs = []struct {
 		ImportPath     string
@@ -358,6 +392,76 @@ func TestListPackagesForSimpleModProject(t *testing.T) {
 
 }
 
+func TestDecodePackages(t *testing.T) {
+	stream := `{"ImportPath": "example.com/a", "Name": "a"}
+{"ImportPath": "example.com/b", "Name": "main"}`
+	pkgs, err := decodePackages(strings.NewReader(stream))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(pkgs))
+	assert.Equal(t, "main", pkgs["example.com/b"].Name)
+
+	_, err = decodePackages(strings.NewReader(`{"ImportPath": "example.com/a"`))
+	assert.Equal(t, ErrCoverListFailed, err)
+
+	_, err = decodePackages(strings.NewReader(`{"ImportPath": "example.com/a", "Error": {"Err": "no Go files"}}`))
+	assert.Equal(t, ErrCoverPkgFailed, err)
+
+	// the broken package is skipped
+	stream = `{"ImportPath": "example.com/a", "Error": {"Err": "expected 'package', found packag"}}
+{"ImportPath": "example.com/b", "Name": "main"}`
+	pkgs, err = decodePackages(strings.NewReader(stream))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pkgs))
+	assert.NotNil(t, pkgs["example.com/b"])
+}
+
+func TestListPackagesWithBrokenPackage(t *testing.T) {
+	os.Setenv("GOPATH", "")
+	os.Setenv("GO111MODULE", "on")
+
+	workingDir, err := ioutil.TempDir("", "goc-broken-project")
+	assert.NoError(t, err)
+	defer os.RemoveAll(workingDir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(workingDir, "broken"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "go.mod"), []byte("module example.com/broken\n\ngo 1.13\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(workingDir, "broken", "broken.go"), []byte("packag broken\n"), 0644))
+
+	pkgs, err := ListPackages(workingDir, "-json ./...", "")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(pkgs))
+	assert.NotNil(t, pkgs["example.com/broken"], "the buildable package should be listed")
+}
+
+// BenchmarkListPackages lists a generated module with many packages
+func BenchmarkListPackages(b *testing.B) {
+	workingDir, err := ioutil.TempDir("", "goc-list-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(workingDir)
+
+	const pkgCount = 500
+	ioutil.WriteFile(filepath.Join(workingDir, "go.mod"), []byte("module example.com/bench\n"), 0644)
+	for i := 0; i < pkgCount; i++ {
+		dir := filepath.Join(workingDir, fmt.Sprintf("pkg%d", i))
+		os.MkdirAll(dir, os.ModePerm)
+		src := fmt.Sprintf("package pkg%d\n\nfunc Foo() int { return %d }\n", i, i)
+		ioutil.WriteFile(filepath.Join(dir, "foo.go"), []byte(src), 0644)
+	}
+
+	os.Setenv("GOPATH", "")
+	os.Setenv("GO111MODULE", "on")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		pkgs, err := ListPackages(workingDir, "-json ./...", "")
+		if err != nil || len(pkgs) != pkgCount {
+			b.Fatalf("list packages failed, err: %v, got %d packages", err, len(pkgs))
+		}
+	}
+}
+
 // test if goc can get variables in internal package
 func TestCoverResultForInternalPackage(t *testing.T) {
 
@@ -386,3 +490,187 @@ func TestCoverResultForInternalPackage(t *testing.T) {
 		assert.FailNow(t, "should generate http_cover_apis_auto_generated.go")
 	}
 }
+
+func TestPackageFilter(t *testing.T) {
+	var tcs = []struct {
+		name       string
+		include    []string
+		exclude    []string
+		importPath string
+		expected   bool
+	}{
+		{name: "no filter", importPath: "example.com/foo", expected: true},
+		{name: "include matched", include: []string{"example.com/foo/..."}, importPath: "example.com/foo/bar", expected: true},
+		{name: "include matched itself", include: []string{"example.com/foo/..."}, importPath: "example.com/foo", expected: true},
+		{name: "include not matched", include: []string{"example.com/foo/..."}, importPath: "example.com/foobar", expected: false},
+		{name: "include glob", include: []string{"example.com/*/bar"}, importPath: "example.com/foo/bar", expected: true},
+		{name: "exclude matched", exclude: []string{"github.com/*"}, importPath: "github.com/lib", expected: false},
+		{name: "exclude not matched", exclude: []string{"github.com/*"}, importPath: "example.com/foo", expected: true},
+		{name: "exclude wins", include: []string{"example.com/..."}, exclude: []string{"example.com/foo/internal/..."}, importPath: "example.com/foo/internal/bar", expected: false},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := newPackageFilter(tc.include, tc.exclude)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, filter.match(tc.importPath))
+		})
+	}
+
+	_, err := newPackageFilter([]string{"example.com/["}, nil)
+	assert.Error(t, err)
+}
+
+// only the packages passing the filter should be instrumented
+func TestCoverWithPackageFilter(t *testing.T) {
+	os.Setenv("GOPATH", "")
+	os.Setenv("GO111MODULE", "on")
+
+	var tcs = []struct {
+		name      string
+		coverPkgs []string
+		skipPkgs  []string
+		covered   []string
+		uncovered []string
+	}{
+		{
+			name:      "include only",
+			coverPkgs: []string{"example.com/simple-project/foo/..."},
+			covered:   []string{"example.com/simple-project/foo/bar1.go", "example.com/simple-project/foo/internal/xiaoming.go"},
+			uncovered: []string{"example.com/simple-project/main.go", "example.com/simple-project/internal/foo.go"},
+		},
+		{
+			name:      "exclude only",
+			skipPkgs:  []string{"example.com/simple-project/foo/..."},
+			covered:   []string{"example.com/simple-project/main.go", "example.com/simple-project/internal/foo.go"},
+			uncovered: []string{"example.com/simple-project/foo/bar1.go", "example.com/simple-project/foo/internal/xiaoming.go"},
+		},
+		{
+			name:      "exclude all",
+			skipPkgs:  []string{"example.com/simple-project/..."},
+			uncovered: []string{"example.com/simple-project/main.go", "example.com/simple-project/foo/bar1.go"},
+		},
+	}
+
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			testDir, err := ioutil.TempDir("", "goc-filter-test")
+			assert.NoError(t, err)
+			defer os.RemoveAll(testDir)
+			assert.NoError(t, copy.Copy("../../tests/samples/simple_project_with_internal", testDir))
+
+			err = Execute(&CoverInfo{
+				Target:    testDir,
+				Mode:      "count",
+				Center:    "http://127.0.0.1:7777",
+				CoverPkgs: tc.coverPkgs,
+				SkipPkgs:  tc.skipPkgs,
+			})
+			assert.NoError(t, err)
+
+			apis, err := ioutil.ReadFile(filepath.Join(testDir, "http_cover_apis_auto_generated.go"))
+			assert.NoError(t, err)
+			for _, file := range tc.covered {
+				assert.Contains(t, string(apis), file)
+			}
+			for _, file := range tc.uncovered {
+				assert.NotContains(t, string(apis), file)
+			}
+			// the cover variables package must not be imported as an unused name
+			assert.Equal(t, len(tc.covered) != 0, strings.Contains(string(apis), "_cover \""))
+		})
+	}
+}
+
+func TestCoverWithInstrumentReport(t *testing.T) {
+	os.Setenv("GOPATH", "")
+	os.Setenv("GO111MODULE", "on")
+
+	testDir, err := ioutil.TempDir("", "goc-report-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(testDir)
+	assert.NoError(t, copy.Copy("../../tests/samples/simple_project_with_internal", testDir))
+	reportFile := filepath.Join(testDir, "report.json")
+
+	err = Execute(&CoverInfo{
+		Target:     testDir,
+		Mode:       "count",
+		Center:     "http://127.0.0.1:7777",
+		ReportFile: reportFile,
+	})
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(reportFile)
+	assert.NoError(t, err)
+	var report InstrumentReport
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.Equal(t, testDir, report.TmpDir)
+
+	files := make(map[string]int)
+	for _, pkg := range report.Packages {
+		for _, file := range pkg.Files {
+			files[file.File] = file.Blocks
+		}
+	}
+	assert.Contains(t, files, "example.com/simple-project/main.go")
+	assert.Contains(t, files, "example.com/simple-project/foo/bar1.go")
+	assert.True(t, files["example.com/simple-project/main.go"] > 0, "main.go should have coverage blocks")
+}
+
+func TestExecuteWithGRPCCenter(t *testing.T) {
+	testDir, err := ioutil.TempDir("", "goc-grpc-center-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(testDir)
+	assert.NoError(t, copy.Copy("../../tests/samples/simple_project_with_internal", testDir))
+
+	// the agent can not register into the center over gRPC
+	err = Execute(&CoverInfo{
+		Target: testDir,
+		Mode:   "count",
+		Center: "grpc://127.0.0.1:7778",
+	})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "the center should be like http://")
+	}
+}
+
+func TestCoverVarCollision(t *testing.T) {
+	os.Setenv("GOPATH", "")
+	os.Setenv("GO111MODULE", "on")
+
+	var tcs = []struct {
+		name   string
+		prefix string
+		err    string
+	}{
+		{name: "default prefix collides", err: ErrCoverVarCollision.Error()},
+		{name: "custom prefix", prefix: "GocCounter"},
+		{name: "invalid prefix", prefix: "gocCounter", err: "invalid cover variable prefix"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			testDir, err := ioutil.TempDir("", "goc-collision-test")
+			assert.NoError(t, err)
+			defer os.RemoveAll(testDir)
+			assert.NoError(t, copy.Copy("../../tests/samples/cover_var_collision_project", testDir))
+
+			err = Execute(&CoverInfo{
+				Target:         testDir,
+				Mode:           "count",
+				Center:         "http://127.0.0.1:7777",
+				CoverVarPrefix: tc.prefix,
+			})
+			if tc.err != "" {
+				if assert.Error(t, err) {
+					assert.Contains(t, err.Error(), tc.err)
+				}
+				return
+			}
+			assert.NoError(t, err)
+			apis, err := ioutil.ReadFile(filepath.Join(testDir, "http_cover_apis_auto_generated.go"))
+			assert.NoError(t, err)
+			assert.Contains(t, string(apis), "_cover.GocCounter_0_")
+			assert.NotContains(t, string(apis), "_cover.GoCover_")
+		})
+	}
+}
@@ -0,0 +1,514 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package coverpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// CoverClient is the client API for Cover service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CoverClient interface {
+	// POST /v1/cover/register
+	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*Result, error)
+	// POST /v1/cover/profile, the merged profile is streamed in chunks as it may exceed the message size limit.
+	// The agents skipped are listed by the goc-failed-agents and goc-unreachable-agents header metadata.
+	Profile(ctx context.Context, in *ProfileParam, opts ...grpc.CallOption) (Cover_ProfileClient, error)
+	// POST /v1/cover/clear
+	Clear(ctx context.Context, in *ProfileParam, opts ...grpc.CallOption) (*Result, error)
+	// POST /v1/cover/init
+	Init(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Result, error)
+	// GET /v1/cover/list
+	List(ctx context.Context, in *ListParam, opts ...grpc.CallOption) (*ServicesList, error)
+	// POST /v1/cover/remove
+	Remove(ctx context.Context, in *ProfileParam, opts ...grpc.CallOption) (*Result, error)
+	// GET /v1/cover/agent
+	GetAgent(ctx context.Context, in *AgentID, opts ...grpc.CallOption) (*Agent, error)
+	// DELETE /v1/cover/agent
+	RemoveAgent(ctx context.Context, in *AgentID, opts ...grpc.CallOption) (*Result, error)
+	// GET /v1/cover/unreachable
+	ListUnreachable(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*UnreachableAgents, error)
+	// GET /v1/cover/ping
+	Ping(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Result, error)
+	// GET /v1/cover/info
+	Info(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ServerInfo, error)
+}
+
+type coverClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCoverClient(cc grpc.ClientConnInterface) CoverClient {
+	return &coverClient{cc}
+}
+
+func (c *coverClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*Result, error) {
+	out := new(Result)
+	err := c.cc.Invoke(ctx, "/goc.v1.Cover/Register", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coverClient) Profile(ctx context.Context, in *ProfileParam, opts ...grpc.CallOption) (Cover_ProfileClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Cover_ServiceDesc.Streams[0], "/goc.v1.Cover/Profile", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &coverProfileClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Cover_ProfileClient interface {
+	Recv() (*ProfileChunk, error)
+	grpc.ClientStream
+}
+
+type coverProfileClient struct {
+	grpc.ClientStream
+}
+
+func (x *coverProfileClient) Recv() (*ProfileChunk, error) {
+	m := new(ProfileChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *coverClient) Clear(ctx context.Context, in *ProfileParam, opts ...grpc.CallOption) (*Result, error) {
+	out := new(Result)
+	err := c.cc.Invoke(ctx, "/goc.v1.Cover/Clear", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coverClient) Init(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Result, error) {
+	out := new(Result)
+	err := c.cc.Invoke(ctx, "/goc.v1.Cover/Init", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coverClient) List(ctx context.Context, in *ListParam, opts ...grpc.CallOption) (*ServicesList, error) {
+	out := new(ServicesList)
+	err := c.cc.Invoke(ctx, "/goc.v1.Cover/List", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coverClient) Remove(ctx context.Context, in *ProfileParam, opts ...grpc.CallOption) (*Result, error) {
+	out := new(Result)
+	err := c.cc.Invoke(ctx, "/goc.v1.Cover/Remove", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coverClient) GetAgent(ctx context.Context, in *AgentID, opts ...grpc.CallOption) (*Agent, error) {
+	out := new(Agent)
+	err := c.cc.Invoke(ctx, "/goc.v1.Cover/GetAgent", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coverClient) RemoveAgent(ctx context.Context, in *AgentID, opts ...grpc.CallOption) (*Result, error) {
+	out := new(Result)
+	err := c.cc.Invoke(ctx, "/goc.v1.Cover/RemoveAgent", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coverClient) ListUnreachable(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*UnreachableAgents, error) {
+	out := new(UnreachableAgents)
+	err := c.cc.Invoke(ctx, "/goc.v1.Cover/ListUnreachable", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coverClient) Ping(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*Result, error) {
+	out := new(Result)
+	err := c.cc.Invoke(ctx, "/goc.v1.Cover/Ping", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *coverClient) Info(ctx context.Context, in *emptypb.Empty, opts ...grpc.CallOption) (*ServerInfo, error) {
+	out := new(ServerInfo)
+	err := c.cc.Invoke(ctx, "/goc.v1.Cover/Info", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CoverServer is the server API for Cover service.
+// All implementations must embed UnimplementedCoverServer
+// for forward compatibility
+type CoverServer interface {
+	// POST /v1/cover/register
+	Register(context.Context, *RegisterRequest) (*Result, error)
+	// POST /v1/cover/profile, the merged profile is streamed in chunks as it may exceed the message size limit.
+	// The agents skipped are listed by the goc-failed-agents and goc-unreachable-agents header metadata.
+	Profile(*ProfileParam, Cover_ProfileServer) error
+	// POST /v1/cover/clear
+	Clear(context.Context, *ProfileParam) (*Result, error)
+	// POST /v1/cover/init
+	Init(context.Context, *emptypb.Empty) (*Result, error)
+	// GET /v1/cover/list
+	List(context.Context, *ListParam) (*ServicesList, error)
+	// POST /v1/cover/remove
+	Remove(context.Context, *ProfileParam) (*Result, error)
+	// GET /v1/cover/agent
+	GetAgent(context.Context, *AgentID) (*Agent, error)
+	// DELETE /v1/cover/agent
+	RemoveAgent(context.Context, *AgentID) (*Result, error)
+	// GET /v1/cover/unreachable
+	ListUnreachable(context.Context, *emptypb.Empty) (*UnreachableAgents, error)
+	// GET /v1/cover/ping
+	Ping(context.Context, *emptypb.Empty) (*Result, error)
+	// GET /v1/cover/info
+	Info(context.Context, *emptypb.Empty) (*ServerInfo, error)
+	mustEmbedUnimplementedCoverServer()
+}
+
+// UnimplementedCoverServer must be embedded to have forward compatible implementations.
+type UnimplementedCoverServer struct {
+}
+
+func (UnimplementedCoverServer) Register(context.Context, *RegisterRequest) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Register not implemented")
+}
+func (UnimplementedCoverServer) Profile(*ProfileParam, Cover_ProfileServer) error {
+	return status.Errorf(codes.Unimplemented, "method Profile not implemented")
+}
+func (UnimplementedCoverServer) Clear(context.Context, *ProfileParam) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Clear not implemented")
+}
+func (UnimplementedCoverServer) Init(context.Context, *emptypb.Empty) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Init not implemented")
+}
+func (UnimplementedCoverServer) List(context.Context, *ListParam) (*ServicesList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedCoverServer) Remove(context.Context, *ProfileParam) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
+}
+func (UnimplementedCoverServer) GetAgent(context.Context, *AgentID) (*Agent, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAgent not implemented")
+}
+func (UnimplementedCoverServer) RemoveAgent(context.Context, *AgentID) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveAgent not implemented")
+}
+func (UnimplementedCoverServer) ListUnreachable(context.Context, *emptypb.Empty) (*UnreachableAgents, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListUnreachable not implemented")
+}
+func (UnimplementedCoverServer) Ping(context.Context, *emptypb.Empty) (*Result, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
+}
+func (UnimplementedCoverServer) Info(context.Context, *emptypb.Empty) (*ServerInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Info not implemented")
+}
+func (UnimplementedCoverServer) mustEmbedUnimplementedCoverServer() {}
+
+// UnsafeCoverServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CoverServer will
+// result in compilation errors.
+type UnsafeCoverServer interface {
+	mustEmbedUnimplementedCoverServer()
+}
+
+func RegisterCoverServer(s grpc.ServiceRegistrar, srv CoverServer) {
+	s.RegisterService(&Cover_ServiceDesc, srv)
+}
+
+func _Cover_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RegisterRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoverServer).Register(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goc.v1.Cover/Register",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoverServer).Register(ctx, req.(*RegisterRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cover_Profile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ProfileParam)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CoverServer).Profile(m, &coverProfileServer{stream})
+}
+
+type Cover_ProfileServer interface {
+	Send(*ProfileChunk) error
+	grpc.ServerStream
+}
+
+type coverProfileServer struct {
+	grpc.ServerStream
+}
+
+func (x *coverProfileServer) Send(m *ProfileChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _Cover_Clear_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProfileParam)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoverServer).Clear(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goc.v1.Cover/Clear",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoverServer).Clear(ctx, req.(*ProfileParam))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cover_Init_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoverServer).Init(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goc.v1.Cover/Init",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoverServer).Init(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cover_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListParam)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoverServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goc.v1.Cover/List",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoverServer).List(ctx, req.(*ListParam))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cover_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProfileParam)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoverServer).Remove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goc.v1.Cover/Remove",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoverServer).Remove(ctx, req.(*ProfileParam))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cover_GetAgent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AgentID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoverServer).GetAgent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goc.v1.Cover/GetAgent",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoverServer).GetAgent(ctx, req.(*AgentID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cover_RemoveAgent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AgentID)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoverServer).RemoveAgent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goc.v1.Cover/RemoveAgent",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoverServer).RemoveAgent(ctx, req.(*AgentID))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cover_ListUnreachable_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoverServer).ListUnreachable(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goc.v1.Cover/ListUnreachable",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoverServer).ListUnreachable(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cover_Ping_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoverServer).Ping(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goc.v1.Cover/Ping",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoverServer).Ping(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Cover_Info_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(emptypb.Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CoverServer).Info(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/goc.v1.Cover/Info",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CoverServer).Info(ctx, req.(*emptypb.Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Cover_ServiceDesc is the grpc.ServiceDesc for Cover service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Cover_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "goc.v1.Cover",
+	HandlerType: (*CoverServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Register",
+			Handler:    _Cover_Register_Handler,
+		},
+		{
+			MethodName: "Clear",
+			Handler:    _Cover_Clear_Handler,
+		},
+		{
+			MethodName: "Init",
+			Handler:    _Cover_Init_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _Cover_List_Handler,
+		},
+		{
+			MethodName: "Remove",
+			Handler:    _Cover_Remove_Handler,
+		},
+		{
+			MethodName: "GetAgent",
+			Handler:    _Cover_GetAgent_Handler,
+		},
+		{
+			MethodName: "RemoveAgent",
+			Handler:    _Cover_RemoveAgent_Handler,
+		},
+		{
+			MethodName: "ListUnreachable",
+			Handler:    _Cover_ListUnreachable_Handler,
+		},
+		{
+			MethodName: "Ping",
+			Handler:    _Cover_Ping_Handler,
+		},
+		{
+			MethodName: "Info",
+			Handler:    _Cover_Info_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Profile",
+			Handler:       _Cover_Profile_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "cover.proto",
+}
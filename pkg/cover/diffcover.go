@@ -0,0 +1,187 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/cover"
+)
+
+// DiffCoverage returns the percentage of the covered lines among the lines
+// added or modified since baseRef, the diff is got by running 'git diff' in the current directory.
+// The files in the diff are matched to the ones in the profile by their import paths.
+// Only the changed lines inside the blocks of the profile are counted,
+// it returns 100 if none of the changed lines is executable.
+func DiffCoverage(profile, baseRef string) (float64, error) {
+	profiles, err := cover.ParseProfiles(profile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse profile %s: %v", profile, err)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", "diff", "--relative", "--no-color", "--no-ext-diff", "--no-prefix", "-U0", baseRef, "--", "*.go")
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the git diff against %s: %v, %s", baseRef, err, stderr.String())
+	}
+	diff, err := parseDiff(bytes.NewReader(out))
+	if err != nil {
+		return 0, err
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return 0, err
+	}
+	importPath, err := dirImportPath(wd)
+	if err != nil {
+		return 0, err
+	}
+	// the files in the diff are relative to the working directory while the ones in the profile are import paths
+	changes := make(map[string][]lineRange, len(diff))
+	for file, ranges := range diff {
+		changes[path.Join(importPath, file)] = ranges
+	}
+
+	covered, total := diffCoverage(profiles, changes)
+	if total == 0 {
+		return 100, nil
+	}
+	return 100 * float64(covered) / float64(total), nil
+}
+
+// lineRange is a range of lines [Start, End]
+type lineRange struct {
+	Start, End int
+}
+
+var hunkRe = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// parseDiff returns the ranges of the added or modified lines of each file in the unified diff
+func parseDiff(r io.Reader) (map[string][]lineRange, error) {
+	changes := make(map[string][]lineRange)
+	var file string
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for s.Scan() {
+		line := s.Text()
+		if strings.HasPrefix(line, "+++ ") {
+			file = strings.TrimPrefix(line, "+++ ")
+			if file == "/dev/null" {
+				file = ""
+			}
+			continue
+		}
+		m := hunkRe.FindStringSubmatch(line)
+		if m == nil || file == "" {
+			continue
+		}
+		start, _ := strconv.Atoi(m[1])
+		count := 1
+		if m[2] != "" {
+			count, _ = strconv.Atoi(m[2])
+		}
+		// lines are only removed in this hunk
+		if count == 0 {
+			continue
+		}
+		changes[file] = append(changes[file], lineRange{Start: start, End: start + count - 1})
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to parse the diff: %v", err)
+	}
+	return changes, nil
+}
+
+// diffCoverage counts the changed lines inside the blocks of the profiles,
+// a line is covered if any block containing it is executed.
+// The changes are keyed by the import paths of the files as the profiles are.
+func diffCoverage(profiles []*cover.Profile, changes map[string][]lineRange) (covered, total int) {
+	for _, p := range profiles {
+		ranges := changes[p.FileName]
+		if len(ranges) == 0 {
+			continue
+		}
+		lines := make(map[int]bool)
+		for _, b := range p.Blocks {
+			for _, r := range ranges {
+				start, end := r.Start, r.End
+				if start < b.StartLine {
+					start = b.StartLine
+				}
+				if end > b.EndLine {
+					end = b.EndLine
+				}
+				for l := start; l <= end; l++ {
+					lines[l] = lines[l] || b.Count > 0
+				}
+			}
+		}
+		for _, c := range lines {
+			total++
+			if c {
+				covered++
+			}
+		}
+	}
+	return covered, total
+}
+
+// dirImportPath returns the import path of the directory, which is the module path of go.mod joined with
+// the path relative to the module root, or the path under GOPATH/src for a project out of modules
+func dirImportPath(dir string) (string, error) {
+	for root := dir; ; {
+		modFile := filepath.Join(root, "go.mod")
+		if data, err := ioutil.ReadFile(modFile); err == nil {
+			modPath := modfile.ModulePath(data)
+			if modPath == "" {
+				return "", fmt.Errorf("no module path in %s", modFile)
+			}
+			rel, err := filepath.Rel(root, dir)
+			if err != nil {
+				return "", err
+			}
+			return path.Join(modPath, filepath.ToSlash(rel)), nil
+		}
+		parent := filepath.Dir(root)
+		if parent == root {
+			break
+		}
+		root = parent
+	}
+	for _, p := range filepath.SplitList(build.Default.GOPATH) {
+		rel, err := filepath.Rel(filepath.Join(p, "src"), dir)
+		if err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel), nil
+		}
+	}
+	return "", fmt.Errorf("failed to get the import path of %s, it is neither in a module nor under GOPATH", dir)
+}
@@ -0,0 +1,161 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/cover"
+)
+
+func TestParseDiff(t *testing.T) {
+	diff := `diff --git pkg/a.go pkg/a.go
+index 1111111..2222222 100644
+--- pkg/a.go
++++ pkg/a.go
+@@ -3,0 +4,2 @@ func A() {
++	a++
++	b++
+@@ -10 +12 @@ func B() {
+-	c++
++	c--
+@@ -20,2 +21,0 @@ func C() {
+-	d++
+-	d++
+diff --git pkg/b.go pkg/b.go
+deleted file mode 100644
+--- pkg/b.go
++++ /dev/null
+@@ -1,3 +0,0 @@
+-package pkg
+`
+	changes, err := parseDiff(strings.NewReader(diff))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]lineRange{
+		"pkg/a.go": {{Start: 4, End: 5}, {Start: 12, End: 12}},
+	}, changes)
+}
+
+func TestDiffCoverage(t *testing.T) {
+	profiles := []*cover.Profile{
+		{
+			FileName: "example.com/foo/pkg/a.go",
+			Mode:     "set",
+			Blocks: []cover.ProfileBlock{
+				{StartLine: 3, StartCol: 12, EndLine: 6, EndCol: 2, NumStmt: 2, Count: 1},
+				{StartLine: 11, StartCol: 12, EndLine: 14, EndCol: 2, NumStmt: 1, Count: 0},
+			},
+		},
+		{
+			FileName: "example.com/foo/pkg/c.go",
+			Mode:     "set",
+			Blocks: []cover.ProfileBlock{
+				{StartLine: 3, StartCol: 12, EndLine: 6, EndCol: 2, NumStmt: 2, Count: 0},
+			},
+		},
+	}
+	changes := map[string][]lineRange{
+		// line 8 is outside of the blocks
+		"example.com/foo/pkg/a.go": {{Start: 4, End: 5}, {Start: 8, End: 8}, {Start: 12, End: 12}},
+	}
+	covered, total := diffCoverage(profiles, changes)
+	assert.Equal(t, 2, covered)
+	assert.Equal(t, 3, total)
+
+	// the files of the same name in different packages are told apart
+	profiles = []*cover.Profile{
+		{
+			FileName: "example.com/foo/cmd/a/main.go",
+			Mode:     "set",
+			Blocks:   []cover.ProfileBlock{{StartLine: 3, StartCol: 12, EndLine: 6, EndCol: 2, NumStmt: 2, Count: 1}},
+		},
+		{
+			FileName: "example.com/foo/cmd/b/main.go",
+			Mode:     "set",
+			Blocks:   []cover.ProfileBlock{{StartLine: 3, StartCol: 12, EndLine: 6, EndCol: 2, NumStmt: 2, Count: 0}},
+		},
+	}
+	changes = map[string][]lineRange{
+		"example.com/foo/cmd/b/main.go": {{Start: 4, End: 5}},
+	}
+	covered, total = diffCoverage(profiles, changes)
+	assert.Equal(t, 0, covered)
+	assert.Equal(t, 2, total)
+}
+
+func TestDirImportPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-import-path")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "cmd", "a"), 0755))
+
+	// out of modules and GOPATH
+	_, err = dirImportPath(dir)
+	assert.Error(t, err)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n"), 0644))
+	importPath, err := dirImportPath(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com/foo", importPath)
+	importPath, err = dirImportPath(filepath.Join(dir, "cmd", "a"))
+	assert.NoError(t, err)
+	assert.Equal(t, "example.com/foo/cmd/a", importPath)
+}
+
+func TestDiffCoverageWithGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "goc-diffcover")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=goc", "-c", "user.email=goc@example.com"}, args...)...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+	file := filepath.Join(dir, "a.go")
+	git("init", "-q")
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/foo\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(file, []byte("package foo\n\nfunc A() int {\n\treturn 1\n}\n"), 0644))
+	git("add", "-A")
+	git("commit", "-q", "-m", "init")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("package foo\n\nfunc A() int {\n\treturn 1\n}\n\nfunc B() int {\n\treturn 2\n}\n"), 0644))
+
+	profile := filepath.Join(dir, "coverage.cov")
+	assert.NoError(t, ioutil.WriteFile(profile, []byte("mode: set\nexample.com/foo/a.go:3.14,5.2 1 1\nexample.com/foo/a.go:7.14,9.2 1 0\n"), 0644))
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+
+	percentage, err := DiffCoverage(profile, "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), percentage)
+
+	_, err = DiffCoverage(profile, "no-such-ref")
+	assert.Error(t, err)
+}
@@ -0,0 +1,75 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// EmbeddedServer is a service center running in the current process, e.g. for the integration tests
+// which do not want to start goc server separately
+type EmbeddedServer struct {
+	// URL is the base URL of the service center, such as http://127.0.0.1:7777, to create the client with
+	URL string
+
+	server     *server
+	httpServer *http.Server
+	done       chan struct{}
+}
+
+// StartServer starts a memory based service center listening on addr, such as 127.0.0.1:0 for a random port,
+// the service center serves in background until it is shut down
+func StartServer(addr string) (*EmbeddedServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewMemoryBasedServer()
+	es := &EmbeddedServer{
+		URL:        "http://" + ln.Addr().String(),
+		server:     s,
+		httpServer: &http.Server{Handler: s.Route(nil)},
+		done:       make(chan struct{}),
+	}
+	go func() {
+		defer close(es.done)
+		es.httpServer.Serve(ln)
+	}()
+	return es, nil
+}
+
+// Store returns the store of the registered services
+func (es *EmbeddedServer) Store() Store {
+	return es.server.Store
+}
+
+// Shutdown stops the service center gracefully, it waits for the active requests until ctx is done
+func (es *EmbeddedServer) Shutdown(ctx context.Context) error {
+	err := es.httpServer.Shutdown(ctx)
+	<-es.done
+	return err
+}
+
+// Close stops the service center immediately
+func (es *EmbeddedServer) Close() error {
+	err := es.httpServer.Close()
+	<-es.done
+	return err
+}
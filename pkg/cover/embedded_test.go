@@ -0,0 +1,70 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbeddedServer(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("mode: count\nmockService/main.go:30.13,48.33 13 1\n"))
+	}))
+	defer agent.Close()
+
+	es, err := StartServer("127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	client := NewWorker(es.URL)
+	assert.NoError(t, client.Ping())
+
+	_, err = client.RegisterService(ServiceUnderTest{Name: "mockService", Address: agent.URL})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{agent.URL}, es.Store().Get("mockService"))
+
+	res, err := client.ListServices()
+	assert.NoError(t, err)
+	var services map[string][]string
+	assert.NoError(t, json.Unmarshal(res, &services))
+	assert.Equal(t, map[string][]string{"mockService": {agent.URL}}, services)
+
+	profile, err := client.Profile(ProfileParam{})
+	assert.NoError(t, err)
+	assert.Contains(t, string(profile), "mockService/main.go:30.13,48.33 13 1")
+
+	assert.NoError(t, es.Shutdown(context.Background()))
+	assert.Error(t, client.Ping(), "the service center should be down")
+}
+
+func TestStartServerWithInvalidAddress(t *testing.T) {
+	es, err := StartServer("127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer es.Close()
+
+	// the address is in use
+	_, err = StartServer(es.URL[len("http://"):])
+	assert.Error(t, err)
+}
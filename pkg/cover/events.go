@@ -0,0 +1,236 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// AgentJoined is the type of the event sent when an agent registers into the service center
+	AgentJoined = "join"
+	// AgentLeft is the type of the event sent when an agent is removed from the service center
+	AgentLeft = "leave"
+)
+
+// AgentEvent tells an agent joined or left the service center
+type AgentEvent struct {
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Address string `json:"address"`
+}
+
+// eventsKeepAlive is the interval of the comments sent on an idle event stream,
+// which keeps the proxies in between from closing the connection
+var eventsKeepAlive = 15 * time.Second
+
+// eventsBuffer is the number of events queued for a slow subscriber before dropping them
+const eventsBuffer = 64
+
+var (
+	// watchBackoff is the wait before reconnecting the event stream, it doubles for each failure
+	watchBackoff = time.Second
+	// maxWatchBackoff bounds the wait before reconnecting the event stream
+	maxWatchBackoff = 30 * time.Second
+)
+
+// eventHub fans out the agent events to the subscribers, the zero value is ready to use
+type eventHub struct {
+	mu   sync.Mutex
+	subs map[chan AgentEvent]struct{}
+}
+
+func (h *eventHub) subscribe() chan AgentEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs == nil {
+		h.subs = make(map[chan AgentEvent]struct{})
+	}
+	ch := make(chan AgentEvent, eventsBuffer)
+	h.subs[ch] = struct{}{}
+	return ch
+}
+
+func (h *eventHub) unsubscribe(ch chan AgentEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.subs, ch)
+}
+
+// publish never blocks, the events are dropped for the subscribers which can not keep up
+func (h *eventHub) publish(e AgentEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs {
+		select {
+		case ch <- e:
+		default:
+			log.Warnf("event subscriber is too slow, drop the %s event of %s", e.Type, e.Address)
+		}
+	}
+}
+
+// agentName returns the name the agent of the address registered with
+func (s *server) agentName(addr string) string {
+	for name, addrs := range s.Store.GetAll() {
+		if contains(addrs, addr) {
+			return name
+		}
+	}
+	return ""
+}
+
+// watchEvents streams the agent events as server-sent events until the client disconnects
+// events API example:
+// GET /v1/cover/events
+func (s *server) watchEvents(c *gin.Context) {
+	ch := s.events.subscribe()
+	defer s.events.unsubscribe(ch)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Status(http.StatusOK)
+	// send the headers right now, so that the client knows it is subscribed
+	fmt.Fprint(c.Writer, ": subscribed\n\n")
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-keepAlive.C:
+			fmt.Fprint(c.Writer, ": keep-alive\n\n")
+		case e := <-ch:
+			data, _ := json.Marshal(e)
+			fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", e.Type, data)
+		}
+		c.Writer.Flush()
+	}
+}
+
+// WatchEvents subscribes to the agent events of the service center. The returned channel is
+// closed once ctx is done, the stream is reconnected with backoff if it is broken meanwhile,
+// the events happening during the reconnection are lost.
+// An error is returned if the first subscription fails.
+func (c *client) WatchEvents(ctx context.Context) (<-chan AgentEvent, error) {
+	res, err := c.subscribeEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan AgentEvent)
+	go func() {
+		defer close(events)
+		backoff := watchBackoff
+		for {
+			if err := readEvents(ctx, res, events); err != nil {
+				log.Debugf("event stream of %s is broken, err: %v", c.Host, err)
+			}
+			for {
+				if ctx.Err() != nil {
+					return
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				if res, err = c.subscribeEvents(ctx); err == nil {
+					backoff = watchBackoff
+					break
+				}
+				log.Debugf("failed to subscribe to the events of %s, err: %v", c.Host, err)
+				if backoff *= 2; backoff > maxWatchBackoff {
+					backoff = maxWatchBackoff
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+func (c *client) subscribeEvents(ctx context.Context) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", joinURL(c.Host, CoverEventsAPI), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("User-Agent", UserAgent)
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		return nil, fmt.Errorf("fail to subscribe to the events of %s, response code: %d, body: %s", c.Host, res.StatusCode, string(body))
+	}
+	return res, nil
+}
+
+// readEvents sends the events of the stream to the channel until the stream ends,
+// only the data fields are read, the event type is part of the data
+func readEvents(ctx context.Context, res *http.Response, events chan<- AgentEvent) error {
+	defer res.Body.Close()
+
+	var data []string
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line != "" {
+			if strings.HasPrefix(line, "data:") {
+				data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			}
+			continue
+		}
+		// a blank line dispatches the event
+		if len(data) == 0 {
+			continue
+		}
+		var e AgentEvent
+		err := json.Unmarshal([]byte(strings.Join(data, "\n")), &e)
+		data = nil
+		if err != nil {
+			log.Warnf("skip the malformed event, err: %v", err)
+			continue
+		}
+		select {
+		case events <- e:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("event stream closed")
+}
@@ -0,0 +1,123 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// nextEvent waits for an event, failing the test if none comes in time
+func nextEvent(t *testing.T, events <-chan AgentEvent) AgentEvent {
+	select {
+	case e, ok := <-events:
+		assert.True(t, ok, "events channel closed")
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received in time")
+	}
+	return AgentEvent{}
+}
+
+func TestWatchEventsReconnect(t *testing.T) {
+	defer func(backoff time.Duration) { watchBackoff = backoff }(watchBackoff)
+	watchBackoff = 10 * time.Millisecond
+
+	var conns int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, CoverEventsAPI, r.URL.Path)
+		n := atomic.AddInt32(&conns, 1)
+		w.Header().Set("Content-Type", "text/event-stream")
+		switch n {
+		case 1:
+			// the first stream breaks right after sending an event
+			fmt.Fprint(w, ": subscribed\n\nevent: join\ndata: {\"type\":\"join\",\"name\":\"foo\",\"address\":\"http://127.0.0.1:1001\"}\n\n")
+		case 2:
+			// the center is restarting
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, "data: not json\n\n")
+			fmt.Fprint(w, "data: {\"type\":\"leave\",\"name\":\"foo\",\n")
+			fmt.Fprint(w, "data: \"address\":\"http://127.0.0.1:1001\"}\n\n")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := NewWorker(ts.URL).WatchEvents(ctx)
+	assert.NoError(t, err)
+
+	assert.Equal(t, AgentEvent{Type: AgentJoined, Name: "foo", Address: "http://127.0.0.1:1001"}, nextEvent(t, events))
+	assert.Equal(t, AgentEvent{Type: AgentLeft, Name: "foo", Address: "http://127.0.0.1:1001"}, nextEvent(t, events))
+	assert.Equal(t, int32(3), atomic.LoadInt32(&conns))
+
+	cancel()
+	select {
+	case _, ok := <-events:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("events channel not closed after the context is done")
+	}
+}
+
+func TestWatchEventsSubscribeFailed(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	_, err := NewWorker(ts.URL).WatchEvents(context.Background())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "response code: 404")
+}
+
+func TestServerPublishesEvents(t *testing.T) {
+	server := NewMemoryBasedServer()
+	server.Store.Add(ServiceUnderTest{Name: "bar", Address: "http://127.0.0.1:1002"})
+	ts := httptest.NewServer(server.Route(os.Stdout))
+	defer ts.Close()
+	c := NewWorker(ts.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := c.WatchEvents(ctx)
+	assert.NoError(t, err)
+
+	_, err = c.RegisterService(ServiceUnderTest{Name: "foo", Address: "http://127.0.0.1:1001"})
+	assert.NoError(t, err)
+	assert.Equal(t, AgentEvent{Type: AgentJoined, Name: "foo", Address: "http://127.0.0.1:1001"}, nextEvent(t, events))
+
+	// registering again is not a join
+	_, err = c.RegisterService(ServiceUnderTest{Name: "foo", Address: "http://127.0.0.1:1001"})
+	assert.NoError(t, err)
+	assert.NoError(t, c.RemoveAgent("http://127.0.0.1:1001"))
+	assert.Equal(t, AgentEvent{Type: AgentLeft, Name: "foo", Address: "http://127.0.0.1:1001"}, nextEvent(t, events))
+
+	_, err = c.InitSystem()
+	assert.NoError(t, err)
+	assert.Equal(t, AgentEvent{Type: AgentLeft, Name: "bar", Address: "http://127.0.0.1:1002"}, nextEvent(t, events))
+}
@@ -0,0 +1,158 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/tools/cover"
+)
+
+// DefaultProfileConcurrency is the number of agents the profile API gets the profiles from at the same time
+// if the server is not given one, it is small enough not to flood the network of the service center
+const DefaultProfileConcurrency = 16
+
+// DefaultAgentTimeout bounds each request of the profile API to an agent if the server is not given one,
+// so that an agent whose host is down does not hold the profile of the others
+const DefaultAgentTimeout = 10 * time.Second
+
+// FailedAgentsHeader lists the addresses of the agents, separated by commas, whose profiles are missing
+// from the merged profile as they failed to respond, it is only set when the profile is forced
+const FailedAgentsHeader = "Goc-Failed-Agents"
+
+// UnreachableAgentsHeader lists the addresses of the agents, separated by commas, whose profiles are missing
+// from the merged profile as they can not be connected or timed out, e.g. their hosts are down
+const UnreachableAgentsHeader = "Goc-Unreachable-Agents"
+
+// fetchedProfiles are the profiles got from the agents, the profiles are in the order of the addresses
+// they are got from, the agents failed are reported in failed with the errors
+type fetchedProfiles struct {
+	profiles [][]*cover.Profile
+	failed   map[string]error
+	// failedAddrs are the agents responded with an error or an invalid profile in the order of the addresses
+	failedAddrs []string
+	// unreachable are the agents can not be connected or timed out in the order of the addresses,
+	// the rest of the keys of failed
+	unreachable []string
+}
+
+// fetchProfiles gets the profiles of the agents with at most concurrency requests in flight, each request
+// to an agent times out after timeout, the failure of one agent does not stop getting the others. If acc
+// is not nil, each profile is merged into it as soon as it is got instead of being kept in profiles,
+// and failing to merge fails the agent.
+func fetchProfiles(addrs []string, concurrency int, timeout time.Duration, acc *ProfileAccumulator) fetchedProfiles {
+	if concurrency <= 0 {
+		concurrency = DefaultProfileConcurrency
+	}
+	if timeout <= 0 {
+		timeout = DefaultAgentTimeout
+	}
+	httpClient := &http.Client{Transport: defaultClient.Transport, Timeout: timeout}
+	type fetched struct {
+		profile []*cover.Profile
+		err     error
+	}
+	results := make([]fetched, len(addrs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i := range addrs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			// each request is bounded by the agent timeout, the retries would exceed it
+			worker := newWorker(addrs[i], httpClient, WorkerOptions{StatusRetries: -1, NoNetworkRetry: true})
+			if acc != nil {
+				results[i].err = fetchProfileInto(worker, acc)
+				return
+			}
+			results[i].profile, results[i].err = fetchProfile(worker)
+		}(i)
+	}
+	wg.Wait()
+
+	res := fetchedProfiles{failed: map[string]error{}}
+	for i, r := range results {
+		if r.err != nil {
+			res.failed[addrs[i]] = r.err
+			if isNetworkError(r.err) {
+				res.unreachable = append(res.unreachable, addrs[i])
+			} else {
+				res.failedAddrs = append(res.failedAddrs, addrs[i])
+			}
+			continue
+		}
+		if r.profile != nil {
+			res.profiles = append(res.profiles, r.profile)
+		}
+	}
+	return res
+}
+
+func fetchProfile(worker Action) ([]*cover.Profile, error) {
+	pp, err := worker.Profile(ProfileParam{})
+	if err != nil {
+		return nil, err
+	}
+	return convertProfile(pp)
+}
+
+func fetchProfileInto(worker Action, acc *ProfileAccumulator) error {
+	pp, err := worker.Profile(ProfileParam{})
+	if err != nil {
+		return err
+	}
+	return acc.Add(bytes.NewReader(pp))
+}
+
+// mergeKept adds the profiles kept by the center, i.e. pushed or flushed by the agents, to the fetched ones
+// in the order of the addresses, or merges them into acc if it is not nil
+func mergeKept(fetched *fetchedProfiles, acc *ProfileAccumulator, kept map[string][]*cover.Profile) error {
+	addrs := make([]string, 0, len(kept))
+	for addr := range kept {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	for _, addr := range addrs {
+		if acc == nil {
+			fetched.profiles = append(fetched.profiles, kept[addr])
+			continue
+		}
+		if err := acc.AddProfiles(kept[addr]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errorMessage describes all the agents failed but the unreachable ones in one message
+func (f fetchedProfiles) errorMessage() string {
+	msgs := make([]string, 0, len(f.failedAddrs))
+	for _, addr := range f.failedAddrs {
+		msgs = append(msgs, fmt.Sprintf("failed to get profile from %s, error %s", addr, f.failed[addr].Error()))
+	}
+	return strings.Join(msgs, "; ")
+}
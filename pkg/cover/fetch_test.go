@@ -0,0 +1,194 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFetchProfiles(t *testing.T) {
+	var inFlight, maxInFlight int32
+	handler := func(profile string, code int) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&inFlight, 1)
+			defer atomic.AddInt32(&inFlight, -1)
+			for {
+				max := atomic.LoadInt32(&maxInFlight)
+				if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			w.WriteHeader(code)
+			w.Write([]byte(profile))
+		}
+	}
+
+	var addrs []string
+	for i := 0; i < 6; i++ {
+		agent := httptest.NewServer(handler(fmt.Sprintf("mode: count\nmockService/main.go:1.1,1.10 1 %d\n", i+1), http.StatusOK))
+		defer agent.Close()
+		addrs = append(addrs, agent.URL)
+	}
+	broken := httptest.NewServer(handler("not a profile", http.StatusOK))
+	defer broken.Close()
+	failing := httptest.NewServer(handler("agent is down", http.StatusInternalServerError))
+	defer failing.Close()
+	unreachable := "http://127.0.0.1:11111"
+	addrs = append([]string{failing.URL, unreachable}, append(addrs, broken.URL)...)
+
+	res := fetchProfiles(addrs, 2, 0, nil)
+	assert.Len(t, res.profiles, 6)
+	for i, profile := range res.profiles {
+		// in the order of the addresses
+		assert.Equal(t, i+1, profile[0].Blocks[0].Count)
+	}
+	assert.Equal(t, []string{failing.URL, broken.URL}, res.failedAddrs)
+	assert.Equal(t, []string{unreachable}, res.unreachable)
+	assert.Len(t, res.failed, 3)
+	assert.Contains(t, res.failed[failing.URL].Error(), "agent is down")
+	assert.True(t, maxInFlight <= 2, "at most 2 requests in flight, got %d", maxInFlight)
+	assert.Contains(t, res.errorMessage(), "failed to get profile from "+failing.URL+", error agent is down; failed to get profile from "+broken.URL)
+	assert.NotContains(t, res.errorMessage(), unreachable)
+
+	// the profiles are merged as soon as they are got
+	acc := NewProfileAccumulator()
+	res = fetchProfiles(addrs, 3, 0, acc)
+	assert.Empty(t, res.profiles)
+	assert.Equal(t, []string{failing.URL, broken.URL}, res.failedAddrs)
+	assert.Equal(t, []string{unreachable}, res.unreachable)
+	assert.Equal(t, 1, acc.Len())
+	assert.Equal(t, 1+2+3+4+5+6, acc.Profiles()[0].Blocks[0].Count)
+
+	// not positive concurrency falls back to the default
+	res = fetchProfiles(addrs[:3], 0, 0, nil)
+	assert.Len(t, res.profiles, 1)
+	assert.Equal(t, []string{failing.URL}, res.failedAddrs)
+
+	// the agents not responding in time are unreachable as well
+	hung := make(chan struct{})
+	var slowCalls int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&slowCalls, 1)
+		<-hung
+	}))
+	defer slow.Close()
+	defer close(hung)
+	start := time.Now()
+	res = fetchProfiles([]string{slow.URL, addrs[2]}, 0, 100*time.Millisecond, nil)
+	assert.True(t, time.Since(start) < 5*time.Second, "the agent should time out, took %v", time.Since(start))
+	assert.Len(t, res.profiles, 1)
+	assert.Empty(t, res.failedAddrs)
+	assert.Equal(t, []string{slow.URL}, res.unreachable)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&slowCalls), "the agent timed out should not be retried")
+}
+
+func TestProfileServiceWithFailedAgents(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("mode: count\nmockService/main.go:30.13,48.33 13 1\n"))
+	}))
+	defer agent.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("agent is down"))
+	}))
+	defer failing.Close()
+
+	server := NewMemoryBasedServer()
+	server.ProfileConcurrency = 1
+	server.Store.Add(ServiceUnderTest{Name: "mockService", Address: agent.URL})
+	server.Store.Add(ServiceUnderTest{Name: "mockService", Address: failing.URL})
+	router := server.Route(os.Stdout)
+
+	// the profile is merged from the agents responded, and the failed ones are reported in the header
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/cover/profile", strings.NewReader(`{"force":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "mockService/main.go:30.13,48.33 13 1")
+	assert.Equal(t, failing.URL, w.Header().Get(FailedAgentsHeader))
+
+	// the same profile is merged incrementally
+	server.MergeIncrementally = true
+	w2 := httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/v1/cover/profile", strings.NewReader(`{"force":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w2, req)
+	assert.Equal(t, http.StatusOK, w2.Code)
+	assert.Equal(t, w.Body.String(), w2.Body.String())
+	assert.Equal(t, failing.URL, w2.Header().Get(FailedAgentsHeader))
+
+	// the failed agents fail the profile unless it is forced
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/v1/cover/profile", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusExpectationFailed, w.Code)
+	assert.Contains(t, w.Body.String(), "failed to get profile from "+failing.URL)
+	assert.Empty(t, w.Header().Get(FailedAgentsHeader))
+}
+
+func TestProfileServiceWithMixedModes(t *testing.T) {
+	agent := func(profile string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(profile))
+		}))
+	}
+	count := agent("mode: count\nmockService/main.go:30.13,48.33 13 2\n")
+	defer count.Close()
+	atomic := agent("mode: atomic\nmockService/main.go:30.13,48.33 13 3\n")
+	defer atomic.Close()
+	set := agent("mode: set\nmockService/main.go:30.13,48.33 13 1\n")
+	defer set.Close()
+
+	for _, incremental := range []bool{false, true} {
+		server := NewMemoryBasedServer()
+		server.MergeIncrementally = incremental
+		router := server.Route(os.Stdout)
+		profile := func(addrs ...string) *httptest.ResponseRecorder {
+			body := fmt.Sprintf(`{"address":["%s"]}`, strings.Join(addrs, `","`))
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/v1/cover/profile", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+			return w
+		}
+		server.Store.Add(ServiceUnderTest{Name: "mockService", Address: count.URL})
+		server.Store.Add(ServiceUnderTest{Name: "mockService", Address: atomic.URL})
+		server.Store.Add(ServiceUnderTest{Name: "mockService", Address: set.URL})
+
+		// count and atomic are summed up
+		w := profile(count.URL, atomic.URL)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "mockService/main.go:30.13,48.33 13 5")
+
+		// set can not be merged with count
+		w = profile(count.URL, set.URL)
+		assert.NotEqual(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), "incompatible cover mode")
+	}
+}
@@ -0,0 +1,58 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"fmt"
+
+	"golang.org/x/tools/cover"
+)
+
+// Fleet is a set of agents whose coverage is merged into one, e.g. the services running in staging,
+// which are the agents selected by Param in each of the service centers
+type Fleet struct {
+	Centers []string
+	Param   ProfileParam
+}
+
+// FleetDiff is the block-level difference between the coverage of two fleets, e.g. staging and prod
+type FleetDiff struct {
+	Base   []*cover.Profile // the merged profile of the base fleet
+	Target []*cover.Profile // the merged profile of the target fleet
+	// OnlyTarget are the blocks covered in the target fleet but not in the base one, ordered by position,
+	// e.g. the code paths exercised in prod but not in staging
+	OnlyTarget []CoveredBlock
+	// OnlyBase are the blocks covered in the base fleet but not in the target one, ordered by position
+	OnlyBase []CoveredBlock
+}
+
+// CompareFleets gets the merged profiles of the two fleets, and compares them block by block.
+// The fleets are expected to run the same source, a block missing in the profile of a fleet,
+// e.g. built from another revision, is taken as not covered by it.
+func CompareFleets(base, target Fleet) (FleetDiff, error) {
+	var diff FleetDiff
+	var err error
+	if diff.Base, err = NewMultiWorker(base.Centers).Profile(base.Param); err != nil {
+		return diff, fmt.Errorf("failed to get the coverage of the base fleet, err: %v", err)
+	}
+	if diff.Target, err = NewMultiWorker(target.Centers).Profile(target.Param); err != nil {
+		return diff, fmt.Errorf("failed to get the coverage of the target fleet, err: %v", err)
+	}
+	diff.OnlyTarget = NewlyCovered(diff.Base, diff.Target)
+	diff.OnlyBase = NewlyCovered(diff.Target, diff.Base)
+	return diff, nil
+}
@@ -0,0 +1,95 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompareFleets(t *testing.T) {
+	var servers []*httptest.Server
+	defer func() {
+		for _, ts := range servers {
+			ts.Close()
+		}
+	}()
+	// center returns a service center with an agent of each of the services serving the profiles
+	center := func(profiles map[string]string) string {
+		server := NewMemoryBasedServer()
+		for name, profile := range profiles {
+			profile := profile
+			agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(profile))
+			}))
+			servers = append(servers, agent)
+			server.Store.Add(ServiceUnderTest{Name: name, Address: agent.URL})
+		}
+		ts := httptest.NewServer(server.Route(os.Stdout))
+		servers = append(servers, ts)
+		return ts.URL
+	}
+	staging := center(map[string]string{
+		"api": "mode: count\napi/main.go:1.1,2.10 1 1\napi/main.go:3.1,4.10 1 1\napi/main.go:5.1,6.10 1 0\napi/main.go:7.1,8.10 1 0\n",
+	})
+	// prod is spread over two regions, and runs another service not in staging
+	east := center(map[string]string{
+		"api":     "mode: count\napi/main.go:1.1,2.10 1 2\napi/main.go:3.1,4.10 1 0\napi/main.go:5.1,6.10 1 0\napi/main.go:7.1,8.10 1 0\n",
+		"billing": "mode: count\nbilling/main.go:1.1,2.10 1 3\n",
+	})
+	west := center(map[string]string{
+		"api": "mode: count\napi/main.go:1.1,2.10 1 0\napi/main.go:3.1,4.10 1 0\napi/main.go:5.1,6.10 1 5\napi/main.go:7.1,8.10 1 0\n",
+	})
+
+	api := ProfileParam{Service: []string{"api"}}
+	diff, err := CompareFleets(Fleet{Centers: []string{staging}, Param: api}, Fleet{Centers: []string{east, west}, Param: api})
+	assert.NoError(t, err)
+	if assert.Len(t, diff.OnlyTarget, 1) {
+		assert.Equal(t, "api/main.go:5.1,6.10", diff.OnlyTarget[0].String(), "exercised in prod but not in staging")
+	}
+	if assert.Len(t, diff.OnlyBase, 1) {
+		assert.Equal(t, "api/main.go:3.1,4.10", diff.OnlyBase[0].String(), "exercised in staging but not in prod")
+	}
+	// the profiles of the regions are merged
+	if assert.Len(t, diff.Target, 1) {
+		counts := []int{}
+		for _, b := range diff.Target[0].Blocks {
+			counts = append(counts, b.Count)
+		}
+		assert.Equal(t, []int{2, 0, 5, 0}, counts)
+	}
+
+	// the services not selected are compared as well without the param
+	diff, err = CompareFleets(Fleet{Centers: []string{staging}}, Fleet{Centers: []string{east, west}})
+	assert.NoError(t, err)
+	if assert.Len(t, diff.OnlyTarget, 2) {
+		assert.Equal(t, "api/main.go:5.1,6.10", diff.OnlyTarget[0].String())
+		assert.Equal(t, "billing/main.go:1.1,2.10", diff.OnlyTarget[1].String())
+	}
+
+	// the coverage missing a center fails the comparison
+	_, err = CompareFleets(Fleet{Centers: []string{staging}}, Fleet{Centers: []string{east, deadAddress(t)}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "target fleet")
+	_, err = CompareFleets(Fleet{}, Fleet{Centers: []string{east}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "base fleet")
+}
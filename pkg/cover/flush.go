@@ -0,0 +1,149 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/tools/cover"
+)
+
+// flushedProfile is the final profile an agent pushes before it exits
+type flushedProfile struct {
+	name   string
+	labels map[string]string
+	acc    *ProfileAccumulator
+}
+
+// flushedProfiles keeps the final profiles of the agents which have exited, so that their coverage is still
+// reported by the profile API. The profiles are kept in memory only, they are lost if the center restarts.
+type flushedProfiles struct {
+	mu       sync.Mutex
+	profiles map[string]*flushedProfile
+}
+
+// add merges the final profile of the agent, the profiles of the instances which took the same address
+// one after another are merged together
+func (f *flushedProfiles) add(addr, name string, labels map[string]string, profile []*cover.Profile) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.profiles == nil {
+		f.profiles = map[string]*flushedProfile{}
+	}
+	p, ok := f.profiles[addr]
+	if !ok {
+		p = &flushedProfile{acc: NewProfileAccumulator()}
+	}
+	if err := p.acc.AddProfiles(profile); err != nil {
+		return err
+	}
+	p.name, p.labels = name, labels
+	f.profiles[addr] = p
+	return nil
+}
+
+// match returns the final profiles of the agents selected by the services, the addresses and the labels
+// like filterAgents, all of them if none is given
+func (f *flushedProfiles) match(param ProfileParam) map[string][]*cover.Profile {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	selector, _ := ParseLabels(param.Label)
+	res := map[string][]*cover.Profile{}
+	for addr, p := range f.profiles {
+		if len(param.Service) != 0 && !contains(param.Service, p.name) {
+			continue
+		}
+		if len(param.Address) != 0 && !contains(param.Address, addr) {
+			continue
+		}
+		if !matchLabels(p.labels, selector) {
+			continue
+		}
+		res[addr] = p.acc.Profiles()
+	}
+	return res
+}
+
+// remove drops the final profiles of the agents selected like match
+func (f *flushedProfiles) remove(param ProfileParam) {
+	matched := f.match(param)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for addr := range matched {
+		delete(f.profiles, addr)
+	}
+}
+
+// reset drops all the final profiles
+func (f *flushedProfiles) reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.profiles = nil
+}
+
+// flushProfile receives the final profile an agent pushes when it is terminated, the agent must still be
+// registered, and its profile is reported by the profile API after it deregisters
+func (s *server) flushProfile(c *gin.Context) {
+	addr := c.Query("address")
+	if addr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing agent address"})
+		return
+	}
+	addr, name := s.resolveAgent(c, addr)
+	if name == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("agent %s not found", addr)})
+		return
+	}
+	profile, err := parseProfile(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid profile: %v", err)})
+		return
+	}
+	if err := s.flushed.add(addr, name, s.Store.Labels(addr), profile); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": fmt.Sprintf("profile of agent %s flushed", addr)})
+}
+
+// resolveAgent returns the address the agent sending the request is registered with, and the name of it,
+// the name is empty if the agent is not registered
+func (s *server) resolveAgent(c *gin.Context, addr string) (string, string) {
+	if name := s.agentName(addr); name != "" {
+		return addr, name
+	}
+	// the agent may be registered with the IP the requests come from instead, see registerService
+	u, err := url.Parse(addr)
+	if err != nil {
+		return addr, ""
+	}
+	_, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return addr, ""
+	}
+	real := fmt.Sprintf("http://%s:%s", c.ClientIP(), port)
+	if name := s.agentName(real); name != "" {
+		return real, name
+	}
+	return addr, ""
+}
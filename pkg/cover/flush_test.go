@@ -0,0 +1,90 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlushProfile(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("mode: count\nmockService/main.go:30.13,48.33 13 1\n"))
+	}))
+	defer agent.Close()
+
+	server := NewMemoryBasedServer()
+	server.Store.Add(ServiceUnderTest{Name: "mockService", Address: agent.URL})
+	server.Store.Add(ServiceUnderTest{Name: "exited", Address: "http://127.0.0.1:1001", Labels: map[string]string{"env": "staging"}})
+	router := server.Route(os.Stdout)
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	flushURL := "/v1/cover/flush?address=http%3A%2F%2F127.0.0.1%3A1001"
+	final := "mode: count\nmockService/main.go:30.13,48.33 13 2\n"
+
+	w := do("POST", "/v1/cover/flush", final)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = do("POST", "/v1/cover/flush?address=http%3A%2F%2F127.0.0.1%3A1002", final)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = do("POST", flushURL, "not a profile")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = do("POST", flushURL, final)
+	assert.Equal(t, http.StatusOK, w.Code)
+	// the instance taking the same address later is merged into the same profile
+	w = do("POST", flushURL, final)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = do("POST", flushURL, "mode: set\nmockService/main.go:30.13,48.33 13 1\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// the flushed profile is reported after the agent deregisters
+	assert.NoError(t, server.Store.Remove("http://127.0.0.1:1001"))
+	w = do("POST", "/v1/cover/profile", `{}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "mockService/main.go:30.13,48.33 13 5")
+
+	// and selected by the service, the address and the labels it registered with
+	w = do("POST", "/v1/cover/profile", `{"service":["mockService"]}`)
+	assert.Contains(t, w.Body.String(), "mockService/main.go:30.13,48.33 13 1")
+	w = do("POST", "/v1/cover/profile", `{"label":["env:prod"]}`)
+	assert.Equal(t, http.StatusExpectationFailed, w.Code)
+	server.MergeIncrementally = true
+	w = do("POST", "/v1/cover/profile", `{"label":["env:staging"], "force":true}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "mockService/main.go:30.13,48.33 13 4")
+
+	// clearing the coverage drops the flushed profiles
+	w = do("POST", "/v1/cover/clear", `{}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, server.flushed.match(ProfileParam{}))
+
+	// so does initializing the center
+	server.Store.Add(ServiceUnderTest{Name: "exited", Address: "http://127.0.0.1:1001"})
+	assert.Equal(t, http.StatusOK, do("POST", flushURL, final).Code)
+	assert.Len(t, server.flushed.match(ProfileParam{}), 1)
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/cover/init", "").Code)
+	assert.Empty(t, server.flushed.match(ProfileParam{}))
+}
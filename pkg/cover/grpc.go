@@ -0,0 +1,561 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/qiniu/goc/pkg/cover/coverpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"k8s.io/test-infra/gopherage/pkg/cov"
+)
+
+// GRPCScheme is the scheme of the center serving the API over gRPC, e.g. grpc://127.0.0.1:7778,
+// see coverpb/cover.proto for the service
+const GRPCScheme = "grpc"
+
+// grpcChunkSize is the max size of the chunks the profile is streamed in, so that the messages are kept
+// well below the default 4 MiB limit of gRPC however large the profile is
+const grpcChunkSize = 1 << 20
+
+// grpcServer serves the Cover service of cover.proto on the store of the server,
+// each RPC behaves the same as its API of the HTTP transport
+type grpcServer struct {
+	coverpb.UnimplementedCoverServer
+	s *server
+}
+
+// newGRPCServer creates the gRPC server of the API of the center
+func newGRPCServer(s *server) *grpc.Server {
+	srv := grpc.NewServer()
+	coverpb.RegisterCoverServer(srv, &grpcServer{s: s})
+	return srv
+}
+
+func (g *grpcServer) Register(ctx context.Context, req *coverpb.RegisterRequest) (*coverpb.Result, error) {
+	if req.Name == "" || req.Address == "" {
+		return nil, status.Error(codes.InvalidArgument, "the name and the address of the service are required")
+	}
+	labels, err := ParseLabels(req.Label)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	service := ServiceUnderTest{Name: req.Name, Address: req.Address, Labels: labels}
+	if err := g.s.register(service, peerIP(ctx), req.Advertised); err != nil {
+		return nil, grpcError(err)
+	}
+	return &coverpb.Result{Result: "success"}, nil
+}
+
+func (g *grpcServer) Profile(req *coverpb.ProfileParam, stream coverpb.Cover_ProfileServer) error {
+	merged, err := g.s.mergeProfile(profileParamFromProto(req))
+	header := metadata.MD{}
+	if len(merged.unreachable) != 0 {
+		header.Set(UnreachableAgentsHeader, strings.Join(merged.unreachable, ","))
+	}
+	if len(merged.failed) != 0 {
+		header.Set(FailedAgentsHeader, strings.Join(merged.failed, ","))
+	}
+	if len(header) != 0 {
+		if err := stream.SetHeader(header); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return grpcError(err)
+	}
+
+	w := bufio.NewWriterSize(profileChunkWriter{stream: stream}, grpcChunkSize)
+	if err := cov.DumpProfile(merged.profiles, w); err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return w.Flush()
+}
+
+// profileChunkWriter sends the profile written into it as the chunks of at most grpcChunkSize
+type profileChunkWriter struct {
+	stream coverpb.Cover_ProfileServer
+}
+
+func (w profileChunkWriter) Write(p []byte) (int, error) {
+	for sent := 0; sent < len(p); sent += grpcChunkSize {
+		end := sent + grpcChunkSize
+		if end > len(p) {
+			end = len(p)
+		}
+		if err := w.stream.Send(&coverpb.ProfileChunk{Data: p[sent:end]}); err != nil {
+			return sent, err
+		}
+	}
+	return len(p), nil
+}
+
+func (g *grpcServer) Clear(ctx context.Context, req *coverpb.ProfileParam) (*coverpb.Result, error) {
+	res, err := g.s.clearAgents(profileParamFromProto(req))
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &coverpb.Result{Result: res}, nil
+}
+
+func (g *grpcServer) Init(ctx context.Context, _ *emptypb.Empty) (*coverpb.Result, error) {
+	if err := g.s.reset(); err != nil {
+		return nil, grpcError(err)
+	}
+	return &coverpb.Result{}, nil
+}
+
+func (g *grpcServer) List(ctx context.Context, req *coverpb.ListParam) (*coverpb.ServicesList, error) {
+	list := g.s.listPage(g.s.Store.GetAll(), ListParam{Offset: int(req.Offset), Limit: int(req.Limit)})
+	return servicesListToProto(list), nil
+}
+
+func (g *grpcServer) Remove(ctx context.Context, req *coverpb.ProfileParam) (*coverpb.Result, error) {
+	res, err := g.s.removeAgents(profileParamFromProto(req))
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &coverpb.Result{Result: res}, nil
+}
+
+func (g *grpcServer) GetAgent(ctx context.Context, req *coverpb.AgentID) (*coverpb.Agent, error) {
+	agent, err := g.s.agent(req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &coverpb.Agent{Name: agent.Name, Address: agent.Address, Labels: agent.Labels}, nil
+}
+
+func (g *grpcServer) RemoveAgent(ctx context.Context, req *coverpb.AgentID) (*coverpb.Result, error) {
+	if err := g.s.unregister(req.Id); err != nil {
+		return nil, grpcError(err)
+	}
+	return &coverpb.Result{Result: fmt.Sprintf("agent %s removed", req.Id)}, nil
+}
+
+func (g *grpcServer) ListUnreachable(ctx context.Context, _ *emptypb.Empty) (*coverpb.UnreachableAgents, error) {
+	res := &coverpb.UnreachableAgents{}
+	for _, agent := range g.s.unreachableList() {
+		res.Agents = append(res.Agents, &coverpb.UnreachableAgent{
+			Name:    agent.Name,
+			Address: agent.Address,
+			Since:   timestamppb.New(agent.Since),
+			Error:   agent.Error,
+		})
+	}
+	return res, nil
+}
+
+func (g *grpcServer) Ping(ctx context.Context, _ *emptypb.Empty) (*coverpb.Result, error) {
+	return &coverpb.Result{Result: "pong"}, nil
+}
+
+func (g *grpcServer) Info(ctx context.Context, _ *emptypb.Empty) (*coverpb.ServerInfo, error) {
+	info := g.s.serverInfo()
+	return &coverpb.ServerInfo{
+		Version: info.Version,
+		Commit:  info.Commit,
+		Uptime:  durationpb.New(info.Uptime),
+		Agents:  int64(info.Agents),
+	}, nil
+}
+
+// peerIP returns the IP the request comes from, which the agents registering are resolved by
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// grpcError returns the status of the error of the API, whose code is mapped from the HTTP status code
+func grpcError(err error) error {
+	return status.Error(grpcCode(statusCode(err)), err.Error())
+}
+
+// grpcCode maps the HTTP status code of the API failed to the code of the gRPC status
+func grpcCode(code int) codes.Code {
+	switch code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusExpectationFailed:
+		return codes.FailedPrecondition
+	}
+	return codes.Internal
+}
+
+// httpStatus maps the code of the gRPC status back to the HTTP status code of the API failed
+func httpStatus(code codes.Code) int {
+	switch code {
+	case codes.InvalidArgument:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.FailedPrecondition:
+		return http.StatusExpectationFailed
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
+
+func profileParamFromProto(m *coverpb.ProfileParam) ProfileParam {
+	return ProfileParam{
+		Force:             m.Force,
+		Service:           m.Service,
+		Address:           m.Address,
+		CoverFilePatterns: m.Coverfile,
+		SkipFilePatterns:  m.Skipfile,
+		Label:             m.Label,
+	}
+}
+
+func profileParamToProto(p ProfileParam) *coverpb.ProfileParam {
+	return &coverpb.ProfileParam{
+		Force:     p.Force,
+		Service:   p.Service,
+		Address:   p.Address,
+		Coverfile: p.CoverFilePatterns,
+		Skipfile:  p.SkipFilePatterns,
+		Label:     p.Label,
+	}
+}
+
+func servicesListToProto(list ServicesList) *coverpb.ServicesList {
+	m := &coverpb.ServicesList{
+		Items: make(map[string]*coverpb.Addresses, len(list.Items)),
+		Total: int64(list.Total),
+		Next:  int64(list.Next),
+	}
+	for name, addrs := range list.Items {
+		m.Items[name] = &coverpb.Addresses{Address: addrs}
+	}
+	for addr, labels := range list.Labels {
+		if m.Labels == nil {
+			m.Labels = make(map[string]*coverpb.Labels)
+		}
+		m.Labels[addr] = &coverpb.Labels{Labels: labels}
+	}
+	return m
+}
+
+func servicesListFromProto(m *coverpb.ServicesList) ServicesList {
+	list := ServicesList{
+		Items: make(map[string][]string, len(m.Items)),
+		Total: int(m.Total),
+		Next:  int(m.Next),
+	}
+	for name, addrs := range m.Items {
+		list.Items[name] = addrs.GetAddress()
+	}
+	for addr, labels := range m.Labels {
+		if list.Labels == nil {
+			list.Labels = make(map[string]map[string]string)
+		}
+		list.Labels[addr] = labels.GetLabels()
+	}
+	return list
+}
+
+// grpcTransport sends the requests of the client to the center over gRPC, each request calls the RPC of its API
+// and the result is converted to the response of the HTTP transport, so that the client works the same over
+// both transports. The requests of the APIs not served over gRPC fail.
+type grpcTransport struct {
+	target string
+}
+
+func (t *grpcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	conn, err := grpcConn(t.target)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/2.0",
+		ProtoMajor:    2,
+		Header:        http.Header{},
+		ContentLength: -1,
+		Request:       req,
+	}
+	api := req.Method + " " + req.URL.Path
+	if api == "POST "+CoverProfileAPI {
+		resp.Body, err = callProfile(req.Context(), coverpb.NewCoverClient(conn), body, resp.Header)
+	} else {
+		var res []byte
+		res, err = callGRPC(req.Context(), coverpb.NewCoverClient(conn), api, req.URL.Query(), body)
+		resp.Body = ioutil.NopCloser(bytes.NewReader(res))
+	}
+	if err == nil {
+		return resp, nil
+	}
+
+	st, ok := status.FromError(err)
+	if !ok {
+		return nil, err
+	}
+	if st.Code() == codes.Unavailable || st.Code() == codes.DeadlineExceeded {
+		// the center is not reached or did not respond
+		return nil, grpcTransportError{err: err}
+	}
+	// the API failed is responded as over HTTP
+	resp.StatusCode = httpStatus(st.Code())
+	resp.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	res, _ := json.Marshal(gin.H{"error": st.Message()})
+	resp.Body = ioutil.NopCloser(bytes.NewReader(res))
+	return resp, nil
+}
+
+// callGRPC calls the RPC of the API with the query and the body of the request, and returns the body
+// the API responds with over HTTP
+func callGRPC(ctx context.Context, c coverpb.CoverClient, api string, query url.Values, body []byte) ([]byte, error) {
+	var param ProfileParam
+	if len(body) != 0 {
+		if err := json.Unmarshal(body, &param); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	switch api {
+	case "POST " + CoverRegisterServiceAPI:
+		res, err := c.Register(ctx, &coverpb.RegisterRequest{
+			Name:       query.Get("name"),
+			Address:    query.Get("address"),
+			Label:      query["label"],
+			Advertised: query.Get("advertised") == "true",
+		})
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(gin.H{"result": res.Result})
+	case "POST " + CoverProfileClearAPI:
+		res, err := c.Clear(ctx, profileParamToProto(param))
+		if err != nil {
+			return nil, err
+		}
+		return []byte(res.Result), nil
+	case "POST " + CoverInitSystemAPI:
+		res, err := c.Init(ctx, &emptypb.Empty{})
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(res.Result)
+	case "GET " + CoverServicesListAPI:
+		var page coverpb.ListParam
+		for key, field := range map[string]*int64{"offset": &page.Offset, "limit": &page.Limit} {
+			if value := query.Get(key); value != "" {
+				n, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					return nil, status.Errorf(codes.InvalidArgument, "invalid %s %q: %v", key, value, err)
+				}
+				*field = n
+			}
+		}
+		res, err := c.List(ctx, &page)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(servicesListFromProto(res))
+	case "POST " + CoverServicesRemoveAPI:
+		res, err := c.Remove(ctx, profileParamToProto(param))
+		if err != nil {
+			return nil, err
+		}
+		return []byte(res.Result), nil
+	case "GET " + CoverAgentAPI:
+		res, err := c.GetAgent(ctx, &coverpb.AgentID{Id: query.Get("id")})
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(ServiceUnderTest{Name: res.Name, Address: res.Address, Labels: res.Labels})
+	case "DELETE " + CoverAgentAPI:
+		res, err := c.RemoveAgent(ctx, &coverpb.AgentID{Id: query.Get("id")})
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(gin.H{"result": res.Result})
+	case "GET " + CoverUnreachableAPI:
+		res, err := c.ListUnreachable(ctx, &emptypb.Empty{})
+		if err != nil {
+			return nil, err
+		}
+		agents := make([]UnreachableAgent, 0, len(res.Agents))
+		for _, agent := range res.Agents {
+			agents = append(agents, UnreachableAgent{
+				Name:    agent.Name,
+				Address: agent.Address,
+				Since:   agent.Since.AsTime(),
+				Error:   agent.Error,
+			})
+		}
+		return json.Marshal(agents)
+	case "GET " + CoverPingAPI:
+		res, err := c.Ping(ctx, &emptypb.Empty{})
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(gin.H{"result": res.Result})
+	case "GET " + CoverServerInfoAPI:
+		res, err := c.Info(ctx, &emptypb.Empty{})
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(ServerInfo{
+			Version: res.Version,
+			Commit:  res.Commit,
+			Uptime:  res.Uptime.AsDuration(),
+			Agents:  int(res.Agents),
+		})
+	}
+	return nil, fmt.Errorf("%s is not served over gRPC", api)
+}
+
+// callProfile calls the Profile RPC with the body of the request, and returns the reader of the profile streamed,
+// the header metadata of the agents skipped are set into header. The first chunk is received before returning,
+// so that the API failed returns its status instead of the reader.
+func callProfile(ctx context.Context, c coverpb.CoverClient, body []byte, header http.Header) (io.ReadCloser, error) {
+	var param ProfileParam
+	if len(body) != 0 {
+		if err := json.Unmarshal(body, &param); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := c.Profile(ctx, profileParamToProto(param))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	chunk, err := stream.Recv()
+	if md, mdErr := stream.Header(); mdErr == nil {
+		for key, values := range md {
+			if strings.HasPrefix(key, "goc-") {
+				for _, value := range values {
+					header.Add(key, value)
+				}
+			}
+		}
+	}
+	reader := &profileReader{stream: stream, cancel: cancel}
+	switch err {
+	case nil:
+		reader.chunk = chunk.Data
+	case io.EOF:
+		reader.err = io.EOF
+	default:
+		cancel()
+		return nil, err
+	}
+	return reader, nil
+}
+
+// profileReader reads the profile streamed in chunks, closing it cancels the stream
+type profileReader struct {
+	stream coverpb.Cover_ProfileClient
+	cancel context.CancelFunc
+	chunk  []byte
+	err    error
+}
+
+func (r *profileReader) Read(p []byte) (int, error) {
+	for len(r.chunk) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		var chunk *coverpb.ProfileChunk
+		if chunk, r.err = r.stream.Recv(); r.err == nil {
+			r.chunk = chunk.Data
+		}
+	}
+	n := copy(p, r.chunk)
+	r.chunk = r.chunk[n:]
+	return n, nil
+}
+
+func (r *profileReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+// grpcTransportError is the error of the gRPC transport, e.g. the center can not be connected,
+// it is a net.Error so that it is retried and reported as the network errors of the HTTP transport
+type grpcTransportError struct {
+	err error
+}
+
+func (e grpcTransportError) Error() string   { return e.err.Error() }
+func (e grpcTransportError) Timeout() bool   { return status.Code(e.err) == codes.DeadlineExceeded }
+func (e grpcTransportError) Temporary() bool { return status.Code(e.err) == codes.Unavailable }
+
+// grpcConns are the connections to the centers shared by the clients, keyed by the targets
+var grpcConns = struct {
+	sync.Mutex
+	conns map[string]*grpc.ClientConn
+}{conns: map[string]*grpc.ClientConn{}}
+
+// grpcConn returns the connection to the target, which is connected in the background
+func grpcConn(target string) (*grpc.ClientConn, error) {
+	grpcConns.Lock()
+	defer grpcConns.Unlock()
+	if conn, ok := grpcConns.conns[target]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.Dial(target, grpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s over gRPC, err: %v", target, err)
+	}
+	grpcConns.conns[target] = conn
+	return conn, nil
+}
@@ -0,0 +1,166 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/qiniu/goc/pkg/cover/coverpb"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGRPCTransport(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("mode: count\nmockService/main.go:30.13,48.33 13 1\n"))
+	}))
+	defer agent.Close()
+	dead := deadAddress(t)
+
+	server := NewMemoryBasedServer()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	grpcServer := newGRPCServer(server)
+	go grpcServer.Serve(ln)
+	defer grpcServer.Stop()
+	c := NewWorker("grpc://" + ln.Addr().String())
+
+	assert.NoError(t, c.Ping())
+	_, err = c.RegisterService(ServiceUnderTest{Name: "mockService", Address: agent.URL, Labels: map[string]string{"zone": "east"}})
+	assert.NoError(t, err)
+	_, err = c.RegisterService(ServiceUnderTest{Name: "deadService", Address: dead})
+	assert.NoError(t, err)
+
+	list, err := c.ListServicesWithLabels(0)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"mockService": {agent.URL}, "deadService": {dead}}, list.Items)
+	info, err := c.ServerInfo()
+	assert.NoError(t, err)
+	assert.Equal(t, 2, info.Agents)
+	assert.True(t, info.Uptime > 0)
+	got, err := c.GetAgent(agent.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, Agent{Name: "mockService", Address: agent.URL, Host: "grpc://" + ln.Addr().String(), Labels: map[string]string{"zone": "east"}}, got)
+	// the HTTP status code of the API is kept over gRPC
+	_, err = c.GetAgent(dead + "0")
+	assert.True(t, errors.Is(err, ErrAgentNotFound))
+
+	// the profile is the same as the one over HTTP
+	profile, err := c.Profile(ProfileParam{Service: []string{"mockService"}})
+	assert.NoError(t, err)
+	assert.Contains(t, string(profile), "mockService/main.go:30.13,48.33 13 1")
+	profile, err = c.Profile(ProfileParam{})
+	assert.NoError(t, err)
+	assert.Contains(t, string(profile), "mockService/main.go:30.13,48.33 13 1")
+	// the clients generated from cover.proto talk to the center directly
+	conn, err := grpcConn(ln.Addr().String())
+	assert.NoError(t, err)
+	stream, err := coverpb.NewCoverClient(conn).Profile(context.Background(), &coverpb.ProfileParam{Force: true})
+	assert.NoError(t, err)
+	chunk, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Contains(t, string(chunk.Data), "mockService/main.go:30.13,48.33 13 1")
+	services, err := coverpb.NewCoverClient(conn).List(context.Background(), &coverpb.ListParam{Limit: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), services.Total)
+	assert.Equal(t, int64(1), services.Next)
+	assert.Len(t, services.Items, 1)
+	// so are the headers of the API
+	resp, err := (&http.Client{Transport: &grpcTransport{target: ln.Addr().String()}}).Post(
+		"grpc://"+ln.Addr().String()+CoverProfileAPI, "application/json", strings.NewReader(`{}`))
+	if assert.NoError(t, err) {
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, dead, resp.Header.Get(UnreachableAgentsHeader))
+	}
+	unreachable, err := c.ListUnreachable()
+	assert.NoError(t, err)
+	if assert.Len(t, unreachable, 1) {
+		assert.Equal(t, dead, unreachable[0].Address)
+	}
+	_, err = c.Profile(ProfileParam{Service: []string{"nonexistent"}})
+	assert.Error(t, err)
+
+	assert.NoError(t, c.RemoveAgent(dead))
+	list, err = c.ListServicesWithLabels(0)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"mockService": {agent.URL}}, list.Items)
+
+	// the events are not served over gRPC
+	_, err = c.WatchEvents(context.Background())
+	assert.Error(t, err)
+
+	// the center down is a network error as over HTTP
+	grpcServer.Stop()
+	err = NewWorker("grpc://" + dead[len("http://"):]).Ping()
+	assert.True(t, errors.Is(err, ErrCenterUnreachable))
+}
+
+func TestGRPCLargeProfile(t *testing.T) {
+	// the profile is larger than the default 4 MiB limit of gRPC
+	var profile strings.Builder
+	profile.WriteString("mode: count\n")
+	for i := 0; profile.Len() <= 5<<20; i++ {
+		fmt.Fprintf(&profile, "mockService/main.go:%d.13,%d.33 13 1\n", i+1, i+2)
+	}
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(profile.String()))
+	}))
+	defer agent.Close()
+
+	server := NewMemoryBasedServer()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	grpcServer := newGRPCServer(server)
+	go grpcServer.Serve(ln)
+	defer grpcServer.Stop()
+	c := NewWorker("grpc://" + ln.Addr().String())
+
+	_, err = c.RegisterService(ServiceUnderTest{Name: "mockService", Address: agent.URL})
+	assert.NoError(t, err)
+	got, err := c.Profile(ProfileParam{})
+	assert.NoError(t, err)
+	assert.True(t, len(got) > 4<<20, "profile of %d bytes should be received", len(got))
+
+	// the profile is streamed in the chunks below the limit
+	conn, err := grpcConn(ln.Addr().String())
+	assert.NoError(t, err)
+	stream, err := coverpb.NewCoverClient(conn).Profile(context.Background(), &coverpb.ProfileParam{})
+	assert.NoError(t, err)
+	var chunks, size int
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.True(t, len(chunk.Data) <= grpcChunkSize)
+		chunks++
+		size += len(chunk.Data)
+	}
+	assert.Equal(t, len(got), size)
+	assert.True(t, chunks > 1)
+}
@@ -0,0 +1,92 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/qiniu/goc/pkg/cover/internal/tool"
+	"golang.org/x/tools/cover"
+)
+
+// HTML renders the profile to a self-contained HTML file like 'go tool cover -html',
+// the source files in the profile are looked up under srcRoot
+func HTML(profile, out, srcRoot string) error {
+	profiles, err := cover.ParseProfiles(profile)
+	if err != nil {
+		return fmt.Errorf("failed to parse profile %s: %v", profile, err)
+	}
+
+	var (
+		files []*tool.HTMLFile
+		set   bool
+	)
+	for _, p := range profiles {
+		if p.Mode == "set" {
+			set = true
+		}
+		file, err := findSource(srcRoot, p.FileName)
+		if err != nil {
+			return err
+		}
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("can't read %q: %v", p.FileName, err)
+		}
+		var buf bytes.Buffer
+		if err := tool.HTMLGen(&buf, src, p.Boundaries(src)); err != nil {
+			return err
+		}
+		coverage, _ := percentage([]*cover.Profile{p}, nil)
+		files = append(files, &tool.HTMLFile{
+			Name:     p.FileName,
+			Body:     template.HTML(buf.String()),
+			Coverage: coverage,
+		})
+	}
+
+	f, err := os.Create(out)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", out, err)
+	}
+	defer f.Close()
+	return tool.WriteHTML(f, files, set)
+}
+
+// findSource finds the file of the profile under srcRoot,
+// the file name in profile is prefixed by the import path, which is trimmed element by element
+func findSource(srcRoot, fileName string) (string, error) {
+	if filepath.IsAbs(fileName) {
+		if _, err := os.Stat(fileName); err == nil {
+			return fileName, nil
+		}
+	}
+	elems := strings.Split(fileName, "/")
+	for i := range elems {
+		file := filepath.Join(srcRoot, filepath.Join(elems[i:]...))
+		if fi, err := os.Stat(file); err == nil && !fi.IsDir() {
+			return file, nil
+		}
+	}
+	return "", fmt.Errorf("can't find %q under %s", fileName, srcRoot)
+}
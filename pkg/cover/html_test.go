@@ -0,0 +1,51 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-html")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src := "package foo\n\nfunc A() int {\n\treturn 1\n}\n\nfunc B(a, b int) bool {\n\treturn a < b && b > 0\n}\n"
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "foo"), 0755))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "foo", "a.go"), []byte(src), 0644))
+
+	profile := filepath.Join(dir, "coverage.cov")
+	assert.NoError(t, ioutil.WriteFile(profile, []byte("mode: count\nexample.com/foo/a.go:3.14,5.2 1 3\nexample.com/foo/a.go:7.23,9.2 1 0\n"), 0644))
+
+	out := filepath.Join(dir, "coverage.html")
+	assert.NoError(t, HTML(profile, out, dir))
+	content, err := ioutil.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "example.com/foo/a.go (50.0%)")
+	assert.Contains(t, string(content), `<span class="cov10" title="3">{`)
+	assert.Contains(t, string(content), `<span class="cov0" title="0">{`)
+	assert.Contains(t, string(content), "a &lt; b &amp;&amp; b &gt; 0")
+
+	// the source file can't be found
+	assert.Error(t, HTML(profile, out, filepath.Join(dir, "foo", "bar")))
+}
@@ -53,18 +53,61 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"strconv"
 	"sync/atomic"
 	"syscall"
 	"testing"
+	"time"
 
-	_cover {{.GlobalCoverVarImportPath | printf "%q"}}
+	{{if .HasCounters}}_cover{{else}}_{{end}} {{.GlobalCoverVarImportPath | printf "%q"}}
 
 )
 
+// gocRegisterCenter is the goc server the service registers into, it is baked in at build time,
+// and can be replaced at link time by -ldflags "-X main.gocRegisterCenter=http://127.0.0.1:7777"
+var gocRegisterCenter = {{.Center | printf "%q"}}
+
+// gocAgentName is the name the service registers with, the binary name is used if it is empty,
+// the GOC_AGENT_NAME environment variable takes precedence, e.g. to tell the instances of a fleet apart
+var gocAgentName = {{.AgentName | printf "%q"}}
+
+// gocAgentHost is the IP, or the network interface whose IP, the service advertises to the center,
+// e.g. to be reached on the right network of a host with multiple networks, an IP of the host is picked
+// if it is empty, the GOC_AGENT_HOST environment variable takes precedence
+var gocAgentHost = {{.AgentHost | printf "%q"}}
+
+// gocAgentListen is the address the service listens on for the center, e.g. 127.0.0.1:8100 or :0 for a port
+// picked by the system, which is registered into the center, a random port is used and kept across restarts
+// if it is empty, the GOC_AGENT_LISTEN environment variable takes precedence, e.g. to avoid the port clashes
+// of the services on the same host
+var gocAgentListen = {{.AgentPort | printf "%q"}}
+
+// gocRegisterTimeout is how long the service retries registering into the center if it is unreachable,
+// e.g. the center starts after the service, the GOC_REGISTER_TIMEOUT environment variable takes precedence,
+// it can be replaced at link time by -ldflags "-X main.gocRegisterTimeout=2m" as well
+var gocRegisterTimeout = {{.RegisterTimeout.String | printf "%q"}}
+
+// gocRevision is the VCS revision the service is built from, registered as the label revision:<gocRevision>
+var gocRevision = {{.Revision | printf "%q"}}
+
+// gocFlushOnExit makes the service push its final coverage to the center when it is terminated by SIGTERM
+// or SIGINT, e.g. by Kubernetes, so that the coverage since the last profile is not lost, it is turned off
+// by the GOC_FLUSH_ON_EXIT=false environment variable as well
+var gocFlushOnExit = {{not .NoFlushOnExit}}
+
+// gocPushInterval is how often the service pushes its coverage to the center, e.g. to keep the dashboards
+// fresh without the center asking every service for it, no push if it is zero, the GOC_PUSH_INTERVAL
+// environment variable takes precedence
+var gocPushInterval = {{.PushInterval.String | printf "%q"}}
+
+// gocPushTimeout bounds the time spent on each push of the coverage, including the final one
+const gocPushTimeout = 5 * time.Second
+
 func init() {
 	go registerHandlers()
 }
@@ -141,10 +184,16 @@ func registerHandlers() {
 	}
 	{{if not .Singleton}}
 	profileAddr := "http://" + host
-	if resp, err := registerSelf(profileAddr); err != nil {
+	if resp, err := gocRegisterWithRetry(profileAddr); err != nil {
 		log.Fatalf("register address %v failed, err: %v, response: %v", profileAddr, err, string(resp))
 	}
 
+	if interval, err := gocParsePushInterval(); err != nil {
+		log.Printf("[goc][WARN]%v, the coverage is not pushed", err)
+	} else if interval > 0 {
+		go gocPushLoop(profileAddr, interval)
+	}
+
 	fn := func() {
 		var (
 			err          error
@@ -158,6 +207,16 @@ func registerHandlers() {
 		for _, addr := range addresses {
 				profileAddrs = append(profileAddrs, "http://"+addr)
 		}
+		// the advertised address may be none of the interfaces, e.g. behind a NAT
+		if !gocContains(profileAddrs, profileAddr) {
+				profileAddrs = append(profileAddrs, profileAddr)
+		}
+		// push the final coverage before deregistering, the center only takes it from the registered ones
+		if gocShouldFlushOnExit() {
+			if resp, err := gocFlushSelf(profileAddr); err != nil {
+				log.Printf("[goc][WARN]failed to flush the coverage into %s, err: %v, response: %v", gocRegisterCenter, err, string(resp))
+			}
+		}
 		deregisterSelf(profileAddrs)
 	}
 	go watchSignal(fn)
@@ -186,29 +245,8 @@ func registerHandlers() {
 
 	// coverprofile reports a coverage profile with the coverage percentage
 	mux.HandleFunc("/v1/cover/profile", func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprint(w, "mode: {{.Mode}}\n")
-		counters, blocks := loadValues()
-		var active, total int64
-		var count uint32
-		for name, counts := range counters {
-			block := blocks[name]
-			for i := range counts {
-				stmts := int64(block[i].Stmts)
-				total += stmts
-				count = atomic.LoadUint32(&counts[i]) // For -mode=atomic.
-				if count > 0 {
-					active += stmts
-				}
-				_, err := fmt.Fprintf(w, "%s:%d.%d,%d.%d %d %d\n", name,
-					block[i].Line0, block[i].Col0,
-					block[i].Line1, block[i].Col1,
-					stmts,
-					count)
-				if err != nil {
-					fmt.Fprintf(w, "invalid block format, err: %v", err)
-					return
-				}
-			}
+		if err := gocDumpProfile(w); err != nil {
+			fmt.Fprintf(w, "invalid block format, err: %v", err)
 		}
 	})
 
@@ -221,9 +259,50 @@ func registerHandlers() {
 	log.Fatal(http.Serve(ln, mux))
 }
 
+// gocDumpProfile writes the current coverage profile into w
+func gocDumpProfile(w io.Writer) error {
+	fmt.Fprint(w, "mode: {{.Mode}}\n")
+	counters, blocks := loadValues()
+	for name, counts := range counters {
+		block := blocks[name]
+		for i := range counts {
+			count := atomic.LoadUint32(&counts[i]) // For -mode=atomic.
+			_, err := fmt.Fprintf(w, "%s:%d.%d,%d.%d %d %d\n", name,
+				block[i].Line0, block[i].Col0,
+				block[i].Line1, block[i].Col1,
+				block[i].Stmts,
+				count)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func registerSelf(address string) ([]byte, error) {
-	selfName := filepath.Base(os.Args[0])
-	req, err := http.NewRequest("POST", fmt.Sprintf("%s/v1/cover/register?name=%s&address=%s", {{.Center | printf "%q"}}, selfName, address), nil)
+	selfName := os.Getenv("GOC_AGENT_NAME")
+	if selfName == "" {
+		selfName = gocAgentName
+	}
+	if selfName == "" {
+		selfName = filepath.Base(os.Args[0])
+	}
+	u := fmt.Sprintf("%s/v1/cover/register?name=%s&address=%s", gocRegisterCenter, url.QueryEscape(selfName), address)
+	// the center accepting the advertised addresses keeps it instead of the IP the request comes from
+	if ip, _ := gocAdvertisedIP(); ip != "" {
+		u += "&advertised=true"
+	}
+	if gocRevision != "" {
+		u += "&label=" + url.QueryEscape("revision:"+gocRevision)
+	}
+	// the labels are given like GOC_AGENT_LABELS=env:staging,team:db, which take precedence over the revision
+	for _, label := range strings.Split(os.Getenv("GOC_AGENT_LABELS"), ",") {
+		if label = strings.TrimSpace(label); label != "" {
+			u += "&label=" + url.QueryEscape(label)
+		}
+	}
+	req, err := http.NewRequest("POST", u, nil)
 	if err != nil {
 		log.Fatalf("http.NewRequest failed: %v", err)
 		return nil, err
@@ -245,9 +324,128 @@ func registerSelf(address string) ([]byte, error) {
 	}
 
 	if resp.StatusCode != 200 {
-		err = fmt.Errorf("failed to register into coverage center, response code %d", resp.StatusCode)
+		err = gocRegisterStatusError(resp.StatusCode)
+	}
+
+	return body, err
+}
+
+// gocRegisterStatusError is the status code the center responds a failed registration with
+type gocRegisterStatusError int
+
+func (e gocRegisterStatusError) Error() string {
+	return fmt.Sprintf("failed to register into coverage center, response code %d", int(e))
+}
+
+// gocRegisterWithRetry registers the service into the center, the unreachable or unavailable center
+// is retried with backoff until the register timeout expires, the rejected registration is not retried
+func gocRegisterWithRetry(address string) ([]byte, error) {
+	timeout, err := gocParseRegisterTimeout()
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	backoff := 500 * time.Millisecond
+	for {
+		resp, err := registerSelf(address)
+		if code, ok := err.(gocRegisterStatusError); err == nil || (ok && code < 500) {
+			return resp, err
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return resp, err
+		}
+		if wait > backoff {
+			wait = backoff
+		}
+		log.Printf("[goc][WARN]failed to register into %s, err: %v, retry in %v", gocRegisterCenter, err, wait)
+		time.Sleep(wait)
+		if backoff *= 2; backoff > 10*time.Second {
+			backoff = 10 * time.Second
+		}
+	}
+}
+
+// gocParseRegisterTimeout returns the register timeout given by GOC_REGISTER_TIMEOUT or baked in at build time
+func gocParseRegisterTimeout() (time.Duration, error) {
+	value := os.Getenv("GOC_REGISTER_TIMEOUT")
+	if value == "" {
+		value = gocRegisterTimeout
+	}
+	if value == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid register timeout %q, err: %v", value, err)
+	}
+	return timeout, nil
+}
+
+// gocShouldFlushOnExit reports whether the final coverage is pushed when the service is terminated,
+// the GOC_FLUSH_ON_EXIT environment variable takes precedence over the build option
+func gocShouldFlushOnExit() bool {
+	if enabled, err := strconv.ParseBool(os.Getenv("GOC_FLUSH_ON_EXIT")); err == nil {
+		return enabled
 	}
+	return gocFlushOnExit
+}
+
+// gocFlushSelf pushes the final coverage of the service to the center, which keeps reporting it
+// after the service deregisters
+func gocFlushSelf(address string) ([]byte, error) {
+	return gocSendProfile("/v1/cover/flush", address)
+}
+
+// gocParsePushInterval returns the push interval given by GOC_PUSH_INTERVAL or baked in at build time
+func gocParsePushInterval() (time.Duration, error) {
+	value := os.Getenv("GOC_PUSH_INTERVAL")
+	if value == "" {
+		value = gocPushInterval
+	}
+	if value == "" {
+		return 0, nil
+	}
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid push interval %q, err: %v", value, err)
+	}
+	return interval, nil
+}
 
+// gocPushLoop pushes the coverage of the service to the center every interval, which the center reports
+// instead of asking the service for it, the failed pushes are logged and tried again at the next tick
+func gocPushLoop(address string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if resp, err := gocSendProfile("/v1/cover/push", address); err != nil {
+			log.Printf("[goc][WARN]failed to push the coverage into %s, err: %v, response: %v", gocRegisterCenter, err, string(resp))
+		}
+	}
+}
+
+// gocSendProfile posts the current coverage profile of the service to the api of the center
+func gocSendProfile(api, address string) ([]byte, error) {
+	var profile bytes.Buffer
+	if err := gocDumpProfile(&profile); err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%s%s?address=%s", gocRegisterCenter, api, url.QueryEscape(address))
+	client := &http.Client{Timeout: gocPushTimeout}
+	resp, err := client.Post(u, "text/plain", &profile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send profile to coverage center, err:%v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body, err:%v", err)
+	}
+	if resp.StatusCode != 200 {
+		err = fmt.Errorf("failed to send profile to coverage center, response code %d", resp.StatusCode)
+	}
 	return body, err
 }
 
@@ -259,7 +457,7 @@ func deregisterSelf(address []string) ([]byte, error) {
         if err != nil {
                 return nil, err
         }
-        req, err := http.NewRequest("POST", fmt.Sprintf("%s/v1/cover/remove", {{.Center | printf "%q"}}), bytes.NewReader(jsonBody))
+        req, err := http.NewRequest("POST", fmt.Sprintf("%s/v1/cover/remove", gocRegisterCenter), bytes.NewReader(jsonBody))
         if err != nil {
                 log.Fatalf("http.NewRequest failed: %v", err)
                 return nil, err
@@ -316,13 +514,21 @@ func isNetworkError(err error) bool {
 	return ok
 }
 
+func gocContains(arr []string, str string) bool {
+	for _, element := range arr {
+		if str == element {
+			return true
+		}
+	}
+	return false
+}
+
 func listen() (ln net.Listener, host string, err error) {
-	agentPort := "{{.AgentPort }}"
-	if agentPort != "" {
-		if ln, err = net.Listen("tcp4", agentPort); err != nil {
+	if agentListen := gocListenAddress(); agentListen != "" {
+		if ln, err = net.Listen("tcp4", agentListen); err != nil {
 			return
 		}
-		if host, err = getRealHost(ln); err != nil {
+		if host, err = gocBoundHost(ln); err != nil {
 			return
 		}
 	} else {
@@ -332,8 +538,7 @@ func listen() (ln net.Listener, host string, err error) {
 			// listen on all network interface
 			ln, err = net.Listen("tcp4", ":"+ss[len(ss)-1])
 			if err == nil {
-				host = previousAddr
-				return
+				return gocAdvertise(ln, previousAddr)
 			}
 		}
 		if ln, err = net.Listen("tcp4", ":0"); err != nil {
@@ -343,10 +548,69 @@ func listen() (ln net.Listener, host string, err error) {
 			return 
 		}
 	}
+	if ln, host, err = gocAdvertise(ln, host); err != nil {
+		return
+	}
 	go genProfileAddr(host)
 	return
 }
 
+// gocListenAddress returns the address given by GOC_AGENT_LISTEN or baked in at build time, empty if not given
+func gocListenAddress() string {
+	if value := os.Getenv("GOC_AGENT_LISTEN"); value != "" {
+		return value
+	}
+	return gocAgentListen
+}
+
+// gocBoundHost returns the address the listener is bound to, an IP of the host is picked if it listens
+// on all the network interfaces, the port is the actual one if the system picked it, e.g. for :0
+func gocBoundHost(ln net.Listener) (string, error) {
+	addr := ln.Addr().(*net.TCPAddr)
+	if addr.IP == nil || addr.IP.IsUnspecified() {
+		return getRealHost(ln)
+	}
+	return addr.String(), nil
+}
+
+// gocAdvertise replaces the IP of the host with the advertised one if it is given
+func gocAdvertise(ln net.Listener, host string) (net.Listener, string, error) {
+	ip, err := gocAdvertisedIP()
+	if err != nil || ip == "" {
+		return ln, host, err
+	}
+	return ln, net.JoinHostPort(ip, strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)), nil
+}
+
+// gocAdvertisedIP returns the IP given by GOC_AGENT_HOST or baked in at build time, which is either an IP
+// or the name of a network interface whose first IPv4 address is used, empty if not given
+func gocAdvertisedIP() (string, error) {
+	value := os.Getenv("GOC_AGENT_HOST")
+	if value == "" {
+		value = gocAgentHost
+	}
+	if value == "" {
+		return "", nil
+	}
+	if ip := net.ParseIP(value); ip != nil {
+		return ip.String(), nil
+	}
+	iface, err := net.InterfaceByName(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid agent host %q, it should be an IP or a network interface, err: %v", value, err)
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return "", fmt.Errorf("failed to get the addresses of the network interface %s, err: %v", value, err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+			return ipNet.IP.String(), nil
+		}
+	}
+	return "", fmt.Errorf("no IPv4 address on the network interface %s", value)
+}
+
 func getRealHost(ln net.Listener) (host string, err error) {
 	adds, err := net.InterfaceAddrs()
 	if err != nil {
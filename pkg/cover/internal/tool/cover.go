@@ -303,8 +303,9 @@ func (f *File) Visit(node ast.Node) ast.Visitor {
 // Annotate do following
 // 1. add cover variables into the original file
 // 2. return the cover variables declarations as plain string
+// 3. return the number of the coverage blocks added
 // original dec: func annotate(name string) {
-func Annotate(name string, mode string, varVar string, globalCoverVarImportPath string) string {
+func Annotate(name string, mode string, varVar string, globalCoverVarImportPath string) (string, int) {
 	// QINIU
 	switch mode {
 	case "set":
@@ -391,7 +392,62 @@ func Annotate(name string, mode string, varVar string, globalCoverVarImportPath
 	// we will write all declarations into a single file
 	declBuf := bytes.NewBufferString("")
 	file.addVariables(declBuf)
-	return declBuf.String()
+	return declBuf.String(), len(file.blocks)
+}
+
+// BlockPosition is the position of a basic block Annotate adds a counter for,
+// the same as the one in the coverage profiles
+type BlockPosition struct {
+	StartLine, StartCol int
+	EndLine, EndCol     int
+	NumStmt             int
+}
+
+// QINIU
+// Blocks returns the basic blocks Annotate would add counters for in the named file,
+// without writing anything
+func Blocks(name string) ([]BlockPosition, error) {
+	if counterStmt == nil {
+		counterStmt = incCounterStmt
+	}
+	fset := token.NewFileSet()
+	content, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	parsedFile, err := parser.ParseFile(fset, name, content, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	file := &File{
+		fset:    fset,
+		name:    name,
+		content: content,
+		edit:    NewBuffer(content),
+		astFile: parsedFile,
+	}
+	ast.Walk(file, file.astFile)
+
+	// dedup the positions like addVariables, but not to affect the files annotated later
+	seen := make(map[pos2]bool)
+	positions := make([]BlockPosition, 0, len(file.blocks))
+	for _, block := range file.blocks {
+		key := pos2{p1: fset.Position(block.startByte), p2: fset.Position(block.endByte)}
+		key.p1.Offset, key.p2.Offset = 0, 0
+		for seen[key] {
+			key.p2.Column++
+		}
+		seen[key] = true
+		start, end := key.p1, key.p2
+		positions = append(positions, BlockPosition{
+			StartLine: start.Line,
+			StartCol:  start.Column,
+			EndLine:   end.Line,
+			EndCol:    end.Column,
+			NumStmt:   block.numStmt,
+		})
+	}
+	return positions, nil
 }
 
 // setCounterStmt returns the expression: __count[23] = 1.
@@ -0,0 +1,71 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ErrInvalidLabel represents the label is not in the form of key:value
+var ErrInvalidLabel = errors.New("invalid label")
+
+// the label keys and values are restricted, so that they are safe in the query string and the store file
+var (
+	labelKeyRe   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_./-]*$`)
+	labelValueRe = regexp.MustCompile(`^[A-Za-z0-9_./-]*$`)
+)
+
+// ParseLabels parses the labels in the form of key:value, e.g. env:staging,
+// nil is returned if no label is given
+func ParseLabels(labels []string) (map[string]string, error) {
+	if len(labels) == 0 {
+		return nil, nil
+	}
+	res := make(map[string]string, len(labels))
+	for _, label := range labels {
+		kv := strings.SplitN(label, ":", 2)
+		if len(kv) != 2 || !labelKeyRe.MatchString(kv[0]) || !labelValueRe.MatchString(kv[1]) {
+			return nil, fmt.Errorf("%w: %q, it should be like env:staging", ErrInvalidLabel, label)
+		}
+		res[kv[0]] = kv[1]
+	}
+	return res, nil
+}
+
+// FormatLabels formats the labels to the sorted key:value pairs, it is the reverse of ParseLabels
+func FormatLabels(labels map[string]string) []string {
+	res := make([]string, 0, len(labels))
+	for k, v := range labels {
+		res = append(res, k+":"+v)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// matchLabels reports whether the labels have all the key value pairs of the selector
+func matchLabels(labels, selector map[string]string) bool {
+	for k, v := range selector {
+		if value, ok := labels[k]; !ok || value != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,50 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLabels(t *testing.T) {
+	labels, err := ParseLabels(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, labels)
+
+	labels, err = ParseLabels([]string{"env:staging", "team:db", "version:"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "staging", "team": "db", "version": ""}, labels)
+	assert.Equal(t, []string{"env:staging", "team:db", "version:"}, FormatLabels(labels))
+
+	for _, label := range []string{"env", ":staging", "env:a:b", "env:a&b", "env:a,b", "e nv:staging"} {
+		_, err := ParseLabels([]string{label})
+		assert.True(t, errors.Is(err, ErrInvalidLabel), label)
+	}
+}
+
+func TestMatchLabels(t *testing.T) {
+	labels := map[string]string{"env": "staging", "team": "db"}
+	assert.True(t, matchLabels(labels, nil))
+	assert.True(t, matchLabels(labels, map[string]string{"env": "staging"}))
+	assert.True(t, matchLabels(labels, map[string]string{"env": "staging", "team": "db"}))
+	assert.False(t, matchLabels(labels, map[string]string{"env": "prod"}))
+	assert.False(t, matchLabels(labels, map[string]string{"env": "staging", "region": "bj"}))
+	assert.False(t, matchLabels(nil, map[string]string{"env": "staging"}))
+}
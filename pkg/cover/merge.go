@@ -0,0 +1,96 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/tools/cover"
+	"k8s.io/test-infra/gopherage/pkg/cov"
+	"k8s.io/test-infra/gopherage/pkg/util"
+)
+
+// ErrIncompatibleMode represents the profiles are generated in incompatible cover modes
+var ErrIncompatibleMode = errors.New("incompatible cover mode")
+
+// Merge merges the coverage profiles on disk into the out file,
+// counters of the same block are summed up
+func Merge(paths []string, out string) error {
+	return MergeWithPathMappings(paths, out, nil)
+}
+
+// MergeWithPathMappings merges the coverage profiles on disk into the out file like Merge,
+// the file names of each profile are rewritten by the mappings before merging, so that
+// the profiles of the binaries built from different paths are merged as the same source
+func MergeWithPathMappings(paths []string, out string, mappings []PathMapping) error {
+	if len(paths) == 0 {
+		return errors.New("expected at least one coverage file")
+	}
+
+	// merge the profiles one by one, so that only one of them is in memory at a time
+	acc := NewProfileAccumulator()
+	for _, path := range paths {
+		profile, err := util.LoadProfile(path)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %v", path, err)
+		}
+		if profile, err = RemapProfiles(profile, mappings); err != nil {
+			return fmt.Errorf("failed to remap %s: %v", path, err)
+		}
+		if err := acc.AddProfiles(profile); err != nil {
+			return fmt.Errorf("failed to merge files: %w", err)
+		}
+	}
+	return util.DumpProfile(out, acc.Profiles())
+}
+
+// MergeProfiles merges the profiles, which must refer to the same source.
+// Profiles in count mode and atomic mode can be merged, the counters are summed up and the result is in
+// the mode of the first profile. Profiles in set mode can only be merged with each other, a block is
+// covered in the result if it is covered in any of them. Merging the others fails with ErrIncompatibleMode.
+func MergeProfiles(profiles [][]*cover.Profile) ([]*cover.Profile, error) {
+	mode := ""
+	for _, profile := range profiles {
+		for _, p := range profile {
+			if mode == "" {
+				mode = p.Mode
+				continue
+			}
+			if p.Mode != mode && (p.Mode == "set" || mode == "set") {
+				return nil, fmt.Errorf("%w: mode for %s mismatches, %s vs %s", ErrIncompatibleMode, p.FileName, p.Mode, mode)
+			}
+			// the counters of count and atomic mode can be summed up
+			p.Mode = mode
+		}
+	}
+
+	merged, err := cov.MergeMultipleProfiles(profiles)
+	if err != nil {
+		return nil, err
+	}
+	if mode == "set" {
+		for _, p := range merged {
+			for i := range p.Blocks {
+				if p.Blocks[i].Count > 1 {
+					p.Blocks[i].Count = 1
+				}
+			}
+		}
+	}
+	return merged, nil
+}
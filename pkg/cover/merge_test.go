@@ -0,0 +1,149 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/cover"
+)
+
+func TestMerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-merge")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"count.out":  "mode: count\nexample.com/foo/main.go:3.13,5.2 1 2\nexample.com/foo/main.go:7.13,9.2 1 0\n",
+		"atomic.out": "mode: atomic\nexample.com/foo/main.go:3.13,5.2 1 3\nexample.com/foo/main.go:7.13,9.2 1 1\n",
+		"set1.out":   "mode: set\nexample.com/foo/main.go:3.13,5.2 1 1\nexample.com/foo/main.go:7.13,9.2 1 0\n",
+		"set2.out":   "mode: set\nexample.com/foo/main.go:3.13,5.2 1 1\nexample.com/foo/main.go:7.13,9.2 1 1\n",
+		"other.out":  "mode: count\nexample.com/foo/main.go:3.13,6.2 2 1\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+	path := func(name string) string { return filepath.Join(dir, name) }
+	out := path("merged.out")
+
+	var tcs = []struct {
+		name     string
+		inputs   []string
+		expected string
+		err      error
+	}{
+		{
+			name:     "count and atomic",
+			inputs:   []string{"count.out", "atomic.out"},
+			expected: "mode: count\nexample.com/foo/main.go:3.13,5.2 1 5\nexample.com/foo/main.go:7.13,9.2 1 1\n",
+		},
+		{
+			name:     "set",
+			inputs:   []string{"set1.out", "set2.out"},
+			expected: "mode: set\nexample.com/foo/main.go:3.13,5.2 1 1\nexample.com/foo/main.go:7.13,9.2 1 1\n",
+		},
+		{
+			name:   "set and count",
+			inputs: []string{"count.out", "set1.out"},
+			err:    ErrIncompatibleMode,
+		},
+		{
+			name:   "different source",
+			inputs: []string{"count.out", "other.out"},
+		},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var inputs []string
+			for _, input := range tc.inputs {
+				inputs = append(inputs, path(input))
+			}
+			err := Merge(inputs, out)
+			if tc.expected == "" {
+				assert.Error(t, err)
+				if tc.err != nil {
+					assert.True(t, errors.Is(err, tc.err))
+				}
+				return
+			}
+			assert.NoError(t, err)
+			merged, err := ioutil.ReadFile(out)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(merged))
+		})
+	}
+
+	assert.Error(t, Merge(nil, out))
+	assert.Error(t, Merge([]string{path("notexist.out")}, out))
+}
+
+func TestMergeProfilesModes(t *testing.T) {
+	profile := func(mode string, counts ...int) []*cover.Profile {
+		p := &cover.Profile{FileName: "example.com/foo/main.go", Mode: mode}
+		for i, count := range counts {
+			p.Blocks = append(p.Blocks, cover.ProfileBlock{StartLine: 4*i + 1, StartCol: 2, EndLine: 4*i + 3, EndCol: 2, NumStmt: 1, Count: count})
+		}
+		return []*cover.Profile{p}
+	}
+
+	var tcs = []struct {
+		modes    []string
+		mode     string
+		expected []int
+	}{
+		{modes: []string{"count", "count"}, mode: "count", expected: []int{1, 3, 4}},
+		{modes: []string{"atomic", "atomic"}, mode: "atomic", expected: []int{1, 3, 4}},
+		{modes: []string{"count", "atomic"}, mode: "count", expected: []int{1, 3, 4}},
+		{modes: []string{"atomic", "count"}, mode: "atomic", expected: []int{1, 3, 4}},
+		{modes: []string{"set", "set"}, mode: "set", expected: []int{0, 1, 1}},
+		{modes: []string{"count", "set"}},
+		{modes: []string{"set", "count"}},
+		{modes: []string{"atomic", "set"}},
+		{modes: []string{"set", "atomic"}},
+	}
+	for _, tc := range tcs {
+		t.Run(strings.Join(tc.modes, "+"), func(t *testing.T) {
+			a, b := profile(tc.modes[0], 0, 1, 2), profile(tc.modes[1], 1, 2, 2)
+			if tc.modes[0] == "set" {
+				a = profile("set", 0, 1, 1)
+			}
+			if tc.modes[1] == "set" {
+				b = profile("set", 0, 0, 1)
+			}
+
+			merged, err := MergeProfiles([][]*cover.Profile{a, b})
+			if tc.expected == nil {
+				assert.True(t, errors.Is(err, ErrIncompatibleMode), "got %v", err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, merged, 1)
+			assert.Equal(t, tc.mode, merged[0].Mode)
+			var counts []int
+			for _, block := range merged[0].Blocks {
+				counts = append(counts, block.Count)
+			}
+			assert.Equal(t, tc.expected, counts)
+		})
+	}
+}
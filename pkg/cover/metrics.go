@@ -0,0 +1,86 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	registeredAgentsDesc = prometheus.NewDesc("goc_registered_agents",
+		"Number of the agents registered into the goc server, grouped by the host of the agents.", []string{"host"}, nil)
+	serverUpDesc = prometheus.NewDesc("goc_server_up",
+		"Whether the agents are listed from the goc server successfully.", nil, nil)
+)
+
+// agentsCollector collects the agents registered into the goc server of the worker on every scrape
+type agentsCollector struct {
+	worker Action
+}
+
+// AgentsCollector returns a collector of the number of the agents registered into the goc server
+// of the worker grouped by the host, so that the missing instances can be alerted on
+func AgentsCollector(worker Action) prometheus.Collector {
+	return &agentsCollector{worker: worker}
+}
+
+// Describe implements prometheus.Collector
+func (c *agentsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- registeredAgentsDesc
+	ch <- serverUpDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *agentsCollector) Collect(ch chan<- prometheus.Metric) {
+	agents, err := listAgents("", c.worker)
+	if err != nil {
+		log.Errorf("failed to list the agents for the metrics, err: %v", err)
+		ch <- prometheus.MustNewConstMetric(serverUpDesc, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(serverUpDesc, prometheus.GaugeValue, 1)
+
+	counts := make(map[string]int)
+	for _, agent := range agents {
+		counts[agentHost(agent.Address)]++
+	}
+	for host, count := range counts {
+		ch <- prometheus.MustNewConstMetric(registeredAgentsDesc, prometheus.GaugeValue, float64(count), host)
+	}
+}
+
+// agentHost returns the host of the agent address without the port, or the address if it is not a URL
+func agentHost(address string) string {
+	u, err := url.Parse(address)
+	if err != nil || u.Hostname() == "" {
+		return address
+	}
+	return u.Hostname()
+}
+
+// MetricsHandler returns a handler serving the metrics of AgentsCollector of the worker,
+// e.g. http.Handle("/metrics", cover.MetricsHandler(cover.NewWorker(center)))
+func MetricsHandler(worker Action) http.Handler {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(AgentsCollector(worker))
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
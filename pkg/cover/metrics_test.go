@@ -0,0 +1,69 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentsCollector(t *testing.T) {
+	server := NewMemoryBasedServer()
+	server.Store.Set(map[string][]string{
+		"a": {"http://10.0.0.1:8001", "http://10.0.0.2:8001"},
+		"b": {"http://10.0.0.1:8002"},
+	})
+	ts := httptest.NewServer(server.Route(ioutil.Discard))
+	defer ts.Close()
+
+	expected := `
+# HELP goc_registered_agents Number of the agents registered into the goc server, grouped by the host of the agents.
+# TYPE goc_registered_agents gauge
+goc_registered_agents{host="10.0.0.1"} 2
+goc_registered_agents{host="10.0.0.2"} 1
+# HELP goc_server_up Whether the agents are listed from the goc server successfully.
+# TYPE goc_server_up gauge
+goc_server_up 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(AgentsCollector(NewWorker(ts.URL)), strings.NewReader(expected)))
+
+	// scrape the handler
+	w := httptest.NewRecorder()
+	MetricsHandler(NewWorker(ts.URL)).ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, 200, w.Code)
+	assert.Contains(t, w.Body.String(), `goc_registered_agents{host="10.0.0.2"} 1`)
+
+	// the server is down
+	ts.Close()
+	expected = `
+# HELP goc_server_up Whether the agents are listed from the goc server successfully.
+# TYPE goc_server_up gauge
+goc_server_up 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(AgentsCollector(NewWorker(ts.URL)), strings.NewReader(expected)))
+}
+
+func TestAgentHost(t *testing.T) {
+	assert.Equal(t, "10.0.0.1", agentHost("http://10.0.0.1:8001"))
+	assert.Equal(t, "::1", agentHost("http://[::1]:8001"))
+	assert.Equal(t, "not a url", agentHost("not a url"))
+}
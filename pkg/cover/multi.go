@@ -0,0 +1,150 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+
+	"golang.org/x/tools/cover"
+)
+
+// Agent is a registered service instance, Host is the service center it is registered into
+type Agent struct {
+	Name    string `json:"name"`
+	Address string `json:"address"`
+	Host    string `json:"host"`
+	// Labels are only filled by GetAgent, the listings leave them empty
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// AgentList is the agents listed from several service centers,
+// the centers failed to list are reported in Failed with the errors
+type AgentList struct {
+	Agents []Agent
+	Failed map[string]error
+}
+
+// MultiWorker contacts with several service centers, e.g. one in each region
+type MultiWorker struct {
+	hosts   []string
+	workers []Action
+}
+
+// NewMultiWorker creates a worker for each of the hosts
+func NewMultiWorker(hosts []string) *MultiWorker {
+	m := &MultiWorker{}
+	for _, host := range hosts {
+		m.hosts = append(m.hosts, host)
+		m.workers = append(m.workers, NewWorker(host))
+	}
+	return m
+}
+
+// ListAgents lists the agents of all the service centers concurrently,
+// the failure of one center does not stop listing the others
+func (m *MultiWorker) ListAgents() AgentList {
+	type listed struct {
+		agents []Agent
+		err    error
+	}
+	results := make([]listed, len(m.workers))
+	var wg sync.WaitGroup
+	for i := range m.workers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i].agents, results[i].err = listAgents(m.hosts[i], m.workers[i])
+		}(i)
+	}
+	wg.Wait()
+
+	list := AgentList{Failed: map[string]error{}}
+	for i, res := range results {
+		if res.err != nil {
+			list.Failed[m.hosts[i]] = res.err
+			continue
+		}
+		list.Agents = append(list.Agents, res.agents...)
+	}
+	sort.Slice(list.Agents, func(i, j int) bool {
+		a, b := list.Agents[i], list.Agents[j]
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Address < b.Address
+	})
+	return list
+}
+
+// Profile gets the profiles of the agents selected by param from all the service centers concurrently,
+// and merges them into one, e.g. the coverage of a fleet spread over several regions. Unlike ListAgents,
+// the failure of any center fails it, as the coverage missing the agents of a center is misleading.
+func (m *MultiWorker) Profile(param ProfileParam) ([]*cover.Profile, error) {
+	if len(m.workers) == 0 {
+		return nil, fmt.Errorf("no service centers")
+	}
+	profiles := make([][]*cover.Profile, len(m.workers))
+	errs := make([]error, len(m.workers))
+	var wg sync.WaitGroup
+	for i := range m.workers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			res, err := m.workers[i].Profile(param)
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to get the profile from %s, err: %v", m.hosts[i], err)
+				return
+			}
+			if profiles[i], err = convertProfile(res); err != nil {
+				errs[i] = fmt.Errorf("failed to parse the profile from %s, err: %v", m.hosts[i], err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return MergeProfiles(profiles)
+}
+
+func listAgents(host string, worker Action) ([]Agent, error) {
+	res, err := worker.ListServices()
+	if err != nil {
+		return nil, err
+	}
+	var services map[string][]string
+	if err := json.Unmarshal(res, &services); err != nil {
+		return nil, fmt.Errorf("failed to decode the services of %s, err: %v, response: %s", host, err, string(res))
+	}
+
+	var agents []Agent
+	for name, addrs := range services {
+		for _, addr := range addrs {
+			agents = append(agents, Agent{Name: name, Address: addr, Host: host})
+		}
+	}
+	return agents, nil
+}
@@ -0,0 +1,64 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiWorkerListAgents(t *testing.T) {
+	east := NewMemoryBasedServer()
+	east.Store.Add(ServiceUnderTest{Name: "foo", Address: "http://127.0.0.1:1001"})
+	east.Store.Add(ServiceUnderTest{Name: "bar", Address: "http://127.0.0.1:1002"})
+	eastTs := httptest.NewServer(east.Route(os.Stdout))
+	defer eastTs.Close()
+
+	west := NewMemoryBasedServer()
+	west.Store.Add(ServiceUnderTest{Name: "foo", Address: "http://127.0.0.2:1001"})
+	westTs := httptest.NewServer(west.Route(os.Stdout))
+	defer westTs.Close()
+
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not a json"))
+	}))
+	defer broken.Close()
+	unreachable := "http://127.0.0.1:11111"
+
+	list := NewMultiWorker([]string{westTs.URL, unreachable, eastTs.URL, broken.URL}).ListAgents()
+	expected := []Agent{
+		{Name: "bar", Address: "http://127.0.0.1:1002", Host: eastTs.URL},
+		{Name: "foo", Address: "http://127.0.0.1:1001", Host: eastTs.URL},
+		{Name: "foo", Address: "http://127.0.0.2:1001", Host: westTs.URL},
+	}
+	if eastTs.URL > westTs.URL {
+		expected = append(expected[2:], expected[:2]...)
+	}
+	assert.Equal(t, expected, list.Agents, "the agents of the healthy centers should be listed")
+	assert.Len(t, list.Failed, 2)
+	assert.Error(t, list.Failed[unreachable])
+	assert.Contains(t, list.Failed[broken.URL].Error(), "failed to decode")
+
+	// no center
+	list = NewMultiWorker(nil).ListAgents()
+	assert.Empty(t, list.Agents)
+	assert.Empty(t, list.Failed)
+}
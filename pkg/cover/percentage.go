@@ -0,0 +1,108 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"golang.org/x/tools/cover"
+)
+
+// Percentage returns the percentage of the covered statements in the profile file,
+// which is the same as the total of 'go tool cover -func'.
+// Files matching the exclude glob patterns, e.g. "**/*_mock.go", are not counted.
+func Percentage(profile string, excludes ...string) (float64, error) {
+	profiles, err := cover.ParseProfiles(profile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse profile %s: %v", profile, err)
+	}
+	excludeRes, err := compileGlobs(excludes)
+	if err != nil {
+		return 0, err
+	}
+
+	percent, ok := percentage(profiles, excludeRes)
+	if !ok {
+		return 0, fmt.Errorf("no statements in profile %s", profile)
+	}
+	return percent, nil
+}
+
+// percentage returns the percentage of the covered statements in the profiles
+// of the files not excluded, ok is false if there are no statements
+func percentage(profiles []*cover.Profile, excludeRes []*regexp.Regexp) (percent float64, ok bool) {
+	var covered, total int64
+	for _, p := range profiles {
+		if matchGlobs(excludeRes, p.FileName) {
+			continue
+		}
+		for _, b := range p.Blocks {
+			total += int64(b.NumStmt)
+			if b.Count > 0 {
+				covered += int64(b.NumStmt)
+			}
+		}
+	}
+	if total == 0 {
+		return 0, false
+	}
+	return 100 * float64(covered) / float64(total), true
+}
+
+// compileGlobs converts the glob patterns to regular expressions,
+// "**" matches any number of directories, "*" and "?" do not match "/"
+func compileGlobs(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, pattern := range patterns {
+		var expr strings.Builder
+		expr.WriteString("(^|/)")
+		for i := 0; i < len(pattern); i++ {
+			switch c := pattern[i]; c {
+			case '*':
+				if i+1 < len(pattern) && pattern[i+1] == '*' {
+					expr.WriteString(".*")
+					i++
+				} else {
+					expr.WriteString("[^/]*")
+				}
+			case '?':
+				expr.WriteString("[^/]")
+			default:
+				expr.WriteString(regexp.QuoteMeta(string(c)))
+			}
+		}
+		// a pattern of a directory excludes all the files in it
+		expr.WriteString("(/.*)?$")
+		re, err := regexp.Compile(expr.String())
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %s: %v", pattern, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+func matchGlobs(res []*regexp.Regexp, file string) bool {
+	for _, re := range res {
+		if re.MatchString(file) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,177 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPercentage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-percentage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var tcs = []struct {
+		name     string
+		profile  string
+		expected float64
+	}{
+		{
+			name:     "count mode",
+			profile:  "mode: count\nexample.com/foo/a.go:3.13,5.2 1 2\nexample.com/foo/a.go:7.13,9.2 3 0\n",
+			expected: 25,
+		},
+		{
+			name:     "duplicated blocks are merged",
+			profile:  "mode: set\nexample.com/foo/a.go:3.13,5.2 1 0\nexample.com/foo/a.go:3.13,5.2 1 1\nexample.com/foo/b.go:7.13,9.2 1 0\n",
+			expected: 50,
+		},
+		{
+			name:     "fully covered",
+			profile:  "mode: atomic\nexample.com/foo/a.go:3.13,5.2 2 1\n",
+			expected: 100,
+		},
+	}
+	for i, tc := range tcs {
+		file := filepath.Join(dir, fmt.Sprintf("%d.out", i))
+		assert.NoError(t, ioutil.WriteFile(file, []byte(tc.profile), 0644))
+		percentage, err := Percentage(file)
+		assert.NoError(t, err, tc.name)
+		assert.Equal(t, tc.expected, percentage, tc.name)
+	}
+
+	// profile without statements
+	file := filepath.Join(dir, "empty.out")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("mode: count\n"), 0644))
+	_, err = Percentage(file)
+	assert.Error(t, err)
+
+	_, err = Percentage(filepath.Join(dir, "notexist.out"))
+	assert.Error(t, err)
+}
+
+// excluded files should not count toward the total
+func TestPercentageWithExcludes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-percentage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	profile := filepath.Join(dir, "cover.out")
+	content := `mode: count
+example.com/foo/a.go:3.13,5.2 2 1
+example.com/foo/a.go:7.13,9.2 2 0
+example.com/foo/api/api.pb.go:3.13,5.2 4 0
+example.com/foo/mocks/store.go:3.13,5.2 2 0
+example.com/foo/store_mock.go:3.13,5.2 2 1
+`
+	assert.NoError(t, ioutil.WriteFile(profile, []byte(content), 0644))
+
+	var tcs = []struct {
+		excludes []string
+		expected float64
+		err      bool
+	}{
+		{excludes: nil, expected: 100 * 4.0 / 12},
+		{excludes: []string{"**/*.pb.go"}, expected: 50},
+		{excludes: []string{"*.pb.go", "mocks"}, expected: 100 * 4.0 / 6},
+		{excludes: []string{"**/*.pb.go", "**/mocks/**", "*_mock.go"}, expected: 50},
+		{excludes: []string{"example.com/foo/a.go"}, expected: 25},
+		{excludes: []string{"example.com/foo/?.go"}, expected: 25},
+		{excludes: []string{"foo"}, err: true}, // everything is excluded
+	}
+	for _, tc := range tcs {
+		percentage, err := Percentage(profile, tc.excludes...)
+		if tc.err {
+			assert.Error(t, err, "%v", tc.excludes)
+			continue
+		}
+		assert.NoError(t, err, "%v", tc.excludes)
+		assert.InDelta(t, tc.expected, percentage, 0.001, "%v", tc.excludes)
+	}
+}
+
+// the percentage should match the total of 'go tool cover -func'
+func TestPercentageMatchesGoToolCover(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-percentage")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"go.mod": "module example.com/foo\n",
+		"foo.go": `package foo
+
+func Abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+func Max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+`,
+		"foo_test.go": `package foo
+
+import "testing"
+
+func TestAbs(t *testing.T) {
+	if Abs(1) != 1 {
+		t.Fail()
+	}
+}
+`,
+	}
+	for name, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	profile := filepath.Join(dir, "cover.out")
+	cmd := exec.Command("go", "test", "-coverprofile="+profile, ".")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod")
+	out, err := cmd.CombinedOutput()
+	if !assert.NoError(t, err, string(out)) {
+		return
+	}
+
+	cmd = exec.Command("go", "tool", "cover", "-func="+profile)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GO111MODULE=on", "GOFLAGS=-mod=mod")
+	out, err = cmd.CombinedOutput()
+	if !assert.NoError(t, err, string(out)) {
+		return
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	expected := fields[len(fields)-1]
+
+	percentage, err := Percentage(profile)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, fmt.Sprintf("%.1f%%", percentage))
+}
@@ -0,0 +1,79 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/qiniu/goc/pkg/cover/internal/tool"
+)
+
+// BlockInfo describes a coverage block goc injects a counter for,
+// the positions are the same as the ones in the coverage profiles
+type BlockInfo struct {
+	StartLine int `json:"startLine"`
+	StartCol  int `json:"startCol"`
+	EndLine   int `json:"endLine"`
+	EndCol    int `json:"endCol"`
+	NumStmt   int `json:"numStmt"`
+}
+
+// PreviewPackage returns the coverage blocks goc would inject into the go files of the package
+// without writing anything, keyed by the file names in the profiles, i.e. import path/file.
+// The files which get no counters are present with no blocks: the test files, the generated files
+// and the cgo files which goc skips, and the files excluded by the build constraints.
+func PreviewPackage(pkg *Package) (map[string][]BlockInfo, error) {
+	p := *pkg
+	markSkipFiles(&p, false)
+
+	res := make(map[string][]BlockInfo)
+	for _, file := range append(append([]string{}, p.GoFiles...), p.CgoFiles...) {
+		name := path.Join(p.ImportPath, file)
+		if p.skipFiles[file] {
+			res[name] = nil
+			continue
+		}
+		positions, err := tool.Blocks(filepath.Join(p.Dir, file))
+		if err != nil {
+			return nil, err
+		}
+		blocks := make([]BlockInfo, 0, len(positions))
+		for _, pos := range positions {
+			blocks = append(blocks, BlockInfo{
+				StartLine: pos.StartLine,
+				StartCol:  pos.StartCol,
+				EndLine:   pos.EndLine,
+				EndCol:    pos.EndCol,
+				NumStmt:   pos.NumStmt,
+			})
+		}
+		// in the order of the source, the counters are injected in the order the syntax tree is walked
+		sort.Slice(blocks, func(i, j int) bool {
+			if blocks[i].StartLine != blocks[j].StartLine {
+				return blocks[i].StartLine < blocks[j].StartLine
+			}
+			return blocks[i].StartCol < blocks[j].StartCol
+		})
+		res[name] = blocks
+	}
+	for _, file := range p.IgnoredGoFiles {
+		res[path.Join(p.ImportPath, file)] = nil
+	}
+	return res, nil
+}
@@ -0,0 +1,101 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/tools/cover"
+)
+
+// pushedProfiles keeps the latest profile each agent pushes periodically, the profile API takes it instead
+// of getting the profile from the agent. Each profile replaces the one pushed before, as the counters of
+// the agent only go up until they are cleared.
+type pushedProfiles struct {
+	mu       sync.Mutex
+	profiles map[string][]*cover.Profile
+}
+
+func (p *pushedProfiles) set(addr string, profile []*cover.Profile) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.profiles == nil {
+		p.profiles = map[string][]*cover.Profile{}
+	}
+	p.profiles[addr] = profile
+}
+
+func (p *pushedProfiles) get(addr string) ([]*cover.Profile, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	profile, ok := p.profiles[addr]
+	return profile, ok
+}
+
+// drop forgets the profiles of the agents, e.g. the ones deregistered or cleared
+func (p *pushedProfiles) drop(addrs ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, addr := range addrs {
+		delete(p.profiles, addr)
+	}
+}
+
+func (p *pushedProfiles) reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.profiles = nil
+}
+
+// split divides the agents into the ones which have pushed their profiles and the others
+func (p *pushedProfiles) split(addrs []string) (pushed map[string][]*cover.Profile, others []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pushed = map[string][]*cover.Profile{}
+	for _, addr := range addrs {
+		if profile, ok := p.profiles[addr]; ok {
+			pushed[addr] = profile
+			continue
+		}
+		others = append(others, addr)
+	}
+	return pushed, others
+}
+
+// pushProfile receives the profile a registered agent pushes periodically
+func (s *server) pushProfile(c *gin.Context) {
+	addr := c.Query("address")
+	if addr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing agent address"})
+		return
+	}
+	addr, name := s.resolveAgent(c, addr)
+	if name == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("agent %s not found", addr)})
+		return
+	}
+	profile, err := parseProfile(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid profile: %v", err)})
+		return
+	}
+	s.pushed.set(addr, profile)
+	c.JSON(http.StatusOK, gin.H{"result": fmt.Sprintf("profile of agent %s pushed", addr)})
+}
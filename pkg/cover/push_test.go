@@ -0,0 +1,77 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushProfile(t *testing.T) {
+	var asked int32
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&asked, 1)
+		w.Write([]byte("mode: count\nmockService/main.go:30.13,48.33 13 1\n"))
+	}))
+	defer agent.Close()
+
+	server := NewMemoryBasedServer()
+	server.Store.Add(ServiceUnderTest{Name: "mockService", Address: agent.URL})
+	server.Store.Add(ServiceUnderTest{Name: "pusher", Address: "http://127.0.0.1:1001"})
+	router := server.Route(os.Stdout)
+	do := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	pushURL := "/v1/cover/push?address=http%3A%2F%2F127.0.0.1%3A1001"
+
+	assert.Equal(t, http.StatusBadRequest, do("POST", "/v1/cover/push", "").Code)
+	assert.Equal(t, http.StatusNotFound, do("POST", "/v1/cover/push?address=http%3A%2F%2F127.0.0.1%3A1002", "").Code)
+	assert.Equal(t, http.StatusBadRequest, do("POST", pushURL, "not a profile").Code)
+
+	// the latest pushed profile replaces the ones before
+	assert.Equal(t, http.StatusOK, do("POST", pushURL, "mode: count\nmockService/main.go:30.13,48.33 13 2\n").Code)
+	assert.Equal(t, http.StatusOK, do("POST", pushURL, "mode: count\nmockService/main.go:30.13,48.33 13 3\n").Code)
+
+	// the agent pushing is not asked for its profile
+	w := do("POST", "/v1/cover/profile", `{"service":["pusher"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "mockService/main.go:30.13,48.33 13 3")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&asked))
+	w = do("POST", "/v1/cover/profile", `{}`)
+	assert.Contains(t, w.Body.String(), "mockService/main.go:30.13,48.33 13 4")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&asked))
+
+	// the pushed profile is dropped when the agent is cleared or removed
+	// the agent is not up to clear its counters, which fails the clear after the profile is dropped
+	do("POST", "/v1/cover/clear", `{"service":["pusher"]}`)
+	_, ok := server.pushed.get("http://127.0.0.1:1001")
+	assert.False(t, ok)
+	assert.Equal(t, http.StatusOK, do("POST", pushURL, "mode: count\nmockService/main.go:30.13,48.33 13 3\n").Code)
+	assert.Equal(t, http.StatusOK, do("DELETE", "/v1/cover/agent?id=http%3A%2F%2F127.0.0.1%3A1001", "").Code)
+	_, ok = server.pushed.get("http://127.0.0.1:1001")
+	assert.False(t, ok)
+}
@@ -0,0 +1,138 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/cover"
+	"k8s.io/test-infra/gopherage/pkg/cov"
+)
+
+// PathMapping rewrites the file paths in the profiles from the prefix the binary is built with
+// to the one of the local source, e.g. from example.com/app to /home/me/src/app
+type PathMapping struct {
+	From string
+	To   string
+}
+
+// ParsePathMappings parses the path mappings in the form of from=to
+func ParsePathMappings(specs []string) ([]PathMapping, error) {
+	var mappings []PathMapping
+	for _, spec := range specs {
+		kv := strings.SplitN(spec, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("invalid path mapping %q, it should be in the form of from=to", spec)
+		}
+		mappings = append(mappings, PathMapping{
+			From: trimSlash(strings.TrimSpace(kv[0])),
+			To:   trimSlash(strings.TrimSpace(kv[1])),
+		})
+	}
+	return mappings, nil
+}
+
+// trimSlash trims the trailing slashes of the path, except the root
+func trimSlash(p string) string {
+	if t := strings.TrimRight(p, "/"); t != "" {
+		return t
+	}
+	return p
+}
+
+// remapPath rewrites the path by the mapping with the longest matching prefix,
+// the prefix only matches whole path elements
+func remapPath(name string, mappings []PathMapping) string {
+	best := -1
+	for i, m := range mappings {
+		if name != m.From && !strings.HasPrefix(name, strings.TrimRight(m.From, "/")+"/") {
+			continue
+		}
+		if best < 0 || len(m.From) > len(mappings[best].From) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return name
+	}
+	m := mappings[best]
+	rest := strings.TrimPrefix(name[len(m.From):], "/")
+	if rest == "" {
+		return m.To
+	}
+	if m.To == "" {
+		return rest
+	}
+	return strings.TrimRight(m.To, "/") + "/" + rest
+}
+
+// RemapProfiles rewrites the file names of the profiles by the mappings, the profiles of
+// the files mapped to the same path are merged, the result is sorted by the file names
+func RemapProfiles(profiles []*cover.Profile, mappings []PathMapping) ([]*cover.Profile, error) {
+	if len(mappings) == 0 {
+		return profiles, nil
+	}
+	byName := make(map[string][]*cover.Profile)
+	for _, p := range profiles {
+		p.FileName = remapPath(p.FileName, mappings)
+		byName[p.FileName] = append(byName[p.FileName], p)
+	}
+
+	remapped := make([]*cover.Profile, 0, len(byName))
+	for _, ps := range byName {
+		if len(ps) == 1 {
+			remapped = append(remapped, ps[0])
+			continue
+		}
+		groups := make([][]*cover.Profile, 0, len(ps))
+		for _, p := range ps {
+			groups = append(groups, []*cover.Profile{p})
+		}
+		merged, err := MergeProfiles(groups)
+		if err != nil {
+			return nil, fmt.Errorf("failed to merge the profiles mapped to %s: %w", ps[0].FileName, err)
+		}
+		remapped = append(remapped, merged...)
+	}
+	sort.Slice(remapped, func(i, j int) bool {
+		return remapped[i].FileName < remapped[j].FileName
+	})
+	return remapped, nil
+}
+
+// RemapProfile rewrites the file names of the profile in the text format by the mappings
+func RemapProfile(profile []byte, mappings []PathMapping) ([]byte, error) {
+	if len(mappings) == 0 {
+		return profile, nil
+	}
+	profiles, err := convertProfile(profile)
+	if err != nil {
+		return nil, err
+	}
+	remapped, err := RemapProfiles(profiles, mappings)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := cov.DumpProfile(remapped, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,108 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePathMappings(t *testing.T) {
+	mappings, err := ParsePathMappings([]string{"example.com/app/=/home/me/src/app/", " /build = /src "})
+	assert.NoError(t, err)
+	assert.Equal(t, []PathMapping{{From: "example.com/app", To: "/home/me/src/app"}, {From: "/build", To: "/src"}}, mappings)
+
+	mappings, err = ParsePathMappings(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, mappings)
+
+	for _, spec := range []string{"example.com/app", "=/home/me/src/app"} {
+		_, err = ParsePathMappings([]string{spec})
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestRemapPath(t *testing.T) {
+	mappings := []PathMapping{
+		{From: "example.com/app", To: "/home/me/src/app"},
+		{From: "example.com/app/vendor/example.com/lib", To: "/home/me/src/lib"},
+		{From: "/", To: "/mnt/root"},
+		{From: "_/build", To: ""},
+	}
+	var tcs = []struct {
+		name     string
+		expected string
+	}{
+		{name: "example.com/app/main.go", expected: "/home/me/src/app/main.go"},
+		{name: "example.com/app/vendor/example.com/lib/lib.go", expected: "/home/me/src/lib/lib.go"},
+		{name: "example.com/application/main.go", expected: "example.com/application/main.go"},
+		{name: "/build/main.go", expected: "/mnt/root/build/main.go"},
+		{name: "_/build/foo/bar.go", expected: "foo/bar.go"},
+		{name: "other.com/main.go", expected: "other.com/main.go"},
+	}
+	for _, tc := range tcs {
+		assert.Equal(t, tc.expected, remapPath(tc.name, mappings), tc.name)
+	}
+}
+
+func TestRemapProfile(t *testing.T) {
+	profile := []byte(`mode: count
+example.com/app/main.go:3.13,5.2 1 1
+github.com/me/app/main.go:3.13,5.2 1 2
+example.com/app/foo/foo.go:3.13,5.2 1 0
+other.com/lib/lib.go:3.13,5.2 1 3
+`)
+	mappings := []PathMapping{
+		{From: "example.com/app", To: "/home/me/src/app"},
+		{From: "github.com/me/app", To: "/home/me/src/app"},
+	}
+	remapped, err := RemapProfile(profile, mappings)
+	assert.NoError(t, err)
+	// the profiles mapped to the same file are merged
+	assert.Equal(t, `mode: count
+/home/me/src/app/foo/foo.go:3.13,5.2 1 0
+/home/me/src/app/main.go:3.13,5.2 1 3
+other.com/lib/lib.go:3.13,5.2 1 3
+`, string(remapped))
+
+	// nothing is changed without mappings
+	remapped, err = RemapProfile(profile, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, profile, remapped)
+}
+
+func TestMergeWithPathMappings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goc-remap")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a := filepath.Join(dir, "a.cov")
+	b := filepath.Join(dir, "b.cov")
+	out := filepath.Join(dir, "merged.cov")
+	assert.NoError(t, ioutil.WriteFile(a, []byte("mode: atomic\nexample.com/app/main.go:3.13,5.2 1 1\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(b, []byte("mode: atomic\ngithub.com/me/app/main.go:3.13,5.2 1 2\n"), 0644))
+
+	mappings := []PathMapping{{From: "github.com/me/app", To: "example.com/app"}}
+	assert.NoError(t, MergeWithPathMappings([]string{a, b}, out, mappings))
+	merged, err := ioutil.ReadFile(out)
+	assert.NoError(t, err)
+	assert.Equal(t, "mode: atomic\nexample.com/app/main.go:3.13,5.2 1 3\n", string(merged))
+}
@@ -0,0 +1,68 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+)
+
+// InstrumentReport describes what goc instrumented in a build
+type InstrumentReport struct {
+	TmpDir   string                 `json:"tmpDir"` // the temporary directory where the project is instrumented
+	Packages []*InstrumentedPackage `json:"packages"`
+}
+
+// InstrumentedPackage describes an instrumented package
+type InstrumentedPackage struct {
+	ImportPath   string              `json:"importPath"`
+	Files        []*InstrumentedFile `json:"files"`
+	SkippedFiles []string            `json:"skippedFiles,omitempty"` // test files and generated files which are not instrumented
+}
+
+// InstrumentedFile describes an instrumented file
+type InstrumentedFile struct {
+	File   string `json:"file"`
+	Blocks int    `json:"blocks"` // number of the coverage blocks added
+}
+
+func newInstrumentReport(tmpDir string) *InstrumentReport {
+	return &InstrumentReport{TmpDir: tmpDir}
+}
+
+func (r *InstrumentReport) add(pkgCover *PackageCover) {
+	pkg := &InstrumentedPackage{ImportPath: pkgCover.Package.ImportPath}
+	for _, v := range pkgCover.Vars {
+		pkg.Files = append(pkg.Files, &InstrumentedFile{File: v.File, Blocks: v.Blocks})
+	}
+	sort.Slice(pkg.Files, func(i, j int) bool { return pkg.Files[i].File < pkg.Files[j].File })
+	for file := range pkgCover.Package.skipFiles {
+		pkg.SkippedFiles = append(pkg.SkippedFiles, file)
+	}
+	sort.Strings(pkg.SkippedFiles)
+	r.Packages = append(r.Packages, pkg)
+}
+
+func (r *InstrumentReport) write(file string) error {
+	sort.Slice(r.Packages, func(i, j int) bool { return r.Packages[i].ImportPath < r.Packages[j].ImportPath })
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
@@ -18,6 +18,8 @@ package cover
 
 import (
 	"bytes"
+	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -26,6 +28,9 @@ import (
 	"net/url"
 	"os"
 	"regexp"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	log "github.com/sirupsen/logrus"
@@ -39,6 +44,31 @@ const LogFile = "goc.log"
 type server struct {
 	PersistenceFile string
 	Store           Store
+	Version         string // version of goc running the server, reported by the info API
+	Commit          string // commit goc is built from, reported by the info API
+	// ProfileConcurrency is the max number of agents the profile API gets the profiles from at the same time,
+	// DefaultProfileConcurrency if it is not positive
+	ProfileConcurrency int
+	// MergeIncrementally makes the profile API merge each profile into the result as soon as it is got
+	// instead of holding the profiles of all the agents in memory before merging them, which bounds the
+	// memory for the large fleets. An agent whose profile fails to merge is taken as failed then.
+	MergeIncrementally bool
+	// AgentTimeout bounds each request of the profile API to an agent, DefaultAgentTimeout if it is not positive,
+	// the agents can not be connected or timed out are skipped and listed by the unreachable API
+	AgentTimeout time.Duration
+	// GRPCAddress is the address to serve the API over gRPC as well by Run, e.g. :7778, see coverpb/cover.proto,
+	// the API is only served over HTTP if it is empty
+	GRPCAddress string
+	// AcceptAdvertised keeps the addresses the agents advertise, e.g. the services behind a NAT, instead of
+	// replacing their hosts with the IPs the registrations come from. The advertised addresses are not
+	// checked, so it should be enabled only if the agents are trusted.
+	AcceptAdvertised bool
+
+	startTime   time.Time
+	events      eventHub
+	flushed     flushedProfiles
+	pushed      pushedProfiles
+	unreachable unreachableAgents
 }
 
 // NewFileBasedServer new a file based server with persistenceFile
@@ -50,13 +80,15 @@ func NewFileBasedServer(persistenceFile string) (*server, error) {
 	return &server{
 		PersistenceFile: persistenceFile,
 		Store:           store,
+		startTime:       time.Now(),
 	}, nil
 }
 
 // NewMemoryBasedServer new a memory based server without persistenceFile
 func NewMemoryBasedServer() *server {
 	return &server{
-		Store: NewMemoryStore(),
+		Store:     NewMemoryStore(),
+		startTime: time.Now(),
 	}
 }
 
@@ -70,6 +102,15 @@ func (s *server) Run(port string) {
 	// both log to stdout and file by default
 	mw := io.MultiWriter(f, os.Stdout)
 	r := s.Route(mw)
+	if s.GRPCAddress != "" {
+		ln, err := net.Listen("tcp", s.GRPCAddress)
+		if err != nil {
+			log.Fatalf("failed to listen on %s for gRPC, err: %v", s.GRPCAddress, err)
+		}
+		go func() {
+			log.Fatal(newGRPCServer(s).Serve(ln))
+		}()
+	}
 	log.Fatal(r.Run(port))
 }
 
@@ -88,18 +129,36 @@ func (s *server) Route(w io.Writer) *gin.Engine {
 		v1.GET("/cover/profile", s.profile)
 		v1.POST("/cover/profile", s.profile)
 		v1.POST("/cover/clear", s.clear)
+		v1.POST("/cover/flush", s.flushProfile)
+		v1.POST("/cover/push", s.pushProfile)
 		v1.POST("/cover/init", s.initSystem)
 		v1.GET("/cover/list", s.listServices)
 		v1.POST("/cover/remove", s.removeServices)
+		v1.GET("/cover/agent", s.getAgent)
+		v1.GET("/cover/unreachable", s.listUnreachable)
+		v1.DELETE("/cover/agent", s.removeAgent)
+		v1.GET("/cover/ping", s.ping)
+		v1.GET("/cover/info", s.info)
+		v1.GET("/cover/events", s.watchEvents)
 	}
 
 	return r
 }
 
+// ServerInfo describes the running service center
+type ServerInfo struct {
+	Version string        `json:"version"`
+	Commit  string        `json:"commit"`
+	Uptime  time.Duration `json:"uptime"`
+	Agents  int           `json:"agents"` // number of the registered service instances
+}
+
 // ServiceUnderTest is a entry under being tested
 type ServiceUnderTest struct {
 	Name    string `form:"name" json:"name" binding:"required"`
 	Address string `form:"address" json:"address" binding:"required"`
+	// Labels are the optional key value pairs to select the service, given by the label query in the form of key:value
+	Labels map[string]string `form:"-" json:"labels,omitempty"`
 }
 
 // ProfileParam is param of profile API
@@ -109,12 +168,86 @@ type ProfileParam struct {
 	Address           []string `form:"address" json:"address"`
 	CoverFilePatterns []string `form:"coverfile" json:"coverfile"`
 	SkipFilePatterns  []string `form:"skipfile" json:"skipfile"`
+	// Label selects the services having all the labels, in the form of key:value
+	Label []string `form:"label" json:"label"`
+}
+
+// ListParam is param of list API
+type ListParam struct {
+	Offset int `form:"offset" json:"offset"`
+	Limit  int `form:"limit" json:"limit"`
+}
+
+// ServicesList is one page of the registered services
+type ServicesList struct {
+	Items map[string][]string `json:"items"`
+	Total int                 `json:"total"`          // number of all the registered service instances
+	Next  int                 `json:"next,omitempty"` // offset of the next page, 0 if it is the last one
+	// Labels are the labels of the listed service instances by address, the ones without labels are omitted
+	Labels map[string]map[string]string `json:"labels,omitempty"`
 }
 
 //listServices list all the registered services
+// list API examples:
+// GET /v1/cover/list
+// GET /v1/cover/list?offset=100&limit=50
 func (s *server) listServices(c *gin.Context) {
+	var param ListParam
+	if err := c.ShouldBindQuery(&param); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	services := s.Store.GetAll()
-	c.JSON(http.StatusOK, services)
+	// keep compatible with the clients which don't know pagination
+	if param.Offset == 0 && param.Limit <= 0 {
+		c.JSON(http.StatusOK, services)
+		return
+	}
+	c.JSON(http.StatusOK, s.listPage(services, param))
+}
+
+// listPage returns the page of the services along with the labels of the listed instances
+func (s *server) listPage(services map[string][]string, param ListParam) ServicesList {
+	list := paginateServices(services, param.Offset, param.Limit)
+	for _, addrs := range list.Items {
+		for _, addr := range addrs {
+			if labels := s.Store.Labels(addr); len(labels) != 0 {
+				if list.Labels == nil {
+					list.Labels = make(map[string]map[string]string)
+				}
+				list.Labels[addr] = labels
+			}
+		}
+	}
+	return list
+}
+
+// paginateServices returns the service instances in [offset, offset+limit),
+// the instances are ordered by service name, limit <= 0 means no limit
+func paginateServices(services map[string][]string, offset, limit int) ServicesList {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := ServicesList{Items: make(map[string][]string)}
+	index := 0
+	for _, name := range names {
+		for _, addr := range services[name] {
+			if index >= offset && (limit <= 0 || index < offset+limit) {
+				list.Items[name] = append(list.Items[name], addr)
+			}
+			index++
+		}
+	}
+
+	list.Total = index
+	if limit > 0 && offset+limit < index {
+		list.Next = offset + limit
+	}
+	return list
 }
 
 func (s *server) registerService(c *gin.Context) {
@@ -123,36 +256,58 @@ func (s *server) registerService(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
-
-	u, err := url.Parse(service.Address)
+	labels, err := ParseLabels(c.QueryArray("label"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	service.Labels = labels
+
+	if err := s.register(service, c.ClientIP(), c.Query("advertised") == "true"); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": "success"})
+	return
+}
+
+// register registers the service sending the request from realIP
+func (s *server) register(service ServiceUnderTest, realIP string, advertised bool) error {
+	if err := CheckAgentName(service.Name); err != nil {
+		return &apiError{code: http.StatusBadRequest, err: err}
+	}
+	u, err := url.Parse(service.Address)
+	if err != nil {
+		return &apiError{code: http.StatusBadRequest, err: err}
+	}
 	host, port, err := net.SplitHostPort(u.Host)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
+		return &apiError{code: http.StatusBadRequest, err: err}
 	}
 
-	realIP := c.ClientIP()
 	// only for IPV4
 	// refer: https://github.com/qiniu/goc/issues/177
-	if net.ParseIP(realIP).To4() != nil && host != realIP {
+	// the address advertised on purpose is kept only if the server accepts it, the request may come from
+	// another network of the service
+	if net.ParseIP(realIP).To4() != nil && host != realIP && !(advertised && s.AcceptAdvertised) {
 		log.Printf("the registered host %s of service %s is different with the real one %s, here we choose the real one", service.Name, host, realIP)
 		service.Address = fmt.Sprintf("http://%s:%s", realIP, port)
 	}
 
 	address := s.Store.Get(service.Name)
 	if !contains(address, service.Address) {
-		if err := s.Store.Add(service); err != nil && err != ErrServiceAlreadyRegistered {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+		err := s.Store.Add(service)
+		if err != nil && err != ErrServiceAlreadyRegistered {
+			return err
+		}
+		if err == nil {
+			s.events.publish(AgentEvent{Type: AgentJoined, Name: service.Name, Address: service.Address})
 		}
+	} else if err := s.Store.SetLabels(service.Address, service.Labels); err != nil {
+		// the labels of a registering again service are replaced by the latest ones
+		return err
 	}
-
-	c.JSON(http.StatusOK, gin.H{"result": "success"})
-	return
+	return nil
 }
 
 // profile API examples:
@@ -165,65 +320,121 @@ func (s *server) profile(c *gin.Context) {
 		return
 	}
 
-	allInfos := s.Store.GetAll()
-	filterAddrList, err := filterAddrs(body.Service, body.Address, body.Force, allInfos)
+	merged, err := s.mergeProfile(body)
+	if len(merged.unreachable) != 0 {
+		c.Header(UnreachableAgentsHeader, strings.Join(merged.unreachable, ","))
+	}
+	if len(merged.failed) != 0 {
+		c.Header(FailedAgentsHeader, strings.Join(merged.failed, ","))
+	}
 	if err != nil {
-		c.JSON(http.StatusExpectationFailed, gin.H{"error": err.Error()})
+		respondError(c, err)
 		return
 	}
 
-	var mergedProfiles = make([][]*cover.Profile, 0)
-	for _, addr := range filterAddrList {
-		pp, err := NewWorker(addr).Profile(ProfileParam{})
-		if err != nil {
-			if body.Force {
-				log.Warnf("get profile from [%s] failed, error: %s", addr, err.Error())
-				continue
-			}
-
-			c.JSON(http.StatusExpectationFailed, gin.H{"error": fmt.Sprintf("failed to get profile from %s, error %s", addr, err.Error())})
+	if err := writeProfile(c, merged.profiles); err != nil {
+		// the error can be responded only if none of the profile is sent yet, e.g. it is empty
+		if c.Writer.Written() {
+			log.Errorf("failed to write the profile, err: %v", err)
 			return
 		}
+		c.Header("Content-Encoding", "")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
 
-		profile, err := convertProfile(pp)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		mergedProfiles = append(mergedProfiles, profile)
+// mergedProfile is the profile merged from the selected agents along with the agents skipped
+type mergedProfile struct {
+	profiles    []*cover.Profile
+	failed      []string // the agents failed to get the profiles from, skipped by force
+	unreachable []string // the agents can not be connected to, which are skipped anyway
+}
+
+// mergeProfile gets the profiles of the agents selected by the param and merges them,
+// the agents skipped are returned along with the error
+func (s *server) mergeProfile(param ProfileParam) (mergedProfile, error) {
+	var res mergedProfile
+	filterAddrList, err := s.filterAgents(param, param.Force)
+	if err != nil {
+		return res, &apiError{code: http.StatusExpectationFailed, err: err}
 	}
 
-	if len(mergedProfiles) == 0 {
-		c.JSON(http.StatusExpectationFailed, gin.H{"error": "no profiles"})
-		return
+	var acc *ProfileAccumulator
+	if s.MergeIncrementally {
+		acc = NewProfileAccumulator()
+	}
+	// the agents pushing their profiles periodically are not asked for them
+	pushed, others := s.pushed.split(filterAddrList)
+	fetched := fetchProfiles(others, s.ProfileConcurrency, s.AgentTimeout, acc)
+	// the unreachable agents, e.g. the ones whose hosts are down, are skipped to be removed by the operators
+	s.unreachable.update(others, fetched)
+	if len(fetched.unreachable) != 0 {
+		for _, addr := range fetched.unreachable {
+			log.Warnf("agent [%s] is unreachable, its profile is skipped, error: %s", addr, fetched.failed[addr].Error())
+		}
+		res.unreachable = fetched.unreachable
+	}
+	if len(fetched.failedAddrs) != 0 {
+		if !param.Force {
+			return res, &apiError{code: http.StatusExpectationFailed, err: errors.New(fetched.errorMessage())}
+		}
+		for _, addr := range fetched.failedAddrs {
+			log.Warnf("get profile from [%s] failed, error: %s", addr, fetched.failed[addr].Error())
+		}
+		res.failed = fetched.failedAddrs
+	}
+	// so are the profiles the agents pushed, and the final ones the agents flushed before they exited
+	for _, profiles := range []map[string][]*cover.Profile{pushed, s.flushed.match(param)} {
+		if err := mergeKept(&fetched, acc, profiles); err != nil {
+			return res, fmt.Errorf("failed to merge the profiles of the agents: %v", err)
+		}
 	}
 
-	merged, err := cov.MergeMultipleProfiles(mergedProfiles)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+	var merged []*cover.Profile
+	if acc != nil {
+		if acc.Len() == 0 {
+			return res, &apiError{code: http.StatusExpectationFailed, err: errors.New("no profiles")}
+		}
+		merged = acc.Profiles()
+	} else {
+		if len(fetched.profiles) == 0 {
+			return res, &apiError{code: http.StatusExpectationFailed, err: errors.New("no profiles")}
+		}
+		// the agents may be built in different cover modes
+		merged, err = MergeProfiles(fetched.profiles)
+		if err != nil {
+			return res, fmt.Errorf("failed to merge the profiles of the agents: %v", err)
+		}
 	}
 
-	if len(body.CoverFilePatterns) > 0 {
-		merged, err = filterProfile(body.CoverFilePatterns, merged)
+	if len(param.CoverFilePatterns) > 0 {
+		merged, err = filterProfile(param.CoverFilePatterns, merged)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to filter profile based on the patterns: %v, error: %v", body.CoverFilePatterns, err)})
-			return
+			return res, fmt.Errorf("failed to filter profile based on the patterns: %v, error: %v", param.CoverFilePatterns, err)
 		}
 	}
 
-	if len(body.SkipFilePatterns) > 0 {
-		merged, err = skipProfile(body.SkipFilePatterns, merged)
+	if len(param.SkipFilePatterns) > 0 {
+		merged, err = skipProfile(param.SkipFilePatterns, merged)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to skip profile based on the patterns: %v, error: %v", body.SkipFilePatterns, err)})
-			return
+			return res, fmt.Errorf("failed to skip profile based on the patterns: %v, error: %v", param.SkipFilePatterns, err)
 		}
 	}
+	res.profiles = merged
+	return res, nil
+}
 
-	if err := cov.DumpProfile(merged, c.Writer); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
+// writeProfile streams the profile into the response, compressed if the client accepts gzip
+func writeProfile(c *gin.Context, profiles []*cover.Profile) error {
+	if !strings.Contains(c.GetHeader("Accept-Encoding"), "gzip") {
+		return cov.DumpProfile(profiles, c.Writer)
+	}
+	c.Header("Content-Encoding", "gzip")
+	gw := gzip.NewWriter(c.Writer)
+	if err := cov.DumpProfile(profiles, gw); err != nil {
+		return err
 	}
+	return gw.Close()
 }
 
 // filterProfile filters profiles of the packages matching the coverFile pattern
@@ -276,25 +487,61 @@ func (s *server) clear(c *gin.Context) {
 		c.JSON(http.StatusExpectationFailed, gin.H{"error": err.Error()})
 		return
 	}
-	svrsUnderTest := s.Store.GetAll()
-	filterAddrList, err := filterAddrs(body.Service, body.Address, true, svrsUnderTest)
+	res, err := s.clearAgents(body)
+	// the results of the agents done are kept before the error, as the status code is sent along with them
+	if res != "" {
+		fmt.Fprint(c.Writer, res)
+	}
 	if err != nil {
 		c.JSON(http.StatusExpectationFailed, gin.H{"error": err.Error()})
-		return
 	}
+}
+
+// clearAgents clears the coverage counters of the agents selected by the param, and returns the results
+// of the agents cleared, which are the ones before the failed agent if any
+func (s *server) clearAgents(param ProfileParam) (string, error) {
+	filterAddrList, err := s.filterAgents(param, true)
+	if err != nil {
+		return "", err
+	}
+	s.flushed.remove(param)
+	s.pushed.drop(filterAddrList...)
+	var res strings.Builder
 	for _, addr := range filterAddrList {
 		pp, err := NewWorker(addr).Clear(ProfileParam{})
 		if err != nil {
-			c.JSON(http.StatusExpectationFailed, gin.H{"error": err.Error()})
-			return
+			return res.String(), err
 		}
-		fmt.Fprintf(c.Writer, "Register service %s coverage counter %s", addr, string(pp))
+		fmt.Fprintf(&res, "Register service %s coverage counter %s", addr, string(pp))
 	}
+	return res.String(), nil
+}
 
+// ping is a lightweight readiness probe, it never touches the store
+func (s *server) ping(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"result": "pong"})
+}
+
+// info reports the version and the state of the service center
+func (s *server) info(c *gin.Context) {
+	c.JSON(http.StatusOK, s.serverInfo())
+}
+
+func (s *server) serverInfo() ServerInfo {
+	agents := 0
+	for _, addrs := range s.Store.GetAll() {
+		agents += len(addrs)
+	}
+	return ServerInfo{
+		Version: s.Version,
+		Commit:  s.Commit,
+		Uptime:  time.Since(s.startTime),
+		Agents:  agents,
+	}
 }
 
 func (s *server) initSystem(c *gin.Context) {
-	if err := s.Store.Init(); err != nil {
+	if err := s.reset(); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -302,29 +549,143 @@ func (s *server) initSystem(c *gin.Context) {
 	c.JSON(http.StatusOK, "")
 }
 
+// reset unregisters all the agents and drops the profiles they pushed and flushed for a new round of testing
+func (s *server) reset() error {
+	services := s.Store.GetAll()
+	if err := s.Store.Init(); err != nil {
+		return err
+	}
+	s.flushed.reset()
+	s.pushed.reset()
+	s.unreachable.reset()
+	for name, addrs := range services {
+		for _, addr := range addrs {
+			s.events.publish(AgentEvent{Type: AgentLeft, Name: name, Address: addr})
+		}
+	}
+	return nil
+}
+
 func (s *server) removeServices(c *gin.Context) {
 	var body ProfileParam
 	if err := c.ShouldBind(&body); err != nil {
 		c.JSON(http.StatusExpectationFailed, gin.H{"error": err.Error()})
 		return
 	}
-	svrsUnderTest := s.Store.GetAll()
-	filterAddrList, err := filterAddrs(body.Service, body.Address, true, svrsUnderTest)
+	res, err := s.removeAgents(body)
+	// the results of the agents done are kept before the error, as the status code is sent along with them
+	if res != "" {
+		fmt.Fprint(c.Writer, res)
+	}
 	if err != nil {
 		c.JSON(http.StatusExpectationFailed, gin.H{"error": err.Error()})
-		return
 	}
+}
+
+// removeAgents unregisters the agents selected by the param, and returns the results of the agents removed,
+// which are the ones before the failed agent if any
+func (s *server) removeAgents(param ProfileParam) (string, error) {
+	filterAddrList, err := s.filterAgents(param, true)
+	if err != nil {
+		return "", err
+	}
+	var res strings.Builder
 	for _, addr := range filterAddrList {
+		name := s.agentName(addr)
 		err := s.Store.Remove(addr)
 		if err != nil {
-			c.JSON(http.StatusExpectationFailed, gin.H{"error": err.Error()})
-			return
+			return res.String(), err
 		}
-		fmt.Fprintf(c.Writer, "Register service %s removed from the center.", addr)
+		s.pushed.drop(addr)
+		s.unreachable.drop(addr)
+		s.events.publish(AgentEvent{Type: AgentLeft, Name: name, Address: addr})
+		fmt.Fprintf(&res, "Register service %s removed from the center.", addr)
 	}
+	return res.String(), nil
+}
+
+// getAgent shows the name and the labels of an agent by its id, which is the address of the agent
+func (s *server) getAgent(c *gin.Context) {
+	agent, err := s.agent(c.Query("id"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, agent)
+}
+
+func (s *server) agent(id string) (ServiceUnderTest, error) {
+	name, err := s.registeredName(id)
+	if err != nil {
+		return ServiceUnderTest{}, err
+	}
+	return ServiceUnderTest{Name: name, Address: id, Labels: s.Store.Labels(id)}, nil
+}
+
+// registeredName returns the name of the agent by its id, an apiError is returned if it is not registered
+func (s *server) registeredName(id string) (string, error) {
+	if id == "" {
+		return "", &apiError{code: http.StatusBadRequest, err: errors.New("missing agent id")}
+	}
+	name := s.agentName(id)
+	if name == "" {
+		return "", &apiError{code: http.StatusNotFound, err: fmt.Errorf("agent %s not found", id)}
+	}
+	return name, nil
+}
+
+// removeAgent unregisters an agent by its id, which is the address of the agent
+func (s *server) removeAgent(c *gin.Context) {
+	id := c.Query("id")
+	if err := s.unregister(id); err != nil {
+		respondError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": fmt.Sprintf("agent %s removed", id)})
+}
+
+func (s *server) unregister(id string) error {
+	name, err := s.registeredName(id)
+	if err != nil {
+		return err
+	}
+	if err := s.Store.Remove(id); err != nil {
+		return err
+	}
+	s.pushed.drop(id)
+	s.unreachable.drop(id)
+	s.events.publish(AgentEvent{Type: AgentLeft, Name: name, Address: id})
+	return nil
+}
+
+// apiError is the error of the API responded with the status code, the other errors are responded with 500
+type apiError struct {
+	code int
+	err  error
+}
+
+func (e *apiError) Error() string { return e.err.Error() }
+
+// statusCode returns the HTTP status code the error of the API is responded with
+func statusCode(err error) int {
+	var ae *apiError
+	if errors.As(err, &ae) {
+		return ae.code
+	}
+	return http.StatusInternalServerError
+}
+
+// respondError responds the error of the API
+func respondError(c *gin.Context, err error) {
+	c.JSON(statusCode(err), gin.H{"error": err.Error()})
 }
 
 func convertProfile(p []byte) ([]*cover.Profile, error) {
+	return parseProfile(bytes.NewReader(p))
+}
+
+// parseProfile parses the profile read from r
+func parseProfile(r io.Reader) ([]*cover.Profile, error) {
 	// Annoyingly, ParseProfiles only accepts a filename, so we have to write the bytes to disk
 	// so it can read them back.
 	// We could probably also just give it /dev/stdin, but that'll break on Windows.
@@ -334,7 +695,7 @@ func convertProfile(p []byte) ([]*cover.Profile, error) {
 	}
 	defer tf.Close()
 	defer os.Remove(tf.Name())
-	if _, err := io.Copy(tf, bytes.NewReader(p)); err != nil {
+	if _, err := io.Copy(tf, r); err != nil {
 		return nil, fmt.Errorf("failed to copy data to temp file, err: %v", err)
 	}
 
@@ -350,6 +711,26 @@ func contains(arr []string, str string) bool {
 	return false
 }
 
+// filterAgents returns the addresses of the services selected by the service, address and label params
+func (s *server) filterAgents(body ProfileParam, force bool) ([]string, error) {
+	filterAddrList, err := filterAddrs(body.Service, body.Address, force, s.Store.GetAll())
+	if err != nil || len(body.Label) == 0 {
+		return filterAddrList, err
+	}
+
+	selector, err := ParseLabels(body.Label)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, addr := range filterAddrList {
+		if matchLabels(s.Store.Labels(addr), selector) {
+			res = append(res, addr)
+		}
+	}
+	return res, nil
+}
+
 // filterAddrs filter address list by given service and address list
 func filterAddrs(serviceList, addressList []string, force bool, allInfos map[string][]string) (filterAddrList []string, err error) {
 	addressAll := []string{}
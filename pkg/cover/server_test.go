@@ -2,13 +2,16 @@ package cover
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 
@@ -52,6 +55,16 @@ func (m *MockStore) Set(services map[string][]string) error {
 	return args.Error(0)
 }
 
+func (m *MockStore) Labels(addr string) map[string]string {
+	args := m.Called(addr)
+	return args.Get(0).(map[string]string)
+}
+
+func (m *MockStore) SetLabels(addr string, labels map[string]string) error {
+	args := m.Called(addr, labels)
+	return args.Error(0)
+}
+
 func TestContains(t *testing.T) {
 	assert.Equal(t, contains([]string{"a", "b"}, "a"), true)
 	assert.Equal(t, contains([]string{"a", "b"}, "c"), false)
@@ -155,6 +168,18 @@ func TestRegisterService(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, w.Code)
 	assert.Contains(t, w.Body.String(), "missing port in address")
 
+	// register with a name breaking the persistent file
+	data = url.Values{}
+	data.Set("name", "foo&bar")
+	data.Set("address", "http://127.0.0.1:64444")
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/v1/cover/register", strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid agent name")
+
 	// register with store failure
 	expectedS := ServiceUnderTest{
 		Name:    "foo",
@@ -177,6 +202,36 @@ func TestRegisterService(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "lala error")
 }
 
+func TestRegisterAdvertisedService(t *testing.T) {
+	server := NewMemoryBasedServer()
+	router := server.Route(os.Stdout)
+
+	register := func(query string) {
+		data := url.Values{}
+		data.Set("name", "foo")
+		data.Set("address", "http://203.0.113.7:64444")
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/cover/register"+query, strings.NewReader(data.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.RemoteAddr = "127.0.0.1:12345"
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// the host is replaced by the IP the request comes from
+	register("")
+	assert.Equal(t, []string{"http://127.0.0.1:64444"}, server.Store.Get("foo"))
+
+	// the advertised host is not trusted by default
+	register("?advertised=true")
+	assert.Equal(t, []string{"http://127.0.0.1:64444"}, server.Store.Get("foo"))
+
+	// the advertised host is kept if the server accepts it
+	server.AcceptAdvertised = true
+	register("?advertised=true")
+	assert.Equal(t, []string{"http://127.0.0.1:64444", "http://203.0.113.7:64444"}, server.Store.Get("foo"))
+}
+
 func TestProfileService(t *testing.T) {
 	server, err := NewFileBasedServer("_svrs_address.txt")
 	assert.NoError(t, err)
@@ -191,6 +246,40 @@ func TestProfileService(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "invalid syntax")
 }
 
+func TestProfileServiceWithGzip(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("mode: count\nmockService/main.go:30.13,48.33 13 1\n"))
+	}))
+	defer agent.Close()
+
+	server := NewMemoryBasedServer()
+	server.Store.Add(ServiceUnderTest{Name: "mockService", Address: agent.URL})
+	router := server.Route(os.Stdout)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/cover/profile", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	gr, err := gzip.NewReader(w.Body)
+	assert.NoError(t, err)
+	profile, err := ioutil.ReadAll(gr)
+	assert.NoError(t, err)
+	assert.Contains(t, string(profile), "mockService/main.go:30.13,48.33 13 1")
+
+	// the error is responded as is if none of the profile is sent, e.g. all the files are filtered out
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/v1/cover/profile", bytes.NewBufferString(`{"coverfile":["nothing.go$"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept-Encoding", "gzip")
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Empty(t, w.Header().Get("Content-Encoding"))
+	assert.Contains(t, w.Body.String(), "empty profile")
+}
+
 func TestClearService(t *testing.T) {
 	testObj := new(MockStore)
 	testObj.On("GetAll").Return(map[string][]string{"foo": {"http://127.0.0.1:66666"}})
@@ -295,8 +384,65 @@ func TestRemoveServices(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "use 'service' flag and 'address' flag at the same time may cause ambiguity, please use them separately")
 }
 
+func TestRemoveAgent(t *testing.T) {
+	testObj := new(MockStore)
+	testObj.On("GetAll").Return(map[string][]string{"foo": {"test1", "test2"}})
+	testObj.On("Remove", "test1").Return(nil)
+	testObj.On("Remove", "test2").Return(fmt.Errorf("fail to persist"))
+
+	server := &server{
+		Store: testObj,
+	}
+	router := server.Route(os.Stdout)
+
+	var tcs = []struct {
+		url      string
+		code     int
+		expected string
+	}{
+		{url: "/v1/cover/agent", code: http.StatusBadRequest, expected: "missing agent id"},
+		{url: "/v1/cover/agent?id=test1", code: http.StatusOK, expected: "agent test1 removed"},
+		{url: "/v1/cover/agent?id=test2", code: http.StatusInternalServerError, expected: "fail to persist"},
+		{url: "/v1/cover/agent?id=test3", code: http.StatusNotFound, expected: "agent test3 not found"},
+	}
+	for _, tc := range tcs {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("DELETE", tc.url, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, tc.url)
+		assert.Contains(t, w.Body.String(), tc.expected, tc.url)
+	}
+}
+
+func TestGetAgent(t *testing.T) {
+	server := NewMemoryBasedServer()
+	server.Store.Add(ServiceUnderTest{Name: "foo", Address: "test1"})
+	server.Store.SetLabels("test1", map[string]string{"revision": "abcdef"})
+	router := server.Route(os.Stdout)
+
+	var tcs = []struct {
+		url      string
+		code     int
+		expected string
+	}{
+		{url: "/v1/cover/agent", code: http.StatusBadRequest, expected: "missing agent id"},
+		{url: "/v1/cover/agent?id=test1", code: http.StatusOK, expected: `{"name":"foo","address":"test1","labels":{"revision":"abcdef"}}`},
+		{url: "/v1/cover/agent?id=test2", code: http.StatusNotFound, expected: "agent test2 not found"},
+	}
+	for _, tc := range tcs {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", tc.url, nil)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, tc.code, w.Code, tc.url)
+		assert.Contains(t, w.Body.String(), tc.expected, tc.url)
+	}
+}
+
 func TestInitService(t *testing.T) {
 	testObj := new(MockStore)
+	testObj.On("GetAll").Return(map[string][]string{})
 	testObj.On("Init").Return(fmt.Errorf("lala error"))
 
 	server := &server{
@@ -313,6 +459,54 @@ func TestInitService(t *testing.T) {
 	assert.Contains(t, w.Body.String(), "lala error")
 }
 
+func TestPaginateServices(t *testing.T) {
+	services := map[string][]string{
+		"b": {"http://127.0.0.1:2001"},
+		"a": {"http://127.0.0.1:1001", "http://127.0.0.1:1002"},
+	}
+
+	list := paginateServices(services, 0, 2)
+	assert.Equal(t, 3, list.Total)
+	assert.Equal(t, 2, list.Next)
+	assert.Equal(t, map[string][]string{"a": {"http://127.0.0.1:1001", "http://127.0.0.1:1002"}}, list.Items)
+
+	list = paginateServices(services, 2, 2)
+	assert.Equal(t, 3, list.Total)
+	assert.Equal(t, 0, list.Next)
+	assert.Equal(t, map[string][]string{"b": {"http://127.0.0.1:2001"}}, list.Items)
+
+	list = paginateServices(services, 5, 2)
+	assert.Equal(t, 0, list.Next)
+	assert.Empty(t, list.Items)
+}
+
+func TestListServicesWithInvalidParam(t *testing.T) {
+	server := &server{
+		Store: new(MockStore),
+	}
+	router := server.Route(os.Stdout)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/cover/list?limit=abc", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPingService(t *testing.T) {
+	server := &server{
+		Store: new(MockStore),
+	}
+	router := server.Route(os.Stdout)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/v1/cover/ping", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "pong")
+}
+
 func TestFilterProfile(t *testing.T) {
 	var tcs = []struct {
 		name      string
@@ -525,3 +719,51 @@ func stringifyCoverProfile(profiles []*cover.Profile) string {
 
 	return fmt.Sprintf("%#v", res)
 }
+
+func TestFilterAgentsByLabel(t *testing.T) {
+	server := NewMemoryBasedServer()
+	router := server.Route(os.Stdout)
+
+	register := func(name, address string, labels ...string) int {
+		data := url.Values{}
+		data.Set("name", name)
+		data.Set("address", address)
+		data["label"] = labels
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/cover/register?"+data.Encode(), strings.NewReader(""))
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, register("foo", "http://127.0.0.1:1001", "env:staging", "team:db"))
+	assert.Equal(t, http.StatusOK, register("foo", "http://127.0.0.1:1002", "env:prod"))
+	assert.Equal(t, http.StatusOK, register("bar", "http://127.0.0.1:1003", "env:staging"))
+	assert.Equal(t, http.StatusBadRequest, register("bar", "http://127.0.0.1:1004", "env"))
+
+	items := []struct {
+		param ProfileParam
+		addrs []string
+		err   bool
+	}{
+		{param: ProfileParam{Label: []string{"env:staging"}}, addrs: []string{"http://127.0.0.1:1001", "http://127.0.0.1:1003"}},
+		{param: ProfileParam{Label: []string{"env:staging", "team:db"}}, addrs: []string{"http://127.0.0.1:1001"}},
+		{param: ProfileParam{Service: []string{"foo"}, Label: []string{"env:staging"}}, addrs: []string{"http://127.0.0.1:1001"}},
+		{param: ProfileParam{Label: []string{"env:test"}}, addrs: nil},
+		{param: ProfileParam{Label: []string{"env"}}, err: true},
+	}
+	for _, item := range items {
+		addrs, err := server.filterAgents(item.param, true)
+		if item.err {
+			assert.Error(t, err)
+			continue
+		}
+		assert.NoError(t, err)
+		sort.Strings(addrs)
+		assert.Equal(t, item.addrs, addrs)
+	}
+
+	// the labels are replaced when the service registers again
+	assert.Equal(t, http.StatusOK, register("foo", "http://127.0.0.1:1002", "env:staging"))
+	addrs, err := server.filterAgents(ProfileParam{Label: []string{"env:staging"}}, true)
+	assert.NoError(t, err)
+	assert.Len(t, addrs, 3)
+}
@@ -0,0 +1,109 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"golang.org/x/tools/cover"
+)
+
+// CoveredBlock is a block of a source file in a coverage profile
+type CoveredBlock struct {
+	FileName string
+	cover.ProfileBlock
+}
+
+// String formats the block like the lines of a coverage profile, e.g. a.go:10.2,12.16
+func (b CoveredBlock) String() string {
+	return fmt.Sprintf("%s:%d.%d,%d.%d", b.FileName, b.StartLine, b.StartCol, b.EndLine, b.EndCol)
+}
+
+// blockKey identifies a block by its position, the counters are not compared
+type blockKey struct {
+	fileName                             string
+	startLine, startCol, endLine, endCol int
+}
+
+// NewlyCovered returns the blocks covered in the after profiles but not in the before ones, ordered by position,
+// blocks missing in the before profiles, e.g. of the agents registered later, are taken as not covered before
+func NewlyCovered(before, after []*cover.Profile) []CoveredBlock {
+	covered := make(map[blockKey]bool)
+	for _, p := range before {
+		for _, b := range p.Blocks {
+			if b.Count > 0 {
+				covered[blockKey{p.FileName, b.StartLine, b.StartCol, b.EndLine, b.EndCol}] = true
+			}
+		}
+	}
+
+	var blocks []CoveredBlock
+	for _, p := range after {
+		for _, b := range p.Blocks {
+			key := blockKey{p.FileName, b.StartLine, b.StartCol, b.EndLine, b.EndCol}
+			// a block is counted once however many agents cover it
+			if b.Count > 0 && !covered[key] {
+				covered[key] = true
+				blocks = append(blocks, CoveredBlock{FileName: p.FileName, ProfileBlock: b})
+			}
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool {
+		a, b := blocks[i], blocks[j]
+		if a.FileName != b.FileName {
+			return a.FileName < b.FileName
+		}
+		if a.StartLine != b.StartLine {
+			return a.StartLine < b.StartLine
+		}
+		return a.StartCol < b.StartCol
+	})
+	return blocks
+}
+
+// Snapshot fetches the profile of the agents selected by param and stores it into the file,
+// the blocks covered after it are reported by CoveredSince
+func Snapshot(worker Action, param ProfileParam, path string) error {
+	res, err := worker.Profile(param)
+	if err != nil {
+		return fmt.Errorf("failed to fetch the profile, err: %v", err)
+	}
+	if err := ioutil.WriteFile(path, res, 0644); err != nil {
+		return fmt.Errorf("failed to store the snapshot %s, err: %v", path, err)
+	}
+	return nil
+}
+
+// CoveredSince fetches the profile of the agents selected by param again, and returns
+// the blocks newly covered since the snapshot in the file, together with the latest profile
+func CoveredSince(worker Action, param ProfileParam, path string) ([]CoveredBlock, []byte, error) {
+	before, err := cover.ParseProfiles(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse the snapshot %s, err: %v", path, err)
+	}
+	res, err := worker.Profile(param)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch the profile, err: %v", err)
+	}
+	after, err := convertProfile(res)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse the profile, err: %v", err)
+	}
+	return NewlyCovered(before, after), res, nil
+}
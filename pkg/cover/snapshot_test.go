@@ -0,0 +1,85 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/tools/cover"
+)
+
+func TestNewlyCovered(t *testing.T) {
+	before, err := convertProfile([]byte(`mode: count
+example.com/a/a.go:3.10,5.2 1 1
+example.com/a/a.go:7.10,9.2 1 0
+example.com/a/b.go:3.10,5.2 2 0
+`))
+	assert.NoError(t, err)
+	after, err := convertProfile([]byte(`mode: count
+example.com/a/a.go:3.10,5.2 1 2
+example.com/a/a.go:7.10,9.2 1 1
+example.com/a/b.go:3.10,5.2 2 0
+example.com/a/c.go:1.10,2.2 1 3
+example.com/a/c.go:1.10,2.2 1 1
+`))
+	assert.NoError(t, err)
+
+	blocks := NewlyCovered(before, after)
+	var got []string
+	for _, b := range blocks {
+		got = append(got, b.String())
+	}
+	// the block covered before, the block not covered yet and the duplicated block are not reported
+	assert.Equal(t, []string{"example.com/a/a.go:7.10,9.2", "example.com/a/c.go:1.10,2.2"}, got)
+	assert.Empty(t, NewlyCovered(after, after))
+	assert.Equal(t, []CoveredBlock(nil), NewlyCovered(after, []*cover.Profile{}))
+}
+
+func TestSnapshot(t *testing.T) {
+	profiles := []string{
+		"mode: set\nexample.com/a/a.go:3.10,5.2 1 0\nexample.com/a/a.go:7.10,9.2 1 1\n",
+		"mode: set\nexample.com/a/a.go:3.10,5.2 1 1\nexample.com/a/a.go:7.10,9.2 1 1\n",
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, CoverProfileAPI, r.URL.Path)
+		w.Write([]byte(profiles[0]))
+		profiles = profiles[1:]
+	}))
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "goc-snapshot")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	snapshot := filepath.Join(dir, "before.cov")
+
+	worker := NewWorker(ts.URL)
+	assert.NoError(t, Snapshot(worker, ProfileParam{}, snapshot))
+	blocks, profile, err := CoveredSince(worker, ProfileParam{}, snapshot)
+	assert.NoError(t, err)
+	assert.Len(t, blocks, 1)
+	assert.Equal(t, "example.com/a/a.go:3.10,5.2", blocks[0].String())
+	assert.Contains(t, string(profile), "example.com/a/a.go:3.10,5.2 1 1")
+
+	_, _, err = CoveredSince(worker, ProfileParam{}, filepath.Join(dir, "nonexistent.cov"))
+	assert.Error(t, err)
+}
@@ -30,6 +30,9 @@ import (
 
 var ErrServiceAlreadyRegistered = errors.New("service already registered")
 
+// ErrInvalidAgentName represents the error the name of the service breaks the persistent file
+var ErrInvalidAgentName = errors.New("invalid agent name")
+
 // Store persistents the registered service information
 type Store interface {
 	// Add adds the given service to store
@@ -49,6 +52,12 @@ type Store interface {
 
 	// Remove the service from the store by address
 	Remove(addr string) error
+
+	// Labels returns the labels of the service with the given address
+	Labels(addr string) map[string]string
+
+	// SetLabels sets the labels of the service with the given address
+	SetLabels(addr string, labels map[string]string) error
 }
 
 // fileStore holds the registered services into memory and persistent to a local file
@@ -103,6 +112,19 @@ func (l *fileStore) GetAll() map[string][]string {
 	return l.memoryStore.GetAll()
 }
 
+// Labels returns the labels of the service with the given address
+func (l *fileStore) Labels(addr string) map[string]string {
+	return l.memoryStore.Labels(addr)
+}
+
+// SetLabels sets the labels of the service into the memory store and the file store
+func (l *fileStore) SetLabels(addr string, labels map[string]string) error {
+	if err := l.memoryStore.SetLabels(addr, labels); err != nil {
+		return err
+	}
+	return l.Set(l.memoryStore.GetAll())
+}
+
 // Remove the service from the memory store and the file store
 func (l *fileStore) Remove(addr string) error {
 	err := l.memoryStore.Remove(addr)
@@ -132,6 +154,7 @@ func (l *fileStore) Init() error {
 // load all registered service from file to memory
 func (l *fileStore) load() error {
 	var svrsMap = make(map[string][]string, 0)
+	var labelsMap = make(map[string]map[string]string, 0)
 
 	f, err := os.Open(l.persistentFile)
 	if err != nil {
@@ -147,6 +170,16 @@ func (l *fileStore) load() error {
 		line := ns.Text()
 		ss := strings.FieldsFunc(line, split)
 
+		// the labels are optional
+		if len(ss) == 3 {
+			labels, err := ParseLabels(strings.Split(ss[2], ","))
+			if err != nil {
+				return fmt.Errorf("failed to parse the labels of %s, err: %v", ss[1], err)
+			}
+			labelsMap[ss[1]] = labels
+			ss = ss[:2]
+		}
+
 		// TODO: use regex
 		if len(ss) == 2 {
 			if urls, ok := svrsMap[ss[0]]; ok {
@@ -164,6 +197,9 @@ func (l *fileStore) load() error {
 
 	// set information to memory
 	l.memoryStore.Set(svrsMap)
+	for addr, labels := range labelsMap {
+		l.memoryStore.SetLabels(addr, labels)
+	}
 	return nil
 }
 
@@ -185,7 +221,7 @@ func (l *fileStore) Set(services map[string][]string) error {
 	s := ""
 	for name, addrs := range services {
 		for _, addr := range addrs {
-			s += fmt.Sprintf("%s&%s\n", name, addr)
+			s += format(ServiceUnderTest{Name: name, Address: addr, Labels: l.memoryStore.Labels(addr)}) + "\n"
 		}
 	}
 
@@ -214,9 +250,21 @@ func (l *fileStore) appendToFile(s ServiceUnderTest) error {
 }
 
 func format(s ServiceUnderTest) string {
+	if len(s.Labels) != 0 {
+		return fmt.Sprintf("%s&%s&%s", s.Name, s.Address, strings.Join(FormatLabels(s.Labels), ","))
+	}
 	return fmt.Sprintf("%s&%s", s.Name, s.Address)
 }
 
+// CheckAgentName checks that the name a service registers with can be persisted,
+// the '&' and line breaks separate the services in the persistent file
+func CheckAgentName(name string) error {
+	if strings.TrimSpace(name) == "" || strings.ContainsAny(name, "&\r\n") {
+		return fmt.Errorf("%w %q, it should not be blank or contain '&' or line breaks", ErrInvalidAgentName, name)
+	}
+	return nil
+}
+
 func split(r rune) bool {
 	return r == '&'
 }
@@ -225,12 +273,15 @@ func split(r rune) bool {
 type memoryStore struct {
 	mu          sync.RWMutex
 	servicesMap map[string][]string
+	// labels maps the address to the labels of the service
+	labels map[string]map[string]string
 }
 
 // NewMemoryStore creates a memory store
 func NewMemoryStore() Store {
 	return &memoryStore{
 		servicesMap: make(map[string][]string, 0),
+		labels:      make(map[string]map[string]string, 0),
 	}
 }
 
@@ -251,6 +302,9 @@ func (l *memoryStore) Add(s ServiceUnderTest) error {
 	} else {
 		l.servicesMap[s.Name] = []string{s.Address}
 	}
+	if len(s.Labels) != 0 {
+		l.labels[s.Address] = copyLabels(s.Labels)
+	}
 
 	return nil
 }
@@ -280,6 +334,7 @@ func (l *memoryStore) Init() error {
 	defer l.mu.Unlock()
 
 	l.servicesMap = make(map[string][]string, 0)
+	l.labels = make(map[string]map[string]string, 0)
 	return nil
 }
 
@@ -288,6 +343,12 @@ func (l *memoryStore) Set(services map[string][]string) error {
 	defer l.mu.Unlock()
 
 	l.servicesMap = services
+	// drop the labels of the services gone
+	for addr := range l.labels {
+		if !l.registered(addr) {
+			delete(l.labels, addr)
+		}
+	}
 
 	return nil
 }
@@ -319,6 +380,52 @@ func (l *memoryStore) Remove(removeAddr string) error {
 	if !flag {
 		return fmt.Errorf("no service found")
 	}
+	delete(l.labels, removeAddr)
 
 	return nil
 }
+
+// Labels returns the labels of the service with the given address
+func (l *memoryStore) Labels(addr string) map[string]string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return copyLabels(l.labels[addr])
+}
+
+// SetLabels sets the labels of the service with the given address,
+// the service must be registered already
+func (l *memoryStore) SetLabels(addr string, labels map[string]string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.registered(addr) {
+		return fmt.Errorf("no service found")
+	}
+	if len(labels) == 0 {
+		delete(l.labels, addr)
+		return nil
+	}
+	l.labels[addr] = copyLabels(labels)
+	return nil
+}
+
+// registered reports whether the address is registered, the caller must hold the lock
+func (l *memoryStore) registered(addr string) bool {
+	for _, addrs := range l.servicesMap {
+		if contains(addrs, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func copyLabels(labels map[string]string) map[string]string {
+	if len(labels) == 0 {
+		return nil
+	}
+	res := make(map[string]string, len(labels))
+	for k, v := range labels {
+		res[k] = v
+	}
+	return res
+}
@@ -17,7 +17,9 @@
 package cover
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -128,3 +130,43 @@ func TestFileStoreRemove(t *testing.T) {
 	err = store.Remove("http")
 	assert.Error(t, err, fmt.Errorf("no service found"))
 }
+
+func TestStoreLabels(t *testing.T) {
+	localStore, err := NewFileStore("_svrs_labels.txt")
+	assert.NoError(t, err)
+	defer os.Remove("_svrs_labels.txt")
+	defer localStore.Init()
+
+	staging := ServiceUnderTest{Name: "a", Address: "http://127.0.0.1:8900", Labels: map[string]string{"env": "staging", "team": "db"}}
+	plain := ServiceUnderTest{Name: "a", Address: "http://127.0.0.1:8901"}
+	assert.NoError(t, localStore.Add(staging))
+	assert.NoError(t, localStore.Add(plain))
+	assert.Equal(t, staging.Labels, localStore.Labels(staging.Address))
+	assert.Nil(t, localStore.Labels(plain.Address))
+
+	// the labels are loaded from the file
+	localStoreNew, err := NewFileStore("_svrs_labels.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, staging.Labels, localStoreNew.Labels(staging.Address))
+
+	// the labels are replaced and persisted
+	assert.NoError(t, localStore.SetLabels(plain.Address, map[string]string{"env": "prod"}))
+	localStoreNew, err = NewFileStore("_svrs_labels.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"env": "prod"}, localStoreNew.Labels(plain.Address))
+	assert.Error(t, localStore.SetLabels("http://127.0.0.1:8902", map[string]string{"env": "prod"}))
+
+	// the labels are gone with the service
+	assert.NoError(t, localStore.Remove(staging.Address))
+	assert.Nil(t, localStore.Labels(staging.Address))
+}
+
+func TestCheckAgentName(t *testing.T) {
+	for _, name := range []string{"foo", "payment canary-1", "svc.v2/eu"} {
+		assert.NoError(t, CheckAgentName(name), name)
+	}
+	for _, name := range []string{"", "  ", "foo&bar", "foo\nbar", "foo\r"} {
+		err := CheckAgentName(name)
+		assert.True(t, errors.Is(err, ErrInvalidAgentName), "%q should be invalid", name)
+	}
+}
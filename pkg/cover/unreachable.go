@@ -0,0 +1,120 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UnreachableAgent is a registered agent the center failed to connect to when getting its profile,
+// e.g. its host is down, which can be removed from the center by its address
+type UnreachableAgent struct {
+	Name    string    `json:"name"`
+	Address string    `json:"address"`
+	Since   time.Time `json:"since"` // when the agent became unreachable
+	Error   string    `json:"error"` // the last error connecting to the agent
+}
+
+// unreachableAgents keeps the agents unreachable since the profile API last failed to connect to them,
+// an agent is forgotten once its profile is got again or it is removed
+type unreachableAgents struct {
+	mu     sync.Mutex
+	agents map[string]UnreachableAgent
+}
+
+// update records the agents of addrs failed to connect when getting their profiles, and forgets the others,
+// the time an agent became unreachable is kept if it already was
+func (u *unreachableAgents) update(addrs []string, fetched fetchedProfiles) {
+	unreachable := map[string]bool{}
+	for _, addr := range fetched.unreachable {
+		unreachable[addr] = true
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.agents == nil {
+		u.agents = map[string]UnreachableAgent{}
+	}
+	now := time.Now()
+	for _, addr := range addrs {
+		if !unreachable[addr] {
+			delete(u.agents, addr)
+			continue
+		}
+		agent, ok := u.agents[addr]
+		if !ok {
+			agent = UnreachableAgent{Address: addr, Since: now}
+		}
+		agent.Error = fetched.failed[addr].Error()
+		u.agents[addr] = agent
+	}
+}
+
+// drop forgets the agents, e.g. the ones removed from the center
+func (u *unreachableAgents) drop(addrs ...string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, addr := range addrs {
+		delete(u.agents, addr)
+	}
+}
+
+func (u *unreachableAgents) reset() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.agents = nil
+}
+
+// list returns the unreachable agents sorted by the addresses
+func (u *unreachableAgents) list() []UnreachableAgent {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	agents := make([]UnreachableAgent, 0, len(u.agents))
+	for _, agent := range u.agents {
+		agents = append(agents, agent)
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].Address < agents[j].Address
+	})
+	return agents
+}
+
+// listUnreachable lists the registered agents the profile API failed to connect to,
+// so that they can be removed from the center
+// GET /v1/cover/unreachable
+func (s *server) listUnreachable(c *gin.Context) {
+	c.JSON(http.StatusOK, s.unreachableList())
+}
+
+// unreachableList returns the unreachable agents along with their names
+func (s *server) unreachableList() []UnreachableAgent {
+	names := map[string]string{}
+	for name, addrs := range s.Store.GetAll() {
+		for _, addr := range addrs {
+			names[addr] = name
+		}
+	}
+	agents := s.unreachable.list()
+	for i := range agents {
+		agents[i].Name = names[agents[i].Address]
+	}
+	return agents
+}
@@ -0,0 +1,94 @@
+/*
+ Copyright 2020 Qiniu Cloud (qiniu.com)
+
+ Licensed under the Apache License, Version 2.0 (the "License");
+ you may not use this file except in compliance with the License.
+ You may obtain a copy of the License at
+
+     http://www.apache.org/licenses/LICENSE-2.0
+
+ Unless required by applicable law or agreed to in writing, software
+ distributed under the License is distributed on an "AS IS" BASIS,
+ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ See the License for the specific language governing permissions and
+ limitations under the License.
+*/
+
+package cover
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// deadAddress returns the address of a port nothing listens on
+func deadAddress(t *testing.T) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	ln.Close()
+	return "http://" + ln.Addr().String()
+}
+
+func TestProfileServiceWithUnreachableAgents(t *testing.T) {
+	agent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("mode: count\nmockService/main.go:30.13,48.33 13 1\n"))
+	}))
+	defer agent.Close()
+	dead := deadAddress(t)
+
+	server := NewMemoryBasedServer()
+	server.AgentTimeout = time.Second
+	server.Store.Add(ServiceUnderTest{Name: "mockService", Address: agent.URL})
+	server.Store.Add(ServiceUnderTest{Name: "deadService", Address: dead})
+	router := server.Route(os.Stdout)
+
+	profile := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/v1/cover/profile", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+	unreachable := func() []UnreachableAgent {
+		agents, err := NewWorker(ts.URL).ListUnreachable()
+		assert.NoError(t, err)
+		return agents
+	}
+	assert.Empty(t, unreachable())
+
+	// the unreachable agent is skipped even if the profile is not forced
+	w := profile()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "mockService/main.go:30.13,48.33 13 1")
+	assert.Equal(t, dead, w.Header().Get(UnreachableAgentsHeader))
+	assert.Empty(t, w.Header().Get(FailedAgentsHeader))
+
+	agents := unreachable()
+	if assert.Len(t, agents, 1) {
+		assert.Equal(t, "deadService", agents[0].Name)
+		assert.Equal(t, dead, agents[0].Address)
+		assert.NotEmpty(t, agents[0].Error)
+	}
+	// it is unreachable since the first failure
+	assert.Equal(t, http.StatusOK, profile().Code)
+	assert.Equal(t, agents[0].Since.UnixNano(), unreachable()[0].Since.UnixNano())
+
+	// the unreachable agent removed is forgotten
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", "/v1/cover/agent?id="+dead, nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, unreachable())
+	w = profile()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(UnreachableAgentsHeader))
+}
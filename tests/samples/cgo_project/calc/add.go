@@ -0,0 +1,16 @@
+package calc
+
+/*
+static int add(int a, int b) {
+	return a + b;
+}
+*/
+import "C"
+
+// Add adds the numbers in C
+func Add(a, b int) int {
+	if a == 0 {
+		return b
+	}
+	return int(C.add(C.int(a), C.int(b)))
+}
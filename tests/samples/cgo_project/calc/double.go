@@ -0,0 +1,9 @@
+package calc
+
+// Double doubles the number in Go
+func Double(a int) int {
+	if a == 0 {
+		return 0
+	}
+	return a * 2
+}
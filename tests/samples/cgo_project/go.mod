@@ -0,0 +1,3 @@
+module example.com/cgo-project
+
+go 1.11
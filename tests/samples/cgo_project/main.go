@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"example.com/cgo-project/calc"
+)
+
+func main() {
+	fmt.Println(calc.Add(1, 2), calc.Double(3))
+}
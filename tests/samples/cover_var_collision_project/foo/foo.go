@@ -0,0 +1,9 @@
+package foo
+
+// GoCover_0_336461383462613434353135 is named as the coverage counter goc injects into this file by default
+var GoCover_0_336461383462613434353135 = "collision"
+
+// Bar returns the value of the colliding variable
+func Bar() string {
+	return GoCover_0_336461383462613434353135
+}
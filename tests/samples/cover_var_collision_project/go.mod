@@ -0,0 +1,3 @@
+module example.com/collision-project
+
+go 1.11
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"example.com/collision-project/foo"
+)
+
+func main() {
+	fmt.Println(foo.Bar())
+}
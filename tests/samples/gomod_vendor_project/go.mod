@@ -0,0 +1,5 @@
+module example.com/gomod-vendor-project
+
+require qiniu.com/foo v0.0.1
+
+go 1.11
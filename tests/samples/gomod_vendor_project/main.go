@@ -0,0 +1,9 @@
+package main
+
+import (
+	"qiniu.com/foo"
+)
+
+func main() {
+	foo.Bar()
+}
@@ -0,0 +1,3 @@
+module example.com/ldflags-project
+
+go 1.11
@@ -0,0 +1,12 @@
+package main
+
+import (
+	"fmt"
+)
+
+// version is injected by -ldflags "-X main.version=..."
+var version = "unknown"
+
+func main() {
+	fmt.Println("version:", version)
+}
@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"example.com/nested-main-project/pkg/used"
+)
+
+func main() {
+	fmt.Println(used.Hello())
+}
@@ -0,0 +1,3 @@
+module example.com/nested-main-project
+
+go 1.11
@@ -0,0 +1,6 @@
+package unused
+
+// Bye is not called by the server
+func Bye() string {
+	return "bye"
+}
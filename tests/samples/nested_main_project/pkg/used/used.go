@@ -0,0 +1,6 @@
+package used
+
+// Hello is called by the server
+func Hello() string {
+	return "hello"
+}
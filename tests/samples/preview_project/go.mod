@@ -0,0 +1,3 @@
+module example.com/preview-project
+
+go 1.13
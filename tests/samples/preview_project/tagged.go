@@ -0,0 +1,7 @@
+// +build preview
+
+package main
+
+func tagged() {
+	println("tagged")
+}